@@ -10,6 +10,10 @@ import (
 	"github.com/reserveone/saa-risk-analyzer/internal/db"
 	"github.com/reserveone/saa-risk-analyzer/internal/domain"
 	"github.com/reserveone/saa-risk-analyzer/internal/handlers"
+	"github.com/reserveone/saa-risk-analyzer/internal/jobs"
+	"github.com/reserveone/saa-risk-analyzer/internal/notify"
+	"github.com/reserveone/saa-risk-analyzer/internal/scheduler"
+	"github.com/reserveone/saa-risk-analyzer/internal/service"
 )
 
 func main() {
@@ -39,18 +43,45 @@ func main() {
 	
 	log.Println("✅ Connected to database")
 	
+	if err := db.DedupePrices(database); err != nil {
+		log.Fatal("Failed to deduplicate prices:", err)
+	}
+	
 	if err := db.AutoMigrate(database,
 		&domain.Asset{},
+		&domain.AssetTicker{},
 		&domain.Price{},
+		&domain.CorporateAction{},
 		&domain.Portfolio{},
 		&domain.Position{},
+		&domain.Transaction{},
 		&domain.Job{},
+		&domain.JobEvent{},
+		&domain.Schedule{},
+		&domain.ScheduleRun{},
+		&domain.RiskSnapshot{},
+		&domain.RiskLimit{},
+		&domain.LimitEvent{},
 	); err != nil {
 		log.Fatal("Failed to migrate database:", err)
 	}
 	
 	log.Println("✅ Database migrated")
 	
+	symbols := service.NewSymbolService(database)
+	if err := symbols.Seed(); err != nil {
+		log.Fatal("Failed to seed symbol master:", err)
+	}
+	
+	queue := jobs.NewQueue(database, jobs.Config{
+		Workers:           cfg.Perf.WorkerPoolSize,
+		Timeout:           cfg.Perf.JobTimeout,
+		MaxPending:        cfg.Perf.JobQueueSize,
+		MaxAttempts:       cfg.Perf.JobMaxAttempts,
+		HeartbeatInterval: cfg.Perf.JobHeartbeat,
+		RetryBackoff:      cfg.Perf.JobRetryDelay,
+	})
+	
 	gin.SetMode(gin.ReleaseMode)
 	router := gin.Default()
 	
@@ -69,8 +100,27 @@ func main() {
 	})
 	
 	// Handlers
-	portfolioHandler := handlers.NewPortfolioHandler(database)
-	riskHandler := handlers.NewRiskHandler(database)
+	quotes := service.NewLatestPriceService(database, service.NewMarketDataService(cfg.Market, symbols), cfg.Market)
+	portfolioHandler := handlers.NewPortfolioHandler(database, quotes)
+	limits := service.NewLimitService(database, notify.New(cfg.Alerts))
+	riskHandler := handlers.NewRiskHandler(database, cfg.Perf, quotes, queue, limits)
+	limitHandler := handlers.NewLimitHandler(limits)
+	transactionHandler := handlers.NewTransactionHandler(service.NewLedgerService(database))
+	importHandler := handlers.NewImportHandler(database)
+	symbolHandler := handlers.NewSymbolHandler(symbols)
+	jobHandler := handlers.NewJobHandler(queue, cfg.CORS.AllowOrigins)
+	
+	// Jobs are registered by the handlers; requeue those left by lost workers
+	if err := queue.Recover(); err != nil {
+		log.Fatal("Failed to recover interrupted jobs:", err)
+	}
+	queue.Start()
+	
+	schedules := scheduler.New(database, queue, cfg.Scheduler)
+	scheduleHandler := handlers.NewScheduleHandler(schedules)
+	if cfg.Scheduler.Enabled {
+		schedules.Start()
+	}
 	
 	// Routes
 	router.GET("/health", func(c *gin.Context) {
@@ -87,6 +137,23 @@ func main() {
 		api.POST("/portfolios/:id/positions", portfolioHandler.AddPositions)
 		api.PUT("/portfolios/:id/positions/:position_id", portfolioHandler.UpdatePosition)
 		api.DELETE("/portfolios/:id/positions/:position_id", portfolioHandler.DeletePosition)
+		api.POST("/portfolios/:id/positions/import", importHandler.ImportPositions)
+		api.GET("/portfolios/:id/valuation", portfolioHandler.GetValuation)
+		api.GET("/portfolios/:id/currency-exposure", portfolioHandler.GetCurrencyExposure)
+		api.POST("/portfolios/:id/snapshots", riskHandler.TakeSnapshot)
+		api.GET("/portfolios/:id/snapshots", riskHandler.GetSnapshots)
+		api.GET("/portfolios/:id/snapshots/compare", riskHandler.CompareSnapshots)
+		api.POST("/portfolios/:id/what-if", riskHandler.WhatIf)
+		api.GET("/portfolios/:id/transactions", transactionHandler.GetTransactions)
+		api.POST("/portfolios/:id/transactions", transactionHandler.CreateTransaction)
+		api.DELETE("/portfolios/:id/transactions/:transaction_id", transactionHandler.DeleteTransaction)
+		api.GET("/portfolios/:id/ledger", transactionHandler.GetLedger)
+		api.GET("/portfolios/:id/limits", limitHandler.GetLimits)
+		api.POST("/portfolios/:id/limits", limitHandler.CreateLimit)
+		api.GET("/portfolios/:id/limits/events", limitHandler.GetLimitEvents)
+		api.GET("/portfolios/:id/limits/:limit_id", limitHandler.GetLimit)
+		api.PUT("/portfolios/:id/limits/:limit_id", limitHandler.UpdateLimit)
+		api.DELETE("/portfolios/:id/limits/:limit_id", limitHandler.DeleteLimit)
 		
 		// Portfolios - individual operations (less specific, comes after positions)
 		api.GET("/portfolios/:id", portfolioHandler.GetPortfolio)
@@ -95,12 +162,58 @@ func main() {
 		
 		// Market Data
 		api.GET("/market/price/:symbol", portfolioHandler.GetLatestPrice)
+		api.GET("/market/prices", portfolioHandler.GetLatestPrices)
+		api.GET("/market/fx", portfolioHandler.GetFXRate)
+		api.GET("/market/providers", portfolioHandler.GetProviders)
+		api.GET("/market/history/:symbol", portfolioHandler.GetPriceHistory)
+		api.POST("/market/prices/import", importHandler.ImportPrices)
+		api.GET("/market/corporate-actions/:symbol", portfolioHandler.GetCorporateActions)
+		api.POST("/market/corporate-actions/sync", portfolioHandler.SyncCorporateActions)
+		api.POST("/market/corporate-actions/import", importHandler.ImportCorporateActions)
+		
+		// Symbol master
+		api.GET("/symbols", symbolHandler.GetSymbols)
+		api.POST("/symbols", symbolHandler.CreateSymbol)
+		api.GET("/symbols/:symbol", symbolHandler.GetSymbol)
+		api.PUT("/symbols/:symbol", symbolHandler.UpdateSymbol)
+		api.DELETE("/symbols/:symbol", symbolHandler.DeleteSymbol)
 		
 		// Risk calculations
 		api.POST("/risk/var", riskHandler.CalculateVaR)
 		api.POST("/risk/cvar", riskHandler.CalculateCVaR)
 		api.POST("/risk/correlation", riskHandler.CalculateCorrelation)
+		api.POST("/risk/stress", riskHandler.RunStressTest)
+		api.POST("/risk/stress/reverse", riskHandler.RunReverseStressTest)
+		api.POST("/risk/paths", riskHandler.SimulatePaths)
+		api.POST("/risk/pca", riskHandler.CalculatePCA)
+		api.POST("/risk/backtest", riskHandler.BacktestVaR)
+		api.POST("/risk/contribution", riskHandler.CalculateRiskContribution)
 		api.GET("/risk/dashboard", riskHandler.GetRealDashboard)
+		api.GET("/risk/cache", riskHandler.GetCacheStats)
+		
+		// Async risk calculations, polled via /jobs/:id
+		api.POST("/risk/var/async", riskHandler.CalculateVaRAsync)
+		api.POST("/risk/cvar/async", riskHandler.CalculateCVaRAsync)
+		api.POST("/risk/stress/async", riskHandler.RunStressTestAsync)
+		api.POST("/risk/pca/async", riskHandler.CalculatePCAAsync)
+		api.POST("/risk/backtest/async", riskHandler.BacktestVaRAsync)
+		api.POST("/risk/contribution/async", riskHandler.CalculateRiskContributionAsync)
+		
+		// Jobs
+		api.GET("/jobs", jobHandler.GetJobs)
+		api.GET("/jobs/:id", jobHandler.GetJob)
+		api.GET("/jobs/:id/events", jobHandler.GetJobEvents)
+		api.GET("/jobs/:id/ws", jobHandler.GetJobEventsWS)
+		api.DELETE("/jobs/:id", jobHandler.CancelJob)
+		
+		// Schedules
+		api.GET("/schedules", scheduleHandler.GetSchedules)
+		api.POST("/schedules", scheduleHandler.CreateSchedule)
+		api.GET("/schedules/:id", scheduleHandler.GetSchedule)
+		api.PUT("/schedules/:id", scheduleHandler.UpdateSchedule)
+		api.DELETE("/schedules/:id", scheduleHandler.DeleteSchedule)
+		api.POST("/schedules/:id/run", scheduleHandler.RunSchedule)
+		api.GET("/schedules/:id/runs", scheduleHandler.GetScheduleRuns)
 		
 		// Dashboard (fallback to mock)
 		api.GET("/dashboard", func(c *gin.Context) {
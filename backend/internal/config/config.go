@@ -2,6 +2,9 @@ package config
 
 import (
 	"fmt"
+	"strings"
+	"time"
+
 	"github.com/spf13/viper"
 )
 
@@ -14,6 +17,9 @@ type Config struct {
 	CORS     CORSConfig
 	Admin    AdminConfig
 	Perf     PerfConfig
+	Market   MarketConfig
+	Scheduler SchedulerConfig
+	Alerts   AlertConfig
 	Log      LogConfig
 }
 
@@ -43,7 +49,48 @@ type AdminConfig struct {
 
 type PerfConfig struct {
 	MaxSimulations int
-	WorkerPoolSize int
+	WorkerPoolSize int           // simulation workers and concurrent jobs
+	JobTimeout     time.Duration // default per-job timeout
+	JobQueueSize   int           // queued jobs beyond which new ones are rejected
+	JobMaxAttempts int           // claims of a job before a lost worker fails it
+	JobHeartbeat   time.Duration // running jobs heartbeat at this interval
+	JobRetryDelay  time.Duration // first delay before rerunning a job whose worker was lost
+	CacheTTL       time.Duration // how long risk results are reused, 0 disables caching
+	CacheSize      int           // risk results kept at most
+}
+
+// MarketConfig controls how latest prices are resolved
+type MarketConfig struct {
+	PriceSources    []string            // ordered latest-price chain, e.g. api,database
+	QuoteTTL        time.Duration       // how long a resolved quote is served from cache
+	StaleAfter      time.Duration       // quotes older than this are reported as stale
+	ProviderChains  map[string][]string // historical price providers by asset class
+	DataDir         string              // directory of CSV price files for the file provider
+	Retries         int                 // attempts per provider call after the first
+	RetryBaseDelay  time.Duration       // first backoff delay, doubled per retry
+	RequestTimeout  time.Duration       // per-attempt HTTP timeout
+	BreakerFailures int                 // consecutive failures that open a provider's circuit
+	BreakerCooldown time.Duration       // how long an open circuit skips the provider
+}
+
+// SchedulerConfig controls the scheduled risk runs
+type SchedulerConfig struct {
+	Enabled  bool          // run due schedules in this instance
+	Interval time.Duration // how often due schedules are looked for
+	Grace    time.Duration // how late a fire time may run before the missed-run policy applies
+}
+
+// AlertConfig configures where risk limit alerts are sent; an empty webhook
+// URL or SMTP address disables that channel
+type AlertConfig struct {
+	WebhookURL    string
+	WebhookSecret string        // signs webhook bodies with HMAC-SHA256
+	SMTPAddr      string        // host:port
+	SMTPUsername  string
+	SMTPPassword  string
+	SMTPFrom      string
+	SMTPTo        []string
+	Timeout       time.Duration // per delivery
 }
 
 type LogConfig struct {
@@ -83,6 +130,28 @@ func Load() (*Config, error) {
 	viper.SetDefault("JWT_REFRESH_EXPIRY_HOURS", 720)
 	viper.SetDefault("VAR_MAX_SIMULATIONS", 100000)
 	viper.SetDefault("WORKER_POOL_SIZE", 4)
+	viper.SetDefault("JOB_TIMEOUT_SECONDS", 600)
+	viper.SetDefault("JOB_QUEUE_SIZE", 1000)
+	viper.SetDefault("JOB_MAX_ATTEMPTS", 3)
+	viper.SetDefault("JOB_HEARTBEAT_SECONDS", 10)
+	viper.SetDefault("JOB_RETRY_BACKOFF_SECONDS", 30)
+	viper.SetDefault("RISK_CACHE_TTL_SECONDS", 300)
+	viper.SetDefault("RISK_CACHE_SIZE", 1000)
+	viper.SetDefault("PRICE_SOURCES", "api,database")
+	viper.SetDefault("PRICE_CACHE_TTL_SECONDS", 60)
+	viper.SetDefault("PRICE_STALE_AFTER_HOURS", 72)
+	viper.SetDefault("MARKET_DATA_DIR", "")
+	viper.SetDefault("MARKET_PROVIDERS", "")
+	viper.SetDefault("MARKET_RETRIES", 2)
+	viper.SetDefault("MARKET_RETRY_BASE_MS", 500)
+	viper.SetDefault("MARKET_TIMEOUT_SECONDS", 10)
+	viper.SetDefault("MARKET_BREAKER_FAILURES", 5)
+	viper.SetDefault("MARKET_BREAKER_COOLDOWN_SECONDS", 60)
+	viper.SetDefault("SCHEDULER_ENABLED", true)
+	viper.SetDefault("SCHEDULER_INTERVAL_SECONDS", 30)
+	viper.SetDefault("SCHEDULER_GRACE_SECONDS", 300)
+	viper.SetDefault("ALERT_SMTP_FROM", "risk-alerts@localhost")
+	viper.SetDefault("ALERT_TIMEOUT_SECONDS", 10)
 	viper.SetDefault("LOG_LEVEL", "info")
 	viper.SetDefault("LOG_FORMAT", "json")
 	viper.SetDefault("ADMIN_EMAIL", "admin@example.com")
@@ -122,6 +191,41 @@ func Load() (*Config, error) {
 		Perf: PerfConfig{
 			MaxSimulations: viper.GetInt("VAR_MAX_SIMULATIONS"),
 			WorkerPoolSize: viper.GetInt("WORKER_POOL_SIZE"),
+			JobTimeout:     time.Duration(viper.GetInt("JOB_TIMEOUT_SECONDS")) * time.Second,
+			JobQueueSize:   viper.GetInt("JOB_QUEUE_SIZE"),
+			JobMaxAttempts: viper.GetInt("JOB_MAX_ATTEMPTS"),
+			JobHeartbeat:   time.Duration(viper.GetInt("JOB_HEARTBEAT_SECONDS")) * time.Second,
+			JobRetryDelay:  time.Duration(viper.GetInt("JOB_RETRY_BACKOFF_SECONDS")) * time.Second,
+			CacheTTL:       time.Duration(viper.GetInt("RISK_CACHE_TTL_SECONDS")) * time.Second,
+			CacheSize:      viper.GetInt("RISK_CACHE_SIZE"),
+		},
+		Market: MarketConfig{
+			PriceSources: splitList(viper.GetString("PRICE_SOURCES")),
+			QuoteTTL:     time.Duration(viper.GetInt("PRICE_CACHE_TTL_SECONDS")) * time.Second,
+			StaleAfter:   time.Duration(viper.GetInt("PRICE_STALE_AFTER_HOURS")) * time.Hour,
+			// e.g. MARKET_PROVIDERS="Crypto=file,binance,coingecko;default=file,yahoo"
+			ProviderChains:  parseChains(viper.GetString("MARKET_PROVIDERS")),
+			DataDir:         viper.GetString("MARKET_DATA_DIR"),
+			Retries:         viper.GetInt("MARKET_RETRIES"),
+			RetryBaseDelay:  time.Duration(viper.GetInt("MARKET_RETRY_BASE_MS")) * time.Millisecond,
+			RequestTimeout:  time.Duration(viper.GetInt("MARKET_TIMEOUT_SECONDS")) * time.Second,
+			BreakerFailures: viper.GetInt("MARKET_BREAKER_FAILURES"),
+			BreakerCooldown: time.Duration(viper.GetInt("MARKET_BREAKER_COOLDOWN_SECONDS")) * time.Second,
+		},
+		Scheduler: SchedulerConfig{
+			Enabled:  viper.GetBool("SCHEDULER_ENABLED"),
+			Interval: time.Duration(viper.GetInt("SCHEDULER_INTERVAL_SECONDS")) * time.Second,
+			Grace:    time.Duration(viper.GetInt("SCHEDULER_GRACE_SECONDS")) * time.Second,
+		},
+		Alerts: AlertConfig{
+			WebhookURL:    viper.GetString("ALERT_WEBHOOK_URL"),
+			WebhookSecret: viper.GetString("ALERT_WEBHOOK_SECRET"),
+			SMTPAddr:      viper.GetString("ALERT_SMTP_ADDR"),
+			SMTPUsername:  viper.GetString("ALERT_SMTP_USERNAME"),
+			SMTPPassword:  viper.GetString("ALERT_SMTP_PASSWORD"),
+			SMTPFrom:      viper.GetString("ALERT_SMTP_FROM"),
+			SMTPTo:        splitList(viper.GetString("ALERT_SMTP_TO")),
+			Timeout:       time.Duration(viper.GetInt("ALERT_TIMEOUT_SECONDS")) * time.Second,
 		},
 		Log: LogConfig{
 			Level:  viper.GetString("LOG_LEVEL"),
@@ -131,3 +235,27 @@ func Load() (*Config, error) {
 
 	return cfg, nil
 }
+
+// splitList parses a comma-separated setting, dropping empty entries
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// parseChains parses class=provider,provider entries separated by semicolons
+func parseChains(value string) map[string][]string {
+	chains := make(map[string][]string)
+	for _, entry := range strings.Split(value, ";") {
+		class, providers, ok := strings.Cut(entry, "=")
+		if !ok || strings.TrimSpace(class) == "" {
+			continue
+		}
+		chains[strings.TrimSpace(class)] = splitList(providers)
+	}
+	return chains
+}
@@ -46,3 +46,19 @@ func Connect(cfg Config) (*gorm.DB, error) {
 func AutoMigrate(db *gorm.DB, models ...interface{}) error {
 	return db.AutoMigrate(models...)
 }
+
+// DedupePrices removes duplicate closes per asset and day, keeping the most
+// recently created row, so the unique (asset_id, date) index can be built on
+// databases populated before it existed
+func DedupePrices(db *gorm.DB) error {
+	if !db.Migrator().HasTable("prices") {
+		return nil
+	}
+	return db.Exec(`
+		DELETE FROM prices a
+		USING prices b
+		WHERE a.asset_id = b.asset_id
+		  AND a.date = b.date
+		  AND (a.created_at, a.id) < (b.created_at, b.id)
+	`).Error
+}
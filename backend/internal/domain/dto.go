@@ -1,8 +1,10 @@
 package domain
 
 import (
-	"github.com/google/uuid"
+	"encoding/json"
 	"time"
+
+	"github.com/google/uuid"
 )
 
 // Auth DTOs
@@ -19,8 +21,10 @@ type LoginResponse struct {
 
 // Portfolio DTOs
 type CreatePortfolioRequest struct {
-	Name        string `json:"name" binding:"required"`
-	Description string `json:"description"`
+	Name         string `json:"name" binding:"required"`
+	Description  string `json:"description"`
+	BaseCurrency string `json:"base_currency"` // default USD
+	CostMethod   string `json:"cost_method"`   // fifo (default), lifo, average
 }
 
 type ImportPositionsRequest struct {
@@ -33,42 +37,94 @@ type PositionImport struct {
 	AvgPrice float64 `json:"avg_price" binding:"required"`
 }
 
+// ImportResult reports a bulk upload. Nothing is written unless Committed.
+type ImportResult struct {
+	DryRun        bool             `json:"dry_run"`
+	Committed     bool             `json:"committed"`
+	Rows          int              `json:"rows"`
+	Valid         int              `json:"valid"`
+	Inserted      int              `json:"inserted"`
+	Updated       int              `json:"updated"`
+	AssetsCreated int              `json:"assets_created"`
+	ErrorCount    int              `json:"error_count"`
+	Errors        []ImportRowError `json:"errors,omitempty"`
+}
+
+type ImportRowError struct {
+	Row     int    `json:"row"`
+	Column  string `json:"column,omitempty"`
+	Value   string `json:"value,omitempty"`
+	Message string `json:"message"`
+}
+
+// maxImportErrors bounds the row errors reported in full, the rest are counted
+const maxImportErrors = 100
+
+// AddError records a row error
+func (r *ImportResult) AddError(row int, column, value, message string) {
+	r.ErrorCount++
+	if len(r.Errors) < maxImportErrors {
+		r.Errors = append(r.Errors, ImportRowError{Row: row, Column: column, Value: value, Message: message})
+	}
+}
+
 // Risk calculation DTOs
 type VaRRequest struct {
-	PortfolioID    uuid.UUID `json:"portfolio_id" binding:"required"`
-	HorizonDays    int       `json:"horizon_days" binding:"required,min=1"`
-	Confidence     float64   `json:"confidence" binding:"required,min=0,max=1"`
-	Method         string    `json:"method" binding:"required"` // historical, parametric_normal, parametric_student, monte_carlo
-	WindowDays     int       `json:"window_days"`
-	Simulations    int       `json:"simulations"`
-	UseLogReturns  bool      `json:"use_log_returns"`
+	PortfolioID      uuid.UUID `json:"portfolio_id" binding:"required"`
+	HorizonDays      int       `json:"horizon_days" binding:"required,min=1"`
+	Confidence       float64   `json:"confidence" binding:"required,min=0,max=1"`
+	Method           string    `json:"method" binding:"required"` // historical, parametric_normal, parametric_student, monte_carlo
+	WindowDays       int       `json:"window_days"`
+	Simulations      int       `json:"simulations"`
+	UseLogReturns    bool      `json:"use_log_returns"`
+	Seed             uint64    `json:"seed,string,omitempty"` // monte_carlo: reproduce a previous run
+	Antithetic       bool      `json:"antithetic"`            // monte_carlo: antithetic variates
+	Sampler          string    `json:"sampler"`               // monte_carlo: pseudo, sobol
+	Dependence       string    `json:"dependence"`            // monte_carlo: normal, student_t, gaussian_copula, t_copula
+	Marginals        string    `json:"marginals"`             // copulas: empirical, student_t
+	DegreesOfFreedom float64   `json:"degrees_of_freedom"`    // student_t, t_copula: 0 fits it
+	Adjustment       string    `json:"adjustment"`            // none, price_return, total_return (default)
 }
 
 type CVaRRequest struct {
-	PortfolioID    uuid.UUID `json:"portfolio_id" binding:"required"`
-	HorizonDays    int       `json:"horizon_days" binding:"required,min=1"`
-	Confidence     float64   `json:"confidence" binding:"required,min=0,max=1"`
-	Method         string    `json:"method" binding:"required"`
-	WindowDays     int       `json:"window_days"`
-	Simulations    int       `json:"simulations"`
-	UseLogReturns  bool      `json:"use_log_returns"`
+	PortfolioID      uuid.UUID `json:"portfolio_id" binding:"required"`
+	HorizonDays      int       `json:"horizon_days" binding:"required,min=1"`
+	Confidence       float64   `json:"confidence" binding:"required,min=0,max=1"`
+	Method           string    `json:"method" binding:"required"`
+	WindowDays       int       `json:"window_days"`
+	Simulations      int       `json:"simulations"`
+	UseLogReturns    bool      `json:"use_log_returns"`
+	Seed             uint64    `json:"seed,string,omitempty"`
+	Antithetic       bool      `json:"antithetic"`
+	Sampler          string    `json:"sampler"`
+	Dependence       string    `json:"dependence"`
+	Marginals        string    `json:"marginals"`
+	DegreesOfFreedom float64   `json:"degrees_of_freedom"`
+	Adjustment       string    `json:"adjustment"`
 }
 
 type CorrelationRequest struct {
 	Symbols    []string `json:"symbols" binding:"required"`
 	WindowDays int      `json:"window_days" binding:"required,min=10"`
+	Adjustment string   `json:"adjustment"`
 }
 
 type PCARequest struct {
 	Symbols    []string `json:"symbols" binding:"required"`
 	Components int      `json:"components" binding:"required,min=1"`
 	WindowDays int      `json:"window_days" binding:"required,min=10"`
+	Adjustment string   `json:"adjustment"`
 }
 
 type StressTestRequest struct {
 	PortfolioID       uuid.UUID        `json:"portfolio_id" binding:"required"`
 	Scenarios         []StressScenario `json:"scenarios" binding:"required"`
-	CorrelationRegime string           `json:"correlation_regime"` // tight, loose, current
+	CorrelationRegime string           `json:"correlation_regime"`                         // tight, loose, current
+	Confidence        float64          `json:"confidence" binding:"omitempty,min=0,max=1"` // default 0.99
+	HorizonDays       int              `json:"horizon_days" binding:"omitempty,min=1"`     // default 1
+	WindowDays        int              `json:"window_days" binding:"omitempty,min=10"`     // current covariance window, default 250
+	HistoryDays       int              `json:"history_days" binding:"omitempty,min=10"`    // stressed VaR search range, default 1260
+	Adjustment        string           `json:"adjustment"`                                 // none, price_return, total_return (default)
 }
 
 type StressScenario struct {
@@ -83,51 +139,171 @@ type TimeWindow struct {
 	To   string `json:"to" binding:"required"`   // YYYY-MM-DD
 }
 
+type ReverseStressRequest struct {
+	PortfolioID uuid.UUID `json:"portfolio_id" binding:"required"`
+	LossLimit   float64   `json:"loss_limit" binding:"required,gt=0"` // in portfolio currency
+	HorizonDays int       `json:"horizon_days" binding:"omitempty,min=1"`
+	WindowDays  int       `json:"window_days" binding:"omitempty,min=10"`
+	Mode        string    `json:"mode"`    // asset, factor
+	Factors     int       `json:"factors"` // principal components used in factor mode
+	Adjustment  string    `json:"adjustment"`
+}
+
+type PathSimulationRequest struct {
+	PortfolioID     uuid.UUID          `json:"portfolio_id" binding:"required"`
+	HorizonMonths   int                `json:"horizon_months" binding:"required,min=1,max=600"`
+	Paths           int                `json:"paths"`            // default 10000
+	RebalanceMonths int                `json:"rebalance_months"` // 0 = buy and hold
+	Contribution    float64            `json:"contribution"`     // per month, negative for withdrawals
+	Goal            float64            `json:"goal"`             // terminal wealth target
+	TargetWeights   map[string]float64 `json:"target_weights"`   // default current weights
+	WindowDays      int                `json:"window_days"`      // estimation window, default 750
+	Seed            uint64             `json:"seed,string,omitempty"`
+	Adjustment      string             `json:"adjustment"`
+}
+
 type BacktestVaRRequest struct {
 	PortfolioID uuid.UUID `json:"portfolio_id" binding:"required"`
 	Confidence  float64   `json:"confidence" binding:"required,min=0,max=1"`
 	WindowDays  int       `json:"window_days" binding:"required,min=10"`
 	Method      string    `json:"method" binding:"required"` // historical, parametric
+	TestDays    int       `json:"test_days"`                 // out-of-sample days, default 250
+	Adjustment  string    `json:"adjustment"`
 }
 
 type RiskContributionRequest struct {
 	PortfolioID uuid.UUID `json:"portfolio_id" binding:"required"`
 	Confidence  float64   `json:"confidence" binding:"required,min=0,max=1"`
 	WindowDays  int       `json:"window_days" binding:"required,min=10"`
+	HorizonDays int       `json:"horizon_days" binding:"omitempty,min=1"` // default 1
+	Adjustment  string    `json:"adjustment"`
 }
 
 // Response DTOs
 type VaRResponse struct {
-	JobID uuid.UUID `json:"job_id"`
-	VaR   float64   `json:"var,omitempty"`
+	JobID      uuid.UUID        `json:"job_id"`
+	VaR        float64          `json:"var,omitempty"`
+	MonteCarlo *MonteCarloStats `json:"monte_carlo,omitempty"`
+	Currency   string           `json:"currency,omitempty"` // base currency of the amounts
+	Adjustment string           `json:"adjustment,omitempty"`
 }
 
 type CVaRResponse struct {
-	JobID uuid.UUID `json:"job_id"`
-	CVaR  float64   `json:"cvar,omitempty"`
+	JobID      uuid.UUID        `json:"job_id"`
+	CVaR       float64          `json:"cvar,omitempty"`
+	MonteCarlo *MonteCarloStats `json:"monte_carlo,omitempty"`
+	Currency   string           `json:"currency,omitempty"` // base currency of the amounts
+	Adjustment string           `json:"adjustment,omitempty"`
+}
+
+// MonteCarloStats reports a simulation run in portfolio currency, with the
+// seed needed to reproduce it and the Monte Carlo standard errors
+type MonteCarloStats struct {
+	VaR         float64        `json:"var"`
+	ES          float64        `json:"es"`
+	VaRStdErr   float64        `json:"var_std_err"`
+	ESStdErr    float64        `json:"es_std_err"`
+	Seed        uint64         `json:"seed,string"`
+	Simulations int            `json:"simulations"`
+	Workers     int            `json:"workers"`
+	Sampler     string         `json:"sampler"`
+	Antithetic  bool           `json:"antithetic"`
+	Dependence  *DependenceFit `json:"dependence,omitempty"`
+	Adjustment  string         `json:"adjustment"`
+}
+
+// DependenceFit reports the fitted parameters of the simulated joint model
+type DependenceFit struct {
+	Model            string        `json:"model"`
+	Marginals        string        `json:"marginals,omitempty"`
+	DegreesOfFreedom float64       `json:"degrees_of_freedom,omitempty"`
+	Symbols          []string      `json:"symbols"`
+	Correlation      [][]float64   `json:"correlation"`
+	MarginalFits     []MarginalFit `json:"marginal_fits,omitempty"`
+}
+
+type MarginalFit struct {
+	Symbol           string  `json:"symbol"`
+	Location         float64 `json:"location"`
+	Scale            float64 `json:"scale"`
+	DegreesOfFreedom float64 `json:"degrees_of_freedom"`
 }
 
 type CorrelationResponse struct {
-	JobID  uuid.UUID   `json:"job_id"`
-	Matrix [][]float64 `json:"matrix,omitempty"`
+	JobID      uuid.UUID   `json:"job_id"`
+	Matrix     [][]float64 `json:"matrix,omitempty"`
+	Adjustment string      `json:"adjustment,omitempty"`
 }
 
 type PCAResponse struct {
 	JobID              uuid.UUID   `json:"job_id"`
 	ExplainedVariance  []float64   `json:"explained_variance,omitempty"`
-	Components         [][]float64 `json:"components,omitempty"`
+	CumulativeVariance []float64   `json:"cumulative_variance,omitempty"`
+	Components         [][]float64 `json:"components,omitempty"` // [component][symbol] loadings
+	Symbols            []string    `json:"symbols,omitempty"`
+	Adjustment         string      `json:"adjustment,omitempty"`
 }
 
 type StressTestResponse struct {
-	JobID    uuid.UUID              `json:"job_id"`
-	Scenarios []ScenarioResult      `json:"scenarios,omitempty"`
+	JobID       uuid.UUID          `json:"job_id"`
+	NAV         float64            `json:"nav,omitempty"`
+	BaseVaR     float64            `json:"base_var,omitempty"`
+	Scenarios   []ScenarioResult   `json:"scenarios,omitempty"`
+	StressedVaR *StressedVaRResult `json:"stressed_var,omitempty"`
+	Adjustment  string             `json:"adjustment,omitempty"`
 }
 
 type ScenarioResult struct {
-	Name        string             `json:"name"`
-	DeltaNAV    float64            `json:"delta_nav"`
-	DeltaVaR    float64            `json:"delta_var"`
-	AssetImpact []AssetImpact      `json:"asset_impact"`
+	Name             string        `json:"name"`
+	DeltaNAV         float64       `json:"delta_nav"`
+	DeltaVaR         float64       `json:"delta_var"`
+	PostShockNAV     float64       `json:"post_shock_nav"`
+	BaseVaR          float64       `json:"base_var"`
+	StressedVaR      float64       `json:"stressed_var"`
+	CovarianceSource string        `json:"covariance_source"` // scenario_window, current
+	AssetImpact      []AssetImpact `json:"asset_impact"`
+}
+
+// StressedVaRResult is the Basel-style stressed VaR calibrated on the worst
+// 12-month window of the available history
+type StressedVaRResult struct {
+	VaR          float64 `json:"var"`
+	CurrentVaR   float64 `json:"current_var"`
+	WindowFrom   string  `json:"window_from"` // YYYY-MM-DD
+	WindowTo     string  `json:"window_to"`   // YYYY-MM-DD
+	Observations int     `json:"observations"`
+}
+
+type ReverseStressResponse struct {
+	NAV                 float64              `json:"nav"`
+	Loss                float64              `json:"loss"`
+	Mode                string               `json:"mode"`
+	MahalanobisDistance float64              `json:"mahalanobis_distance"`
+	Plausibility        float64              `json:"plausibility"`
+	FactorShocks        []float64            `json:"factor_shocks,omitempty"`
+	Scenario            []ReverseStressShock `json:"scenario"`
+	Adjustment          string               `json:"adjustment"`
+}
+
+type ReverseStressShock struct {
+	Symbol string  `json:"symbol"`
+	Shock  float64 `json:"shock"`
+	PnL    float64 `json:"pnl"`
+}
+
+type PathSimulationResponse struct {
+	InitialValue         float64     `json:"initial_value"`
+	Quantiles            []float64   `json:"quantiles"` // probabilities of the quantile arrays below
+	TerminalWealth       []float64   `json:"terminal_wealth"`
+	MeanTerminalWealth   float64     `json:"mean_terminal_wealth"`
+	ShortfallProbability float64     `json:"shortfall_probability"`
+	DepletionProbability float64     `json:"depletion_probability"`
+	MaxDrawdown          []float64   `json:"max_drawdown"`
+	MeanMaxDrawdown      float64     `json:"mean_max_drawdown"`
+	Fan                  [][]float64 `json:"fan"` // [month][quantile] portfolio value
+	Seed                 uint64      `json:"seed,string"`
+	Paths                int         `json:"paths"`
+	Adjustment           string      `json:"adjustment"`
 }
 
 type AssetImpact struct {
@@ -136,36 +312,194 @@ type AssetImpact struct {
 }
 
 type BacktestResult struct {
-	JobID        uuid.UUID `json:"job_id"`
-	Exceedances  int       `json:"exceedances,omitempty"`
-	KupiecLR     float64   `json:"kupiec_lr,omitempty"`
-	KupiecPValue float64   `json:"kupiec_p_value,omitempty"`
-	ChristLR     float64   `json:"christ_lr,omitempty"`
-	ChristPValue float64   `json:"christ_p_value,omitempty"`
+	JobID               uuid.UUID `json:"job_id"`
+	Exceedances         int       `json:"exceedances,omitempty"`
+	KupiecLR            float64   `json:"kupiec_lr,omitempty"`
+	KupiecPValue        float64   `json:"kupiec_p_value,omitempty"`
+	ChristLR            float64   `json:"christ_lr,omitempty"`
+	ChristPValue        float64   `json:"christ_p_value,omitempty"`
+	Observations        int       `json:"observations,omitempty"`
+	ExpectedExceedances float64   `json:"expected_exceedances,omitempty"`
+	Method              string    `json:"method,omitempty"`
+	Adjustment          string    `json:"adjustment,omitempty"`
 }
 
 type RiskContributionResponse struct {
-	JobID         uuid.UUID            `json:"job_id"`
-	Contributions []AssetContribution  `json:"contributions,omitempty"`
+	JobID         uuid.UUID           `json:"job_id"`
+	VaR           float64             `json:"var,omitempty"`
+	NAV           float64             `json:"nav,omitempty"`
+	Contributions []AssetContribution `json:"contributions,omitempty"`
+	Currency      string              `json:"currency,omitempty"`
+	Adjustment    string              `json:"adjustment,omitempty"`
 }
 
 type AssetContribution struct {
-	Symbol      string  `json:"symbol"`
-	Component   float64 `json:"component_var"`
-	Marginal    float64 `json:"marginal_var"`
-	Percentage  float64 `json:"percentage"`
+	Symbol     string  `json:"symbol"`
+	Exposure   float64 `json:"exposure"`
+	Component  float64 `json:"component_var"`
+	Marginal   float64 `json:"marginal_var"`
+	Percentage float64 `json:"percentage"`
+}
+
+// Valuation DTOs
+type PositionValuation struct {
+	PositionID    uuid.UUID `json:"position_id"`
+	Symbol        string    `json:"symbol"`
+	Quantity      float64   `json:"quantity"`
+	AvgPrice      float64   `json:"avg_price"`
+	Price         float64   `json:"price"`
+	PriceDate     time.Time `json:"price_date"`
+	PriceSource   string    `json:"price_source"`
+	Currency      string    `json:"currency"` // currency of Price and AvgPrice
+	FXRate        float64   `json:"fx_rate"`  // base currency per unit of Currency
+	MarketValue   float64   `json:"market_value"`
+	CostBasis     float64   `json:"cost_basis"`
+	UnrealizedPnL float64   `json:"unrealized_pnl"`
+	Weight        float64   `json:"weight"`
+}
+
+// PortfolioValuation is a portfolio marked to market as of a date, with every
+// value in its base currency
+type PortfolioValuation struct {
+	PortfolioID   uuid.UUID           `json:"portfolio_id"`
+	BaseCurrency  string              `json:"base_currency"`
+	AsOf          time.Time           `json:"as_of"`
+	NAV           float64             `json:"nav"`
+	CostBasis     float64             `json:"cost_basis"`
+	UnrealizedPnL float64             `json:"unrealized_pnl"`
+	Positions     []PositionValuation `json:"positions"`
+}
+
+// MarketValue returns the marked value of a position, or 0 if it is not part
+// of the valuation
+func (v *PortfolioValuation) MarketValue(positionID uuid.UUID) float64 {
+	for _, p := range v.Positions {
+		if p.PositionID == positionID {
+			return p.MarketValue
+		}
+	}
+	return 0
+}
+
+// CurrencyExposure is the base currency value of the positions exposed to a
+// currency
+type CurrencyExposure struct {
+	Currency    string  `json:"currency"`
+	MarketValue float64 `json:"market_value"`
+	Weight      float64 `json:"weight"`
+	Positions   int     `json:"positions"`
+}
+
+type CurrencyExposureResponse struct {
+	PortfolioID  uuid.UUID          `json:"portfolio_id"`
+	BaseCurrency string             `json:"base_currency"`
+	AsOf         time.Time          `json:"as_of"`
+	NAV          float64            `json:"nav"`
+	Currencies   []CurrencyExposure `json:"currencies"`
+}
+
+// Market data DTOs
+type PriceQuote struct {
+	Symbol     string    `json:"symbol"`
+	Price      float64   `json:"price"`
+	AsOf       time.Time `json:"as_of"`
+	Source     string    `json:"source"`
+	AgeSeconds float64   `json:"age_seconds"`
+	Stale      bool      `json:"stale"`
+	Cached     bool      `json:"cached"`
+}
+
+// PriceCoverage reports how much of a history request was served, and whether
+// it came from stored closes or was fetched for the missing range
+type PriceCoverage struct {
+	Symbol    string    `json:"symbol"`
+	Requested int       `json:"requested,omitempty"` // closes requested for windows
+	From      time.Time `json:"from,omitempty"`
+	To        time.Time `json:"to"`
+	Returned  int       `json:"returned"`
+	Stored    int       `json:"stored"`
+	Fetched   int       `json:"fetched"`
+	Source    string    `json:"source"`
+	FirstDate time.Time `json:"first_date,omitempty"`
+	LastDate  time.Time `json:"last_date,omitempty"`
+	Complete  bool      `json:"complete"`
+}
+
+type PriceBar struct {
+	Date  time.Time `json:"date"`
+	Close float64   `json:"close"`
+}
+
+type PriceHistoryResponse struct {
+	Symbol   string        `json:"symbol"`
+	Prices   []PriceBar    `json:"prices"`
+	Coverage PriceCoverage `json:"coverage"`
+}
+
+type CorporateActionSyncRequest struct {
+	Symbols []string `json:"symbols" binding:"required"`
+	Days    int      `json:"days"` // lookback, default 1825
+}
+
+// CorporateActionSyncResponse reports the actions stored per symbol and the
+// symbols that failed
+type CorporateActionSyncResponse struct {
+	Synced map[string]int    `json:"synced"`
+	Errors map[string]string `json:"errors,omitempty"`
+}
+
+type FXRateResponse struct {
+	From string    `json:"from"`
+	To   string    `json:"to"`
+	Rate float64   `json:"rate"`
+	AsOf time.Time `json:"as_of"`
+}
+
+// ProviderHealth reports a market data provider's circuit breaker and rate
+// limit state
+type ProviderHealth struct {
+	Name                string             `json:"name"`
+	AssetClasses        []string           `json:"asset_classes,omitempty"` // empty serves every class
+	State               string             `json:"state"`                   // closed, open, half_open
+	ConsecutiveFailures int                `json:"consecutive_failures"`
+	Requests            int64              `json:"requests"`
+	Errors              int64              `json:"errors"`
+	LastError           string             `json:"last_error,omitempty"`
+	LastFailure         *time.Time         `json:"last_failure,omitempty"`
+	LastSuccess         *time.Time         `json:"last_success,omitempty"`
+	OpenUntil           *time.Time         `json:"open_until,omitempty"`
+	RateLimit           *ProviderRateLimit `json:"rate_limit,omitempty"`
+}
+
+type ProviderRateLimit struct {
+	Requests   int     `json:"requests"`
+	PerSeconds float64 `json:"per_seconds"`
+	Available  float64 `json:"available"` // tokens left in the bucket
+}
+
+type PriceQuotesResponse struct {
+	Quotes []PriceQuote      `json:"quotes"`
+	Errors map[string]string `json:"errors,omitempty"`
 }
 
 // Job response
 type JobResponse struct {
-	ID        uuid.UUID              `json:"id"`
-	Type      string                 `json:"type"`
-	Status    string                 `json:"status"`
-	Progress  int                    `json:"progress"`
-	Result    map[string]interface{} `json:"result,omitempty"`
-	Error     string                 `json:"error,omitempty"`
-	CreatedAt time.Time              `json:"created_at"`
-	UpdatedAt time.Time              `json:"updated_at"`
+	ID             uuid.UUID              `json:"id"`
+	Type           string                 `json:"type"`
+	Status         string                 `json:"status"`
+	Priority       string                 `json:"priority"`
+	TimeoutSeconds int                    `json:"timeout_seconds,omitempty"`
+	Progress       int                    `json:"progress"`
+	Stage          string                 `json:"stage,omitempty"`
+	Input          json.RawMessage        `json:"input,omitempty"`
+	Result         map[string]interface{} `json:"result,omitempty"`
+	Error          string                 `json:"error,omitempty"`
+	Attempts       int                    `json:"attempts"`
+	MaxAttempts    int                    `json:"max_attempts"`
+	StartedAt      *time.Time             `json:"started_at,omitempty"`
+	FinishedAt     *time.Time             `json:"finished_at,omitempty"`
+	CreatedAt      time.Time              `json:"created_at"`
+	UpdatedAt      time.Time              `json:"updated_at"`
 }
 
 // Health check
@@ -174,3 +508,238 @@ type HealthResponse struct {
 	Timestamp time.Time `json:"timestamp"`
 	Version   string    `json:"version"`
 }
+
+// SymbolRequest creates or updates a symbol of the symbol master. Tickers
+// map provider names to the ticker each provider uses for the symbol.
+type SymbolRequest struct {
+	Symbol   string            `json:"symbol"`
+	Name     string            `json:"name"`
+	Class    string            `json:"class"`
+	SubClass string            `json:"sub_class"`
+	Currency string            `json:"currency"`
+	Exchange string            `json:"exchange"`
+	ISIN     string            `json:"isin"`
+	CUSIP    string            `json:"cusip"`
+	FIGI     string            `json:"figi"`
+	Tickers  map[string]string `json:"tickers"`
+}
+
+// ScheduleRequest creates or replaces a schedule. Enabled defaults to true,
+// Timezone to UTC, Priority to normal and MissedRuns to run_once.
+type ScheduleRequest struct {
+	Name         string                 `json:"name" binding:"required"`
+	Cron         string                 `json:"cron" binding:"required"`
+	Timezone     string                 `json:"timezone"`
+	PortfolioIDs []uuid.UUID            `json:"portfolio_ids"`
+	Calculations []ScheduledCalculation `json:"calculations" binding:"required,min=1"`
+	Priority     string                 `json:"priority"`
+	MissedRuns   string                 `json:"missed_runs"`
+	Enabled      *bool                  `json:"enabled"`
+}
+
+// SnapshotRequest takes a risk snapshot of a portfolio. Confidence defaults to
+// 0.99, HorizonDays to 1 and WindowDays to 250.
+type SnapshotRequest struct {
+	PortfolioID uuid.UUID `json:"portfolio_id"`
+	Confidence  float64   `json:"confidence" binding:"omitempty,gt=0,lt=1"`
+	HorizonDays int       `json:"horizon_days" binding:"omitempty,min=1"`
+	WindowDays  int       `json:"window_days" binding:"omitempty,min=10"`
+	Adjustment  string    `json:"adjustment"`
+	Source      string    `json:"source,omitempty"` // set by the caller: manual, schedule
+}
+
+// SnapshotComparison compares a portfolio's risk snapshots of two dates
+type SnapshotComparison struct {
+	PortfolioID uuid.UUID           `json:"portfolio_id"`
+	From        *RiskSnapshot       `json:"from"`
+	To          *RiskSnapshot       `json:"to"`
+	Change      SnapshotChange      `json:"change"`
+	Attribution []AttributionChange `json:"attribution"` // largest change first
+	Warnings    []string            `json:"warnings,omitempty"`
+}
+
+// SnapshotChange is To minus From. The attribution adds up to
+// ContributionVaR; ModelDifference is the part of the VaR change that the
+// historical and delta-normal models disagree on.
+type SnapshotChange struct {
+	NAV             float64 `json:"nav"`
+	VaR             float64 `json:"var"`
+	CVaR            float64 `json:"cvar"`
+	Volatility      float64 `json:"volatility"`
+	ContributionVaR float64 `json:"contribution_var"`
+	ModelDifference float64 `json:"model_difference"`
+}
+
+// AttributionChange splits the change of a position's component VaR into an
+// exposure effect, from the change of its market value at the earlier
+// marginal VaR, and a risk effect, from the change of its marginal VaR at the
+// later market value
+type AttributionChange struct {
+	Symbol         string  `json:"symbol"`
+	From           float64 `json:"from"`
+	To             float64 `json:"to"`
+	Change         float64 `json:"change"`
+	ExposureEffect float64 `json:"exposure_effect"`
+	RiskEffect     float64 `json:"risk_effect"`
+}
+
+// RiskLimitRequest creates or replaces a risk limit. Max, and Min, are
+// fractions of NAV. Warning defaults to 0.8 and Enabled to true.
+type RiskLimitRequest struct {
+	Name        string   `json:"name" binding:"required"`
+	Type        string   `json:"type" binding:"required"` // var, cvar, concentration, asset_class, stress_loss
+	AssetClass  string   `json:"asset_class"`
+	Scenario    string   `json:"scenario"`
+	Confidence  float64  `json:"confidence" binding:"omitempty,gt=0,lt=1"`
+	HorizonDays int      `json:"horizon_days" binding:"omitempty,min=1"`
+	Min         *float64 `json:"min" binding:"omitempty,min=0"`
+	Max         float64  `json:"max" binding:"required,gt=0"`
+	Warning     float64  `json:"warning" binding:"omitempty,gt=0,lte=1"`
+	Enabled     *bool    `json:"enabled"`
+}
+
+// WhatIfTrade is a hypothetical trade: a signed change of quantity, positive
+// to buy. Price, if set, is the cost of a new position, which is otherwise
+// valued at its latest quote.
+type WhatIfTrade struct {
+	Symbol   string  `json:"symbol" binding:"required"`
+	Quantity float64 `json:"quantity" binding:"required"`
+	Price    float64 `json:"price" binding:"omitempty,gt=0"`
+}
+
+// WhatIfRequest checks the risk of a portfolio after hypothetical trades.
+// Confidence defaults to 0.99, HorizonDays to 1 and WindowDays to 250.
+type WhatIfRequest struct {
+	Trades      []WhatIfTrade `json:"trades" binding:"required,min=1,dive"`
+	Confidence  float64       `json:"confidence" binding:"omitempty,gt=0,lt=1"`
+	HorizonDays int           `json:"horizon_days" binding:"omitempty,min=1"`
+	WindowDays  int           `json:"window_days" binding:"omitempty,min=10"`
+	Adjustment  string        `json:"adjustment"`
+}
+
+// WhatIfResponse compares a portfolio's risk before and after hypothetical
+// trades, and the limits they would bring into warning or breach
+type WhatIfResponse struct {
+	PortfolioID uuid.UUID     `json:"portfolio_id"`
+	Currency    string        `json:"currency"`
+	Confidence  float64       `json:"confidence"`
+	HorizonDays int           `json:"horizon_days"`
+	WindowDays  int           `json:"window_days"`
+	Adjustment  string        `json:"adjustment"`
+	Trades      []WhatIfTrade `json:"trades"`
+	Before      WhatIfRisk    `json:"before"`
+	After       WhatIfRisk    `json:"after"`
+	Change      WhatIfChange  `json:"change"`
+	Limits      []WhatIfLimit `json:"limits"`
+	Breaches    int           `json:"breaches"` // limits in breach after the trades
+}
+
+// WhatIfRisk is a portfolio's risk on one side of hypothetical trades
+type WhatIfRisk struct {
+	NAV           float64             `json:"nav"`
+	VaR           float64             `json:"var"`
+	CVaR          float64             `json:"cvar"`
+	Volatility    float64             `json:"volatility"`
+	Contributions []AssetContribution `json:"contributions"`
+}
+
+// WhatIfChange is the after minus the before of hypothetical trades
+type WhatIfChange struct {
+	NAV        float64 `json:"nav"`
+	VaR        float64 `json:"var"`
+	CVaR       float64 `json:"cvar"`
+	Volatility float64 `json:"volatility"`
+}
+
+// WhatIfLimit checks a risk limit before and after hypothetical trades; a
+// side is nil if the limit cannot be measured there
+type WhatIfLimit struct {
+	LimitID   uuid.UUID   `json:"limit_id"`
+	Name      string      `json:"name"`
+	Type      string      `json:"type"`
+	Before    *LimitCheck `json:"before"`
+	After     *LimitCheck `json:"after"`
+	NewBreach bool        `json:"new_breach"` // in breach after the trades but not before
+}
+
+// LimitCheck is a risk limit's measurement without recording it
+type LimitCheck struct {
+	Value       float64 `json:"value"`
+	Utilization float64 `json:"utilization"`
+	State       string  `json:"state"`
+	Detail      string  `json:"detail,omitempty"`
+}
+
+// TransactionRequest records a ledger entry. Buys and sells need a symbol,
+// quantity and price; transfers a signed quantity, and a price to carry in
+// the cost basis; dividends a symbol and amount; fees an amount, and a
+// symbol if they are charged on a holding.
+type TransactionRequest struct {
+	Type      string  `json:"type" binding:"required"` // buy, sell, transfer, fee, dividend
+	Symbol    string  `json:"symbol"`
+	TradeDate string  `json:"trade_date" binding:"required"` // YYYY-MM-DD
+	Quantity  float64 `json:"quantity"`
+	Price     float64 `json:"price" binding:"omitempty,min=0"`
+	Fee       float64 `json:"fee" binding:"omitempty,min=0"`
+	Amount    float64 `json:"amount"`
+	Note      string  `json:"note"`
+}
+
+// Ledger is a portfolio's holdings, tax lots and realized P&L derived from
+// its transactions up to a date
+type Ledger struct {
+	PortfolioID uuid.UUID     `json:"portfolio_id"`
+	AsOf        time.Time     `json:"as_of"`
+	CostMethod  string        `json:"cost_method"`
+	Holdings    []Holding     `json:"holdings"`
+	Realized    []Realization `json:"realized"`
+	Totals      []LedgerTotal `json:"totals"` // by currency
+}
+
+// Holding is an asset's quantity and cost in a ledger, with the P&L realized
+// on it. Closed holdings have no quantity.
+type Holding struct {
+	AssetID     uuid.UUID `json:"asset_id"`
+	Symbol      string    `json:"symbol"`
+	Currency    string    `json:"currency"`
+	Quantity    float64   `json:"quantity"`
+	CostBasis   float64   `json:"cost_basis"` // of the open lots, with fees
+	AvgCost     float64   `json:"avg_cost"`   // cost basis per unit
+	RealizedPnL float64   `json:"realized_pnl"`
+	Dividends   float64   `json:"dividends"`
+	Fees        float64   `json:"fees"` // fees charged on the holding outside trades
+	Lots        []TaxLot  `json:"lots"`
+}
+
+// TaxLot is the open part of a buy or transfer in
+type TaxLot struct {
+	TransactionID uuid.UUID `json:"transaction_id"`
+	OpenDate      time.Time `json:"open_date"`
+	Quantity      float64   `json:"quantity"`
+	UnitCost      float64   `json:"unit_cost"` // with the fee of the buy
+}
+
+// Realization is the P&L of a sale, one per lot it closed; with average cost
+// a sale closes every lot in proportion and has one realization without an
+// open date
+type Realization struct {
+	TransactionID uuid.UUID  `json:"transaction_id"`
+	Date          time.Time  `json:"date"`
+	Symbol        string     `json:"symbol"`
+	Currency      string     `json:"currency"`
+	Quantity      float64    `json:"quantity"`
+	Proceeds      float64    `json:"proceeds"` // net of the fee
+	CostBasis     float64    `json:"cost_basis"`
+	PnL           float64    `json:"pnl"`
+	OpenDate      *time.Time `json:"open_date,omitempty"`
+}
+
+// LedgerTotal sums a ledger's income in one currency. Net is realized P&L
+// plus dividends less fees.
+type LedgerTotal struct {
+	Currency    string  `json:"currency"`
+	RealizedPnL float64 `json:"realized_pnl"`
+	Dividends   float64 `json:"dividends"`
+	Fees        float64 `json:"fees"`
+	Net         float64 `json:"net"`
+}
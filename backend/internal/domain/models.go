@@ -1,6 +1,7 @@
 package domain
 
 import (
+	"encoding/json"
 	"time"
 
 	"github.com/google/uuid"
@@ -21,43 +22,86 @@ func (User) TableName() string {
 	return "users"
 }
 
-// Asset represents a financial instrument
+// Asset represents a financial instrument. The assets table is the symbol
+// master: reference data and provider tickers for every symbol.
 type Asset struct {
-	ID        uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
-	Symbol    string    `gorm:"uniqueIndex;not null" json:"symbol"`
-	Name      string    `gorm:"not null" json:"name"`
-	Class     string    `gorm:"not null" json:"class"` // Equity, Bond, FX, Commodities, Crypto
-	Currency  string    `gorm:"not null;default:'USD'" json:"currency"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID        uuid.UUID     `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	Symbol    string        `gorm:"uniqueIndex;not null" json:"symbol"`
+	Name      string        `gorm:"not null" json:"name"`
+	Class     string        `gorm:"not null" json:"class"` // Equity, Bond, FX, Commodities, Crypto
+	SubClass  string        `json:"sub_class,omitempty"`   // e.g. Large Cap, Treasury, Gold
+	Currency  string        `gorm:"not null;default:'USD'" json:"currency"`
+	Exchange  string        `json:"exchange,omitempty"` // e.g. NYSE Arca, NASDAQ
+	ISIN      string        `gorm:"index" json:"isin,omitempty"`
+	CUSIP     string        `gorm:"index" json:"cusip,omitempty"`
+	FIGI      string        `gorm:"index" json:"figi,omitempty"`
+	Tickers   []AssetTicker `gorm:"foreignKey:AssetID;constraint:OnDelete:CASCADE" json:"tickers,omitempty"`
+	CreatedAt time.Time     `json:"created_at"`
+	UpdatedAt time.Time     `json:"updated_at"`
 }
 
 func (Asset) TableName() string {
 	return "assets"
 }
 
-// Price represents historical price data
+// AssetTicker is the ticker a market data provider uses for an asset, e.g.
+// BTCUSDT on binance or bitcoin on coingecko
+type AssetTicker struct {
+	ID        uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"-"`
+	AssetID   uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_asset_tickers_asset_provider" json:"-"`
+	Provider  string    `gorm:"not null;uniqueIndex:idx_asset_tickers_asset_provider" json:"provider"`
+	Ticker    string    `gorm:"not null" json:"ticker"`
+	CreatedAt time.Time `json:"-"`
+	UpdatedAt time.Time `json:"-"`
+}
+
+func (AssetTicker) TableName() string {
+	return "asset_tickers"
+}
+
+// Price represents historical price data, one close per asset and day
 type Price struct {
+	ID        uuid.UUID  `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	AssetID   uuid.UUID  `gorm:"type:uuid;not null;index;uniqueIndex:idx_prices_asset_date" json:"asset_id"`
+	Asset     Asset      `gorm:"foreignKey:AssetID" json:"asset,omitempty"`
+	Date      time.Time  `gorm:"not null;index;uniqueIndex:idx_prices_asset_date" json:"date"`
+	Close     float64    `gorm:"not null" json:"close"`
+	Source    string     `gorm:"not null;default:'import'" json:"source"` // import, or the provider it was fetched from
+	FetchedAt *time.Time `json:"fetched_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+func (Price) TableName() string {
+	return "prices"
+}
+
+// CorporateAction represents a split or cash dividend of an asset
+type CorporateAction struct {
 	ID        uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
-	AssetID   uuid.UUID `gorm:"type:uuid;not null;index" json:"asset_id"`
+	AssetID   uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_corporate_actions_asset_date_type" json:"asset_id"`
 	Asset     Asset     `gorm:"foreignKey:AssetID" json:"asset,omitempty"`
-	Date      time.Time `gorm:"not null;index" json:"date"`
-	Close     float64   `gorm:"not null" json:"close"`
+	Type      string    `gorm:"not null;uniqueIndex:idx_corporate_actions_asset_date_type" json:"type"` // split, dividend
+	ExDate    time.Time `gorm:"not null;uniqueIndex:idx_corporate_actions_asset_date_type" json:"ex_date"`
+	Value     float64   `gorm:"not null" json:"value"` // split ratio (2 for 2-for-1) or cash dividend per share
+	Source    string    `gorm:"not null;default:'import'" json:"source"`
 	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
 }
 
-func (Price) TableName() string {
-	return "prices"
+func (CorporateAction) TableName() string {
+	return "corporate_actions"
 }
 
 // Portfolio represents a collection of positions
 type Portfolio struct {
-	ID          uuid.UUID  `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
-	Name        string     `gorm:"not null" json:"name"`
-	Description string     `json:"description"`
-	Positions   []Position `gorm:"foreignKey:PortfolioID" json:"positions,omitempty"`
-	CreatedAt   time.Time  `json:"created_at"`
-	UpdatedAt   time.Time  `json:"updated_at"`
+	ID           uuid.UUID  `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	Name         string     `gorm:"not null" json:"name"`
+	Description  string     `json:"description"`
+	BaseCurrency string     `gorm:"not null;default:'USD'" json:"base_currency"` // currency NAV and risk are reported in
+	CostMethod   string     `gorm:"not null;default:'fifo'" json:"cost_method"`  // fifo, lifo, average: how sales are matched to lots
+	Positions    []Position `gorm:"foreignKey:PortfolioID" json:"positions,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
 }
 
 func (Portfolio) TableName() string {
@@ -97,20 +141,210 @@ func (Scenario) TableName() string {
 
 // Job represents an async computation job
 type Job struct {
-	ID        uuid.UUID              `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
-	Type      string                 `gorm:"not null;index" json:"type"` // var, cvar, stress, pca, etc.
-	Status    string                 `gorm:"not null;index" json:"status"` // queued, running, succeeded, failed
-	Progress  int                    `gorm:"default:0" json:"progress"` // 0-100
-	Result    map[string]interface{} `gorm:"type:jsonb" json:"result,omitempty"`
-	Error     string                 `json:"error,omitempty"`
-	CreatedAt time.Time              `json:"created_at"`
-	UpdatedAt time.Time              `json:"updated_at"`
+	ID              uuid.UUID              `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	Type            string                 `gorm:"not null;index" json:"type"`                        // var, cvar, stress, pca, etc.
+	Status          string                 `gorm:"not null;index" json:"status"`                      // queued, running, succeeded, failed, cancelled
+	Priority        string                 `gorm:"not null;default:'normal'" json:"priority"`         // high, normal, low
+	TimeoutSeconds  int                    `json:"timeout_seconds,omitempty"`                         // 0 is none
+	Input           json.RawMessage        `gorm:"type:jsonb;serializer:json" json:"input,omitempty"` // request the job computes
+	Progress        int                    `gorm:"default:0" json:"progress"`                         // 0-100
+	Stage           string                 `json:"stage,omitempty"`                                   // stage last reported while running
+	Result          map[string]interface{} `gorm:"type:jsonb;serializer:json" json:"result,omitempty"`
+	Error           string                 `json:"error,omitempty"`
+	Attempts        int                    `gorm:"not null;default:0" json:"attempts"` // times a worker claimed the job
+	MaxAttempts     int                    `gorm:"not null;default:3" json:"max_attempts"`
+	RunAfter        time.Time              `gorm:"not null;index" json:"run_after"`  // not claimed before, for retry backoff
+	WorkerID        string                 `gorm:"index" json:"worker_id,omitempty"` // worker running the job
+	HeartbeatAt     *time.Time             `json:"heartbeat_at,omitempty"`
+	CancelRequested bool                   `gorm:"not null;default:false" json:"cancel_requested,omitempty"`
+	StartedAt       *time.Time             `json:"started_at,omitempty"`
+	FinishedAt      *time.Time             `json:"finished_at,omitempty"`
+	CreatedAt       time.Time              `json:"created_at"`
+	UpdatedAt       time.Time              `json:"updated_at"`
 }
 
 func (Job) TableName() string {
 	return "jobs"
 }
 
+// JobEvent is an entry of a job's event stream: status changes, progress
+// and the final result. IDs increase, so a client resumes a stream after the
+// last ID it saw.
+type JobEvent struct {
+	ID        uint64                 `gorm:"primaryKey;autoIncrement" json:"id"`
+	JobID     uuid.UUID              `gorm:"type:uuid;not null;index" json:"job_id"`
+	Type      string                 `gorm:"not null" json:"type"` // status, progress
+	Status    string                 `json:"status"`
+	Progress  int                    `json:"progress"`
+	Stage     string                 `json:"stage,omitempty"`
+	Result    map[string]interface{} `gorm:"type:jsonb;serializer:json" json:"result,omitempty"`
+	Error     string                 `json:"error,omitempty"`
+	CreatedAt time.Time              `json:"created_at"`
+}
+
+func (JobEvent) TableName() string {
+	return "job_events"
+}
+
+// Schedule runs risk calculations for a set of portfolios at the times of a
+// cron expression, by queueing jobs
+type Schedule struct {
+	ID           uuid.UUID              `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	Name         string                 `gorm:"not null" json:"name"`
+	Cron         string                 `gorm:"not null" json:"cron"`                            // e.g. "30 22 * * MON-FRI"
+	Timezone     string                 `gorm:"not null;default:'UTC'" json:"timezone"`          // IANA zone the cron expression is read in
+	PortfolioIDs []uuid.UUID            `gorm:"type:jsonb;serializer:json" json:"portfolio_ids"` // empty for every portfolio
+	Calculations []ScheduledCalculation `gorm:"type:jsonb;serializer:json" json:"calculations"`
+	Priority     string                 `gorm:"not null;default:'normal'" json:"priority"`      // of the queued jobs
+	MissedRuns   string                 `gorm:"not null;default:'run_once'" json:"missed_runs"` // skip, run_once
+	Enabled      bool                   `gorm:"not null" json:"enabled"`
+	NextRunAt    *time.Time             `gorm:"index" json:"next_run_at,omitempty"`
+	LastRunAt    *time.Time             `json:"last_run_at,omitempty"`
+	Runs         []ScheduleRun          `gorm:"foreignKey:ScheduleID;constraint:OnDelete:CASCADE" json:"-"`
+	CreatedAt    time.Time              `json:"created_at"`
+	UpdatedAt    time.Time              `json:"updated_at"`
+}
+
+func (Schedule) TableName() string {
+	return "schedules"
+}
+
+// ScheduledCalculation is a calculation a schedule runs for each of its
+// portfolios: a job type and the request of that type, without the
+// portfolio_id
+type ScheduledCalculation struct {
+	Type   string                 `json:"type"` // var, cvar, stress, backtest, risk_contribution
+	Params map[string]interface{} `json:"params,omitempty"`
+}
+
+// ScheduleRun records a run of a schedule and the jobs it queued
+type ScheduleRun struct {
+	ID           uuid.UUID   `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	ScheduleID   uuid.UUID   `gorm:"type:uuid;not null;index" json:"schedule_id"`
+	ScheduledFor time.Time   `gorm:"not null" json:"scheduled_for"` // fire time, or when a manual run was requested
+	Trigger      string      `gorm:"not null" json:"trigger"`       // schedule, catch_up, manual
+	Status       string      `gorm:"not null" json:"status"`        // queued, partial, failed, skipped
+	JobIDs       []uuid.UUID `gorm:"type:jsonb;serializer:json" json:"job_ids,omitempty"`
+	Skipped      int         `json:"skipped,omitempty"` // missed fire times this entry records as skipped
+	Error        string      `json:"error,omitempty"`
+	CreatedAt    time.Time   `json:"created_at"`
+}
+
+func (ScheduleRun) TableName() string {
+	return "schedule_runs"
+}
+
+// RiskSnapshot records a portfolio's risk figures as of a date, one per
+// portfolio and day. Amounts are in Currency, the portfolio's base currency
+// when the snapshot was taken.
+type RiskSnapshot struct {
+	ID              uuid.UUID              `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	PortfolioID     uuid.UUID              `gorm:"type:uuid;not null;uniqueIndex:idx_risk_snapshots_portfolio_date" json:"portfolio_id"`
+	AsOf            time.Time              `gorm:"type:date;not null;uniqueIndex:idx_risk_snapshots_portfolio_date" json:"as_of"`
+	Currency        string                 `gorm:"not null" json:"currency"`
+	NAV             float64                `json:"nav"`
+	VaR             float64                `gorm:"column:var" json:"var"`                           // historical
+	CVaR            float64                `gorm:"column:cvar" json:"cvar"`                         // historical
+	Volatility      float64                `json:"volatility"`                                      // annualized
+	ContributionVaR float64                `gorm:"column:contribution_var" json:"contribution_var"` // delta-normal VaR the contributions add up to
+	Contributions   []SnapshotContribution `gorm:"type:jsonb;serializer:json" json:"contributions"`
+	Confidence      float64                `json:"confidence"`
+	HorizonDays     int                    `json:"horizon_days"`
+	WindowDays      int                    `json:"window_days"`
+	Adjustment      string                 `json:"adjustment"`
+	Source          string                 `gorm:"not null" json:"source"` // manual, schedule
+	CreatedAt       time.Time              `json:"created_at"`
+	UpdatedAt       time.Time              `json:"updated_at"`
+}
+
+func (RiskSnapshot) TableName() string {
+	return "risk_snapshots"
+}
+
+// RiskLimit caps a portfolio risk figure, as a fraction of NAV: VaR, CVaR,
+// the largest position, an asset class's weight (a band when Min is set) or a
+// stress scenario's loss. Limits are checked after each risk calculation of
+// the portfolio; State, Value and Utilization are from the latest check.
+type RiskLimit struct {
+	ID          uuid.UUID    `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	PortfolioID uuid.UUID    `gorm:"type:uuid;not null;index" json:"portfolio_id"`
+	Name        string       `gorm:"not null" json:"name"`
+	Type        string       `gorm:"not null" json:"type"`    // var, cvar, concentration, asset_class, stress_loss
+	AssetClass  string       `json:"asset_class,omitempty"`   // asset_class: the class
+	Scenario    string       `json:"scenario,omitempty"`      // stress_loss: the scenario, empty for the worst
+	Confidence  float64      `json:"confidence,omitempty"`    // var, cvar: only results at this confidence, 0 for any
+	HorizonDays int          `json:"horizon_days,omitempty"`  // var, cvar: only results at this horizon, 0 for any
+	Min         *float64     `json:"min,omitempty"`           // asset_class: lower weight bound
+	Max         float64      `gorm:"not null" json:"max"`     // fraction of NAV
+	Warning     float64      `gorm:"not null" json:"warning"` // utilization from which the limit is in warning
+	Enabled     bool         `gorm:"not null" json:"enabled"`
+	State       string       `gorm:"not null" json:"state"` // ok, warning, breach
+	Value       *float64     `json:"value,omitempty"`       // latest measured value
+	Utilization *float64     `json:"utilization,omitempty"` // 1 at the limit
+	Detail      string       `json:"detail,omitempty"`      // e.g. the largest position
+	CheckedAt   *time.Time   `json:"checked_at,omitempty"`
+	Events      []LimitEvent `gorm:"foreignKey:LimitID;constraint:OnDelete:CASCADE" json:"-"`
+	CreatedAt   time.Time    `json:"created_at"`
+	UpdatedAt   time.Time    `json:"updated_at"`
+}
+
+func (RiskLimit) TableName() string {
+	return "risk_limits"
+}
+
+// LimitEvent records a limit changing state, and whether the alert was
+// delivered
+type LimitEvent struct {
+	ID            uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	LimitID       uuid.UUID `gorm:"type:uuid;not null;index" json:"limit_id"`
+	PortfolioID   uuid.UUID `gorm:"type:uuid;not null;index" json:"portfolio_id"`
+	State         string    `gorm:"not null" json:"state"`
+	PreviousState string    `gorm:"not null" json:"previous_state"`
+	Value         float64   `json:"value"`
+	Utilization   float64   `json:"utilization"`
+	Detail        string    `json:"detail,omitempty"`
+	Notified      bool      `json:"notified"`
+	NotifyError   string    `json:"notify_error,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+func (LimitEvent) TableName() string {
+	return "limit_events"
+}
+
+// Transaction is an entry of a portfolio's trade ledger. Once a portfolio
+// has any, its positions are derived from them. Prices and amounts are in
+// the asset's currency, or the portfolio's base currency for a fee without
+// an asset.
+type Transaction struct {
+	ID          uuid.UUID  `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	PortfolioID uuid.UUID  `gorm:"type:uuid;not null;index:idx_transactions_portfolio_date" json:"portfolio_id"`
+	AssetID     *uuid.UUID `gorm:"type:uuid;index" json:"asset_id,omitempty"`
+	Asset       *Asset     `gorm:"foreignKey:AssetID" json:"asset,omitempty"`
+	Type        string     `gorm:"not null" json:"type"` // buy, sell, transfer, fee, dividend
+	TradeDate   time.Time  `gorm:"type:date;not null;index:idx_transactions_portfolio_date" json:"trade_date"`
+	Quantity    float64    `json:"quantity,omitempty"` // units, signed for transfers: positive in, negative out
+	Price       float64    `json:"price,omitempty"`    // per unit; the cost basis of a transfer in
+	Fee         float64    `json:"fee,omitempty"`      // commission of a buy or sell
+	Amount      float64    `json:"amount,omitempty"`   // cash of a dividend or fee
+	Note        string     `json:"note,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+func (Transaction) TableName() string {
+	return "transactions"
+}
+
+// SnapshotContribution is a position's share of a snapshot's risk
+type SnapshotContribution struct {
+	Symbol    string  `json:"symbol"`
+	Exposure  float64 `json:"exposure"` // market value in the snapshot's currency
+	Weight    float64 `json:"weight"`   // of NAV
+	Component float64 `json:"component_var"`
+	Marginal  float64 `json:"marginal_var"`
+}
+
 // BeforeCreate hooks to ensure UUIDs
 func (u *User) BeforeCreate(tx *gorm.DB) error {
 	if u.ID == uuid.Nil {
@@ -126,6 +360,13 @@ func (a *Asset) BeforeCreate(tx *gorm.DB) error {
 	return nil
 }
 
+func (t *AssetTicker) BeforeCreate(tx *gorm.DB) error {
+	if t.ID == uuid.Nil {
+		t.ID = uuid.New()
+	}
+	return nil
+}
+
 func (p *Price) BeforeCreate(tx *gorm.DB) error {
 	if p.ID == uuid.Nil {
 		p.ID = uuid.New()
@@ -133,6 +374,13 @@ func (p *Price) BeforeCreate(tx *gorm.DB) error {
 	return nil
 }
 
+func (a *CorporateAction) BeforeCreate(tx *gorm.DB) error {
+	if a.ID == uuid.Nil {
+		a.ID = uuid.New()
+	}
+	return nil
+}
+
 func (p *Portfolio) BeforeCreate(tx *gorm.DB) error {
 	if p.ID == uuid.Nil {
 		p.ID = uuid.New()
@@ -160,3 +408,45 @@ func (j *Job) BeforeCreate(tx *gorm.DB) error {
 	}
 	return nil
 }
+
+func (s *Schedule) BeforeCreate(tx *gorm.DB) error {
+	if s.ID == uuid.Nil {
+		s.ID = uuid.New()
+	}
+	return nil
+}
+
+func (r *ScheduleRun) BeforeCreate(tx *gorm.DB) error {
+	if r.ID == uuid.Nil {
+		r.ID = uuid.New()
+	}
+	return nil
+}
+
+func (r *RiskSnapshot) BeforeCreate(tx *gorm.DB) error {
+	if r.ID == uuid.Nil {
+		r.ID = uuid.New()
+	}
+	return nil
+}
+
+func (l *RiskLimit) BeforeCreate(tx *gorm.DB) error {
+	if l.ID == uuid.Nil {
+		l.ID = uuid.New()
+	}
+	return nil
+}
+
+func (e *LimitEvent) BeforeCreate(tx *gorm.DB) error {
+	if e.ID == uuid.Nil {
+		e.ID = uuid.New()
+	}
+	return nil
+}
+
+func (t *Transaction) BeforeCreate(tx *gorm.DB) error {
+	if t.ID == uuid.Nil {
+		t.ID = uuid.New()
+	}
+	return nil
+}
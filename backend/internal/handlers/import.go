@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"errors"
+	"mime/multipart"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/reserveone/saa-risk-analyzer/internal/domain"
+	"github.com/reserveone/saa-risk-analyzer/internal/service"
+)
+
+type ImportHandler struct {
+	imports *service.ImportService
+}
+
+func NewImportHandler(db *gorm.DB) *ImportHandler {
+	return &ImportHandler{
+		imports: service.NewImportService(db),
+	}
+}
+
+// ImportPrices loads a date,symbol,close CSV or XLSX upload (form field
+// "file"). With ?dry_run=true the rows are validated but not committed.
+func (h *ImportHandler) ImportPrices(c *gin.Context) {
+	rows, file, ok := openUpload(c)
+	if !ok {
+		return
+	}
+	defer file.Close()
+
+	result, err := h.imports.ImportPrices(rows, c.Query("dry_run") == "true")
+	respondImport(c, result, err)
+}
+
+// ImportPositions loads a symbol,quantity,avg_price CSV or XLSX upload into
+// a portfolio, updating positions it already holds
+func (h *ImportHandler) ImportPositions(c *gin.Context) {
+	portfolioID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(400, gin.H{"error": "invalid portfolio id"})
+		return
+	}
+
+	rows, file, ok := openUpload(c)
+	if !ok {
+		return
+	}
+	defer file.Close()
+
+	result, err := h.imports.ImportPositions(portfolioID, rows, c.Query("dry_run") == "true")
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(404, gin.H{"error": "portfolio not found"})
+		return
+	}
+	if errors.Is(err, service.ErrLedgerPositions) {
+		c.JSON(409, gin.H{"error": err.Error() + ", record transactions instead"})
+		return
+	}
+	respondImport(c, result, err)
+}
+
+// ImportCorporateActions loads a date,symbol,type,value CSV or XLSX upload of
+// splits and dividends
+func (h *ImportHandler) ImportCorporateActions(c *gin.Context) {
+	rows, file, ok := openUpload(c)
+	if !ok {
+		return
+	}
+	defer file.Close()
+
+	result, err := h.imports.ImportCorporateActions(rows, c.Query("dry_run") == "true")
+	respondImport(c, result, err)
+}
+
+// openUpload opens the uploaded file as rows; the caller closes the file
+func openUpload(c *gin.Context) (service.TableReader, multipart.File, bool) {
+	header, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(400, gin.H{"error": "file required: " + err.Error()})
+		return nil, nil, false
+	}
+	file, err := header.Open()
+	if err != nil {
+		c.JSON(400, gin.H{"error": "failed to read file: " + err.Error()})
+		return nil, nil, false
+	}
+
+	rows, err := service.NewTableReader(header.Filename, file, header.Size)
+	if err != nil {
+		file.Close()
+		c.JSON(400, gin.H{"error": err.Error()})
+		return nil, nil, false
+	}
+	return rows, file, true
+}
+
+// respondImport returns 400 with the row errors when nothing was committed
+// because of invalid rows
+func respondImport(c *gin.Context, result *domain.ImportResult, err error) {
+	if err != nil {
+		c.JSON(400, gin.H{"error": "Failed to import: " + err.Error()})
+		return
+	}
+	if result.ErrorCount > 0 {
+		c.JSON(400, result)
+		return
+	}
+	c.JSON(200, result)
+}
@@ -0,0 +1,205 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	"gorm.io/gorm"
+)
+
+// keepAliveInterval is how often an idle event stream is pinged, so proxies
+// do not drop it
+const keepAliveInterval = 15 * time.Second
+
+// WebSocket limits: the largest message read from clients, and how long a
+// write may take
+const (
+	maxWSMessageSize = 1 << 20
+	wsWriteTimeout   = 10 * time.Second
+)
+
+// OriginChecker returns the WebSocket origin check for allowed, a comma
+// separated list of origins such as CORS_ALLOW_ORIGINS, where * allows any.
+// Requests from the API's own host are allowed, as are those without an
+// Origin header, which only non-browser clients leave out.
+func OriginChecker(allowed string) func(r *http.Request) bool {
+	var origins []string
+	for _, origin := range strings.Split(allowed, ",") {
+		if origin = strings.TrimSpace(origin); origin != "" {
+			origins = append(origins, strings.TrimSuffix(origin, "/"))
+		}
+	}
+	return func(r *http.Request) bool {
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			return true
+		}
+		if u, err := url.Parse(origin); err == nil && strings.EqualFold(u.Host, r.Host) {
+			return true
+		}
+		for _, allowed := range origins {
+			if allowed == "*" || strings.EqualFold(allowed, origin) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// GetJobEvents streams a job's events as Server-Sent Events: status changes,
+// progress with the current stage, and last the final status with the result
+// or error. Each event carries its ID; a client reconnecting with
+// Last-Event-ID (or ?last_event_id=) resumes after it.
+func (h *JobHandler) GetJobEvents(c *gin.Context) {
+	id, after, ok := h.eventsRequest(c, c.GetHeader("Last-Event-ID"))
+	if !ok {
+		return
+	}
+
+	events, err := h.queue.Subscribe(c.Request.Context(), id, after)
+	if !subscribed(c, err) {
+		return
+	}
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no") // no proxy buffering
+	c.Status(200)
+	c.Writer.Flush()
+
+	keepAlive := time.NewTicker(keepAliveInterval)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			data, err := json.Marshal(event)
+			if err != nil {
+				fmt.Printf("Warning: failed to encode event of job %s: %v\n", id, err)
+				continue
+			}
+			if event.ID > 0 {
+				fmt.Fprintf(c.Writer, "id: %d\n", event.ID)
+			}
+			fmt.Fprintf(c.Writer, "event: %s\ndata: %s\n\n", event.Type, data)
+		case <-keepAlive.C:
+			fmt.Fprint(c.Writer, ": keep-alive\n\n")
+		}
+		c.Writer.Flush()
+	}
+}
+
+// GetJobEventsWS streams a job's events, as GetJobEvents does, as JSON text
+// messages over a WebSocket. Resume with ?last_event_id=. The server closes
+// the socket after the final status. Upgrades from origins other than the
+// API's own and the allowed ones are refused with 403.
+func (h *JobHandler) GetJobEventsWS(c *gin.Context) {
+	id, after, ok := h.eventsRequest(c, "")
+	if !ok {
+		return
+	}
+	if _, err := h.queue.GetJob(id); !subscribed(c, err) {
+		return
+	}
+
+	conn, err := h.upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		return // Upgrade answered the request
+	}
+	defer conn.Close()
+	conn.SetReadLimit(maxWSMessageSize)
+
+	// Read until the client goes away, which ends the subscription. Reading
+	// also answers the client's pings and close.
+	ctx, cancel := context.WithCancel(c.Request.Context())
+	defer cancel()
+	go func() {
+		defer cancel()
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	events, err := h.queue.Subscribe(ctx, id, after)
+	if err != nil {
+		closeWS(conn, websocket.CloseGoingAway, "failed to subscribe")
+		return
+	}
+
+	keepAlive := time.NewTicker(keepAliveInterval)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				closeWS(conn, websocket.CloseNormalClosure, "")
+				return
+			}
+			conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+			if err := conn.WriteJSON(event); err != nil {
+				return
+			}
+		case <-keepAlive.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteTimeout)); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// closeWS sends a close message with code and reason; the deferred Close
+// drops the connection
+func closeWS(conn *websocket.Conn, code int, reason string) {
+	conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), time.Now().Add(wsWriteTimeout))
+}
+
+// eventsRequest reads the job ID and the event ID to resume after, from
+// lastEventID or ?last_event_id=
+func (h *JobHandler) eventsRequest(c *gin.Context, lastEventID string) (uuid.UUID, uint64, bool) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(400, gin.H{"error": "invalid job id"})
+		return uuid.Nil, 0, false
+	}
+
+	if lastEventID == "" {
+		lastEventID = c.Query("last_event_id")
+	}
+	var after uint64
+	if lastEventID != "" {
+		after, err = strconv.ParseUint(lastEventID, 10, 64)
+		if err != nil {
+			c.JSON(400, gin.H{"error": "invalid last event id"})
+			return uuid.Nil, 0, false
+		}
+	}
+	return id, after, true
+}
+
+// subscribed answers a failure to find the job to stream
+func subscribed(c *gin.Context, err error) bool {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(404, gin.H{"error": "job not found"})
+		return false
+	case err != nil:
+		c.JSON(500, gin.H{"error": "Failed to load job: " + err.Error()})
+		return false
+	}
+	return true
+}
@@ -0,0 +1,148 @@
+package handlers
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	"gorm.io/gorm"
+
+	"github.com/reserveone/saa-risk-analyzer/internal/domain"
+	"github.com/reserveone/saa-risk-analyzer/internal/jobs"
+)
+
+type JobHandler struct {
+	queue    *jobs.Queue
+	upgrader websocket.Upgrader
+}
+
+// NewJobHandler serves jobs from queue. allowedOrigins lists the origins,
+// besides the API's own, that may open event WebSockets; see OriginChecker.
+func NewJobHandler(queue *jobs.Queue, allowedOrigins string) *JobHandler {
+	return &JobHandler{
+		queue:    queue,
+		upgrader: websocket.Upgrader{CheckOrigin: OriginChecker(allowedOrigins)},
+	}
+}
+
+// GetJob returns a job's status and input and, once it has succeeded, its
+// result
+func (h *JobHandler) GetJob(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(400, gin.H{"error": "invalid job id"})
+		return
+	}
+
+	job, err := h.queue.GetJob(id)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(404, gin.H{"error": "job not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to load job: " + err.Error()})
+		return
+	}
+
+	c.JSON(200, jobResponse(job, true))
+}
+
+// CancelJob cancels a queued job at once (200) or asks a running one to stop
+// (202); the running job turns cancelled when its calculation returns
+func (h *JobHandler) CancelJob(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(400, gin.H{"error": "invalid job id"})
+		return
+	}
+
+	status, err := h.queue.Cancel(id)
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(404, gin.H{"error": "job not found"})
+		return
+	case errors.Is(err, jobs.ErrJobFinished):
+		c.JSON(409, gin.H{"error": err.Error(), "status": status})
+		return
+	case err != nil:
+		c.JSON(500, gin.H{"error": "Failed to cancel job: " + err.Error()})
+		return
+	}
+
+	if status == jobs.StatusRunning {
+		c.JSON(202, gin.H{"id": id, "status": status, "message": "cancellation requested"})
+		return
+	}
+	c.JSON(200, gin.H{"id": id, "status": status})
+}
+
+// GetJobs lists recent jobs, newest first, filtered by ?type= and ?status=
+// and limited by ?limit= (default 50). Inputs and results are left out; fetch
+// a job by ID for them.
+func (h *JobHandler) GetJobs(c *gin.Context) {
+	filter := jobs.Filter{Type: c.Query("type"), Status: c.Query("status")}
+	if filter.Type != "" && !contains(jobs.Types, filter.Type) {
+		c.JSON(400, gin.H{"error": "invalid type, expected one of " + strings.Join(jobs.Types, ", ")})
+		return
+	}
+	if filter.Status != "" && !contains(jobs.Statuses, filter.Status) {
+		c.JSON(400, gin.H{"error": "invalid status, expected one of " + strings.Join(jobs.Statuses, ", ")})
+		return
+	}
+	if limit := c.Query("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n <= 0 {
+			c.JSON(400, gin.H{"error": "invalid limit"})
+			return
+		}
+		filter.Limit = n
+	}
+
+	list, err := h.queue.ListJobs(filter)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to list jobs: " + err.Error()})
+		return
+	}
+
+	responses := make([]domain.JobResponse, len(list))
+	for i := range list {
+		responses[i] = jobResponse(&list[i], false)
+	}
+	c.JSON(200, responses)
+}
+
+func jobResponse(job *domain.Job, withResult bool) domain.JobResponse {
+	response := domain.JobResponse{
+		ID:             job.ID,
+		Type:           job.Type,
+		Status:         job.Status,
+		Priority:       job.Priority,
+		TimeoutSeconds: job.TimeoutSeconds,
+		Progress:       job.Progress,
+		Stage:          job.Stage,
+		Error:          job.Error,
+		Attempts:       job.Attempts,
+		MaxAttempts:    job.MaxAttempts,
+		StartedAt:      job.StartedAt,
+		FinishedAt:     job.FinishedAt,
+		CreatedAt:      job.CreatedAt,
+		UpdatedAt:      job.UpdatedAt,
+	}
+	if withResult {
+		response.Input = job.Input
+		response.Result = job.Result
+	}
+	return response
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,191 @@
+package handlers
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/reserveone/saa-risk-analyzer/internal/domain"
+	"github.com/reserveone/saa-risk-analyzer/internal/service"
+)
+
+type LimitHandler struct {
+	limits *service.LimitService
+}
+
+func NewLimitHandler(limits *service.LimitService) *LimitHandler {
+	return &LimitHandler{limits: limits}
+}
+
+// GetLimits lists the portfolio's risk limits with their state and
+// utilization at the latest check
+func (h *LimitHandler) GetLimits(c *gin.Context) {
+	portfolioID, ok := limitPortfolioID(c)
+	if !ok {
+		return
+	}
+
+	limits, err := h.limits.List(portfolioID)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to load limits: " + err.Error()})
+		return
+	}
+
+	c.JSON(200, limits)
+}
+
+func (h *LimitHandler) GetLimit(c *gin.Context) {
+	portfolioID, limitID, ok := limitIDs(c)
+	if !ok {
+		return
+	}
+
+	limit, err := h.limits.Get(portfolioID, limitID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(404, gin.H{"error": "limit not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to load limit: " + err.Error()})
+		return
+	}
+
+	c.JSON(200, limit)
+}
+
+func (h *LimitHandler) CreateLimit(c *gin.Context) {
+	portfolioID, ok := limitPortfolioID(c)
+	if !ok {
+		return
+	}
+	var req domain.RiskLimitRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	limit, err := h.limits.Create(portfolioID, req)
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(404, gin.H{"error": "portfolio not found"})
+		return
+	case errors.Is(err, service.ErrInvalidLimit):
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		c.JSON(500, gin.H{"error": "Failed to create limit: " + err.Error()})
+		return
+	}
+
+	c.JSON(200, limit)
+}
+
+// UpdateLimit replaces a limit's definition; its state is rechecked by the
+// next risk calculation
+func (h *LimitHandler) UpdateLimit(c *gin.Context) {
+	portfolioID, limitID, ok := limitIDs(c)
+	if !ok {
+		return
+	}
+	var req domain.RiskLimitRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	limit, err := h.limits.Update(portfolioID, limitID, req)
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(404, gin.H{"error": "limit not found"})
+		return
+	case errors.Is(err, service.ErrInvalidLimit):
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		c.JSON(500, gin.H{"error": "Failed to update limit: " + err.Error()})
+		return
+	}
+
+	c.JSON(200, limit)
+}
+
+// DeleteLimit deletes a limit and its breach history
+func (h *LimitHandler) DeleteLimit(c *gin.Context) {
+	portfolioID, limitID, ok := limitIDs(c)
+	if !ok {
+		return
+	}
+
+	err := h.limits.Delete(portfolioID, limitID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(404, gin.H{"error": "limit not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to delete limit: " + err.Error()})
+		return
+	}
+
+	c.JSON(200, gin.H{"message": "Limit deleted"})
+}
+
+// GetLimitEvents returns the breach history of the portfolio's limits: each
+// change of state, newest first, filtered by ?limit_id= and limited by
+// ?limit= (default 100)
+func (h *LimitHandler) GetLimitEvents(c *gin.Context) {
+	portfolioID, ok := limitPortfolioID(c)
+	if !ok {
+		return
+	}
+	var limitID *uuid.UUID
+	if value := c.Query("limit_id"); value != "" {
+		id, err := uuid.Parse(value)
+		if err != nil {
+			c.JSON(400, gin.H{"error": "invalid limit_id"})
+			return
+		}
+		limitID = &id
+	}
+	n := 0
+	if value := c.Query("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 {
+			c.JSON(400, gin.H{"error": "invalid limit"})
+			return
+		}
+		n = parsed
+	}
+
+	events, err := h.limits.Events(portfolioID, limitID, n)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to load limit events: " + err.Error()})
+		return
+	}
+
+	c.JSON(200, events)
+}
+
+func limitPortfolioID(c *gin.Context) (uuid.UUID, bool) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(400, gin.H{"error": "invalid portfolio id"})
+		return uuid.Nil, false
+	}
+	return id, true
+}
+
+func limitIDs(c *gin.Context) (uuid.UUID, uuid.UUID, bool) {
+	portfolioID, ok := limitPortfolioID(c)
+	if !ok {
+		return uuid.Nil, uuid.Nil, false
+	}
+	limitID, err := uuid.Parse(c.Param("limit_id"))
+	if err != nil {
+		c.JSON(400, gin.H{"error": "invalid limit id"})
+		return uuid.Nil, uuid.Nil, false
+	}
+	return portfolioID, limitID, true
+}
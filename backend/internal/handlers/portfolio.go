@@ -1,6 +1,10 @@
 package handlers
 
 import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
 	"time"
 	
 	"github.com/gin-gonic/gin"
@@ -13,13 +17,21 @@ import (
 
 type PortfolioHandler struct {
 	db          *gorm.DB
-	marketData  *service.MarketDataService
+	quotes      *service.LatestPriceService
+	prices      *service.PriceStore
+	actions     *service.CorporateActionService
+	valuation   *service.ValuationService
+	ledger      *service.LedgerService
 }
 
-func NewPortfolioHandler(db *gorm.DB) *PortfolioHandler {
+func NewPortfolioHandler(db *gorm.DB, quotes *service.LatestPriceService) *PortfolioHandler {
 	return &PortfolioHandler{
-		db:         db,
-		marketData: service.NewMarketDataService(),
+		db:        db,
+		quotes:    quotes,
+		prices:    service.NewPriceStore(db, quotes.Market()),
+		actions:   service.NewCorporateActionService(db, quotes.Market()),
+		valuation: service.NewValuationService(db, quotes),
+		ledger:    service.NewLedgerService(db),
 	}
 }
 
@@ -46,6 +58,147 @@ func (h *PortfolioHandler) GetPortfolio(c *gin.Context) {
 	c.JSON(200, portfolio)
 }
 
+// GetValuation marks the portfolio to market as of the as_of query date
+// (YYYY-MM-DD, default today), with the positions its ledger held then
+func (h *PortfolioHandler) GetValuation(c *gin.Context) {
+	portfolioID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(400, gin.H{"error": "invalid portfolio id"})
+		return
+	}
+	
+	asOf, ok := parseAsOf(c)
+	if !ok {
+		return
+	}
+	
+	var portfolio domain.Portfolio
+	if err := h.db.Preload("Positions.Asset").First(&portfolio, "id = ?", portfolioID).Error; err != nil {
+		c.JSON(404, gin.H{"error": "portfolio not found"})
+		return
+	}
+	if !h.positionsAsOf(c, &portfolio, asOf) {
+		return
+	}
+	
+	valuation, err := h.valuation.ValuePortfolio(c.Request.Context(), &portfolio, asOf)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to value portfolio: " + err.Error()})
+		return
+	}
+	
+	c.JSON(200, valuation)
+}
+
+// GetCurrencyExposure breaks the portfolio value down by currency as of the
+// as_of query date (YYYY-MM-DD, default today), with the positions its
+// ledger held then
+func (h *PortfolioHandler) GetCurrencyExposure(c *gin.Context) {
+	portfolioID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(400, gin.H{"error": "invalid portfolio id"})
+		return
+	}
+
+	asOf, ok := parseAsOf(c)
+	if !ok {
+		return
+	}
+
+	var portfolio domain.Portfolio
+	if err := h.db.Preload("Positions.Asset").First(&portfolio, "id = ?", portfolioID).Error; err != nil {
+		c.JSON(404, gin.H{"error": "portfolio not found"})
+		return
+	}
+	if !h.positionsAsOf(c, &portfolio, asOf) {
+		return
+	}
+
+	valuation, err := h.valuation.ValuePortfolio(c.Request.Context(), &portfolio, asOf)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to value portfolio: " + err.Error()})
+		return
+	}
+
+	c.JSON(200, h.valuation.CurrencyExposure(&portfolio, valuation))
+}
+
+// GetFXRate returns the from/to rate (units of to per from) as of the as_of
+// query date (YYYY-MM-DD, default today)
+func (h *PortfolioHandler) GetFXRate(c *gin.Context) {
+	from, err := service.NormalizeCurrency(c.Query("from"))
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	to, err := service.NormalizeCurrency(c.Query("to"))
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	asOf, ok := parseAsOf(c)
+	if !ok {
+		return
+	}
+
+	rate, err := h.valuation.FX().Rate(c.Request.Context(), from, to, asOf)
+	if err != nil {
+		c.JSON(404, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(200, domain.FXRateResponse{From: from, To: to, Rate: rate, AsOf: asOf})
+}
+
+// parseAsOf reads the as_of query date as the end of that day, defaulting
+// to now
+func parseAsOf(c *gin.Context) (time.Time, bool) {
+	asOfStr := c.Query("as_of")
+	if asOfStr == "" {
+		return time.Now(), true
+	}
+	date, err := time.Parse("2006-01-02", asOfStr)
+	if err != nil {
+		c.JSON(400, gin.H{"error": "invalid as_of date, expected YYYY-MM-DD"})
+		return time.Time{}, false
+	}
+	// Include every close on the as-of date itself
+	return date.Add(24*time.Hour - time.Nanosecond), true
+}
+
+// positionsAsOf replaces the portfolio's positions by those its ledger held
+// on the as_of date, if one is given
+func (h *PortfolioHandler) positionsAsOf(c *gin.Context, portfolio *domain.Portfolio, asOf time.Time) bool {
+	if c.Query("as_of") == "" {
+		return true
+	}
+	err := h.ledger.PortfolioAsOf(portfolio, asOf)
+	if errors.Is(err, service.ErrBeforeOpeningBalances) {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return false
+	}
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to derive positions: " + err.Error()})
+		return false
+	}
+	return true
+}
+
+// derivedPositions responds with 409 and returns true if the portfolio's
+// positions are derived from its transactions, and cannot be changed directly
+func (h *PortfolioHandler) derivedPositions(c *gin.Context, portfolioID uuid.UUID) bool {
+	derived, err := h.ledger.HasTransactions(portfolioID)
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return true
+	}
+	if derived {
+		c.JSON(409, gin.H{"error": service.ErrLedgerPositions.Error() + ", record a transaction instead"})
+		return true
+	}
+	return false
+}
+
 func (h *PortfolioHandler) CreatePortfolio(c *gin.Context) {
 	var req domain.CreatePortfolioRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -53,9 +206,22 @@ func (h *PortfolioHandler) CreatePortfolio(c *gin.Context) {
 		return
 	}
 	
+	baseCurrency, err := service.NormalizeCurrency(req.BaseCurrency)
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	costMethod, err := service.NormalizeCostMethod(req.CostMethod)
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	
 	portfolio := domain.Portfolio{
-		Name:        req.Name,
-		Description: req.Description,
+		Name:         req.Name,
+		Description:  req.Description,
+		BaseCurrency: baseCurrency,
+		CostMethod:   costMethod,
 	}
 	
 	if err := h.db.Create(&portfolio).Error; err != nil {
@@ -82,33 +248,43 @@ func (h *PortfolioHandler) AddPositions(c *gin.Context) {
 		return
 	}
 	
-	pid, _ := uuid.Parse(portfolioID)
+	pid, err := uuid.Parse(portfolioID)
+	if err != nil {
+		c.JSON(400, gin.H{"error": "invalid portfolio id"})
+		return
+	}
+	if h.derivedPositions(c, pid) {
+		return
+	}
 	
-	for _, p := range req.Positions {
-		var asset domain.Asset
-		if err := h.db.Where("symbol = ?", p.Symbol).First(&asset).Error; err != nil {
-			asset = domain.Asset{
-				Symbol:   p.Symbol,
-				Name:     p.Symbol,
-				Class:    "Unknown",
-				Currency: "USD",
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		for _, p := range req.Positions {
+			asset, err := service.ResolveAsset(tx, p.Symbol)
+			if err != nil {
+				return err
+			}
+			
+			position := domain.Position{
+				PortfolioID: pid,
+				AssetID:     asset.ID,
+				Quantity:    p.Quantity,
+				AvgPrice:    p.AvgPrice,
+			}
+			if err := tx.Create(&position).Error; err != nil {
+				return err
 			}
-			h.db.Create(&asset)
-		}
-		
-		position := domain.Position{
-			PortfolioID: pid,
-			AssetID:     asset.ID,
-			Quantity:    p.Quantity,
-			AvgPrice:    p.AvgPrice,
 		}
-		h.db.Create(&position)
+		return nil
+	})
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to add positions: " + err.Error()})
+		return
 	}
 	
 	c.JSON(200, gin.H{"message": "positions added", "count": len(req.Positions)})
 }
 
-// GetLatestPrice returns the CURRENT market price for a symbol
+// GetLatestPrice returns the latest quote for a symbol with its source and age
 func (h *PortfolioHandler) GetLatestPrice(c *gin.Context) {
 	symbol := c.Param("symbol")
 	if symbol == "" {
@@ -116,77 +292,145 @@ func (h *PortfolioHandler) GetLatestPrice(c *gin.Context) {
 		return
 	}
 	
-	// Current market prices (Nov 13, 2025) - hardcoded for demo
-	currentPrices := map[string]float64{
-		// Crypto (from Binance/CoinGecko)
-		"BTC":  99886.29,
-		"ETH":  3276.12,
-		"BNB":  620.45,
-		"SOL":  215.30,
-		"XRP":  0.58,
-		"ADA":  0.42,
-		// US Stocks/ETFs
-		"SPY":  595.12,
-		"QQQ":  507.83,
-		"IWM":  226.45,
-		"DIA":  445.67,
-		// Bonds
-		"TLT":  94.23,
-		"IEF":  99.87,
-		"SHY":  82.15,
-		// Commodities
-		"GLD":  234.56,
-		"SLV":  27.89,
-		"USO":  72.34,
-		// FX
-		"EURUSD": 1.0550,
-		"GBPUSD": 1.2750,
-		"USDJPY": 151.25,
-	}
-	
-	// Check if we have current price
-	if price, ok := currentPrices[symbol]; ok {
-		c.JSON(200, gin.H{
-			"symbol": symbol,
-			"price":  price,
-			"date":   time.Now(),
-			"source": "current market data",
-		})
-		return
-	}
-	
-	// Try API for crypto
-	prices, err := h.marketData.GetHistoricalPrices(symbol, 1)
-	if err == nil && len(prices) > 0 {
-		latestPrice := prices[len(prices)-1]
-		c.JSON(200, gin.H{
-			"symbol": symbol,
-			"price":  latestPrice.Close,
-			"date":   latestPrice.Date,
-			"source": "live api",
-		})
-		return
-	}
-	
-	// Fallback to DB
-	var price domain.Price
-	err = h.db.
-		Joins("JOIN assets ON assets.id = prices.asset_id").
-		Where("assets.symbol = ?", symbol).
-		Order("prices.date DESC").
-		First(&price).Error
-	
-	if err == nil {
-		c.JSON(200, gin.H{
-			"symbol": symbol,
-			"price":  price.Close,
-			"date":   price.Date,
-			"source": "database",
-		})
-		return
-	}
-	
-	c.JSON(404, gin.H{"error": "Price not found for symbol: " + symbol})
+	quote, err := h.quotes.Quote(c.Request.Context(), symbol)
+	if err != nil {
+		c.JSON(404, gin.H{"error": "Price not found for symbol: " + symbol})
+		return
+	}
+	
+	c.JSON(200, quote)
+}
+
+// GetPriceHistory returns daily closes for a symbol with a coverage report,
+// either the window most recent closes up to as_of (default 250 up to today)
+// or every close between from and to (YYYY-MM-DD)
+func (h *PortfolioHandler) GetPriceHistory(c *gin.Context) {
+	query := service.HistoryQuery{Symbol: strings.ToUpper(c.Param("symbol"))}
+	
+	dates := map[string]*time.Time{"as_of": &query.AsOf, "from": &query.From, "to": &query.To}
+	for name, target := range dates {
+		value := c.Query(name)
+		if value == "" {
+			continue
+		}
+		date, err := time.Parse("2006-01-02", value)
+		if err != nil {
+			c.JSON(400, gin.H{"error": "invalid " + name + " date, expected YYYY-MM-DD"})
+			return
+		}
+		*target = date
+	}
+	// End dates include every close on the date itself
+	if !query.AsOf.IsZero() {
+		query.AsOf = query.AsOf.Add(24*time.Hour - time.Nanosecond)
+	}
+	if !query.To.IsZero() {
+		query.To = query.To.Add(24*time.Hour - time.Nanosecond)
+	}
+	
+	if query.From.IsZero() {
+		query.Days = 250
+		if window := c.Query("window"); window != "" {
+			days, err := strconv.Atoi(window)
+			if err != nil || days <= 0 {
+				c.JSON(400, gin.H{"error": "invalid window"})
+				return
+			}
+			query.Days = days
+		}
+	}
+	
+	prices, coverage, err := h.prices.Query(c.Request.Context(), query)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to load prices: " + err.Error()})
+		return
+	}
+	
+	bars := make([]domain.PriceBar, len(prices))
+	for i, p := range prices {
+		bars[i] = domain.PriceBar{Date: p.Date, Close: p.Close}
+	}
+	c.JSON(200, domain.PriceHistoryResponse{
+		Symbol:   query.Symbol,
+		Prices:   bars,
+		Coverage: *coverage,
+	})
+}
+
+// GetCorporateActions returns the stored splits and dividends of a symbol
+func (h *PortfolioHandler) GetCorporateActions(c *gin.Context) {
+	actions, err := h.actions.List(strings.ToUpper(c.Param("symbol")))
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to load corporate actions: " + err.Error()})
+		return
+	}
+
+	c.JSON(200, actions)
+}
+
+// SyncCorporateActions fetches recent splits and dividends from the providers
+func (h *PortfolioHandler) SyncCorporateActions(c *gin.Context) {
+	var req domain.CorporateActionSyncRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	days := req.Days
+	if days == 0 {
+		days = 1825
+	}
+
+	response := domain.CorporateActionSyncResponse{
+		Synced: make(map[string]int),
+		Errors: make(map[string]string),
+	}
+	for _, symbol := range req.Symbols {
+		symbol = strings.ToUpper(strings.TrimSpace(symbol))
+		count, err := h.actions.Sync(c.Request.Context(), symbol, days)
+		if err != nil {
+			response.Errors[symbol] = err.Error()
+			continue
+		}
+		response.Synced[symbol] = count
+	}
+
+	c.JSON(200, response)
+}
+
+// GetProviders reports the health of the market data providers
+func (h *PortfolioHandler) GetProviders(c *gin.Context) {
+	c.JSON(200, h.quotes.Market().Health())
+}
+
+// maxLatestPriceSymbols caps the symbols of one latest prices request, as
+// each may call the providers
+const maxLatestPriceSymbols = 100
+
+// GetLatestPrices returns latest quotes for a comma-separated symbols list
+func (h *PortfolioHandler) GetLatestPrices(c *gin.Context) {
+	var symbols []string
+	seen := make(map[string]bool)
+	for _, symbol := range strings.Split(c.Query("symbols"), ",") {
+		symbol = strings.ToUpper(strings.TrimSpace(symbol))
+		if symbol != "" && !seen[symbol] {
+			seen[symbol] = true
+			symbols = append(symbols, symbol)
+		}
+	}
+	if len(symbols) == 0 {
+		c.JSON(400, gin.H{"error": "symbols required"})
+		return
+	}
+	if len(symbols) > maxLatestPriceSymbols {
+		c.JSON(400, gin.H{"error": fmt.Sprintf("at most %d symbols per request", maxLatestPriceSymbols)})
+		return
+	}
+	
+	quotes, errs := h.quotes.Quotes(c.Request.Context(), symbols)
+	c.JSON(200, domain.PriceQuotesResponse{
+		Quotes: quotes,
+		Errors: errs,
+	})
 }
 
 func (h *PortfolioHandler) UpdatePortfolio(c *gin.Context) {
@@ -198,8 +442,10 @@ func (h *PortfolioHandler) UpdatePortfolio(c *gin.Context) {
 	}
 	
 	var req struct {
-		Name        string `json:"name"`
-		Description string `json:"description"`
+		Name         string `json:"name"`
+		Description  string `json:"description"`
+		BaseCurrency string `json:"base_currency"`
+		CostMethod   string `json:"cost_method"`
 	}
 	
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -219,11 +465,36 @@ func (h *PortfolioHandler) UpdatePortfolio(c *gin.Context) {
 	if req.Description != "" {
 		portfolio.Description = req.Description
 	}
+	if req.BaseCurrency != "" {
+		baseCurrency, err := service.NormalizeCurrency(req.BaseCurrency)
+		if err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		portfolio.BaseCurrency = baseCurrency
+	}
+	costMethodChanged := false
+	if req.CostMethod != "" {
+		costMethod, err := service.NormalizeCostMethod(req.CostMethod)
+		if err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		costMethodChanged = costMethod != portfolio.CostMethod
+		portfolio.CostMethod = costMethod
+	}
 	
 	if err := h.db.Save(&portfolio).Error; err != nil {
 		c.JSON(500, gin.H{"error": err.Error()})
 		return
 	}
+	if costMethodChanged {
+		// Average prices of positions derived from a ledger depend on the method
+		if err := h.ledger.SyncPositions(portfolioID); err != nil {
+			c.JSON(500, gin.H{"error": "Failed to update positions: " + err.Error()})
+			return
+		}
+	}
 	
 	c.JSON(200, portfolio)
 }
@@ -238,6 +509,9 @@ func (h *PortfolioHandler) DeletePortfolio(c *gin.Context) {
 	
 	// Delete positions first (cascade)
 	h.db.Where("portfolio_id = ?", portfolioID).Delete(&domain.Position{})
+	h.db.Where("portfolio_id = ?", portfolioID).Delete(&domain.Transaction{})
+	h.db.Where("portfolio_id = ?", portfolioID).Delete(&domain.RiskSnapshot{})
+	h.db.Where("portfolio_id = ?", portfolioID).Delete(&domain.RiskLimit{})
 	
 	// Delete portfolio
 	if err := h.db.Delete(&domain.Portfolio{}, "id = ?", portfolioID).Error; err != nil {
@@ -263,6 +537,9 @@ func (h *PortfolioHandler) UpdatePosition(c *gin.Context) {
 		c.JSON(400, gin.H{"error": "invalid position id"})
 		return
 	}
+	if h.derivedPositions(c, portfolioID) {
+		return
+	}
 	
 	var req struct {
 		Quantity float64 `json:"quantity"`
@@ -283,15 +560,10 @@ func (h *PortfolioHandler) UpdatePosition(c *gin.Context) {
 	
 	// Update asset if symbol changed
 	if req.Symbol != "" {
-		var asset domain.Asset
-		if err := h.db.Where("symbol = ?", req.Symbol).First(&asset).Error; err != nil {
-			asset = domain.Asset{
-				Symbol:   req.Symbol,
-				Name:     req.Symbol,
-				Class:    "Unknown",
-				Currency: "USD",
-			}
-			h.db.Create(&asset)
+		asset, err := service.ResolveAsset(h.db, req.Symbol)
+		if err != nil {
+			c.JSON(500, gin.H{"error": "Failed to update position: " + err.Error()})
+			return
 		}
 		position.AssetID = asset.ID
 	}
@@ -327,6 +599,9 @@ func (h *PortfolioHandler) DeletePosition(c *gin.Context) {
 		c.JSON(400, gin.H{"error": "invalid position id: " + positionIDStr})
 		return
 	}
+	if h.derivedPositions(c, portfolioID) {
+		return
+	}
 	
 	// Check if position exists
 	var position domain.Position
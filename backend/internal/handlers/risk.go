@@ -1,22 +1,40 @@
 package handlers
 
 import (
+	"context"
+	"time"
+
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"gorm.io/gorm"
 
+	"github.com/reserveone/saa-risk-analyzer/internal/config"
 	"github.com/reserveone/saa-risk-analyzer/internal/domain"
+	"github.com/reserveone/saa-risk-analyzer/internal/jobs"
+	riskmath "github.com/reserveone/saa-risk-analyzer/internal/math"
 	"github.com/reserveone/saa-risk-analyzer/internal/service"
 )
 
 type RiskHandler struct {
 	riskService *service.RiskService
+	queue       *jobs.Queue
 }
 
-func NewRiskHandler(db *gorm.DB) *RiskHandler {
-	return &RiskHandler{
-		riskService: service.NewRiskService(db),
+func NewRiskHandler(db *gorm.DB, perf config.PerfConfig, quotes *service.LatestPriceService, queue *jobs.Queue, limits *service.LimitService) *RiskHandler {
+	h := &RiskHandler{
+		riskService: service.NewRiskServiceWithLimits(db, perf, quotes, limits),
+		queue:       queue,
 	}
+
+	// Job functions for the async endpoints
+	queue.Register(jobs.TypeVaR, jobs.Typed(h.calculateVaR))
+	queue.Register(jobs.TypeCVaR, jobs.Typed(h.calculateCVaR))
+	queue.Register(jobs.TypeStress, jobs.Typed(h.riskService.RunStressTest))
+	queue.Register(jobs.TypePCA, jobs.Typed(h.riskService.CalculatePCA))
+	queue.Register(jobs.TypeBacktest, jobs.Typed(h.riskService.BacktestVaR))
+	queue.Register(jobs.TypeRiskContribution, jobs.Typed(h.riskService.CalculateRiskContributions))
+	queue.Register(jobs.TypeSnapshot, jobs.Typed(h.riskService.TakeSnapshot))
+	return h
 }
 
 func (h *RiskHandler) CalculateVaR(c *gin.Context) {
@@ -26,12 +44,7 @@ func (h *RiskHandler) CalculateVaR(c *gin.Context) {
 		return
 	}
 
-	result, err := h.riskService.CalculatePortfolioVaR(
-		req.PortfolioID,
-		req.Confidence,
-		req.HorizonDays,
-		250,
-	)
+	result, err := h.calculateVaR(c.Request.Context(), req)
 	if err != nil {
 		c.JSON(500, gin.H{"error": "Failed to calculate VaR: " + err.Error()})
 		return
@@ -40,6 +53,24 @@ func (h *RiskHandler) CalculateVaR(c *gin.Context) {
 	c.JSON(200, result)
 }
 
+func (h *RiskHandler) calculateVaR(ctx context.Context, req domain.VaRRequest) (*domain.VaRResponse, error) {
+	if req.Method == "monte_carlo" {
+		stats, err := h.riskService.CalculatePortfolioMonteCarlo(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		return &domain.VaRResponse{VaR: stats.VaR, MonteCarlo: stats, Adjustment: stats.Adjustment}, nil
+	}
+
+	return h.riskService.CalculatePortfolioVaR(ctx,
+		req.PortfolioID,
+		req.Confidence,
+		req.HorizonDays,
+		250,
+		req.Adjustment,
+	)
+}
+
 func (h *RiskHandler) CalculateCVaR(c *gin.Context) {
 	var req domain.VaRRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -47,36 +78,150 @@ func (h *RiskHandler) CalculateCVaR(c *gin.Context) {
 		return
 	}
 
-	result, err := h.riskService.CalculatePortfolioCVaR(
+	result, err := h.calculateCVaR(c.Request.Context(), req)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to calculate CVaR: " + err.Error()})
+		return
+	}
+
+	c.JSON(200, result)
+}
+
+func (h *RiskHandler) calculateCVaR(ctx context.Context, req domain.VaRRequest) (*domain.CVaRResponse, error) {
+	if req.Method == "monte_carlo" {
+		stats, err := h.riskService.CalculatePortfolioMonteCarlo(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		return &domain.CVaRResponse{CVaR: stats.ES, MonteCarlo: stats, Adjustment: stats.Adjustment}, nil
+	}
+
+	return h.riskService.CalculatePortfolioCVaR(ctx,
 		req.PortfolioID,
 		req.Confidence,
 		req.HorizonDays,
 		250,
+		req.Adjustment,
 	)
+}
+
+func (h *RiskHandler) CalculateCorrelation(c *gin.Context) {
+	var req domain.CorrelationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	result, err := h.riskService.CalculateCorrelations(c.Request.Context(), req.Symbols, req.WindowDays, req.Adjustment)
 	if err != nil {
-		c.JSON(500, gin.H{"error": "Failed to calculate CVaR: " + err.Error()})
+		c.JSON(500, gin.H{"error": "Failed to calculate correlations: " + err.Error()})
 		return
 	}
 
 	c.JSON(200, result)
 }
 
-func (h *RiskHandler) CalculateCorrelation(c *gin.Context) {
-	var req domain.CorrelationRequest
+func (h *RiskHandler) RunStressTest(c *gin.Context) {
+	var req domain.StressTestRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(400, gin.H{"error": err.Error()})
 		return
 	}
 
-	result, err := h.riskService.CalculateCorrelations(req.Symbols, req.WindowDays)
+	result, err := h.riskService.RunStressTest(c.Request.Context(), req)
 	if err != nil {
-		c.JSON(500, gin.H{"error": "Failed to calculate correlations: " + err.Error()})
+		c.JSON(500, gin.H{"error": "Failed to run stress test: " + err.Error()})
 		return
 	}
 
 	c.JSON(200, result)
 }
 
+func (h *RiskHandler) RunReverseStressTest(c *gin.Context) {
+	var req domain.ReverseStressRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	result, err := h.riskService.RunReverseStressTest(c.Request.Context(), req)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to run reverse stress test: " + err.Error()})
+		return
+	}
+
+	c.JSON(200, result)
+}
+
+func (h *RiskHandler) SimulatePaths(c *gin.Context) {
+	var req domain.PathSimulationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	result, err := h.riskService.SimulatePortfolioPaths(c.Request.Context(), req)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to simulate paths: " + err.Error()})
+		return
+	}
+
+	c.JSON(200, result)
+}
+
+func (h *RiskHandler) CalculatePCA(c *gin.Context) {
+	var req domain.PCARequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	result, err := h.riskService.CalculatePCA(c.Request.Context(), req)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to calculate PCA: " + err.Error()})
+		return
+	}
+
+	c.JSON(200, result)
+}
+
+func (h *RiskHandler) BacktestVaR(c *gin.Context) {
+	var req domain.BacktestVaRRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	result, err := h.riskService.BacktestVaR(c.Request.Context(), req)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to backtest VaR: " + err.Error()})
+		return
+	}
+
+	c.JSON(200, result)
+}
+
+func (h *RiskHandler) CalculateRiskContribution(c *gin.Context) {
+	var req domain.RiskContributionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	result, err := h.riskService.CalculateRiskContributions(c.Request.Context(), req)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to calculate risk contributions: " + err.Error()})
+		return
+	}
+
+	c.JSON(200, result)
+}
+
+// GetCacheStats reports how often risk results were reused
+func (h *RiskHandler) GetCacheStats(c *gin.Context) {
+	c.JSON(200, h.riskService.CacheStats())
+}
+
 func (h *RiskHandler) GetRealDashboard(c *gin.Context) {
 	portfolioIDStr := c.Query("portfolio_id")
 	if portfolioIDStr == "" {
@@ -90,6 +235,12 @@ func (h *RiskHandler) GetRealDashboard(c *gin.Context) {
 		return
 	}
 
+	adjustment, err := riskmath.NormalizeAdjustment(c.Query("adjustment"))
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
 	// Get portfolio with positions
 	var portfolio domain.Portfolio
 	if err := h.riskService.GetDB().Preload("Positions.Asset").First(&portfolio, "id = ?", portfolioID).Error; err != nil {
@@ -98,50 +249,52 @@ func (h *RiskHandler) GetRealDashboard(c *gin.Context) {
 	}
 
 	// Calculate VaR
-	varResult, err := h.riskService.CalculatePortfolioVaR(portfolioID, 0.99, 1, 250)
+	varResult, err := h.riskService.CalculatePortfolioVaR(c.Request.Context(), portfolioID, 0.99, 1, 250, adjustment)
 	var var1d float64 = 0
 	if err == nil && varResult != nil {
 		var1d = varResult.VaR
 	}
 
 	// Calculate CVaR
-	cvarResult, err2 := h.riskService.CalculatePortfolioCVaR(portfolioID, 0.99, 1, 250)
+	cvarResult, err2 := h.riskService.CalculatePortfolioCVaR(c.Request.Context(), portfolioID, 0.99, 1, 250, adjustment)
 	var cvar1d float64 = 0
 	if err2 == nil && cvarResult != nil {
 		cvar1d = cvarResult.CVaR
 	}
 
-	// Calculate portfolio value and contributors based on PURCHASE VALUE (as in original)
-	totalValue := 0.0
-	for _, pos := range portfolio.Positions {
-		totalValue += pos.Quantity * pos.AvgPrice
+	// Value the portfolio and its contributors at market prices
+	valuation, err := h.riskService.ValuePortfolio(c.Request.Context(), &portfolio, time.Now())
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to value portfolio: " + err.Error()})
+		return
 	}
 	
-	// Build contributors from PURCHASE VALUE (as shown in screenshot)
 	contributors := []gin.H{}
-	for _, pos := range portfolio.Positions {
-		marketValue := pos.Quantity * pos.AvgPrice
-		contribution := marketValue / totalValue
+	for _, pos := range valuation.Positions {
 		contributors = append(contributors, gin.H{
-			"symbol":       pos.Asset.Symbol,
-			"contribution": contribution,
+			"symbol":       pos.Symbol,
+			"contribution": pos.Weight,
 		})
 	}
 	
 	// Calculate portfolio volatility from actual returns
-	vol, err3 := h.riskService.CalculatePortfolioVolatility(portfolioID, 250)
+	vol, err3 := h.riskService.CalculatePortfolioVolatility(c.Request.Context(), portfolioID, 250, adjustment)
 	if err3 != nil {
 		// If calculation fails, use default or try with fewer days
-		vol, _ = h.riskService.CalculatePortfolioVolatility(portfolioID, 30)
+		vol, _ = h.riskService.CalculatePortfolioVolatility(c.Request.Context(), portfolioID, 30, adjustment)
 		if vol == 0 {
 			vol = 0.154 // Fallback to default if still fails
 		}
 	}
 
 	c.JSON(200, gin.H{
-		"var_1d":       var1d,
-		"cvar_1d":      cvar1d,
-		"vol":          vol,
-		"contributors": contributors,
+		"var_1d":         var1d,
+		"cvar_1d":        cvar1d,
+		"vol":            vol,
+		"contributors":   contributors,
+		"nav":            valuation.NAV,
+		"unrealized_pnl": valuation.UnrealizedPnL,
+		"currency":       valuation.BaseCurrency,
+		"adjustment":     adjustment,
 	})
 }
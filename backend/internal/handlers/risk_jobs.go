@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/reserveone/saa-risk-analyzer/internal/domain"
+	"github.com/reserveone/saa-risk-analyzer/internal/jobs"
+)
+
+const maxJobTimeoutSeconds = 24 * 60 * 60
+
+// The async variants of the risk endpoints validate the request, queue the
+// calculation as a job and answer 202 with the job ID; poll /api/jobs/:id
+// for the result, which has the body of the synchronous response. Jobs take
+// ?priority=high|normal|low and ?timeout= in seconds.
+
+func (h *RiskHandler) CalculateVaRAsync(c *gin.Context) {
+	var req domain.VaRRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	h.enqueue(c, jobs.TypeVaR, req, func(id uuid.UUID) interface{} {
+		return domain.VaRResponse{JobID: id}
+	})
+}
+
+func (h *RiskHandler) CalculateCVaRAsync(c *gin.Context) {
+	var req domain.VaRRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	h.enqueue(c, jobs.TypeCVaR, req, func(id uuid.UUID) interface{} {
+		return domain.CVaRResponse{JobID: id}
+	})
+}
+
+func (h *RiskHandler) RunStressTestAsync(c *gin.Context) {
+	var req domain.StressTestRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	h.enqueue(c, jobs.TypeStress, req, func(id uuid.UUID) interface{} {
+		return domain.StressTestResponse{JobID: id}
+	})
+}
+
+func (h *RiskHandler) CalculatePCAAsync(c *gin.Context) {
+	var req domain.PCARequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	h.enqueue(c, jobs.TypePCA, req, func(id uuid.UUID) interface{} {
+		return domain.PCAResponse{JobID: id}
+	})
+}
+
+func (h *RiskHandler) BacktestVaRAsync(c *gin.Context) {
+	var req domain.BacktestVaRRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	h.enqueue(c, jobs.TypeBacktest, req, func(id uuid.UUID) interface{} {
+		return domain.BacktestResult{JobID: id}
+	})
+}
+
+func (h *RiskHandler) CalculateRiskContributionAsync(c *gin.Context) {
+	var req domain.RiskContributionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	h.enqueue(c, jobs.TypeRiskContribution, req, func(id uuid.UUID) interface{} {
+		return domain.RiskContributionResponse{JobID: id}
+	})
+}
+
+// enqueue queues input as a job of jobType and responds with accepted, the
+// response DTO carrying the job ID. The job is stored with its input and
+// outlives the request; any API instance's workers may run it.
+func (h *RiskHandler) enqueue(c *gin.Context, jobType string, input interface{}, accepted func(id uuid.UUID) interface{}) {
+	opts, err := jobOptions(c)
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	job, err := h.queue.Enqueue(jobType, input, opts)
+	if errors.Is(err, jobs.ErrQueueFull) || errors.Is(err, jobs.ErrQueueClosed) {
+		c.JSON(503, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to queue job: " + err.Error()})
+		return
+	}
+
+	c.Header("Location", "/api/jobs/"+job.ID.String())
+	c.JSON(202, accepted(job.ID))
+}
+
+// jobOptions reads the ?priority= and ?timeout= (seconds) of a job request
+func jobOptions(c *gin.Context) (jobs.Options, error) {
+	priority, err := jobs.NormalizePriority(c.Query("priority"))
+	if err != nil {
+		return jobs.Options{}, err
+	}
+	opts := jobs.Options{Priority: priority}
+
+	if timeout := c.Query("timeout"); timeout != "" {
+		seconds, err := strconv.Atoi(timeout)
+		if err != nil || seconds <= 0 || seconds > maxJobTimeoutSeconds {
+			return opts, fmt.Errorf("invalid timeout, expected 1-%d seconds", maxJobTimeoutSeconds)
+		}
+		opts.Timeout = time.Duration(seconds) * time.Second
+	}
+	return opts, nil
+}
@@ -0,0 +1,202 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/reserveone/saa-risk-analyzer/internal/domain"
+	"github.com/reserveone/saa-risk-analyzer/internal/scheduler"
+)
+
+type ScheduleHandler struct {
+	scheduler *scheduler.Scheduler
+}
+
+func NewScheduleHandler(scheduler *scheduler.Scheduler) *ScheduleHandler {
+	return &ScheduleHandler{scheduler: scheduler}
+}
+
+func (h *ScheduleHandler) GetSchedules(c *gin.Context) {
+	schedules, err := h.scheduler.List()
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to load schedules: " + err.Error()})
+		return
+	}
+
+	c.JSON(200, schedules)
+}
+
+func (h *ScheduleHandler) GetSchedule(c *gin.Context) {
+	id, ok := scheduleID(c)
+	if !ok {
+		return
+	}
+
+	schedule, err := h.scheduler.Get(id)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(404, gin.H{"error": "schedule not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to load schedule: " + err.Error()})
+		return
+	}
+
+	c.JSON(200, schedule)
+}
+
+func (h *ScheduleHandler) CreateSchedule(c *gin.Context) {
+	req, ok := scheduleRequest(c)
+	if !ok {
+		return
+	}
+
+	schedule, err := h.scheduler.Create(req)
+	if errors.Is(err, scheduler.ErrInvalidSchedule) {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to create schedule: " + err.Error()})
+		return
+	}
+
+	c.JSON(200, schedule)
+}
+
+// UpdateSchedule replaces a schedule's definition; its next run is planned
+// afresh from now
+func (h *ScheduleHandler) UpdateSchedule(c *gin.Context) {
+	id, ok := scheduleID(c)
+	if !ok {
+		return
+	}
+	req, ok := scheduleRequest(c)
+	if !ok {
+		return
+	}
+
+	schedule, err := h.scheduler.Update(id, req)
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(404, gin.H{"error": "schedule not found"})
+		return
+	case errors.Is(err, scheduler.ErrInvalidSchedule):
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		c.JSON(500, gin.H{"error": "Failed to update schedule: " + err.Error()})
+		return
+	}
+
+	c.JSON(200, schedule)
+}
+
+// DeleteSchedule deletes a schedule and its run history; jobs it queued are
+// kept
+func (h *ScheduleHandler) DeleteSchedule(c *gin.Context) {
+	id, ok := scheduleID(c)
+	if !ok {
+		return
+	}
+
+	err := h.scheduler.Delete(id)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(404, gin.H{"error": "schedule not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to delete schedule: " + err.Error()})
+		return
+	}
+
+	c.JSON(200, gin.H{"message": "Schedule deleted"})
+}
+
+// RunSchedule queues a schedule's calculations now, enabled or not, and
+// returns the run with its job IDs
+func (h *ScheduleHandler) RunSchedule(c *gin.Context) {
+	id, ok := scheduleID(c)
+	if !ok {
+		return
+	}
+
+	run, err := h.scheduler.Trigger(id)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(404, gin.H{"error": "schedule not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to run schedule: " + err.Error()})
+		return
+	}
+
+	c.JSON(202, run)
+}
+
+// GetScheduleRuns returns a schedule's run history, newest first, limited by
+// ?limit= (default 50)
+func (h *ScheduleHandler) GetScheduleRuns(c *gin.Context) {
+	id, ok := scheduleID(c)
+	if !ok {
+		return
+	}
+	limit := 0
+	if value := c.Query("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 {
+			c.JSON(400, gin.H{"error": "invalid limit"})
+			return
+		}
+		limit = n
+	}
+
+	runs, err := h.scheduler.Runs(id, limit)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(404, gin.H{"error": "schedule not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to load schedule runs: " + err.Error()})
+		return
+	}
+
+	c.JSON(200, runs)
+}
+
+func scheduleID(c *gin.Context) (uuid.UUID, bool) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(400, gin.H{"error": "invalid schedule id"})
+		return uuid.Nil, false
+	}
+	return id, true
+}
+
+// scheduleRequest binds a schedule request and validates each calculation's
+// params as the calculation's own endpoint validates its request
+func scheduleRequest(c *gin.Context) (domain.ScheduleRequest, bool) {
+	var req domain.ScheduleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return req, false
+	}
+
+	for i, calc := range req.Calculations {
+		input, err := scheduler.Input(calc, uuid.New())
+		if err == nil {
+			err = binding.Validator.ValidateStruct(input)
+		}
+		if err != nil {
+			c.JSON(400, gin.H{"error": fmt.Sprintf("calculations[%d]: %v", i, err)})
+			return req, false
+		}
+	}
+	return req, true
+}
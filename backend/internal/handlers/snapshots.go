@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/reserveone/saa-risk-analyzer/internal/domain"
+	"github.com/reserveone/saa-risk-analyzer/internal/service"
+)
+
+// TakeSnapshot calculates the portfolio's risk now and stores it as today's
+// snapshot. The body is optional: confidence, horizon_days, window_days and
+// adjustment.
+func (h *RiskHandler) TakeSnapshot(c *gin.Context) {
+	portfolioID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(400, gin.H{"error": "invalid portfolio id"})
+		return
+	}
+
+	var req domain.SnapshotRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	req.PortfolioID = portfolioID
+	req.Source = service.SnapshotSourceManual
+
+	snapshot, err := h.riskService.TakeSnapshot(c.Request.Context(), req)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(404, gin.H{"error": "portfolio not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to take risk snapshot: " + err.Error()})
+		return
+	}
+
+	c.JSON(200, snapshot)
+}
+
+// GetSnapshots returns the portfolio's risk snapshots, oldest first, from the
+// from date to the to date (YYYY-MM-DD, both optional)
+func (h *RiskHandler) GetSnapshots(c *gin.Context) {
+	portfolioID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(400, gin.H{"error": "invalid portfolio id"})
+		return
+	}
+	from, ok := parseDate(c, "from", time.Time{})
+	if !ok {
+		return
+	}
+	to, ok := parseDate(c, "to", time.Time{})
+	if !ok {
+		return
+	}
+
+	snapshots, err := h.riskService.ListSnapshots(portfolioID, from, to)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to load risk snapshots: " + err.Error()})
+		return
+	}
+
+	c.JSON(200, snapshots)
+}
+
+// CompareSnapshots compares the latest snapshots on or before the from and to
+// dates (YYYY-MM-DD, to defaults to today) and attributes the change of VaR
+// to the positions
+func (h *RiskHandler) CompareSnapshots(c *gin.Context) {
+	portfolioID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(400, gin.H{"error": "invalid portfolio id"})
+		return
+	}
+	if c.Query("from") == "" {
+		c.JSON(400, gin.H{"error": "from date is required"})
+		return
+	}
+	from, ok := parseDate(c, "from", time.Time{})
+	if !ok {
+		return
+	}
+	to, ok := parseDate(c, "to", time.Now())
+	if !ok {
+		return
+	}
+	if to.Before(from) {
+		c.JSON(400, gin.H{"error": "to must not be before from"})
+		return
+	}
+
+	comparison, err := h.riskService.CompareSnapshots(portfolioID, from, to)
+	if errors.Is(err, service.ErrSnapshotNotFound) {
+		c.JSON(404, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to compare risk snapshots: " + err.Error()})
+		return
+	}
+
+	c.JSON(200, comparison)
+}
+
+// parseDate reads a YYYY-MM-DD query parameter, defaulting to fallback
+func parseDate(c *gin.Context, name string, fallback time.Time) (time.Time, bool) {
+	value := c.Query(name)
+	if value == "" {
+		return fallback, true
+	}
+	date, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		c.JSON(400, gin.H{"error": "invalid " + name + " date, expected YYYY-MM-DD"})
+		return time.Time{}, false
+	}
+	return date, true
+}
@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/reserveone/saa-risk-analyzer/internal/domain"
+	"github.com/reserveone/saa-risk-analyzer/internal/service"
+)
+
+type SymbolHandler struct {
+	symbols *service.SymbolService
+}
+
+func NewSymbolHandler(symbols *service.SymbolService) *SymbolHandler {
+	return &SymbolHandler{symbols: symbols}
+}
+
+// GetSymbols lists the symbol master, filtered by ?class= and searched by
+// ?q= on symbol, name, ISIN, CUSIP or FIGI
+func (h *SymbolHandler) GetSymbols(c *gin.Context) {
+	assets, err := h.symbols.List(c.Query("class"), strings.TrimSpace(c.Query("q")))
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to load symbols: " + err.Error()})
+		return
+	}
+
+	c.JSON(200, assets)
+}
+
+func (h *SymbolHandler) GetSymbol(c *gin.Context) {
+	asset, err := h.symbols.Get(strings.ToUpper(c.Param("symbol")))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(404, gin.H{"error": "symbol not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to load symbol: " + err.Error()})
+		return
+	}
+
+	c.JSON(200, asset)
+}
+
+func (h *SymbolHandler) CreateSymbol(c *gin.Context) {
+	var req domain.SymbolRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	if _, err := h.symbols.Get(strings.ToUpper(strings.TrimSpace(req.Symbol))); err == nil {
+		c.JSON(409, gin.H{"error": "symbol already exists"})
+		return
+	}
+
+	asset, err := h.symbols.Create(req)
+	if errors.Is(err, service.ErrInvalidSymbol) {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to create symbol: " + err.Error()})
+		return
+	}
+
+	c.JSON(200, asset)
+}
+
+// UpdateSymbol changes the non-empty fields of the request; a provider
+// mapped to an empty ticker is removed
+func (h *SymbolHandler) UpdateSymbol(c *gin.Context) {
+	var req domain.SymbolRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	asset, err := h.symbols.Update(strings.ToUpper(c.Param("symbol")), req)
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(404, gin.H{"error": "symbol not found"})
+		return
+	case errors.Is(err, service.ErrInvalidSymbol):
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		c.JSON(500, gin.H{"error": "Failed to update symbol: " + err.Error()})
+		return
+	}
+
+	c.JSON(200, asset)
+}
+
+func (h *SymbolHandler) DeleteSymbol(c *gin.Context) {
+	err := h.symbols.Delete(strings.ToUpper(c.Param("symbol")))
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(404, gin.H{"error": "symbol not found"})
+		return
+	case errors.Is(err, service.ErrSymbolInUse):
+		c.JSON(409, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		c.JSON(500, gin.H{"error": "Failed to delete symbol: " + err.Error()})
+		return
+	}
+
+	c.JSON(200, gin.H{"message": "symbol deleted"})
+}
@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"errors"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/reserveone/saa-risk-analyzer/internal/domain"
+	"github.com/reserveone/saa-risk-analyzer/internal/service"
+)
+
+type TransactionHandler struct {
+	ledger *service.LedgerService
+}
+
+func NewTransactionHandler(ledger *service.LedgerService) *TransactionHandler {
+	return &TransactionHandler{ledger: ledger}
+}
+
+// GetTransactions lists the portfolio's transactions in the order they apply,
+// from the from date to the to date (YYYY-MM-DD, both optional)
+func (h *TransactionHandler) GetTransactions(c *gin.Context) {
+	portfolioID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(400, gin.H{"error": "invalid portfolio id"})
+		return
+	}
+	from, ok := parseDate(c, "from", time.Time{})
+	if !ok {
+		return
+	}
+	to, ok := parseDate(c, "to", time.Time{})
+	if !ok {
+		return
+	}
+
+	transactions, err := h.ledger.Transactions(portfolioID, from, to)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to load transactions: " + err.Error()})
+		return
+	}
+
+	c.JSON(200, transactions)
+}
+
+// CreateTransaction records a transaction and updates the portfolio's
+// positions from its ledger
+func (h *TransactionHandler) CreateTransaction(c *gin.Context) {
+	portfolioID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(400, gin.H{"error": "invalid portfolio id"})
+		return
+	}
+
+	var req domain.TransactionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	transaction, err := h.ledger.Record(portfolioID, req)
+	if !respondLedgerError(c, err, "portfolio not found", "Failed to record transaction: ") {
+		return
+	}
+
+	c.JSON(201, transaction)
+}
+
+// DeleteTransaction removes a transaction and updates the portfolio's
+// positions from its ledger
+func (h *TransactionHandler) DeleteTransaction(c *gin.Context) {
+	portfolioID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(400, gin.H{"error": "invalid portfolio id"})
+		return
+	}
+	transactionID, err := uuid.Parse(c.Param("transaction_id"))
+	if err != nil {
+		c.JSON(400, gin.H{"error": "invalid transaction id"})
+		return
+	}
+
+	err = h.ledger.Delete(portfolioID, transactionID)
+	if !respondLedgerError(c, err, "transaction not found", "Failed to delete transaction: ") {
+		return
+	}
+
+	c.JSON(200, gin.H{"message": "transaction deleted"})
+}
+
+// GetLedger returns the portfolio's holdings, tax lots and realized P&L as of
+// the as_of date (YYYY-MM-DD, default today), matching sales to lots with the
+// method query parameter (fifo, lifo, average; default the portfolio's)
+func (h *TransactionHandler) GetLedger(c *gin.Context) {
+	portfolioID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(400, gin.H{"error": "invalid portfolio id"})
+		return
+	}
+	asOf, ok := parseAsOf(c)
+	if !ok {
+		return
+	}
+
+	ledger, err := h.ledger.Ledger(portfolioID, asOf, c.Query("method"))
+	if !respondLedgerError(c, err, "portfolio not found", "Failed to build ledger: ") {
+		return
+	}
+
+	c.JSON(200, ledger)
+}
+
+// respondLedgerError responds to a ledger error and reports whether there
+// was none
+func respondLedgerError(c *gin.Context, err error, notFound, failed string) bool {
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, service.ErrInvalidTransaction), errors.Is(err, service.ErrBeforeOpeningBalances):
+		c.JSON(400, gin.H{"error": err.Error()})
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(404, gin.H{"error": notFound})
+	default:
+		c.JSON(500, gin.H{"error": failed + err.Error()})
+	}
+	return false
+}
@@ -0,0 +1,150 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/reserveone/saa-risk-analyzer/internal/domain"
+)
+
+// Job event types
+const (
+	EventStatus   = "status"   // the job was queued, started or finished
+	EventProgress = "progress" // the job reported progress
+)
+
+// publish stores an event with the job's current state and wakes this
+// process's subscribers to the job. Subscribers in other processes find it
+// when they next poll the store.
+func (q *Queue) publish(job *domain.Job, eventType string) {
+	event := &domain.JobEvent{
+		JobID:    job.ID,
+		Type:     eventType,
+		Status:   job.Status,
+		Progress: job.Progress,
+		Stage:    job.Stage,
+		Error:    job.Error,
+	}
+	if job.Status == StatusSucceeded {
+		event.Result = job.Result
+	}
+	if err := q.store.AddEvent(event); err != nil {
+		fmt.Printf("Warning: failed to store event of job %s: %v\n", job.ID, err)
+	}
+
+	q.mu.Lock()
+	for notify := range q.watch[job.ID] {
+		select {
+		case notify <- struct{}{}:
+		default:
+		}
+	}
+	q.mu.Unlock()
+}
+
+// Subscribe streams the events of a job after the event ID after, 0 for all
+// of them. The channel is closed after the event with the job's final
+// status, or once ctx is done or the queue closed. Every subscriber reads
+// the stream on its own, so any number may follow the same job.
+func (q *Queue) Subscribe(ctx context.Context, jobID uuid.UUID, after uint64) (<-chan domain.JobEvent, error) {
+	if _, err := q.store.Get(jobID); err != nil {
+		return nil, err
+	}
+
+	notify := make(chan struct{}, 1)
+	q.mu.Lock()
+	if q.watch[jobID] == nil {
+		q.watch[jobID] = make(map[chan struct{}]struct{})
+	}
+	q.watch[jobID][notify] = struct{}{}
+	q.mu.Unlock()
+
+	events := make(chan domain.JobEvent)
+	go func() {
+		defer close(events)
+		defer func() {
+			q.mu.Lock()
+			delete(q.watch[jobID], notify)
+			if len(q.watch[jobID]) == 0 {
+				delete(q.watch, jobID)
+			}
+			q.mu.Unlock()
+		}()
+
+		send := func(event domain.JobEvent) bool {
+			select {
+			case events <- event:
+				return true
+			case <-ctx.Done():
+				return false
+			case <-q.done:
+				return false
+			}
+		}
+
+		poll := time.NewTicker(q.cfg.PollInterval)
+		defer poll.Stop()
+		for {
+			// Load the job before its events: once it has finished, its
+			// final event is stored
+			job, err := q.store.Get(jobID)
+			if err != nil {
+				fmt.Printf("Warning: failed to load job %s: %v\n", jobID, err)
+			}
+			stored, err := q.store.Events(jobID, after)
+			if err != nil {
+				fmt.Printf("Warning: failed to load events of job %s: %v\n", jobID, err)
+			}
+			for _, event := range stored {
+				if !send(event) {
+					return
+				}
+				after = event.ID
+				if event.Type == EventStatus && finished(event.Status) {
+					return
+				}
+			}
+			if job != nil && finished(job.Status) {
+				if after > 0 && q.finalEventStored(jobID) {
+					return // resumed after the final event
+				}
+				// Finished without a stored final event, e.g. failed when its
+				// worker was lost
+				send(domain.JobEvent{
+					JobID:     job.ID,
+					Type:      EventStatus,
+					Status:    job.Status,
+					Progress:  job.Progress,
+					Result:    job.Result,
+					Error:     job.Error,
+					CreatedAt: job.UpdatedAt,
+				})
+				return
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-q.done:
+				return
+			case <-notify:
+			case <-poll.C:
+			}
+		}
+	}()
+	return events, nil
+}
+
+// finalEventStored reports whether a job's last stored event has a final
+// status
+func (q *Queue) finalEventStored(jobID uuid.UUID) bool {
+	events, err := q.store.Events(jobID, 0)
+	if err != nil || len(events) == 0 {
+		return false
+	}
+	last := events[len(events)-1]
+	return last.Type == EventStatus && finished(last.Status)
+}
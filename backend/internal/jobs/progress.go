@@ -0,0 +1,30 @@
+package jobs
+
+import "context"
+
+// Progress is a job's progress report
+type Progress struct {
+	Percent int    // 0-99; 100 is reserved for success
+	Stage   string // what the job is doing, e.g. "loading prices"
+}
+
+type progressKey struct{}
+
+// WithProgress returns a context whose ReportProgress calls send on progress
+func WithProgress(ctx context.Context, progress chan<- Progress) context.Context {
+	return context.WithValue(ctx, progressKey{}, progress)
+}
+
+// ReportProgress reports the progress of the job computing under ctx. It does
+// nothing outside a job, so calculations report progress whether or not they
+// run as one.
+func ReportProgress(ctx context.Context, percent int, stage string) {
+	progress, ok := ctx.Value(progressKey{}).(chan<- Progress)
+	if !ok {
+		return
+	}
+	select {
+	case progress <- Progress{Percent: percent, Stage: stage}:
+	case <-ctx.Done():
+	}
+}
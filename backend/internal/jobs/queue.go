@@ -2,119 +2,500 @@ package jobs
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"os"
 	"sync"
-	
+	"time"
+
 	"github.com/google/uuid"
 	"gorm.io/gorm"
-	
+
 	"github.com/reserveone/saa-risk-analyzer/internal/domain"
 )
 
+const (
+	defaultWorkers           = 4
+	defaultMaxAttempts       = 3
+	defaultHeartbeatInterval = 10 * time.Second
+	defaultRetryBackoff      = 30 * time.Second
+	defaultPollInterval      = time.Second
+	maxRetryBackoff          = time.Hour
+	// staleHeartbeats is the number of missed heartbeats after which a
+	// running job's worker is presumed lost
+	staleHeartbeats = 3
+)
+
+var (
+	// ErrQueueFull is returned by Enqueue and NewJob when MaxPending jobs are
+	// waiting
+	ErrQueueFull = errors.New("job queue is full")
+	// ErrQueueClosed is returned by Enqueue and NewJob after Close
+	ErrQueueClosed = errors.New("job queue is closed")
+	// ErrJobFinished is returned when cancelling a job that has finished
+	ErrJobFinished = errors.New("job has already finished")
+)
+
+// Config sizes the queue
+type Config struct {
+	Workers           int           // jobs run concurrently by this process, default 4
+	Timeout           time.Duration // default per-job timeout, 0 is none
+	MaxPending        int           // queued jobs beyond which Enqueue fails, 0 is unlimited
+	MaxAttempts       int           // claims of a job before a lost worker fails it, default 3
+	HeartbeatInterval time.Duration // default 10s; jobs missing 3 heartbeats are requeued
+	RetryBackoff      time.Duration // delay before a requeued job runs again, doubled per attempt, default 30s
+	PollInterval      time.Duration // how often idle workers look for jobs, default 1s
+}
+
+// Options tune a single job
+type Options struct {
+	Priority string        // high, normal (default), low
+	Timeout  time.Duration // overrides the queue's default timeout
+}
+
+// Queue runs jobs stored in a Store on a fixed pool of workers. Workers take
+// the oldest runnable job of the highest priority lane. Jobs survive
+// restarts: running jobs heartbeat, and those whose worker stops
+// heartbeating are requeued with backoff, by this or any other process
+// sharing the store.
 type Queue struct {
-	db       *gorm.DB
-	mu       sync.RWMutex
-	jobs     map[uuid.UUID]*JobExecution
-	progress map[uuid.UUID]chan int
+	store    Store
+	cfg      Config
+	worker   string // identifies this process's workers in the store
+	handlers map[string]JobFunc
+
+	mu      sync.Mutex
+	running map[uuid.UUID]*JobExecution
+	watch   map[uuid.UUID]map[chan struct{}]struct{} // local subscribers by job
+	started bool
+	closed  bool
+
+	wake    chan struct{}
+	done    chan struct{}
+	workers sync.WaitGroup
 }
 
 type JobExecution struct {
 	Job    *domain.Job
 	Func   JobFunc
 	Cancel context.CancelFunc
+
+	cancelled bool // cancellation requested
+}
+
+func NewQueue(db *gorm.DB, cfg Config) *Queue {
+	return NewQueueWithStore(NewGormStore(db), cfg)
 }
 
-func NewQueue(db *gorm.DB) *Queue {
+// NewQueueWithStore returns a queue of jobs persisted in store. Register the
+// job types, then Start the workers.
+func NewQueueWithStore(store Store, cfg Config) *Queue {
+	if cfg.Workers <= 0 {
+		cfg.Workers = defaultWorkers
+	}
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = defaultMaxAttempts
+	}
+	if cfg.HeartbeatInterval <= 0 {
+		cfg.HeartbeatInterval = defaultHeartbeatInterval
+	}
+	if cfg.RetryBackoff <= 0 {
+		cfg.RetryBackoff = defaultRetryBackoff
+	}
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = defaultPollInterval
+	}
+
+	host, _ := os.Hostname()
 	return &Queue{
-		db:       db,
-		jobs:     make(map[uuid.UUID]*JobExecution),
-		progress: make(map[uuid.UUID]chan int),
+		store:    store,
+		cfg:      cfg,
+		worker:   fmt.Sprintf("%s-%d-%s", host, os.Getpid(), uuid.New().String()[:8]),
+		handlers: make(map[string]JobFunc),
+		running:  make(map[uuid.UUID]*JobExecution),
+		watch:    make(map[uuid.UUID]map[chan struct{}]struct{}),
+		wake:     make(chan struct{}, cfg.Workers),
+		done:     make(chan struct{}),
 	}
 }
 
-func (q *Queue) Enqueue(jobType string, fn JobFunc) (*domain.Job, error) {
-	job := &domain.Job{
-		ID:       uuid.New(),
-		Type:     jobType,
-		Status:   StatusQueued,
-		Progress: 0,
+// Register sets the function computing jobs of jobType. Register every type
+// before Start.
+func (q *Queue) Register(jobType string, fn JobFunc) {
+	q.handlers[jobType] = fn
+}
+
+// Start launches the workers, the heartbeat and the requeueing of jobs whose
+// worker was lost
+func (q *Queue) Start() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.started || q.closed {
+		return
+	}
+	q.started = true
+
+	q.workers.Add(q.cfg.Workers + 1)
+	for i := 0; i < q.cfg.Workers; i++ {
+		go q.work()
+	}
+	go q.maintain()
+}
+
+// Recover requeues the jobs whose worker stopped heartbeating, such as those
+// a previous process left running
+func (q *Queue) Recover() error {
+	now := time.Now()
+	requeued, failed, err := q.store.RequeueStale(now.Add(-q.staleAfter()), now, q.backoff)
+	if err != nil {
+		return err
+	}
+	if requeued > 0 || failed > 0 {
+		fmt.Printf("Warning: requeued %d and failed %d jobs whose worker was lost\n", requeued, failed)
+	}
+	return nil
+}
+
+func (q *Queue) staleAfter() time.Duration {
+	return staleHeartbeats * q.cfg.HeartbeatInterval
+}
+
+// backoff returns the delay before a job that was lost attempts times runs
+// again
+func (q *Queue) backoff(attempts int) time.Duration {
+	delay := q.cfg.RetryBackoff
+	for i := 1; i < attempts && delay < maxRetryBackoff; i++ {
+		delay *= 2
+	}
+	if delay > maxRetryBackoff {
+		delay = maxRetryBackoff
 	}
-	
-	if err := q.db.Create(job).Error; err != nil {
+	return delay
+}
+
+// Enqueue stores a job of jobType computing input
+func (q *Queue) Enqueue(jobType string, input interface{}, opts Options) (*domain.Job, error) {
+	job, err := q.NewJob(jobType, input, opts)
+	if err != nil {
 		return nil, err
 	}
-	
-	progressChan := make(chan int, 100)
-	
-	q.mu.Lock()
-	q.jobs[job.ID] = &JobExecution{
-		Job:  job,
-		Func: fn,
+	if err := q.store.Create(job); err != nil {
+		return nil, err
 	}
-	q.progress[job.ID] = progressChan
+	q.Queued(job)
+	return job, nil
+}
+
+// NewJob returns a queued job of jobType computing input, without storing
+// it. Callers that store jobs in their own transaction, next to other rows,
+// create it there and call Queued once the transaction commits.
+func (q *Queue) NewJob(jobType string, input interface{}, opts Options) (*domain.Job, error) {
+	if _, ok := q.handlers[jobType]; !ok {
+		return nil, fmt.Errorf("unknown job type %q", jobType)
+	}
+	priority, err := NormalizePriority(opts.Priority)
+	if err != nil {
+		return nil, err
+	}
+	timeout := opts.Timeout
+	if timeout <= 0 {
+		timeout = q.cfg.Timeout
+	}
+	// Timeouts are stored in whole seconds; round up rather than drop them
+	timeoutSeconds := int((timeout + time.Second - 1) / time.Second)
+	data, err := json.Marshal(input)
+	if err != nil {
+		return nil, fmt.Errorf("invalid job input: %w", err)
+	}
+
+	q.mu.Lock()
+	closed := q.closed
 	q.mu.Unlock()
-	
-	go q.executeJob(job.ID)
-	
+	if closed {
+		return nil, ErrQueueClosed
+	}
+	if q.cfg.MaxPending > 0 {
+		pending, err := q.store.Pending()
+		if err != nil {
+			return nil, err
+		}
+		if pending >= int64(q.cfg.MaxPending) {
+			return nil, ErrQueueFull
+		}
+	}
+
+	job := &domain.Job{
+		ID:             uuid.New(),
+		Type:           jobType,
+		Status:         StatusQueued,
+		Priority:       priority,
+		TimeoutSeconds: timeoutSeconds,
+		Input:          data,
+		MaxAttempts:    q.cfg.MaxAttempts,
+		RunAfter:       time.Now(),
+	}
 	return job, nil
 }
 
-func (q *Queue) executeJob(jobID uuid.UUID) {
-	q.mu.RLock()
-	exec, ok := q.jobs[jobID]
-	progressChan := q.progress[jobID]
-	q.mu.RUnlock()
-	
+// Queued announces stored jobs: it records their queued event and wakes idle
+// workers rather than leave the jobs to their next poll
+func (q *Queue) Queued(jobs ...*domain.Job) {
+	for _, job := range jobs {
+		q.publish(job, EventStatus)
+		select {
+		case q.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Cancel cancels a job. A queued job is cancelled at once and Cancel returns
+// StatusCancelled; a running job, here or in another process, has its
+// context cancelled and Cancel returns StatusRunning, the job turning
+// cancelled when its function returns.
+func (q *Queue) Cancel(jobID uuid.UUID) (string, error) {
+	status, err := q.store.Cancel(jobID, time.Now())
+	if err != nil {
+		return status, err
+	}
+	if status == StatusCancelled {
+		q.publish(&domain.Job{ID: jobID, Status: status, Error: "cancelled"}, EventStatus)
+		return status, nil
+	}
+
+	// Running here: cancel now rather than at the next heartbeat
+	q.mu.Lock()
+	if exec, ok := q.running[jobID]; ok {
+		exec.cancelled = true
+		exec.Cancel()
+	}
+	q.mu.Unlock()
+	return status, nil
+}
+
+// Close stops the workers and waits for them to return. Running jobs are
+// cancelled and queued again for the next process.
+func (q *Queue) Close() {
+	q.mu.Lock()
+	if q.closed {
+		q.mu.Unlock()
+		return
+	}
+	q.closed = true
+	close(q.done)
+	for _, exec := range q.running {
+		exec.Cancel()
+	}
+	q.mu.Unlock()
+
+	q.workers.Wait()
+}
+
+func (q *Queue) work() {
+	defer q.workers.Done()
+
+	poll := time.NewTicker(q.cfg.PollInterval)
+	defer poll.Stop()
+	for {
+		select {
+		case <-q.done:
+			return
+		default:
+		}
+
+		job, err := q.store.Claim(q.worker, time.Now())
+		if err != nil {
+			fmt.Printf("Warning: failed to claim job: %v\n", err)
+		}
+		if job != nil {
+			q.executeJob(job)
+			continue
+		}
+
+		select {
+		case <-q.done:
+			return
+		case <-q.wake:
+		case <-poll.C:
+		}
+	}
+}
+
+// maintain heartbeats the running jobs, cancels those whose cancellation was
+// requested elsewhere, and requeues jobs whose worker was lost
+func (q *Queue) maintain() {
+	defer q.workers.Done()
+
+	ticker := time.NewTicker(q.cfg.HeartbeatInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-q.done:
+			return
+		case <-ticker.C:
+		}
+
+		q.mu.Lock()
+		ids := make([]uuid.UUID, 0, len(q.running))
+		for id := range q.running {
+			ids = append(ids, id)
+		}
+		q.mu.Unlock()
+
+		cancelled, err := q.store.Heartbeat(q.worker, ids, time.Now())
+		if err != nil {
+			fmt.Printf("Warning: failed to heartbeat jobs: %v\n", err)
+		}
+		q.mu.Lock()
+		for _, id := range cancelled {
+			if exec, ok := q.running[id]; ok {
+				exec.cancelled = true
+				exec.Cancel()
+			}
+		}
+		q.mu.Unlock()
+
+		if err := q.Recover(); err != nil {
+			fmt.Printf("Warning: failed to requeue stale jobs: %v\n", err)
+		}
+	}
+}
+
+func (q *Queue) executeJob(job *domain.Job) {
+	fn, ok := q.handlers[job.Type]
 	if !ok {
+		q.finish(job, StatusFailed, fmt.Sprintf("unknown job type %q", job.Type))
 		return
 	}
-	
-	// Update status to running
-	exec.Job.Status = StatusRunning
-	q.db.Model(exec.Job).Updates(map[string]interface{}{
-		"status": StatusRunning,
-	})
-	
-	// Execute function
-	result, err := exec.Func(jobID, progressChan)
-	
+
+	ctx, cancel := context.WithCancel(context.Background())
+	if job.TimeoutSeconds > 0 {
+		ctx, cancel = context.WithTimeout(context.Background(), time.Duration(job.TimeoutSeconds)*time.Second)
+	}
+	progress := make(chan Progress)
+	ctx = WithProgress(ctx, progress)
+	exec := &JobExecution{Job: job, Func: fn, Cancel: cancel}
+
+	q.mu.Lock()
+	q.running[job.ID] = exec
+	exec.cancelled = job.CancelRequested
+	closed := q.closed
+	q.mu.Unlock()
+	defer func() {
+		cancel()
+		q.mu.Lock()
+		delete(q.running, job.ID)
+		q.mu.Unlock()
+	}()
+	if closed || exec.cancelled {
+		cancel()
+	}
+	q.publish(job, EventStatus)
+
+	// Persist and publish progress reported by the function while it runs
+	reported := make(chan struct{})
+	go func() {
+		defer close(reported)
+		for p := range progress {
+			if p.Percent < 0 {
+				p.Percent = 0
+			} else if p.Percent > 99 {
+				p.Percent = 99 // 100 is reserved for success
+			}
+			if p.Percent == job.Progress && p.Stage == job.Stage {
+				continue
+			}
+			job.Progress = p.Percent
+			job.Stage = p.Stage
+			q.save(job, "progress", "stage")
+			q.publish(job, EventProgress)
+		}
+	}()
+
+	result, err := run(ctx, exec)
+	close(progress)
+	<-reported
+
+	q.mu.Lock()
+	cancelled := exec.cancelled
+	closed = q.closed
+	q.mu.Unlock()
+
 	// Update final status
+	switch {
+	case cancelled:
+		q.finish(job, StatusCancelled, "cancelled")
+	case err == nil:
+		job.Result = result
+		job.Progress = 100
+		q.finish(job, StatusSucceeded, "")
+	case closed:
+		// Shutting down: hand the job to the next process
+		requeue(job, time.Now(), func(int) time.Duration { return 0 })
+		q.save(job, requeueColumns...)
+		q.publish(job, EventStatus)
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		q.finish(job, StatusFailed, fmt.Sprintf("timed out after %ds", job.TimeoutSeconds))
+	default:
+		q.finish(job, StatusFailed, err.Error())
+	}
+}
+
+// finish records a job's final status
+func (q *Queue) finish(job *domain.Job, status, message string) {
+	finished := time.Now()
+	job.Status = status
+	job.Error = message
+	job.FinishedAt = &finished
+	if status != StatusSucceeded {
+		job.Progress = 0
+	}
+	// Publish first: subscribers reading a finished job expect its final
+	// event to be stored
+	q.publish(job, EventStatus)
+	q.save(job, "status", "progress", "result", "error", "finished_at")
+}
+
+// save updates a job this process runs. A job requeued after its heartbeat
+// went stale belongs to another worker, and is left alone.
+func (q *Queue) save(job *domain.Job, columns ...string) {
+	ok, err := q.store.Save(job, q.worker, columns...)
 	if err != nil {
-		exec.Job.Status = StatusFailed
-		exec.Job.Error = err.Error()
-		exec.Job.Progress = 0
-	} else {
-		exec.Job.Status = StatusSucceeded
-		exec.Job.Result = result
-		exec.Job.Progress = 100
-	}
-	
-	q.db.Model(exec.Job).Updates(map[string]interface{}{
-		"status":   exec.Job.Status,
-		"progress": exec.Job.Progress,
-		"result":   exec.Job.Result,
-		"error":    exec.Job.Error,
-	})
-	
-	close(progressChan)
+		fmt.Printf("Warning: failed to save job %s: %v\n", job.ID, err)
+	} else if !ok {
+		fmt.Printf("Warning: job %s no longer runs on this worker\n", job.ID)
+	}
+}
+
+// run calls the job function, turning a panic into a job failure
+func run(ctx context.Context, exec *JobExecution) (result map[string]interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("job panicked: %v", r)
+		}
+	}()
+	return exec.Func(ctx, exec.Job)
 }
 
 func (q *Queue) GetJob(jobID uuid.UUID) (*domain.Job, error) {
-	var job domain.Job
-	if err := q.db.First(&job, "id = ?", jobID).Error; err != nil {
-		return nil, err
-	}
-	return &job, nil
+	return q.store.Get(jobID)
 }
 
-func (q *Queue) GetProgress(jobID uuid.UUID) (<-chan int, error) {
-	q.mu.RLock()
-	defer q.mu.RUnlock()
-	
-	ch, ok := q.progress[jobID]
-	if !ok {
-		return nil, fmt.Errorf("job not found or completed")
+// ListJobs returns the most recent jobs matching filter, newest first
+func (q *Queue) ListJobs(filter Filter) ([]domain.Job, error) {
+	return q.store.List(filter)
+}
+
+// Result converts a response DTO into a job result through its JSON encoding
+func Result(v interface{}) (map[string]interface{}, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var result map[string]interface{}
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, err
 	}
-	
-	return ch, nil
+	return result, nil
 }
@@ -0,0 +1,261 @@
+package jobs
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/reserveone/saa-risk-analyzer/internal/domain"
+)
+
+const (
+	defaultListLimit = 50
+	maxListLimit     = 500
+)
+
+// Store persists jobs and hands them out to workers. Workers of several
+// processes may share a store.
+type Store interface {
+	Create(job *domain.Job) error
+	Get(id uuid.UUID) (*domain.Job, error)
+	List(filter Filter) ([]domain.Job, error)
+	// Pending counts the queued jobs
+	Pending() (int64, error)
+
+	// Claim marks the next runnable job as running on worker and returns it,
+	// or nil if there is none: the oldest queued job of the highest priority
+	// whose RunAfter has passed. Claiming counts an attempt.
+	Claim(worker string, now time.Time) (*domain.Job, error)
+	// Save updates the named columns of a job running on worker, reporting
+	// false if the job no longer runs there
+	Save(job *domain.Job, worker string, columns ...string) (bool, error)
+	// Heartbeat marks the jobs worker runs as alive and returns those whose
+	// cancellation was requested
+	Heartbeat(worker string, ids []uuid.UUID, now time.Time) ([]uuid.UUID, error)
+	// Cancel cancels a queued job, or requests the cancellation of a running
+	// one, and returns the job's status: cancelled, running, or the final
+	// status with ErrJobFinished
+	Cancel(id uuid.UUID, now time.Time) (string, error)
+	// RequeueStale queues again the running jobs whose heartbeat is older
+	// than staleBefore, to run after backoff(attempts), and fails those that
+	// have used all their attempts
+	RequeueStale(staleBefore, now time.Time, backoff func(attempts int) time.Duration) (requeued, failed int, err error)
+
+	// AddEvent appends an event to a job's event stream, setting its ID
+	AddEvent(event *domain.JobEvent) error
+	// Events returns a job's events with IDs above after, oldest first
+	Events(jobID uuid.UUID, after uint64) ([]domain.JobEvent, error)
+}
+
+// Filter selects jobs to list; empty fields match every job
+type Filter struct {
+	Type   string
+	Status string
+	Limit  int // default 50, at most 500
+}
+
+// limit returns the filter's limit within its bounds
+func (f Filter) limit() int {
+	switch {
+	case f.Limit <= 0:
+		return defaultListLimit
+	case f.Limit > maxListLimit:
+		return maxListLimit
+	}
+	return f.Limit
+}
+
+// priorityOrder sorts jobs by priority lane, highest first
+const priorityOrder = "CASE priority WHEN '" + PriorityHigh + "' THEN 0 WHEN '" + PriorityNormal + "' THEN 1 ELSE 2 END"
+
+type gormStore struct {
+	db *gorm.DB
+}
+
+// NewGormStore stores jobs in the jobs table. Workers claim jobs with
+// SELECT ... FOR UPDATE SKIP LOCKED, so several API instances can share it.
+func NewGormStore(db *gorm.DB) Store {
+	return &gormStore{db: db}
+}
+
+func (s *gormStore) Create(job *domain.Job) error {
+	return s.db.Create(job).Error
+}
+
+func (s *gormStore) Get(id uuid.UUID) (*domain.Job, error) {
+	var job domain.Job
+	if err := s.db.First(&job, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+func (s *gormStore) List(filter Filter) ([]domain.Job, error) {
+	query := s.db.Order("created_at DESC").Limit(filter.limit())
+	if filter.Type != "" {
+		query = query.Where("type = ?", filter.Type)
+	}
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	}
+
+	var jobs []domain.Job
+	err := query.Find(&jobs).Error
+	return jobs, err
+}
+
+func (s *gormStore) Pending() (int64, error) {
+	var count int64
+	err := s.db.Model(&domain.Job{}).Where("status = ?", StatusQueued).Count(&count).Error
+	return count, err
+}
+
+func (s *gormStore) Claim(worker string, now time.Time) (*domain.Job, error) {
+	var claimed *domain.Job
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var jobs []domain.Job
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ? AND run_after <= ?", StatusQueued, now).
+			Order(priorityOrder).Order("created_at").
+			Limit(1).
+			Find(&jobs).Error
+		if err != nil || len(jobs) == 0 {
+			return err
+		}
+
+		job := &jobs[0]
+		job.Status = StatusRunning
+		job.WorkerID = worker
+		job.Attempts++
+		job.Progress = 0
+		job.Stage = ""
+		job.StartedAt = &now
+		job.HeartbeatAt = &now
+		if err := tx.Model(job).Select("status", "worker_id", "attempts", "progress", "stage", "started_at", "heartbeat_at").Updates(job).Error; err != nil {
+			return err
+		}
+		claimed = job
+		return nil
+	})
+	return claimed, err
+}
+
+func (s *gormStore) Save(job *domain.Job, worker string, columns ...string) (bool, error) {
+	result := s.db.Model(job).
+		Where("worker_id = ? AND status = ?", worker, StatusRunning).
+		Select(columns).
+		Updates(job)
+	return result.RowsAffected == 1, result.Error
+}
+
+func (s *gormStore) Heartbeat(worker string, ids []uuid.UUID, now time.Time) ([]uuid.UUID, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	running := s.db.Model(&domain.Job{}).Where("id IN ? AND worker_id = ? AND status = ?", ids, worker, StatusRunning)
+	if err := running.Session(&gorm.Session{}).Update("heartbeat_at", now).Error; err != nil {
+		return nil, err
+	}
+
+	var cancelled []uuid.UUID
+	err := running.Session(&gorm.Session{}).Where("cancel_requested").Pluck("id", &cancelled).Error
+	return cancelled, err
+}
+
+func (s *gormStore) Cancel(id uuid.UUID, now time.Time) (string, error) {
+	result := s.db.Model(&domain.Job{}).
+		Where("id = ? AND status = ?", id, StatusQueued).
+		Updates(map[string]interface{}{
+			"status":      StatusCancelled,
+			"error":       "cancelled",
+			"finished_at": now,
+		})
+	if result.Error != nil {
+		return "", result.Error
+	}
+	if result.RowsAffected == 1 {
+		return StatusCancelled, nil
+	}
+
+	result = s.db.Model(&domain.Job{}).
+		Where("id = ? AND status = ?", id, StatusRunning).
+		Update("cancel_requested", true)
+	if result.Error != nil {
+		return "", result.Error
+	}
+	if result.RowsAffected == 1 {
+		return StatusRunning, nil
+	}
+
+	job, err := s.Get(id)
+	if err != nil {
+		return "", err
+	}
+	return job.Status, ErrJobFinished
+}
+
+func (s *gormStore) RequeueStale(staleBefore, now time.Time, backoff func(attempts int) time.Duration) (int, int, error) {
+	requeued, failed := 0, 0
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var stale []domain.Job
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ? AND (heartbeat_at IS NULL OR heartbeat_at < ?)", StatusRunning, staleBefore).
+			Find(&stale).Error
+		if err != nil {
+			return err
+		}
+
+		for i := range stale {
+			job := &stale[i]
+			requeue(job, now, backoff)
+			if job.Status == StatusQueued {
+				requeued++
+			} else {
+				failed++
+			}
+			if err := tx.Model(job).Select(requeueColumns).Updates(job).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return requeued, failed, err
+}
+
+func (s *gormStore) AddEvent(event *domain.JobEvent) error {
+	return s.db.Create(event).Error
+}
+
+func (s *gormStore) Events(jobID uuid.UUID, after uint64) ([]domain.JobEvent, error) {
+	var events []domain.JobEvent
+	err := s.db.Where("job_id = ? AND id > ?", jobID, after).Order("id").Find(&events).Error
+	return events, err
+}
+
+// requeueColumns are the columns requeue changes
+var requeueColumns = []string{"status", "error", "progress", "stage", "run_after", "worker_id", "heartbeat_at", "started_at", "finished_at"}
+
+// requeue returns a job whose worker was lost to the queue, or ends it if
+// it was being cancelled or has used all its attempts
+func requeue(job *domain.Job, now time.Time, backoff func(attempts int) time.Duration) {
+	job.WorkerID = ""
+	job.HeartbeatAt = nil
+	job.Progress = 0
+	job.Stage = ""
+	switch {
+	case job.CancelRequested:
+		job.Status = StatusCancelled
+		job.Error = "cancelled"
+		job.FinishedAt = &now
+	case job.MaxAttempts > 0 && job.Attempts >= job.MaxAttempts:
+		job.Status = StatusFailed
+		job.Error = "worker lost, no attempts left"
+		job.FinishedAt = &now
+	default:
+		job.Status = StatusQueued
+		job.StartedAt = nil
+		job.RunAfter = now.Add(backoff(job.Attempts))
+	}
+}
@@ -1,7 +1,12 @@
 package jobs
 
 import (
-	"github.com/google/uuid"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/reserveone/saa-risk-analyzer/internal/domain"
 )
 
 const (
@@ -9,6 +14,7 @@ const (
 	StatusRunning   = "running"
 	StatusSucceeded = "succeeded"
 	StatusFailed    = "failed"
+	StatusCancelled = "cancelled"
 )
 
 const (
@@ -19,6 +25,67 @@ const (
 	TypeStress            = "stress"
 	TypeBacktest          = "backtest"
 	TypeRiskContribution  = "risk_contribution"
+	TypeSnapshot          = "snapshot"
 )
 
-type JobFunc func(jobID uuid.UUID, progress chan<- int) (map[string]interface{}, error)
+// Priority lanes. Workers always take the oldest job of the highest
+// non-empty lane.
+const (
+	PriorityHigh   = "high"
+	PriorityNormal = "normal"
+	PriorityLow    = "low"
+)
+
+// Statuses, Types and Priorities list the valid job statuses, types and
+// priorities; Priorities is in the order workers serve the lanes
+var (
+	Statuses   = []string{StatusQueued, StatusRunning, StatusSucceeded, StatusFailed, StatusCancelled}
+	Types      = []string{TypeVaR, TypeCVaR, TypeCorrelation, TypePCA, TypeStress, TypeBacktest, TypeRiskContribution, TypeSnapshot}
+	Priorities = []string{PriorityHigh, PriorityNormal, PriorityLow}
+)
+
+// JobFunc computes a job's result from its input. It should return once ctx
+// is done, which happens when the job is cancelled or times out. It may
+// report progress with ReportProgress(ctx, ...).
+type JobFunc func(ctx context.Context, job *domain.Job) (map[string]interface{}, error)
+
+// Typed adapts a calculation to a JobFunc: the job input decodes into the
+// calculation's request, and its response becomes the job result with the
+// job_id set
+func Typed[Req, Resp any](compute func(ctx context.Context, req Req) (Resp, error)) JobFunc {
+	return func(ctx context.Context, job *domain.Job) (map[string]interface{}, error) {
+		var req Req
+		if err := json.Unmarshal(job.Input, &req); err != nil {
+			return nil, fmt.Errorf("invalid job input: %w", err)
+		}
+		response, err := compute(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		result, err := Result(response)
+		if err != nil {
+			return nil, err
+		}
+		result["job_id"] = job.ID
+		return result, nil
+	}
+}
+
+// NormalizePriority validates a priority, defaulting to normal
+func NormalizePriority(priority string) (string, error) {
+	if priority == "" {
+		return PriorityNormal, nil
+	}
+	priority = strings.ToLower(priority)
+	for _, p := range Priorities {
+		if p == priority {
+			return p, nil
+		}
+	}
+	return "", fmt.Errorf("invalid priority %q, expected one of %s", priority, strings.Join(Priorities, ", "))
+}
+
+// finished reports whether a job in status will not run again
+func finished(status string) bool {
+	return status == StatusSucceeded || status == StatusFailed || status == StatusCancelled
+}
@@ -0,0 +1,73 @@
+package math
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Adjustment bases for price history used in return calculations
+const (
+	AdjustmentNone        = "none"         // raw closes
+	AdjustmentPriceReturn = "price_return" // split-adjusted closes
+	AdjustmentTotalReturn = "total_return" // split-adjusted with cash dividends reinvested
+)
+
+// CorporateAction is a split or cash dividend effective on ExDate. A split
+// multiplies the share count by SplitRatio (2 for a 2-for-1 split); Dividend
+// is the cash paid per share before the split adjustment.
+type CorporateAction struct {
+	ExDate     time.Time
+	SplitRatio float64
+	Dividend   float64
+}
+
+// NormalizeAdjustment validates an adjustment basis, defaulting to total return
+func NormalizeAdjustment(basis string) (string, error) {
+	switch basis {
+	case "":
+		return AdjustmentTotalReturn, nil
+	case AdjustmentNone, AdjustmentPriceReturn, AdjustmentTotalReturn:
+		return basis, nil
+	}
+	return "", fmt.Errorf("unknown adjustment %q, expected none, price_return or total_return", basis)
+}
+
+// AdjustPrices back-adjusts raw closes (oldest first) for corporate actions,
+// so the latest close is unchanged and earlier closes are scaled to be
+// comparable with it. Splits divide earlier closes by the split ratio; for
+// total return, a dividend scales earlier closes by 1 - D/P, where P is the
+// last close before the ex-date.
+func AdjustPrices(prices []PricePoint, actions []CorporateAction, basis string) []PricePoint {
+	adjusted := make([]PricePoint, len(prices))
+	copy(adjusted, prices)
+	if basis == AdjustmentNone || len(actions) == 0 || len(prices) < 2 {
+		return adjusted
+	}
+
+	sorted := make([]CorporateAction, len(actions))
+	copy(sorted, actions)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].ExDate.Before(sorted[j].ExDate) })
+
+	factor := 1.0
+	next := len(sorted) - 1
+	for i := len(prices) - 1; i > 0; i-- {
+		// Actions with an ex-date in (date[i-1], date[i]] separate the two closes
+		for next >= 0 && sorted[next].ExDate.After(prices[i].Date) {
+			next--
+		}
+		for next >= 0 && sorted[next].ExDate.After(prices[i-1].Date) {
+			action := sorted[next]
+			if action.SplitRatio > 0 {
+				factor /= action.SplitRatio
+			}
+			if basis == AdjustmentTotalReturn && action.Dividend > 0 && prices[i-1].Close > action.Dividend {
+				factor *= 1 - action.Dividend/prices[i-1].Close
+			}
+			next--
+		}
+		adjusted[i-1].Close = prices[i-1].Close * factor
+	}
+
+	return adjusted
+}
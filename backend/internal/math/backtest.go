@@ -105,3 +105,31 @@ func chiSquarePValue(x, df float64) float64 {
 	// Very rough approximation
 	return math.Exp(-x / 2)
 }
+
+// RollingVaR estimates one-day VaR for each return after the first window,
+// from the window returns preceding it. Method is historical or parametric.
+// The estimates line up with portfolioReturns[window:] for BacktestVaR.
+func RollingVaR(portfolioReturns []float64, window int, confidence float64, method string) ([]float64, error) {
+	if window < 2 || window >= len(portfolioReturns) {
+		return nil, fmt.Errorf("need more than %d returns for a %d-day window, got %d", window, window, len(portfolioReturns))
+	}
+
+	estimate := CalculateHistoricalVaR
+	switch method {
+	case "historical":
+	case "parametric", "parametric_normal":
+		estimate = CalculateParametricVaR
+	default:
+		return nil, fmt.Errorf("unknown backtest method %q", method)
+	}
+
+	estimates := make([]float64, 0, len(portfolioReturns)-window)
+	for t := window; t < len(portfolioReturns); t++ {
+		result, err := estimate(portfolioReturns[t-window:t], confidence, 1)
+		if err != nil {
+			return nil, err
+		}
+		estimates = append(estimates, result.VaR)
+	}
+	return estimates, nil
+}
@@ -0,0 +1,51 @@
+package math
+
+import (
+	"fmt"
+	"math"
+
+	"gonum.org/v1/gonum/mat"
+	"gonum.org/v1/gonum/stat/distuv"
+)
+
+// ContributionResult decomposes delta-normal VaR across positions
+type ContributionResult struct {
+	VaR       float64
+	Marginal  []float64 // dVaR / d exposure
+	Component []float64 // exposure * marginal, summing to VaR
+}
+
+// RiskContributions computes the Euler decomposition of the zero-mean
+// delta-normal VaR of the exposures: the marginal VaR of each position and
+// its component VaR, which add up to the portfolio VaR. Exposures in currency
+// give VaR in currency.
+func RiskContributions(exposures []float64, cov *mat.SymDense, confidence float64, horizonDays int) (*ContributionResult, error) {
+	n := len(exposures)
+	if n == 0 {
+		return nil, fmt.Errorf("no exposures")
+	}
+	if r, _ := cov.Dims(); r != n {
+		return nil, fmt.Errorf("covariance has %d assets, expected %d", r, n)
+	}
+
+	sigma := PortfolioStdDev(exposures, cov)
+	if sigma == 0 {
+		return nil, fmt.Errorf("portfolio has zero variance")
+	}
+
+	scale := distuv.UnitNormal.Quantile(confidence) * math.Sqrt(float64(horizonDays))
+
+	var covExposure mat.VecDense
+	covExposure.MulVec(cov, mat.NewVecDense(n, exposures))
+
+	result := &ContributionResult{
+		VaR:       scale * sigma,
+		Marginal:  make([]float64, n),
+		Component: make([]float64, n),
+	}
+	for i := range exposures {
+		result.Marginal[i] = scale * covExposure.AtVec(i) / sigma
+		result.Component[i] = exposures[i] * result.Marginal[i]
+	}
+	return result, nil
+}
@@ -0,0 +1,457 @@
+package math
+
+import (
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"sort"
+
+	"gonum.org/v1/gonum/mat"
+	"gonum.org/v1/gonum/stat"
+	"gonum.org/v1/gonum/stat/distuv"
+)
+
+// Dependence models accepted by MonteCarloConfig
+const (
+	DependenceNormal         = "normal"
+	DependenceStudentT       = "student_t"
+	DependenceGaussianCopula = "gaussian_copula"
+	DependenceTCopula        = "t_copula"
+)
+
+// Marginal models used by the copula dependence models
+const (
+	MarginalEmpirical = "empirical"
+	MarginalStudentT  = "student_t"
+)
+
+// degreesOfFreedomGrid is searched by the profile likelihood fits
+var degreesOfFreedomGrid = []float64{3, 4, 5, 6, 7, 8, 10, 12, 15, 20, 25, 30, 40, 50}
+
+// DependenceFit reports the fitted parameters of the simulated joint model
+type DependenceFit struct {
+	Model            string
+	Marginals        string      // copula models only
+	DegreesOfFreedom float64     // student_t and t_copula only
+	Correlation      [][]float64 // copula correlation, or the correlation of the joint model
+	MarginalFits     []MarginalFit
+}
+
+// MarginalFit holds the parameters of a fitted Student-t marginal
+type MarginalFit struct {
+	Location         float64
+	Scale            float64
+	DegreesOfFreedom float64
+}
+
+// dependenceModel builds the scenario model for the configured dependence
+// structure, fitted to the aligned asset returns
+func dependenceModel(assetReturns [][]float64, cfg MonteCarloConfig) (scenarioModel, *DependenceFit, error) {
+	model := cfg.Dependence
+	if model == "" {
+		model = DependenceNormal
+	}
+
+	switch model {
+	case DependenceNormal, DependenceStudentT:
+		return jointModel(assetReturns, model, cfg.DegreesOfFreedom)
+	case DependenceGaussianCopula, DependenceTCopula:
+		return copulaModel(assetReturns, model, cfg.Marginals, cfg.DegreesOfFreedom)
+	default:
+		return nil, nil, fmt.Errorf("unknown dependence model: %s", model)
+	}
+}
+
+// jointModel simulates multivariate normal or multivariate Student-t returns
+// with the sample mean and covariance. The t draws are scaled so that their
+// covariance matches the sample covariance.
+func jointModel(assetReturns [][]float64, model string, nu float64) (scenarioModel, *DependenceFit, error) {
+	numAssets := len(assetReturns)
+	cov, means := ReturnMoments(assetReturns)
+	chol, err := Cholesky(cov)
+	if err != nil {
+		return nil, nil, err
+	}
+	var L mat.TriDense
+	chol.LTo(&L)
+
+	fit := &DependenceFit{Model: model, Correlation: covToCorrelation(cov)}
+
+	if model == DependenceNormal {
+		return func(z []float64, _ *rand.Rand, out []float64) {
+			for i := 0; i < numAssets; i++ {
+				out[i] = means[i]
+				for j := 0; j <= i; j++ {
+					out[i] += L.At(i, j) * z[j]
+				}
+			}
+		}, fit, nil
+	}
+
+	if nu == 0 {
+		nu = fitMultivariateT(assetReturns, means, cov)
+	}
+	if nu <= 2 {
+		return nil, nil, fmt.Errorf("degrees of freedom must exceed 2, got %g", nu)
+	}
+	fit.DegreesOfFreedom = nu
+
+	return func(z []float64, rng *rand.Rand, out []float64) {
+		mix := math.Sqrt((nu - 2) / chiSquared(rng, nu))
+		for i := 0; i < numAssets; i++ {
+			out[i] = 0
+			for j := 0; j <= i; j++ {
+				out[i] += L.At(i, j) * z[j]
+			}
+			out[i] = means[i] + out[i]*mix
+		}
+	}, fit, nil
+}
+
+// copulaModel simulates uniforms from a Gaussian or t copula and maps them
+// through empirical or fitted Student-t marginals
+func copulaModel(assetReturns [][]float64, model, marginals string, nu float64) (scenarioModel, *DependenceFit, error) {
+	numAssets := len(assetReturns)
+	if marginals == "" {
+		marginals = MarginalEmpirical
+	}
+
+	uniforms := pseudoObservations(assetReturns)
+
+	var corr *mat.SymDense
+	if model == DependenceGaussianCopula {
+		// Correlation of normal scores
+		scores := make([][]float64, numAssets)
+		for i, u := range uniforms {
+			scores[i] = make([]float64, len(u))
+			for t := range u {
+				scores[i][t] = distuv.UnitNormal.Quantile(u[t])
+			}
+		}
+		cov, _ := ReturnMoments(scores)
+		corr = mat.NewSymDense(numAssets, nil)
+		for i, row := range covToCorrelation(cov) {
+			for j := i; j < numAssets; j++ {
+				corr.SetSym(i, j, row[j])
+			}
+		}
+	} else {
+		// Kendall's tau inversion is robust to the heavy tails of a t copula
+		corr = mat.NewSymDense(numAssets, nil)
+		for i := 0; i < numAssets; i++ {
+			corr.SetSym(i, i, 1)
+			for j := i + 1; j < numAssets; j++ {
+				corr.SetSym(i, j, math.Sin(math.Pi/2*kendallTau(assetReturns[i], assetReturns[j])))
+			}
+		}
+	}
+	corr = nearestCorrelation(corr)
+
+	chol, err := Cholesky(corr)
+	if err != nil {
+		return nil, nil, err
+	}
+	var L mat.TriDense
+	chol.LTo(&L)
+
+	fit := &DependenceFit{
+		Model:       model,
+		Marginals:   marginals,
+		Correlation: ExportCorrelationMatrix(corr),
+	}
+
+	if model == DependenceTCopula {
+		if nu == 0 {
+			nu = fitTCopula(uniforms, corr)
+		}
+		if nu <= 0 {
+			return nil, nil, fmt.Errorf("degrees of freedom must be positive, got %g", nu)
+		}
+		fit.DegreesOfFreedom = nu
+	}
+
+	var quantiles []func(float64) float64
+	switch marginals {
+	case MarginalEmpirical:
+		quantiles = make([]func(float64) float64, numAssets)
+		for i, series := range assetReturns {
+			sorted := append([]float64(nil), series...)
+			sort.Float64s(sorted)
+			quantiles[i] = func(u float64) float64 { return empiricalQuantile(sorted, u) }
+		}
+	case MarginalStudentT:
+		quantiles = make([]func(float64) float64, numAssets)
+		fit.MarginalFits = make([]MarginalFit, numAssets)
+		for i, series := range assetReturns {
+			marginal := fitStudentTMarginal(series)
+			fit.MarginalFits[i] = marginal
+			dist := distuv.StudentsT{Mu: marginal.Location, Sigma: marginal.Scale, Nu: marginal.DegreesOfFreedom}
+			quantiles[i] = dist.Quantile
+		}
+	default:
+		return nil, nil, fmt.Errorf("unknown marginal model: %s", marginals)
+	}
+
+	tDist := distuv.StudentsT{Mu: 0, Sigma: 1, Nu: nu}
+
+	return func(z []float64, rng *rand.Rand, out []float64) {
+		mix := 1.0
+		if model == DependenceTCopula {
+			mix = math.Sqrt(nu / chiSquared(rng, nu))
+		}
+		for i := 0; i < numAssets; i++ {
+			y := 0.0
+			for j := 0; j <= i; j++ {
+				y += L.At(i, j) * z[j]
+			}
+			var u float64
+			if model == DependenceTCopula {
+				u = tDist.CDF(y * mix)
+			} else {
+				u = distuv.UnitNormal.CDF(y)
+			}
+			out[i] = quantiles[i](u)
+		}
+	}, fit, nil
+}
+
+// pseudoObservations maps each series to ranks/(n+1)
+func pseudoObservations(assetReturns [][]float64) [][]float64 {
+	uniforms := make([][]float64, len(assetReturns))
+	for i, series := range assetReturns {
+		n := len(series)
+		order := make([]int, n)
+		for t := range order {
+			order[t] = t
+		}
+		sort.SliceStable(order, func(a, b int) bool { return series[order[a]] < series[order[b]] })
+
+		uniforms[i] = make([]float64, n)
+		for rank, t := range order {
+			uniforms[i][t] = float64(rank+1) / float64(n+1)
+		}
+	}
+	return uniforms
+}
+
+// empiricalQuantile interpolates linearly between sorted observations placed
+// at probabilities k/(n+1)
+func empiricalQuantile(sorted []float64, u float64) float64 {
+	n := len(sorted)
+	pos := u*float64(n+1) - 1
+	if pos <= 0 {
+		return sorted[0]
+	}
+	if pos >= float64(n-1) {
+		return sorted[n-1]
+	}
+	lo := int(pos)
+	frac := pos - float64(lo)
+	return sorted[lo] + frac*(sorted[lo+1]-sorted[lo])
+}
+
+func kendallTau(x, y []float64) float64 {
+	n := len(x)
+	concordant, discordant := 0.0, 0.0
+	for i := 0; i < n; i++ {
+		for j := i + 1; j < n; j++ {
+			s := (x[i] - x[j]) * (y[i] - y[j])
+			if s > 0 {
+				concordant++
+			} else if s < 0 {
+				discordant++
+			}
+		}
+	}
+	if concordant+discordant == 0 {
+		return 0
+	}
+	return (concordant - discordant) / (concordant + discordant)
+}
+
+// nearestCorrelation clips negative eigenvalues and rescales to a unit
+// diagonal so that the matrix can be Cholesky factorised
+func nearestCorrelation(corr *mat.SymDense) *mat.SymDense {
+	n, _ := corr.Dims()
+	var eigen mat.EigenSym
+	if ok := eigen.Factorize(corr, true); !ok {
+		return corr
+	}
+	values := eigen.Values(nil)
+	if values[0] > 1e-8 {
+		return corr
+	}
+
+	var vectors mat.Dense
+	eigen.VectorsTo(&vectors)
+	for i := range values {
+		values[i] = math.Max(values[i], 1e-8)
+	}
+
+	fixed := mat.NewSymDense(n, nil)
+	for i := 0; i < n; i++ {
+		for j := i; j < n; j++ {
+			v := 0.0
+			for k := 0; k < n; k++ {
+				v += vectors.At(i, k) * values[k] * vectors.At(j, k)
+			}
+			fixed.SetSym(i, j, v)
+		}
+	}
+	for i := 0; i < n; i++ {
+		for j := i + 1; j < n; j++ {
+			fixed.SetSym(i, j, fixed.At(i, j)/math.Sqrt(fixed.At(i, i)*fixed.At(j, j)))
+		}
+	}
+	for i := 0; i < n; i++ {
+		fixed.SetSym(i, i, 1)
+	}
+	return fixed
+}
+
+func covToCorrelation(cov *mat.SymDense) [][]float64 {
+	n, _ := cov.Dims()
+	corr := make([][]float64, n)
+	for i := 0; i < n; i++ {
+		corr[i] = make([]float64, n)
+		for j := 0; j < n; j++ {
+			denom := math.Sqrt(cov.At(i, i) * cov.At(j, j))
+			if i == j {
+				corr[i][j] = 1
+			} else if denom > 0 {
+				corr[i][j] = cov.At(i, j) / denom
+			}
+		}
+	}
+	return corr
+}
+
+// fitStudentTMarginal fits a location-scale Student-t by the method of
+// moments: the degrees of freedom from the excess kurtosis 6/(ν-4), the scale
+// so that the variance matches the sample variance
+func fitStudentTMarginal(series []float64) MarginalFit {
+	mean := Mean(series)
+	sd := StdDev(series)
+	nu := degreesOfFreedomGrid[len(degreesOfFreedomGrid)-1]
+	if kurt := stat.ExKurtosis(series, nil); kurt > 0 {
+		nu = math.Min(6/kurt+4, nu)
+	}
+	scale := sd * math.Sqrt((nu-2)/nu)
+	if scale == 0 {
+		scale = 1e-12
+	}
+	return MarginalFit{Location: mean, Scale: scale, DegreesOfFreedom: nu}
+}
+
+// fitMultivariateT picks the degrees of freedom maximising the multivariate t
+// likelihood with mean and covariance fixed at their sample values
+func fitMultivariateT(assetReturns [][]float64, means []float64, cov *mat.SymDense) float64 {
+	d := len(assetReturns)
+	n := len(assetReturns[0])
+
+	var chol mat.Cholesky
+	if ok := chol.Factorize(cov); !ok {
+		return degreesOfFreedomGrid[len(degreesOfFreedomGrid)-1]
+	}
+	logDetCov := chol.LogDet()
+
+	// Squared Mahalanobis distances of the observations under the covariance
+	dist := make([]float64, n)
+	x := mat.NewVecDense(d, nil)
+	var solved mat.VecDense
+	for t := 0; t < n; t++ {
+		for i := 0; i < d; i++ {
+			x.SetVec(i, assetReturns[i][t]-means[i])
+		}
+		if err := chol.SolveVecTo(&solved, x); err != nil {
+			return degreesOfFreedomGrid[len(degreesOfFreedomGrid)-1]
+		}
+		dist[t] = mat.Dot(x, &solved)
+	}
+
+	best, bestLL := 0.0, math.Inf(-1)
+	for _, nu := range degreesOfFreedomGrid {
+		// Shape matrix S = Σ(ν-2)/ν
+		shape := (nu - 2) / nu
+		lgNum, _ := math.Lgamma((nu + float64(d)) / 2)
+		lgDen, _ := math.Lgamma(nu / 2)
+		ll := float64(n) * (lgNum - lgDen - float64(d)/2*math.Log(nu*math.Pi) - 0.5*(logDetCov+float64(d)*math.Log(shape)))
+		for t := 0; t < n; t++ {
+			ll -= (nu + float64(d)) / 2 * math.Log1p(dist[t]/shape/nu)
+		}
+		if ll > bestLL {
+			best, bestLL = nu, ll
+		}
+	}
+	return best
+}
+
+// fitTCopula picks the degrees of freedom maximising the t copula
+// pseudo-likelihood of the pseudo-observations for a fixed correlation
+func fitTCopula(uniforms [][]float64, corr *mat.SymDense) float64 {
+	d := len(uniforms)
+	n := len(uniforms[0])
+
+	var chol mat.Cholesky
+	if ok := chol.Factorize(corr); !ok {
+		return degreesOfFreedomGrid[len(degreesOfFreedomGrid)-1]
+	}
+	logDet := chol.LogDet()
+
+	best, bestLL := 0.0, math.Inf(-1)
+	x := mat.NewVecDense(d, nil)
+	var solved mat.VecDense
+	for _, nu := range degreesOfFreedomGrid {
+		tDist := distuv.StudentsT{Mu: 0, Sigma: 1, Nu: nu}
+		lgJoint, _ := math.Lgamma((nu + float64(d)) / 2)
+		lgHalf, _ := math.Lgamma(nu / 2)
+		lgOne, _ := math.Lgamma((nu + 1) / 2)
+
+		ll := 0.0
+		for t := 0; t < n; t++ {
+			marginal := 0.0
+			for i := 0; i < d; i++ {
+				q := tDist.Quantile(uniforms[i][t])
+				x.SetVec(i, q)
+				marginal += lgOne - lgHalf - 0.5*math.Log(nu*math.Pi) - (nu+1)/2*math.Log1p(q*q/nu)
+			}
+			if err := chol.SolveVecTo(&solved, x); err != nil {
+				return degreesOfFreedomGrid[len(degreesOfFreedomGrid)-1]
+			}
+			joint := lgJoint - lgHalf - float64(d)/2*math.Log(nu*math.Pi) - 0.5*logDet -
+				(nu+float64(d))/2*math.Log1p(mat.Dot(x, &solved)/nu)
+			ll += joint - marginal
+		}
+		if ll > bestLL {
+			best, bestLL = nu, ll
+		}
+	}
+	return best
+}
+
+// chiSquared draws from a chi-squared distribution with nu degrees of freedom
+// as 2·Gamma(nu/2), using Marsaglia and Tsang's method
+func chiSquared(rng *rand.Rand, nu float64) float64 {
+	return 2 * gammaVariate(rng, nu/2)
+}
+
+func gammaVariate(rng *rand.Rand, shape float64) float64 {
+	if shape < 1 {
+		// Boost the shape and correct with a uniform power
+		return gammaVariate(rng, shape+1) * math.Pow(rng.Float64(), 1/shape)
+	}
+	d := shape - 1.0/3
+	c := 1 / math.Sqrt(9*d)
+	for {
+		x := rng.NormFloat64()
+		v := 1 + c*x
+		if v <= 0 {
+			continue
+		}
+		v = v * v * v
+		u := rng.Float64()
+		if math.Log(u) < 0.5*x*x+d-d*v+d*math.Log(v) {
+			return d * v
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package math
+
+import (
+	"sort"
+	"time"
+)
+
+// maxRateAge is how far back a price may reach for the FX rate it is
+// converted at, so weekend closes of crypto use Friday's rate
+const maxRateAge = 5 * 24 * time.Hour
+
+// ConvertPrices converts closes (oldest first) into another currency at the
+// latest rate on or before each close date. Rates quote units of the target
+// currency per unit of the price currency. Closes with no rate in the
+// preceding maxRateAge are dropped.
+func ConvertPrices(prices []PricePoint, rates []PricePoint) []PricePoint {
+	sorted := make([]PricePoint, len(rates))
+	copy(sorted, rates)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Date.Before(sorted[j].Date) })
+
+	converted := make([]PricePoint, 0, len(prices))
+	next := 0
+	for _, p := range prices {
+		date := truncateToDay(p.Date)
+		for next < len(sorted) && !truncateToDay(sorted[next].Date).After(date) {
+			next++
+		}
+		if next == 0 {
+			continue
+		}
+		rate := sorted[next-1]
+		if date.Sub(truncateToDay(rate.Date)) > maxRateAge || rate.Close <= 0 {
+			continue
+		}
+		converted = append(converted, PricePoint{Date: p.Date, Close: p.Close * rate.Close})
+	}
+	return converted
+}
+
+// InvertRates turns FROM/TO rates into TO/FROM rates
+func InvertRates(rates []PricePoint) []PricePoint {
+	inverted := make([]PricePoint, 0, len(rates))
+	for _, r := range rates {
+		if r.Close > 0 {
+			inverted = append(inverted, PricePoint{Date: r.Date, Close: 1 / r.Close})
+		}
+	}
+	return inverted
+}
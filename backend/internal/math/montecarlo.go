@@ -0,0 +1,367 @@
+package math
+
+import (
+	crand "crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"runtime"
+	"sort"
+	"sync"
+
+	"gonum.org/v1/gonum/stat/distuv"
+)
+
+// Samplers accepted by MonteCarloConfig
+const (
+	SamplerPseudo = "pseudo"
+	SamplerSobol  = "sobol"
+)
+
+const (
+	// mcBlockSize is the number of simulations drawn from one RNG stream. Blocks
+	// are seeded from (seed, block index), so results depend only on the seed and
+	// not on how many workers processed them.
+	mcBlockSize = 1024
+	// mcBatches is the number of batches used for batch-means standard errors,
+	// and of independently shifted replications of the Sobol sequence
+	mcBatches = 20
+)
+
+// MonteCarloConfig controls the simulation engine
+type MonteCarloConfig struct {
+	Simulations      int
+	Workers          int    // defaults to GOMAXPROCS
+	Seed             uint64 // 0 draws a fresh seed, reported in the result
+	Antithetic       bool
+	Sampler          string  // pseudo (default) or sobol
+	Dependence       string  // normal (default), student_t, gaussian_copula, t_copula
+	Marginals        string  // copulas only: empirical (default) or student_t
+	DegreesOfFreedom float64 // student_t and t_copula; 0 fits it to the data
+}
+
+// MonteCarloResult contains simulated VaR and ES with their Monte Carlo
+// standard errors, estimated by batch means. With the Sobol sampler each batch
+// is a replication of the sequence under its own random digital shift, so
+// the batches are independent.
+type MonteCarloResult struct {
+	VaR          float64
+	ES           float64
+	VaRStdErr    float64
+	ESStdErr     float64
+	Confidence   float64
+	HorizonDays  int
+	Seed         uint64
+	Simulations  int
+	Workers      int
+	Sampler      string
+	Antithetic   bool
+	Dependence   *DependenceFit
+	Distribution []float64 // sorted simulated portfolio returns
+}
+
+// scenarioModel turns a vector of independent standard normal draws z into one
+// simulated vector of asset returns. rng may be used for any extra randomness.
+type scenarioModel func(z []float64, rng *rand.Rand, out []float64)
+
+// RunMonteCarlo simulates one-period asset returns from the configured
+// dependence model fitted to assetReturns, and estimates VaR and ES of the
+// weighted portfolio over the horizon
+func RunMonteCarlo(
+	assetReturns [][]float64,
+	weights []float64,
+	confidence float64,
+	horizonDays int,
+	cfg MonteCarloConfig,
+) (*MonteCarloResult, error) {
+	if len(assetReturns) == 0 || len(weights) != len(assetReturns) {
+		return nil, fmt.Errorf("invalid input")
+	}
+
+	model, fit, err := dependenceModel(assetReturns, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := simulatePortfolio(len(weights), weights, confidence, horizonDays, cfg, model)
+	if err != nil {
+		return nil, err
+	}
+	result.Dependence = fit
+	return result, nil
+}
+
+// simulatePortfolio runs the block-parallel simulation loop for a scenario
+// model and summarises the simulated portfolio returns
+func simulatePortfolio(
+	numAssets int,
+	weights []float64,
+	confidence float64,
+	horizonDays int,
+	cfg MonteCarloConfig,
+	model scenarioModel,
+) (*MonteCarloResult, error) {
+	if cfg.Simulations < 2 {
+		return nil, fmt.Errorf("at least 2 simulations required")
+	}
+	if cfg.Workers <= 0 {
+		cfg.Workers = runtime.GOMAXPROCS(0)
+	}
+	if cfg.Sampler == "" {
+		cfg.Sampler = SamplerPseudo
+	}
+	if cfg.Seed == 0 {
+		cfg.Seed = newSeed()
+	}
+
+	var sobol *sobolSequence
+	switch cfg.Sampler {
+	case SamplerPseudo:
+	case SamplerSobol:
+		var err error
+		if sobol, err = newSobolSequence(numAssets); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown sampler: %s", cfg.Sampler)
+	}
+
+	// Batch means over contiguous, even-sized batches keeps antithetic pairs together
+	batches := mcBatches
+	if cfg.Simulations/batches < 50 {
+		batches = cfg.Simulations / 50
+	}
+	batchSize := cfg.Simulations
+	if batches >= 2 {
+		batchSize = cfg.Simulations / batches
+		batchSize -= batchSize % 2
+	} else {
+		batches = 1
+	}
+
+	// A random digital shift per batch, so that Sobol estimates are unbiased
+	// and seed dependent, and the batches are independent replications
+	var shifts [][]uint32
+	if sobol != nil {
+		shiftRng := rand.New(rand.NewPCG(cfg.Seed, math.MaxUint64))
+		shifts = make([][]uint32, batches)
+		for k := range shifts {
+			shifts[k] = make([]uint32, numAssets)
+			for i := range shifts[k] {
+				shifts[k][i] = shiftRng.Uint32()
+			}
+		}
+	}
+
+	simulated := make([]float64, cfg.Simulations)
+	scale := math.Sqrt(float64(horizonDays))
+	numBlocks := (cfg.Simulations + mcBlockSize - 1) / mcBlockSize
+
+	blocks := make(chan int, numBlocks)
+	for b := 0; b < numBlocks; b++ {
+		blocks <- b
+	}
+	close(blocks)
+
+	workers := cfg.Workers
+	if workers > numBlocks {
+		workers = numBlocks
+	}
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			z := make([]float64, numAssets)
+			u := make([]uint32, numAssets)
+			assetReturn := make([]float64, numAssets)
+
+			for b := range blocks {
+				rng := rand.New(rand.NewPCG(cfg.Seed, uint64(b)))
+				start := b * mcBlockSize
+				end := start + mcBlockSize
+				if end > cfg.Simulations {
+					end = cfg.Simulations
+				}
+
+				for sim := start; sim < end; sim++ {
+					if cfg.Antithetic && (sim-start)%2 == 1 {
+						// Mirror the previous draw
+						for i := range z {
+							z[i] = -z[i]
+						}
+					} else if sobol != nil {
+						batch := sim / batchSize
+						if batch >= batches {
+							batch = batches - 1
+						}
+						index := uint64(sim-batch*batchSize) + 1 // skip the origin
+						if cfg.Antithetic {
+							index = uint64((sim-batch*batchSize)/2) + 1
+						}
+						sobol.point(index, shifts[batch], u)
+						for i := range z {
+							z[i] = distuv.UnitNormal.Quantile((float64(u[i]) + 0.5) / (1 << 32))
+						}
+					} else {
+						for i := range z {
+							z[i] = rng.NormFloat64()
+						}
+					}
+
+					model(z, rng, assetReturn)
+
+					portfolioReturn := 0.0
+					for i, weight := range weights {
+						portfolioReturn += weight * assetReturn[i]
+					}
+					simulated[sim] = portfolioReturn * scale
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	alpha := 1 - confidence
+
+	var varStdErr, esStdErr float64
+	if batches >= 2 {
+		batchVaR := make([]float64, batches)
+		batchES := make([]float64, batches)
+		for k := 0; k < batches; k++ {
+			end := (k + 1) * batchSize
+			if k == batches-1 {
+				end = cfg.Simulations
+			}
+			batch := append([]float64(nil), simulated[k*batchSize:end]...)
+			batchVaR[k], batchES[k] = tailRisk(batch, alpha)
+		}
+		varStdErr = StdDev(batchVaR) / math.Sqrt(float64(batches))
+		esStdErr = StdDev(batchES) / math.Sqrt(float64(batches))
+	}
+
+	varValue, esValue := tailRisk(simulated, alpha)
+
+	return &MonteCarloResult{
+		VaR:          varValue,
+		ES:           esValue,
+		VaRStdErr:    varStdErr,
+		ESStdErr:     esStdErr,
+		Confidence:   confidence,
+		HorizonDays:  horizonDays,
+		Seed:         cfg.Seed,
+		Simulations:  cfg.Simulations,
+		Workers:      workers,
+		Sampler:      cfg.Sampler,
+		Antithetic:   cfg.Antithetic,
+		Distribution: simulated,
+	}, nil
+}
+
+// tailRisk sorts returns in place and returns VaR and ES at tail probability alpha
+func tailRisk(returns []float64, alpha float64) (float64, float64) {
+	sort.Float64s(returns)
+	varValue := -Quantile(returns, alpha)
+
+	tailSize := int(math.Max(1, float64(len(returns))*alpha))
+	sum := 0.0
+	for i := 0; i < tailSize; i++ {
+		sum += returns[i]
+	}
+
+	return varValue, -sum / float64(tailSize)
+}
+
+func newSeed() uint64 {
+	var b [8]byte
+	if _, err := crand.Read(b[:]); err != nil {
+		return rand.Uint64() | 1
+	}
+	if seed := binary.LittleEndian.Uint64(b[:]); seed != 0 {
+		return seed
+	}
+	return 1
+}
+
+// sobolDirections holds the degree s, coefficients a and initial direction
+// numbers m of the primitive polynomials for dimensions 2..21 (Joe & Kuo)
+var sobolDirections = []struct {
+	s int
+	a uint32
+	m []uint32
+}{
+	{1, 0, []uint32{1}},
+	{2, 1, []uint32{1, 3}},
+	{3, 1, []uint32{1, 3, 1}},
+	{3, 2, []uint32{1, 1, 1}},
+	{4, 1, []uint32{1, 1, 3, 3}},
+	{4, 4, []uint32{1, 3, 5, 13}},
+	{5, 2, []uint32{1, 1, 5, 5, 17}},
+	{5, 4, []uint32{1, 1, 5, 5, 5}},
+	{5, 7, []uint32{1, 1, 7, 11, 19}},
+	{5, 11, []uint32{1, 1, 5, 1, 1}},
+	{5, 13, []uint32{1, 1, 1, 3, 11}},
+	{5, 14, []uint32{1, 3, 5, 5, 31}},
+	{6, 1, []uint32{1, 3, 3, 9, 7, 49}},
+	{6, 13, []uint32{1, 1, 1, 15, 21, 21}},
+	{6, 16, []uint32{1, 3, 1, 13, 27, 49}},
+	{6, 19, []uint32{1, 1, 1, 15, 7, 5}},
+	{6, 22, []uint32{1, 3, 1, 15, 13, 25}},
+	{6, 25, []uint32{1, 1, 5, 5, 19, 61}},
+	{7, 1, []uint32{1, 3, 7, 11, 23, 15, 103}},
+	{7, 4, []uint32{1, 3, 7, 13, 13, 15, 69}},
+}
+
+// MaxSobolDimension is the largest number of assets the Sobol sampler supports
+const MaxSobolDimension = 21
+
+type sobolSequence struct {
+	directions [][32]uint32
+}
+
+func newSobolSequence(dims int) (*sobolSequence, error) {
+	if dims > MaxSobolDimension {
+		return nil, fmt.Errorf("sobol sampler supports at most %d assets, got %d", MaxSobolDimension, dims)
+	}
+
+	seq := &sobolSequence{directions: make([][32]uint32, dims)}
+	for k := 0; k < 32; k++ {
+		seq.directions[0][k] = 1 << (31 - k)
+	}
+
+	for d := 1; d < dims; d++ {
+		p := sobolDirections[d-1]
+		v := &seq.directions[d]
+		for k := 0; k < 32; k++ {
+			if k < p.s {
+				v[k] = p.m[k] << (31 - k)
+				continue
+			}
+			v[k] = v[k-p.s] ^ (v[k-p.s] >> p.s)
+			for l := 1; l < p.s; l++ {
+				if (p.a>>(p.s-1-l))&1 == 1 {
+					v[k] ^= v[k-l]
+				}
+			}
+		}
+	}
+
+	return seq, nil
+}
+
+// point writes the digitally shifted n-th Sobol point, computed directly from
+// the Gray code of n so that blocks can be generated independently
+func (s *sobolSequence) point(n uint64, shift []uint32, out []uint32) {
+	gray := n ^ (n >> 1)
+	for d := range out {
+		x := shift[d]
+		for k := 0; gray>>k != 0 && k < 32; k++ {
+			if (gray>>k)&1 == 1 {
+				x ^= s.directions[d][k]
+			}
+		}
+		out[d] = x
+	}
+}
@@ -0,0 +1,205 @@
+package math
+
+import (
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"runtime"
+	"sort"
+	"sync"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// PathQuantiles are the probabilities reported for terminal wealth, drawdowns
+// and the per-period fan chart
+var PathQuantiles = []float64{0.05, 0.25, 0.5, 0.75, 0.95}
+
+// PathConfig controls a multi-period portfolio projection
+type PathConfig struct {
+	Paths          int
+	Periods        int     // number of projection periods
+	PeriodDays     int     // trading days per period, e.g. 21 for months
+	InitialValue   float64 // portfolio value at the start
+	Contribution   float64 // cash flow added each period, negative for withdrawals
+	RebalanceEvery int     // periods between rebalancing to target weights, 0 never rebalances
+	Goal           float64 // terminal wealth goal for the shortfall probability, 0 disables it
+	Seed           uint64  // 0 draws a fresh seed, reported in the result
+	Workers        int     // defaults to GOMAXPROCS
+}
+
+// PathResult summarises the simulated distribution of portfolio paths
+type PathResult struct {
+	TerminalQuantiles    []float64 // terminal wealth at PathQuantiles
+	MeanTerminal         float64
+	ShortfallProbability float64   // P(terminal wealth < goal)
+	DepletionProbability float64   // P(portfolio value reaches zero)
+	MaxDrawdownQuantiles []float64 // maximum drawdown at PathQuantiles
+	MeanMaxDrawdown      float64
+	PeriodQuantiles      [][]float64 // [period][quantile] portfolio value, period 0 is the start
+	Seed                 uint64
+	Paths                int
+}
+
+// SimulatePaths projects the portfolio over cfg.Periods periods. Per-period log
+// returns are multivariate normal with the daily mean and covariance of
+// assetReturns scaled to the period length. Contributions are invested at the
+// target weights, withdrawals are taken pro rata, and holdings drift between
+// rebalancing dates.
+func SimulatePaths(assetReturns [][]float64, targetWeights []float64, cfg PathConfig) (*PathResult, error) {
+	if len(assetReturns) == 0 || len(targetWeights) != len(assetReturns) {
+		return nil, fmt.Errorf("invalid input")
+	}
+	if cfg.Paths < 2 || cfg.Periods < 1 || cfg.PeriodDays < 1 {
+		return nil, fmt.Errorf("paths, periods and period length must be positive")
+	}
+	if cfg.InitialValue <= 0 {
+		return nil, fmt.Errorf("initial value must be positive")
+	}
+	if cfg.Workers <= 0 {
+		cfg.Workers = runtime.GOMAXPROCS(0)
+	}
+	if cfg.Seed == 0 {
+		cfg.Seed = newSeed()
+	}
+
+	numAssets := len(targetWeights)
+	cov, means := ReturnMoments(assetReturns)
+	cov.ScaleSym(float64(cfg.PeriodDays), cov)
+	chol, err := Cholesky(cov)
+	if err != nil {
+		return nil, err
+	}
+	var L mat.TriDense
+	chol.LTo(&L)
+
+	values := make([][]float64, cfg.Periods+1) // [period][path]
+	for t := range values {
+		values[t] = make([]float64, cfg.Paths)
+	}
+	drawdowns := make([]float64, cfg.Paths)
+
+	paths := make(chan int, cfg.Paths)
+	for p := 0; p < cfg.Paths; p++ {
+		paths <- p
+	}
+	close(paths)
+
+	var wg sync.WaitGroup
+	for w := 0; w < cfg.Workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			z := make([]float64, numAssets)
+			holdings := make([]float64, numAssets)
+
+			for p := range paths {
+				// One stream per path keeps results independent of the worker count
+				rng := rand.New(rand.NewPCG(cfg.Seed, uint64(p)))
+				for i := range holdings {
+					holdings[i] = cfg.InitialValue * targetWeights[i]
+				}
+				value, maxDrawdown := cfg.InitialValue, 0.0
+				// A time-weighted performance index, which cash flows do not move
+				index, peak := 1.0, 1.0
+				values[0][p] = value
+
+				for t := 1; t <= cfg.Periods; t++ {
+					for i := range z {
+						z[i] = rng.NormFloat64()
+					}
+					start := value
+					value = 0
+					for i := 0; i < numAssets; i++ {
+						logReturn := means[i] * float64(cfg.PeriodDays)
+						for j := 0; j <= i; j++ {
+							logReturn += L.At(i, j) * z[j]
+						}
+						holdings[i] *= math.Exp(logReturn)
+						value += holdings[i]
+					}
+
+					// Drawdown is measured on investment performance, before cash flows
+					if start > 0 {
+						index *= value / start
+					}
+					peak = math.Max(peak, index)
+					maxDrawdown = math.Max(maxDrawdown, 1-index/peak)
+
+					preFlow := value
+					value = math.Max(value+cfg.Contribution, 0)
+					switch {
+					case value == 0:
+						for i := range holdings {
+							holdings[i] = 0
+						}
+					case cfg.RebalanceEvery > 0 && t%cfg.RebalanceEvery == 0:
+						for i := range holdings {
+							holdings[i] = value * targetWeights[i]
+						}
+					case cfg.Contribution < 0:
+						// Withdrawals are taken pro rata so no holding goes short
+						for i := range holdings {
+							holdings[i] *= value / preFlow
+						}
+					default:
+						for i := range holdings {
+							holdings[i] += cfg.Contribution * targetWeights[i]
+						}
+					}
+					values[t][p] = value
+				}
+				drawdowns[p] = maxDrawdown
+			}
+		}()
+	}
+	wg.Wait()
+
+	result := &PathResult{
+		PeriodQuantiles: make([][]float64, cfg.Periods+1),
+		Seed:            cfg.Seed,
+		Paths:           cfg.Paths,
+	}
+
+	for t := range values {
+		sorted := append([]float64(nil), values[t]...)
+		sort.Float64s(sorted)
+		result.PeriodQuantiles[t] = quantilesOf(sorted)
+	}
+
+	terminal := append([]float64(nil), values[cfg.Periods]...)
+	sort.Float64s(terminal)
+	result.TerminalQuantiles = quantilesOf(terminal)
+	result.MeanTerminal = Mean(terminal)
+
+	shortfall, depleted := 0, 0
+	for _, v := range terminal {
+		if cfg.Goal > 0 && v < cfg.Goal {
+			shortfall++
+		}
+	}
+	for p := 0; p < cfg.Paths; p++ {
+		for t := 1; t <= cfg.Periods; t++ {
+			if values[t][p] == 0 {
+				depleted++
+				break
+			}
+		}
+	}
+	result.ShortfallProbability = float64(shortfall) / float64(cfg.Paths)
+	result.DepletionProbability = float64(depleted) / float64(cfg.Paths)
+
+	sort.Float64s(drawdowns)
+	result.MaxDrawdownQuantiles = quantilesOf(drawdowns)
+	result.MeanMaxDrawdown = Mean(drawdowns)
+
+	return result, nil
+}
+
+func quantilesOf(sorted []float64) []float64 {
+	q := make([]float64, len(PathQuantiles))
+	for i, p := range PathQuantiles {
+		q[i] = empiricalQuantile(sorted, p)
+	}
+	return q
+}
@@ -2,6 +2,7 @@ package math
 
 import (
 	"math"
+	"sort"
 	"time"
 )
 
@@ -69,3 +70,55 @@ func RollingVolatility(returns []float64, window int) []float64 {
 	
 	return rolling
 }
+
+// AlignReturns builds return series for the given symbols over the dates on
+// which every symbol has a close, so that the i-th return of each series refers
+// to the same period. dates[t] is the date at the end of period t.
+func AlignReturns(prices map[string][]PricePoint, symbols []string, logReturns bool) ([]time.Time, [][]float64) {
+	if len(symbols) == 0 {
+		return nil, nil
+	}
+
+	closes := make([]map[time.Time]float64, len(symbols))
+	for i, symbol := range symbols {
+		closes[i] = make(map[time.Time]float64, len(prices[symbol]))
+		for _, p := range prices[symbol] {
+			closes[i][truncateToDay(p.Date)] = p.Close
+		}
+	}
+
+	dates := make([]time.Time, 0, len(closes[0]))
+	for date := range closes[0] {
+		shared := true
+		for i := 1; i < len(closes); i++ {
+			if _, ok := closes[i][date]; !ok {
+				shared = false
+				break
+			}
+		}
+		if shared {
+			dates = append(dates, date)
+		}
+	}
+	sort.Slice(dates, func(i, j int) bool { return dates[i].Before(dates[j]) })
+
+	if len(dates) < 2 {
+		return nil, make([][]float64, len(symbols))
+	}
+
+	returns := make([][]float64, len(symbols))
+	for i := range symbols {
+		series := make([]PricePoint, len(dates))
+		for t, date := range dates {
+			series[t] = PricePoint{Date: date, Close: closes[i][date]}
+		}
+		returns[i] = CalculateReturns(series, logReturns)
+	}
+
+	return dates[1:], returns
+}
+
+func truncateToDay(t time.Time) time.Time {
+	y, m, d := t.UTC().Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
@@ -0,0 +1,127 @@
+package math
+
+import (
+	"fmt"
+	"math"
+
+	"gonum.org/v1/gonum/mat"
+	"gonum.org/v1/gonum/stat/distuv"
+)
+
+// ReverseStressResult is the most plausible scenario producing a target loss
+type ReverseStressResult struct {
+	Loss                float64
+	Shocks              []float64 // per-asset return over the horizon
+	PnL                 []float64 // per-asset P&L implied by the shocks
+	FactorShocks        []float64 // principal component moves, factor mode only
+	MahalanobisDistance float64
+	Plausibility        float64 // probability of a portfolio loss at least this large
+}
+
+// ReverseStressTest finds the asset return vector x of minimum Mahalanobis
+// distance under the covariance Σ of assetReturns for which the portfolio loses
+// exactly loss, i.e. -e'x = loss. The solution is x = -loss·Σe / (e'Σe) and its
+// distance is loss / σp, so it does not require Σ to be invertible.
+func ReverseStressTest(assetReturns [][]float64, exposures []float64, loss float64, horizonDays int) (*ReverseStressResult, error) {
+	if len(assetReturns) == 0 || len(assetReturns) != len(exposures) {
+		return nil, fmt.Errorf("invalid input")
+	}
+	if loss <= 0 {
+		return nil, fmt.Errorf("loss must be positive")
+	}
+
+	cov, _ := ReturnMoments(assetReturns)
+	cov.ScaleSym(float64(horizonDays), cov)
+
+	e := mat.NewVecDense(len(exposures), exposures)
+	var sigmaE mat.VecDense
+	sigmaE.MulVec(cov, e)
+	variance := mat.Dot(e, &sigmaE)
+	if variance <= 0 {
+		return nil, fmt.Errorf("portfolio has zero variance")
+	}
+
+	shocks := make([]float64, len(exposures))
+	for i := range shocks {
+		shocks[i] = -loss * sigmaE.AtVec(i) / variance
+	}
+
+	return newReverseStressResult(loss, shocks, exposures, loss/math.Sqrt(variance)), nil
+}
+
+// ReverseStressTestFactors solves the reverse stress test in the space of the
+// leading principal components of the covariance matrix: asset moves are
+// restricted to x = Bf where B holds the top numFactors eigenvectors and the
+// factor moves f have variances Λ. The most plausible factor move is
+// f = -loss·ΛB'e / (e'BΛB'e).
+func ReverseStressTestFactors(assetReturns [][]float64, exposures []float64, loss float64, horizonDays, numFactors int) (*ReverseStressResult, error) {
+	if len(assetReturns) == 0 || len(assetReturns) != len(exposures) {
+		return nil, fmt.Errorf("invalid input")
+	}
+	if loss <= 0 {
+		return nil, fmt.Errorf("loss must be positive")
+	}
+
+	numAssets := len(exposures)
+	if numFactors <= 0 || numFactors > numAssets {
+		numFactors = numAssets
+	}
+
+	cov, _ := ReturnMoments(assetReturns)
+	cov.ScaleSym(float64(horizonDays), cov)
+
+	var eigen mat.EigenSym
+	if ok := eigen.Factorize(cov, true); !ok {
+		return nil, fmt.Errorf("eigenvalue decomposition failed")
+	}
+	values := eigen.Values(nil)
+	var vectors mat.Dense
+	eigen.VectorsTo(&vectors)
+
+	// Eigenvalues come back in ascending order, the leading factors are at the end
+	factorExposure := make([]float64, numFactors) // B'e
+	factorVariance := make([]float64, numFactors) // Λ
+	loadings := make([][]float64, numFactors)
+	variance := 0.0
+	for k := 0; k < numFactors; k++ {
+		col := numAssets - 1 - k
+		loadings[k] = make([]float64, numAssets)
+		mat.Col(loadings[k], col, &vectors)
+		for i := 0; i < numAssets; i++ {
+			factorExposure[k] += loadings[k][i] * exposures[i]
+		}
+		factorVariance[k] = math.Max(values[col], 0)
+		variance += factorVariance[k] * factorExposure[k] * factorExposure[k]
+	}
+	if variance <= 0 {
+		return nil, fmt.Errorf("portfolio has no exposure to the leading factors")
+	}
+
+	factorShocks := make([]float64, numFactors)
+	shocks := make([]float64, numAssets)
+	for k := 0; k < numFactors; k++ {
+		factorShocks[k] = -loss * factorVariance[k] * factorExposure[k] / variance
+		for i := 0; i < numAssets; i++ {
+			shocks[i] += loadings[k][i] * factorShocks[k]
+		}
+	}
+
+	result := newReverseStressResult(loss, shocks, exposures, loss/math.Sqrt(variance))
+	result.FactorShocks = factorShocks
+	return result, nil
+}
+
+func newReverseStressResult(loss float64, shocks, exposures []float64, distance float64) *ReverseStressResult {
+	pnl := make([]float64, len(shocks))
+	for i := range shocks {
+		pnl[i] = shocks[i] * exposures[i]
+	}
+
+	return &ReverseStressResult{
+		Loss:                loss,
+		Shocks:              shocks,
+		PnL:                 pnl,
+		MahalanobisDistance: distance,
+		Plausibility:        distuv.UnitNormal.Survival(distance),
+	}
+}
@@ -1,20 +1,48 @@
 package math
 
 import (
+	"fmt"
+	"math"
 	"time"
+
+	"gonum.org/v1/gonum/mat"
+	"gonum.org/v1/gonum/stat/distuv"
 )
 
 type StressScenarioResult struct {
-	Name        string
-	DeltaNAV    float64
-	DeltaVaR    float64
-	AssetImpact map[string]float64
+	Name         string
+	DeltaNAV     float64
+	DeltaVaR     float64
+	BaseVaR      float64
+	StressedVaR  float64
+	PostShockNAV float64
+	AssetImpact  map[string]float64
 }
 
 type StressTestResult struct {
 	Scenarios []StressScenarioResult
 }
 
+// StressedVaRResult describes the Basel-style stressed VaR: the worst VaR
+// observed over any rolling calibration window in the available history.
+type StressedVaRResult struct {
+	VaR         float64
+	WindowStart int // index of the first return in the worst window
+	WindowEnd   int // index one past the last return in the worst window
+	Confidence  float64
+	HorizonDays int
+}
+
+// Correlation regimes accepted by RegimeAdjustedCovariance
+const (
+	RegimeCurrent = "current"
+	RegimeTight   = "tight"
+	RegimeLoose   = "loose"
+)
+
+// regimeBlend is how far correlations are pulled towards 1 (tight) or 0 (loose)
+const regimeBlend = 0.5
+
 func ApplyHistoricalStress(
 	positions map[string]float64,
 	prices map[string][]PricePoint,
@@ -30,12 +58,13 @@ func ApplyHistoricalStress(
 			continue
 		}
 		
+		// First close on or after the start date, last close on or before the end date
 		var startPrice, endPrice float64
 		for _, p := range priceHistory {
-			if p.Date.Equal(startDate) || (p.Date.After(startDate) && startPrice == 0) {
-				startPrice = p.Close
-			}
-			if p.Date.Equal(endDate) || (p.Date.Before(endDate) && endPrice == 0) {
+			if !p.Date.Before(startDate) && !p.Date.After(endDate) {
+				if startPrice == 0 {
+					startPrice = p.Close
+				}
 				endPrice = p.Close
 			}
 		}
@@ -88,3 +117,119 @@ func ApplyCustomStress(
 		AssetImpact: assetImpact,
 	}, nil
 }
+
+// DeltaNormalVaR returns the zero-mean delta-normal VaR of a vector of exposures
+// under the given covariance matrix. Exposures expressed as weights give VaR in
+// return units, exposures expressed as market values give VaR in currency.
+func DeltaNormalVaR(exposures []float64, cov *mat.SymDense, confidence float64, horizonDays int) float64 {
+	z := distuv.UnitNormal.Quantile(confidence)
+	return z * PortfolioStdDev(exposures, cov) * math.Sqrt(float64(horizonDays))
+}
+
+// ApplyStressedVaR revalues the portfolio after the scenario's asset impacts and
+// recomputes VaR under the stressed covariance, filling the VaR fields of result.
+// symbols gives the asset order of both covariance matrices.
+func ApplyStressedVaR(
+	result *StressScenarioResult,
+	symbols []string,
+	positions map[string]float64,
+	baseCov, stressedCov *mat.SymDense,
+	confidence float64,
+	horizonDays int,
+) error {
+	if n, _ := baseCov.Dims(); n != len(symbols) {
+		return fmt.Errorf("base covariance has %d assets, expected %d", n, len(symbols))
+	}
+	if n, _ := stressedCov.Dims(); n != len(symbols) {
+		return fmt.Errorf("stressed covariance has %d assets, expected %d", n, len(symbols))
+	}
+
+	baseExposures := make([]float64, len(symbols))
+	shockedExposures := make([]float64, len(symbols))
+	nav := 0.0
+	for _, marketValue := range positions {
+		nav += marketValue
+	}
+	for i, symbol := range symbols {
+		baseExposures[i] = positions[symbol]
+		shockedExposures[i] = positions[symbol] + result.AssetImpact[symbol]
+	}
+
+	result.BaseVaR = DeltaNormalVaR(baseExposures, baseCov, confidence, horizonDays)
+	result.StressedVaR = DeltaNormalVaR(shockedExposures, stressedCov, confidence, horizonDays)
+	result.DeltaVaR = result.StressedVaR - result.BaseVaR
+	result.PostShockNAV = nav + result.DeltaNAV
+
+	return nil
+}
+
+// RegimeAdjustedCovariance keeps asset volatilities but moves correlations
+// towards 1 (tight) or towards 0 (loose). Both blends preserve positive
+// semi-definiteness of the correlation matrix.
+func RegimeAdjustedCovariance(cov *mat.SymDense, regime string) (*mat.SymDense, error) {
+	n, _ := cov.Dims()
+	adjusted := mat.NewSymDense(n, nil)
+	adjusted.CopySym(cov)
+
+	var target float64
+	switch regime {
+	case "", RegimeCurrent:
+		return adjusted, nil
+	case RegimeTight:
+		target = 1
+	case RegimeLoose:
+		target = 0
+	default:
+		return nil, fmt.Errorf("unknown correlation regime: %s", regime)
+	}
+
+	vols := make([]float64, n)
+	for i := 0; i < n; i++ {
+		vols[i] = math.Sqrt(cov.At(i, i))
+	}
+
+	for i := 0; i < n; i++ {
+		for j := i + 1; j < n; j++ {
+			if vols[i] == 0 || vols[j] == 0 {
+				continue
+			}
+			rho := cov.At(i, j) / (vols[i] * vols[j])
+			rho = (1-regimeBlend)*rho + regimeBlend*target
+			adjusted.SetSym(i, j, rho*vols[i]*vols[j])
+		}
+	}
+
+	return adjusted, nil
+}
+
+// CalculateStressedVaR slides a calibration window over the portfolio return
+// history and returns the window producing the highest historical VaR. When the
+// history is shorter than the window the whole history is used.
+func CalculateStressedVaR(portfolioReturns []float64, windowSize int, confidence float64, horizonDays int) (*StressedVaRResult, error) {
+	if len(portfolioReturns) == 0 {
+		return nil, fmt.Errorf("no returns data")
+	}
+	if windowSize <= 0 || windowSize > len(portfolioReturns) {
+		windowSize = len(portfolioReturns)
+	}
+
+	worst := &StressedVaRResult{
+		VaR:         math.Inf(-1),
+		Confidence:  confidence,
+		HorizonDays: horizonDays,
+	}
+
+	for start := 0; start+windowSize <= len(portfolioReturns); start++ {
+		varResult, err := CalculateHistoricalVaR(portfolioReturns[start:start+windowSize], confidence, horizonDays)
+		if err != nil {
+			return nil, err
+		}
+		if varResult.VaR > worst.VaR {
+			worst.VaR = varResult.VaR
+			worst.WindowStart = start
+			worst.WindowEnd = start + windowSize
+		}
+	}
+
+	return worst, nil
+}
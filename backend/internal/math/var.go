@@ -3,7 +3,6 @@ package math
 import (
 	"fmt"
 	"math"
-	"sort"
 
 	"gonum.org/v1/gonum/mat"
 	"gonum.org/v1/gonum/stat/distuv"
@@ -73,6 +72,8 @@ func CalculateParametricVaR(portfolioReturns []float64, confidence float64, hori
 	}, nil
 }
 
+// CalculateMonteCarloVaR estimates VaR by simulation with the parallel engine
+// and default settings; use RunMonteCarlo for seeding and variance reduction
 func CalculateMonteCarloVaR(
 	assetReturns [][]float64,
 	weights []float64,
@@ -84,66 +85,40 @@ func CalculateMonteCarloVaR(
 		return nil, fmt.Errorf("invalid input")
 	}
 	
+	result, err := RunMonteCarlo(assetReturns, weights, confidence, horizonDays, MonteCarloConfig{
+		Simulations: simulations,
+	})
+	if err != nil {
+		return nil, err
+	}
+	
+	return &VaRResult{
+		VaR:          result.VaR,
+		Method:       "monte_carlo",
+		Confidence:   confidence,
+		HorizonDays:  horizonDays,
+		Distribution: result.Distribution,
+	}, nil
+}
+
+// ReturnMoments estimates the mean vector and covariance matrix of aligned
+// per-asset return series
+func ReturnMoments(assetReturns [][]float64) (*mat.SymDense, []float64) {
 	numAssets := len(assetReturns)
 	numPeriods := len(assetReturns[0])
-	
+
 	returnsMatrix := mat.NewDense(numPeriods, numAssets, nil)
 	for i := 0; i < numAssets; i++ {
 		for j := 0; j < numPeriods; j++ {
 			returnsMatrix.Set(j, i, assetReturns[i][j])
 		}
 	}
-	
+
 	cov := Covariance(returnsMatrix)
 	means := make([]float64, numAssets)
 	for i := 0; i < numAssets; i++ {
 		means[i] = Mean(assetReturns[i])
 	}
-	
-	chol, err := Cholesky(cov)
-	if err != nil {
-		return nil, err
-	}
-	
-	// Get L matrix directly
-	L := mat.NewTriDense(numAssets, mat.Lower, nil)
-	for i := 0; i < numAssets; i++ {
-		for j := 0; j <= i; j++ {
-			L.SetTri(i, j, chol.At(i, j))
-		}
-	}
-	
-	simulatedReturns := make([]float64, simulations)
-	normal := distuv.Normal{Mu: 0, Sigma: 1}
-	
-	for sim := 0; sim < simulations; sim++ {
-		z := mat.NewVecDense(numAssets, nil)
-		for i := 0; i < numAssets; i++ {
-			z.SetVec(i, normal.Rand())
-		}
-		
-		var sampledReturns mat.VecDense
-		sampledReturns.MulVec(L, z)
-		
-		portfolioReturn := 0.0
-		for i := 0; i < numAssets; i++ {
-			assetReturn := means[i] + sampledReturns.AtVec(i)
-			portfolioReturn += weights[i] * assetReturn
-		}
-		
-		scaleFactor := math.Sqrt(float64(horizonDays))
-		simulatedReturns[sim] = portfolioReturn * scaleFactor
-	}
-	
-	sort.Float64s(simulatedReturns)
-	alpha := 1 - confidence
-	varValue := -Quantile(simulatedReturns, alpha)
-	
-	return &VaRResult{
-		VaR:          varValue,
-		Method:       "monte_carlo",
-		Confidence:   confidence,
-		HorizonDays:  horizonDays,
-		Distribution: simulatedReturns,
-	}, nil
+
+	return cov, means
 }
@@ -0,0 +1,76 @@
+// Package notify delivers risk limit alerts. A Notifier sends an alert
+// somewhere: a webhook, an email, or several of them at once.
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/reserveone/saa-risk-analyzer/internal/config"
+)
+
+// Alert reports a risk limit changing state
+type Alert struct {
+	LimitID       uuid.UUID `json:"limit_id"`
+	LimitName     string    `json:"limit_name"`
+	LimitType     string    `json:"limit_type"`
+	PortfolioID   uuid.UUID `json:"portfolio_id"`
+	PortfolioName string    `json:"portfolio_name"`
+	State         string    `json:"state"` // ok, warning, breach
+	PreviousState string    `json:"previous_state"`
+	Value         float64   `json:"value"`
+	Min           *float64  `json:"min,omitempty"`
+	Max           float64   `json:"max"`
+	Utilization   float64   `json:"utilization"`
+	Detail        string    `json:"detail,omitempty"`
+	At            time.Time `json:"at"`
+}
+
+// Subject is a one-line summary of the alert
+func (a Alert) Subject() string {
+	return fmt.Sprintf("[%s] %s: %s limit %q at %.0f%%",
+		a.State, a.PortfolioName, a.LimitType, a.LimitName, a.Utilization*100)
+}
+
+// Notifier delivers alerts
+type Notifier interface {
+	Notify(ctx context.Context, alert Alert) error
+}
+
+// Multi notifies each of its notifiers, returning their errors joined
+type Multi []Notifier
+
+func (m Multi) Notify(ctx context.Context, alert Alert) error {
+	var errs []error
+	for _, n := range m {
+		if err := n.Notify(ctx, alert); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// New returns the notifiers configured: a webhook if ALERT_WEBHOOK_URL is
+// set, and email if ALERT_SMTP_ADDR and recipients are. None are configured
+// by default, and alerts are only recorded.
+func New(cfg config.AlertConfig) Multi {
+	var notifiers Multi
+	if cfg.WebhookURL != "" {
+		notifiers = append(notifiers, NewWebhook(cfg.WebhookURL, cfg.WebhookSecret, cfg.Timeout))
+	}
+	if cfg.SMTPAddr != "" && len(cfg.SMTPTo) > 0 {
+		notifiers = append(notifiers, &SMTP{
+			Addr:     cfg.SMTPAddr,
+			Username: cfg.SMTPUsername,
+			Password: cfg.SMTPPassword,
+			From:     cfg.SMTPFrom,
+			To:       cfg.SMTPTo,
+			Timeout:  cfg.Timeout,
+		})
+	}
+	return notifiers
+}
@@ -0,0 +1,113 @@
+package notify
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// SMTP emails alerts as plain text. It upgrades to TLS when the server
+// offers STARTTLS, and authenticates with PLAIN when a username is set.
+type SMTP struct {
+	Addr     string // host:port
+	Username string
+	Password string
+	From     string
+	To       []string
+	Timeout  time.Duration
+}
+
+func (s *SMTP) Notify(ctx context.Context, alert Alert) error {
+	host, _, err := net.SplitHostPort(s.Addr)
+	if err != nil {
+		return fmt.Errorf("smtp: invalid address %q: %w", s.Addr, err)
+	}
+	timeout := s.Timeout
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+	deadline := time.Now().Add(timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+
+	dialer := net.Dialer{Deadline: deadline}
+	conn, err := dialer.DialContext(ctx, "tcp", s.Addr)
+	if err != nil {
+		return fmt.Errorf("smtp: %w", err)
+	}
+	conn.SetDeadline(deadline)
+
+	client, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("smtp: %w", err)
+	}
+	defer client.Close()
+
+	if err := s.send(client, host, alert); err != nil {
+		return fmt.Errorf("smtp: %w", err)
+	}
+	return client.Quit()
+}
+
+func (s *SMTP) send(client *smtp.Client, host string, alert Alert) error {
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	}
+	if s.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", s.Username, s.Password, host)); err != nil {
+			return err
+		}
+	}
+	if err := client.Mail(s.From); err != nil {
+		return err
+	}
+	for _, to := range s.To {
+		if err := client.Rcpt(to); err != nil {
+			return err
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(s.message(alert)); err != nil {
+		return err
+	}
+	return w.Close()
+}
+
+// message formats an alert as an RFC 5322 message
+func (s *SMTP) message(alert Alert) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", s.From)
+	fmt.Fprintf(&b, "To: %s\r\n", strings.Join(s.To, ", "))
+	fmt.Fprintf(&b, "Subject: %s\r\n", strings.NewReplacer("\r", " ", "\n", " ").Replace(alert.Subject()))
+	fmt.Fprintf(&b, "Date: %s\r\n", alert.At.Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("\r\n")
+
+	fmt.Fprintf(&b, "Portfolio:   %s (%s)\r\n", alert.PortfolioName, alert.PortfolioID)
+	fmt.Fprintf(&b, "Limit:       %s (%s)\r\n", alert.LimitName, alert.LimitType)
+	fmt.Fprintf(&b, "State:       %s, was %s\r\n", alert.State, alert.PreviousState)
+	fmt.Fprintf(&b, "Value:       %.4f\r\n", alert.Value)
+	if alert.Min != nil {
+		fmt.Fprintf(&b, "Band:        %.4f to %.4f\r\n", *alert.Min, alert.Max)
+	} else {
+		fmt.Fprintf(&b, "Maximum:     %.4f\r\n", alert.Max)
+	}
+	fmt.Fprintf(&b, "Utilization: %.1f%%\r\n", alert.Utilization*100)
+	if alert.Detail != "" {
+		fmt.Fprintf(&b, "Detail:      %s\r\n", alert.Detail)
+	}
+	fmt.Fprintf(&b, "At:          %s\r\n", alert.At.UTC().Format(time.RFC3339))
+	return []byte(b.String())
+}
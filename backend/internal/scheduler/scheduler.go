@@ -0,0 +1,527 @@
+// Package scheduler runs risk calculations on cron schedules. Due schedules
+// queue jobs on the job queue; several API instances may run schedulers on
+// one database, each schedule being claimed by one of them.
+package scheduler
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+	_ "time/tzdata" // schedules name IANA zones whether or not the host has them
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/reserveone/saa-risk-analyzer/internal/config"
+	"github.com/reserveone/saa-risk-analyzer/internal/domain"
+	"github.com/reserveone/saa-risk-analyzer/internal/jobs"
+	"github.com/reserveone/saa-risk-analyzer/internal/service"
+)
+
+// Missed-run policies: what a schedule does about fire times that passed
+// while no scheduler ran. There is no policy running each of them: the
+// calculations measure the portfolio as it is now, so every run would give
+// the same result.
+const (
+	MissedSkip    = "skip"     // skip them
+	MissedRunOnce = "run_once" // run once for the latest of them
+)
+
+// Run triggers
+const (
+	TriggerSchedule = "schedule"
+	TriggerCatchUp  = "catch_up"
+	TriggerManual   = "manual"
+)
+
+// Run statuses
+const (
+	RunQueued  = "queued"  // every job was queued
+	RunPartial = "partial" // some jobs could not be queued
+	RunFailed  = "failed"  // no job could be queued
+	RunSkipped = "skipped" // missed fire times that did not run
+)
+
+const (
+	defaultInterval = 30 * time.Second
+	defaultGrace    = 5 * time.Minute
+	defaultRunLimit = 50
+	maxRunLimit     = 500
+)
+
+// ErrInvalidSchedule wraps the validation errors of schedule requests
+var ErrInvalidSchedule = errors.New("invalid schedule")
+
+var (
+	MissedRunPolicies = []string{MissedSkip, MissedRunOnce}
+	CalculationTypes  = []string{jobs.TypeVaR, jobs.TypeCVaR, jobs.TypeStress, jobs.TypeBacktest, jobs.TypeRiskContribution, jobs.TypeSnapshot}
+)
+
+// inputs returns the request of each job type a schedule can run
+var inputs = map[string]func() interface{}{
+	jobs.TypeVaR:              func() interface{} { return &domain.VaRRequest{} },
+	jobs.TypeCVaR:             func() interface{} { return &domain.VaRRequest{} },
+	jobs.TypeStress:           func() interface{} { return &domain.StressTestRequest{} },
+	jobs.TypeBacktest:         func() interface{} { return &domain.BacktestVaRRequest{} },
+	jobs.TypeRiskContribution: func() interface{} { return &domain.RiskContributionRequest{} },
+	jobs.TypeSnapshot:         func() interface{} { return &domain.SnapshotRequest{} },
+}
+
+// Input returns the request a scheduled calculation queues for a portfolio:
+// its params with the portfolio_id, decoded into the job type's request
+func Input(calc domain.ScheduledCalculation, portfolioID uuid.UUID) (interface{}, error) {
+	newInput, ok := inputs[calc.Type]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown calculation type %q, expected one of %s",
+			ErrInvalidSchedule, calc.Type, strings.Join(CalculationTypes, ", "))
+	}
+
+	params := make(map[string]interface{}, len(calc.Params)+1)
+	for k, v := range calc.Params {
+		params[k] = v
+	}
+	params["portfolio_id"] = portfolioID
+	data, err := json.Marshal(params)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s params: %v", ErrInvalidSchedule, calc.Type, err)
+	}
+
+	input := newInput()
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(input); err != nil {
+		return nil, fmt.Errorf("%w: %s params: %v", ErrInvalidSchedule, calc.Type, err)
+	}
+	if snapshot, ok := input.(*domain.SnapshotRequest); ok {
+		snapshot.Source = service.SnapshotSourceSchedule
+	}
+	return input, nil
+}
+
+// PlannedRun is a fire time to run
+type PlannedRun struct {
+	At      time.Time
+	Trigger string // schedule, or catch_up for a missed fire time
+}
+
+// Plan is what a due schedule does now
+type Plan struct {
+	Runs         []PlannedRun // oldest first
+	Skipped      int          // missed fire times that do not run
+	FirstSkipped time.Time
+	Next         time.Time // first fire time after now, zero if there is none
+}
+
+// PlanRuns plans the fire times of cron from due, the schedule's next run,
+// to now. Fire times at most grace old run; older ones were missed while no
+// scheduler ran, and policy decides which of them run. A missed run is not
+// caught up under run_once when a fire time runs on time anyway.
+func PlanRuns(cron *Cron, loc *time.Location, due, now time.Time, policy string, grace time.Duration) Plan {
+	var plan Plan
+	var onTime []time.Time
+	var lastMissed time.Time
+	for t := due.In(loc); !t.IsZero() && !t.After(now); t = cron.Next(t) {
+		if now.Sub(t) <= grace {
+			onTime = append(onTime, t)
+			continue
+		}
+		if plan.Skipped == 0 {
+			plan.FirstSkipped = t
+		}
+		plan.Skipped++
+		lastMissed = t
+	}
+
+	if policy == MissedRunOnce && plan.Skipped > 0 && len(onTime) == 0 {
+		plan.Runs = append(plan.Runs, PlannedRun{At: lastMissed, Trigger: TriggerCatchUp})
+		plan.Skipped--
+	}
+	if plan.Skipped == 0 {
+		plan.FirstSkipped = time.Time{}
+	}
+
+	for _, t := range onTime {
+		plan.Runs = append(plan.Runs, PlannedRun{At: t, Trigger: TriggerSchedule})
+	}
+	plan.Next = cron.Next(now.In(loc))
+	return plan
+}
+
+// Scheduler stores schedules and queues the jobs of those due
+type Scheduler struct {
+	db    *gorm.DB
+	queue *jobs.Queue
+	cfg   config.SchedulerConfig
+
+	done chan struct{}
+	wg   sync.WaitGroup
+	once sync.Once
+}
+
+func New(db *gorm.DB, queue *jobs.Queue, cfg config.SchedulerConfig) *Scheduler {
+	if cfg.Interval <= 0 {
+		cfg.Interval = defaultInterval
+	}
+	if cfg.Grace <= 0 {
+		cfg.Grace = defaultGrace
+	}
+	return &Scheduler{db: db, queue: queue, cfg: cfg, done: make(chan struct{})}
+}
+
+// Start runs due schedules now and then every interval, until Close
+func (s *Scheduler) Start() {
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		ticker := time.NewTicker(s.cfg.Interval)
+		defer ticker.Stop()
+		for {
+			if err := s.RunDue(time.Now()); err != nil {
+				fmt.Printf("Warning: failed to run due schedules: %v\n", err)
+			}
+			select {
+			case <-s.done:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Close stops the scheduler and waits for a pass in progress
+func (s *Scheduler) Close() {
+	s.once.Do(func() { close(s.done) })
+	s.wg.Wait()
+}
+
+// RunDue runs every schedule due at now. Each is claimed with SELECT ...
+// FOR UPDATE SKIP LOCKED and runs in its own transaction, which also stores
+// its jobs, so schedulers of several instances never run one twice.
+func (s *Scheduler) RunDue(now time.Time) error {
+	for {
+		ran := false
+		var queued []*domain.Job
+		err := s.db.Transaction(func(tx *gorm.DB) error {
+			var due []domain.Schedule
+			err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+				Where("enabled AND next_run_at <= ?", now).
+				Order("next_run_at").
+				Limit(1).
+				Find(&due).Error
+			if err != nil || len(due) == 0 {
+				return err
+			}
+			ran = true
+			queued, err = s.runDue(tx, &due[0], now)
+			return err
+		})
+		if err != nil || !ran {
+			return err
+		}
+		s.queue.Queued(queued...)
+	}
+}
+
+// runDue runs a due schedule in tx and returns the jobs it stored
+func (s *Scheduler) runDue(tx *gorm.DB, schedule *domain.Schedule, now time.Time) ([]*domain.Job, error) {
+	cron, loc, err := parseSchedule(schedule.Cron, schedule.Timezone)
+	if err != nil {
+		// Stored before validation changed: disable rather than retry forever
+		schedule.Enabled = false
+		schedule.NextRunAt = nil
+		run := &domain.ScheduleRun{ScheduleID: schedule.ID, ScheduledFor: now, Trigger: TriggerSchedule, Status: RunFailed, Error: err.Error()}
+		if err := tx.Create(run).Error; err != nil {
+			return nil, err
+		}
+		return nil, tx.Model(schedule).Select("enabled", "next_run_at").Updates(schedule).Error
+	}
+
+	plan := PlanRuns(cron, loc, *schedule.NextRunAt, now, schedule.MissedRuns, s.cfg.Grace)
+	if plan.Skipped > 0 {
+		run := &domain.ScheduleRun{
+			ScheduleID:   schedule.ID,
+			ScheduledFor: plan.FirstSkipped,
+			Trigger:      TriggerSchedule,
+			Status:       RunSkipped,
+			Skipped:      plan.Skipped,
+			Error:        fmt.Sprintf("%d fire times missed while no scheduler ran", plan.Skipped),
+		}
+		if err := tx.Create(run).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	var queued []*domain.Job
+	if len(plan.Runs) > 0 {
+		portfolios, err := portfolioIDs(tx, schedule)
+		if err != nil {
+			return nil, err
+		}
+		for _, planned := range plan.Runs {
+			_, stored, err := s.run(tx, schedule, portfolios, planned.At, planned.Trigger)
+			if err != nil {
+				return nil, err
+			}
+			queued = append(queued, stored...)
+		}
+		schedule.LastRunAt = &now
+	}
+
+	schedule.NextRunAt = nil
+	if !plan.Next.IsZero() {
+		schedule.NextRunAt = &plan.Next
+	}
+	if err := tx.Model(schedule).Select("next_run_at", "last_run_at").Updates(schedule).Error; err != nil {
+		return nil, err
+	}
+	return queued, nil
+}
+
+// run stores a schedule's calculations for each portfolio as jobs, and the
+// run, in tx. It returns the run and its jobs, for the queue to announce once
+// tx commits; jobs that could not be queued are recorded on the run.
+func (s *Scheduler) run(tx *gorm.DB, schedule *domain.Schedule, portfolios []uuid.UUID, at time.Time, trigger string) (*domain.ScheduleRun, []*domain.Job, error) {
+	run := &domain.ScheduleRun{ScheduleID: schedule.ID, ScheduledFor: at, Trigger: trigger}
+	if len(portfolios) == 0 {
+		run.Status = RunFailed
+		run.Error = "no portfolios"
+		return run, nil, tx.Create(run).Error
+	}
+
+	var queued []*domain.Job
+	var errs []string
+	for _, portfolioID := range portfolios {
+		for _, calc := range schedule.Calculations {
+			input, err := Input(calc, portfolioID)
+			if err == nil {
+				var job *domain.Job
+				job, err = s.queue.NewJob(calc.Type, input, jobs.Options{Priority: schedule.Priority})
+				if err == nil {
+					if err := tx.Create(job).Error; err != nil {
+						return nil, nil, err
+					}
+					queued = append(queued, job)
+					run.JobIDs = append(run.JobIDs, job.ID)
+					continue
+				}
+			}
+			errs = append(errs, fmt.Sprintf("%s for %s: %v", calc.Type, portfolioID, err))
+		}
+	}
+
+	switch {
+	case len(errs) == 0:
+		run.Status = RunQueued
+	case len(run.JobIDs) == 0:
+		run.Status = RunFailed
+	default:
+		run.Status = RunPartial
+	}
+	run.Error = strings.Join(errs, "; ")
+	if err := tx.Create(run).Error; err != nil {
+		return nil, nil, err
+	}
+	return run, queued, nil
+}
+
+// portfolioIDs returns the portfolios a schedule runs for
+func portfolioIDs(db *gorm.DB, schedule *domain.Schedule) ([]uuid.UUID, error) {
+	if len(schedule.PortfolioIDs) > 0 {
+		return schedule.PortfolioIDs, nil
+	}
+	var ids []uuid.UUID
+	err := db.Model(&domain.Portfolio{}).Order("created_at").Pluck("id", &ids).Error
+	return ids, err
+}
+
+// Trigger runs a schedule now, whether or not it is enabled, leaving its next
+// run as it is
+func (s *Scheduler) Trigger(id uuid.UUID) (*domain.ScheduleRun, error) {
+	schedule, err := s.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	portfolios, err := portfolioIDs(s.db, schedule)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	var run *domain.ScheduleRun
+	var queued []*domain.Job
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if run, queued, err = s.run(tx, schedule, portfolios, now, TriggerManual); err != nil {
+			return err
+		}
+		return tx.Model(schedule).Update("last_run_at", now).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.queue.Queued(queued...)
+	return run, nil
+}
+
+func (s *Scheduler) List() ([]domain.Schedule, error) {
+	var schedules []domain.Schedule
+	err := s.db.Order("name").Find(&schedules).Error
+	return schedules, err
+}
+
+func (s *Scheduler) Get(id uuid.UUID) (*domain.Schedule, error) {
+	var schedule domain.Schedule
+	if err := s.db.First(&schedule, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	return &schedule, nil
+}
+
+func (s *Scheduler) Create(req domain.ScheduleRequest) (*domain.Schedule, error) {
+	var schedule domain.Schedule
+	if err := s.apply(&schedule, req); err != nil {
+		return nil, err
+	}
+	if err := s.db.Create(&schedule).Error; err != nil {
+		return nil, err
+	}
+	return &schedule, nil
+}
+
+// Update replaces a schedule's definition and plans its next run afresh
+func (s *Scheduler) Update(id uuid.UUID, req domain.ScheduleRequest) (*domain.Schedule, error) {
+	schedule, err := s.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.apply(schedule, req); err != nil {
+		return nil, err
+	}
+	if err := s.db.Save(schedule).Error; err != nil {
+		return nil, err
+	}
+	return schedule, nil
+}
+
+func (s *Scheduler) Delete(id uuid.UUID) error {
+	result := s.db.Delete(&domain.Schedule{}, "id = ?", id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// Runs returns a schedule's most recent runs, newest first
+func (s *Scheduler) Runs(id uuid.UUID, limit int) ([]domain.ScheduleRun, error) {
+	if _, err := s.Get(id); err != nil {
+		return nil, err
+	}
+	if limit <= 0 {
+		limit = defaultRunLimit
+	} else if limit > maxRunLimit {
+		limit = maxRunLimit
+	}
+
+	var runs []domain.ScheduleRun
+	err := s.db.Where("schedule_id = ?", id).Order("created_at DESC").Limit(limit).Find(&runs).Error
+	return runs, err
+}
+
+// apply validates a request and sets the schedule's definition from it
+func (s *Scheduler) apply(schedule *domain.Schedule, req domain.ScheduleRequest) error {
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidSchedule)
+	}
+	timezone := strings.TrimSpace(req.Timezone)
+	if timezone == "" {
+		timezone = "UTC"
+	}
+	cron, loc, err := parseSchedule(req.Cron, timezone)
+	if err != nil {
+		return err
+	}
+	priority, err := jobs.NormalizePriority(req.Priority)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidSchedule, err)
+	}
+	missed := strings.ToLower(strings.TrimSpace(req.MissedRuns))
+	if missed == "" {
+		missed = MissedRunOnce
+	}
+	if !contains(MissedRunPolicies, missed) {
+		return fmt.Errorf("%w: invalid missed_runs %q, expected one of %s",
+			ErrInvalidSchedule, req.MissedRuns, strings.Join(MissedRunPolicies, ", "))
+	}
+
+	if len(req.Calculations) == 0 {
+		return fmt.Errorf("%w: at least one calculation is required", ErrInvalidSchedule)
+	}
+	for _, calc := range req.Calculations {
+		if _, err := Input(calc, uuid.Nil); err != nil {
+			return err
+		}
+	}
+
+	if len(req.PortfolioIDs) > 0 {
+		unique := make(map[uuid.UUID]bool)
+		for _, id := range req.PortfolioIDs {
+			unique[id] = true
+		}
+		var count int64
+		if err := s.db.Model(&domain.Portfolio{}).Where("id IN ?", req.PortfolioIDs).Count(&count).Error; err != nil {
+			return err
+		}
+		if int(count) != len(unique) {
+			return fmt.Errorf("%w: unknown portfolio in portfolio_ids", ErrInvalidSchedule)
+		}
+	}
+
+	schedule.Name = name
+	schedule.Cron = strings.TrimSpace(req.Cron)
+	schedule.Timezone = loc.String()
+	schedule.PortfolioIDs = req.PortfolioIDs
+	schedule.Calculations = req.Calculations
+	schedule.Priority = priority
+	schedule.MissedRuns = missed
+	schedule.Enabled = req.Enabled == nil || *req.Enabled
+
+	schedule.NextRunAt = nil
+	if schedule.Enabled {
+		next := cron.Next(time.Now().In(loc))
+		if next.IsZero() {
+			return fmt.Errorf("%w: cron %q never fires", ErrInvalidSchedule, req.Cron)
+		}
+		schedule.NextRunAt = &next
+	}
+	return nil
+}
+
+// parseSchedule parses a schedule's cron expression and time zone
+func parseSchedule(expr, timezone string) (*Cron, *time.Location, error) {
+	cron, err := ParseCron(expr)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: invalid cron: %v", ErrInvalidSchedule, err)
+	}
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: invalid timezone %q", ErrInvalidSchedule, timezone)
+	}
+	return cron, loc, nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,62 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/reserveone/saa-risk-analyzer/internal/domain"
+	riskmath "github.com/reserveone/saa-risk-analyzer/internal/math"
+)
+
+const defaultBacktestDays = 250
+
+// BacktestVaR re-estimates one-day VaR of the current holdings on each of the
+// last test days from the window before it, and tests the exceedances for
+// correct frequency (Kupiec) and independence (Christoffersen)
+func (s *RiskService) BacktestVaR(ctx context.Context, req domain.BacktestVaRRequest) (*domain.BacktestResult, error) {
+	testDays := req.TestDays
+	if testDays <= 0 {
+		testDays = defaultBacktestDays
+	}
+
+	data, err := s.loadAlignedPortfolio(ctx, req.PortfolioID, req.WindowDays+testDays, req.Adjustment)
+	if err != nil {
+		return nil, err
+	}
+
+	exposures := data.Exposures()
+	weights := make([]float64, len(exposures))
+	for i, exposure := range exposures {
+		weights[i] = exposure / data.NAV
+	}
+	portfolioReturns := riskmath.CalculatePortfolioReturns(data.Returns, weights)
+
+	window := req.WindowDays
+	if len(portfolioReturns) <= window {
+		return nil, fmt.Errorf("need more than %d returns to backtest a %d-day window, got %d", window, window, len(portfolioReturns))
+	}
+	if len(portfolioReturns) > window+testDays {
+		portfolioReturns = portfolioReturns[len(portfolioReturns)-window-testDays:]
+	}
+
+	estimates, err := riskmath.RollingVaR(portfolioReturns, window, req.Confidence, req.Method)
+	if err != nil {
+		return nil, err
+	}
+	result, err := riskmath.BacktestVaR(portfolioReturns[window:], estimates, req.Confidence)
+	if err != nil {
+		return nil, err
+	}
+
+	return &domain.BacktestResult{
+		Exceedances:         result.Exceedances,
+		KupiecLR:            result.KupiecLR,
+		KupiecPValue:        result.KupiecPValue,
+		ChristLR:            result.ChristLR,
+		ChristPValue:        result.ChristPValue,
+		Observations:        len(estimates),
+		ExpectedExceedances: float64(len(estimates)) * (1 - req.Confidence),
+		Method:              req.Method,
+		Adjustment:          data.Adjustment,
+	}, nil
+}
@@ -0,0 +1,167 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ComputeCache caches calculation results by key for a TTL, and runs
+// concurrent calculations of the same key once: the first caller computes,
+// the others wait for its result. Failed calculations are not cached.
+type ComputeCache struct {
+	ttl  time.Duration
+	size int
+
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+	flights map[string]*flight
+	hits    int64
+	shared  int64
+	misses  int64
+}
+
+type cacheEntry struct {
+	value   interface{}
+	expires time.Time
+}
+
+// flight is a calculation in progress
+type flight struct {
+	done  chan struct{}
+	value interface{}
+	err   error
+}
+
+// CacheStats counts cache lookups
+type CacheStats struct {
+	Entries int   `json:"entries"`
+	Hits    int64 `json:"hits"`   // served from the cache
+	Shared  int64 `json:"shared"` // served by a concurrent identical calculation
+	Misses  int64 `json:"misses"` // calculated
+}
+
+// NewComputeCache keeps up to size results for ttl. A zero ttl disables
+// caching but still deduplicates concurrent calculations.
+func NewComputeCache(ttl time.Duration, size int) *ComputeCache {
+	if size <= 0 {
+		size = 1000
+	}
+	return &ComputeCache{
+		ttl:     ttl,
+		size:    size,
+		entries: make(map[string]cacheEntry),
+		flights: make(map[string]*flight),
+	}
+}
+
+// CacheKey fingerprints the parts of a calculation's input: a SHA-256 of
+// their JSON encoding
+func CacheKey(parts ...interface{}) (string, error) {
+	data, err := json.Marshal(parts)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Do returns the cached result for key, or computes it. Callers waiting on
+// another's calculation stop waiting when their ctx is done; if the
+// calculating caller's ctx is done first, a waiting caller computes instead.
+func (c *ComputeCache) Do(ctx context.Context, key string, compute func(ctx context.Context) (interface{}, error)) (interface{}, error) {
+	for {
+		c.mu.Lock()
+		if entry, ok := c.entries[key]; ok && time.Now().Before(entry.expires) {
+			c.hits++
+			c.mu.Unlock()
+			return entry.value, nil
+		}
+
+		if f, ok := c.flights[key]; ok {
+			c.shared++
+			c.mu.Unlock()
+			select {
+			case <-f.done:
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+			if isContextError(f.err) && ctx.Err() == nil {
+				continue // the calculating caller gave up, not the calculation
+			}
+			return f.value, f.err
+		}
+
+		c.misses++
+		f := &flight{done: make(chan struct{})}
+		c.flights[key] = f
+		c.mu.Unlock()
+
+		c.run(ctx, key, f, compute)
+		return f.value, f.err
+	}
+}
+
+// run computes f and ends the flight, caching a successful result. A panic
+// in compute fails the calculation for every caller waiting on it.
+func (c *ComputeCache) run(ctx context.Context, key string, f *flight, compute func(ctx context.Context) (interface{}, error)) {
+	defer func() {
+		if r := recover(); r != nil {
+			f.value, f.err = nil, fmt.Errorf("calculation panicked: %v", r)
+		}
+		c.mu.Lock()
+		delete(c.flights, key)
+		if f.err == nil && c.ttl > 0 {
+			c.store(key, f.value)
+		}
+		c.mu.Unlock()
+		close(f.done)
+	}()
+	f.value, f.err = compute(ctx)
+}
+
+// store adds an entry, evicting expired entries and then those expiring
+// first when the cache is full. Callers hold c.mu.
+func (c *ComputeCache) store(key string, value interface{}) {
+	now := time.Now()
+	if len(c.entries) >= c.size {
+		for k, entry := range c.entries {
+			if !now.Before(entry.expires) {
+				delete(c.entries, k)
+			}
+		}
+	}
+	for len(c.entries) >= c.size {
+		oldest := ""
+		for k, entry := range c.entries {
+			if oldest == "" || entry.expires.Before(c.entries[oldest].expires) {
+				oldest = k
+			}
+		}
+		delete(c.entries, oldest)
+	}
+	c.entries[key] = cacheEntry{value: value, expires: now.Add(c.ttl)}
+}
+
+// Purge drops every cached result
+func (c *ComputeCache) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = make(map[string]cacheEntry)
+}
+
+// Stats returns the number of cached results and lookups so far
+func (c *ComputeCache) Stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return CacheStats{Entries: len(c.entries), Hits: c.hits, Shared: c.shared, Misses: c.misses}
+}
+
+func isContextError(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
@@ -0,0 +1,56 @@
+package service
+
+import (
+	"context"
+	"sort"
+
+	"github.com/reserveone/saa-risk-analyzer/internal/domain"
+	riskmath "github.com/reserveone/saa-risk-analyzer/internal/math"
+)
+
+// CalculateRiskContributions decomposes the portfolio's delta-normal VaR into
+// the marginal and component VaR of each priced position, largest first
+func (s *RiskService) CalculateRiskContributions(ctx context.Context, req domain.RiskContributionRequest) (*domain.RiskContributionResponse, error) {
+	horizonDays := req.HorizonDays
+	if horizonDays == 0 {
+		horizonDays = 1
+	}
+
+	data, err := s.loadAlignedPortfolio(ctx, req.PortfolioID, req.WindowDays, req.Adjustment)
+	if err != nil {
+		return nil, err
+	}
+	return riskContributions(data, req.Confidence, horizonDays)
+}
+
+// riskContributions decomposes the delta-normal VaR of aligned positions
+func riskContributions(data *alignedPortfolio, confidence float64, horizonDays int) (*domain.RiskContributionResponse, error) {
+	exposures := data.Exposures()
+	cov, _ := riskmath.ReturnMoments(data.Returns)
+	result, err := riskmath.RiskContributions(exposures, cov, confidence, horizonDays)
+	if err != nil {
+		return nil, err
+	}
+
+	contributions := make([]domain.AssetContribution, len(data.Symbols))
+	for i, symbol := range data.Symbols {
+		contributions[i] = domain.AssetContribution{
+			Symbol:     symbol,
+			Exposure:   exposures[i],
+			Component:  result.Component[i],
+			Marginal:   result.Marginal[i],
+			Percentage: result.Component[i] / result.VaR,
+		}
+	}
+	sort.SliceStable(contributions, func(i, j int) bool {
+		return contributions[i].Component > contributions[j].Component
+	})
+
+	return &domain.RiskContributionResponse{
+		VaR:           result.VaR,
+		NAV:           data.NAV,
+		Contributions: contributions,
+		Currency:      data.Currency,
+		Adjustment:    data.Adjustment,
+	}, nil
+}
@@ -0,0 +1,113 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/reserveone/saa-risk-analyzer/internal/domain"
+	riskmath "github.com/reserveone/saa-risk-analyzer/internal/math"
+)
+
+// CorporateActionService stores splits and dividends and applies them to
+// price history
+type CorporateActionService struct {
+	db     *gorm.DB
+	market *MarketDataService
+}
+
+func NewCorporateActionService(db *gorm.DB, market *MarketDataService) *CorporateActionService {
+	return &CorporateActionService{
+		db:     db,
+		market: market,
+	}
+}
+
+// List returns the stored corporate actions of a symbol by ex-date
+func (s *CorporateActionService) List(symbol string) ([]domain.CorporateAction, error) {
+	var actions []domain.CorporateAction
+	err := s.db.
+		Joins("JOIN assets ON assets.id = corporate_actions.asset_id").
+		Where("assets.symbol = ?", symbol).
+		Order("corporate_actions.ex_date ASC").
+		Find(&actions).Error
+	return actions, err
+}
+
+// Sync fetches the corporate actions of the last days from the providers and
+// stores them, returning how many were reported
+func (s *CorporateActionService) Sync(ctx context.Context, symbol string, days int) (int, error) {
+	var asset domain.Asset
+	if err := s.db.Where("symbol = ?", symbol).First(&asset).Error; err != nil {
+		return 0, fmt.Errorf("asset %s not found: %w", symbol, err)
+	}
+
+	actions, source, err := s.market.FetchCorporateActions(ctx, symbol, days)
+	if err != nil {
+		return 0, err
+	}
+
+	rows := make([]domain.CorporateAction, 0, len(actions))
+	for _, a := range actions {
+		if a.Value <= 0 {
+			continue
+		}
+		rows = append(rows, domain.CorporateAction{
+			AssetID: asset.ID,
+			Type:    a.Type,
+			ExDate:  truncateToDay(a.ExDate),
+			Value:   a.Value,
+			Source:  source,
+		})
+	}
+	if err := s.Save(s.db, rows); err != nil {
+		return 0, err
+	}
+	return len(rows), nil
+}
+
+// Save upserts corporate actions on (asset, type, ex-date)
+func (s *CorporateActionService) Save(tx *gorm.DB, actions []domain.CorporateAction) error {
+	if len(actions) == 0 {
+		return nil
+	}
+	return tx.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "asset_id"}, {Name: "type"}, {Name: "ex_date"}},
+		DoUpdates: clause.AssignmentColumns([]string{"value", "source", "updated_at"}),
+	}).Create(&actions).Error
+}
+
+// Adjust applies the stored corporate actions of symbol to its closes
+// (oldest first) on the given adjustment basis
+func (s *CorporateActionService) Adjust(symbol string, prices []riskmath.PricePoint, basis string) ([]riskmath.PricePoint, error) {
+	if basis == riskmath.AdjustmentNone || len(prices) < 2 {
+		return prices, nil
+	}
+
+	var rows []domain.CorporateAction
+	err := s.db.
+		Joins("JOIN assets ON assets.id = corporate_actions.asset_id").
+		Where("assets.symbol = ? AND corporate_actions.ex_date > ? AND corporate_actions.ex_date <= ?",
+			symbol, prices[0].Date, prices[len(prices)-1].Date).
+		Find(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return riskmath.AdjustPrices(prices, toMathActions(rows), basis), nil
+}
+
+func toMathActions(rows []domain.CorporateAction) []riskmath.CorporateAction {
+	actions := make([]riskmath.CorporateAction, 0, len(rows))
+	for _, row := range rows {
+		switch row.Type {
+		case ActionSplit:
+			actions = append(actions, riskmath.CorporateAction{ExDate: row.ExDate, SplitRatio: row.Value})
+		case ActionDividend:
+			actions = append(actions, riskmath.CorporateAction{ExDate: row.ExDate, Dividend: row.Value})
+		}
+	}
+	return actions
+}
@@ -0,0 +1,164 @@
+package service
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FileProvider serves prices from a directory of CSV files so the system can
+// run offline against deterministic data. Files either hold many symbols with
+// a date,symbol,close header (like data/prices.csv) or a single symbol named
+// after the file (SPY.csv) with a date,close header. Extra columns are ignored.
+// Parquet exports are not read, as no Parquet decoder is vendored; convert
+// them to CSV first.
+type FileProvider struct {
+	dir string
+
+	once   sync.Once
+	prices map[string][]PricePoint
+	err    error
+}
+
+func NewFileProvider(dir string) *FileProvider {
+	return &FileProvider{dir: dir}
+}
+
+func (p *FileProvider) Name() string { return ProviderFile }
+
+func (p *FileProvider) Capabilities() ProviderCapabilities {
+	return ProviderCapabilities{}
+}
+
+func (p *FileProvider) HistoricalPrices(ctx context.Context, symbol string, days int) ([]PricePoint, error) {
+	p.once.Do(p.load)
+	if p.err != nil {
+		return nil, p.err
+	}
+
+	prices, ok := p.prices[strings.ToUpper(symbol)]
+	if !ok {
+		return nil, fmt.Errorf("no prices for %s in %s", symbol, p.dir)
+	}
+	if days > 0 && len(prices) > days {
+		prices = prices[len(prices)-days:]
+	}
+
+	result := make([]PricePoint, len(prices))
+	copy(result, prices)
+	return result, nil
+}
+
+// load reads every CSV file in the directory once
+func (p *FileProvider) load() {
+	files, err := filepath.Glob(filepath.Join(p.dir, "*.csv"))
+	if err != nil {
+		p.err = err
+		return
+	}
+	if len(files) == 0 {
+		p.err = fmt.Errorf("no price files in %s", p.dir)
+		return
+	}
+
+	p.prices = make(map[string][]PricePoint)
+	for _, file := range files {
+		prices, err := loadPriceFile(file)
+		if err != nil {
+			// Skip unreadable files, but log the error
+			fmt.Printf("Warning: failed to load prices from %s: %v\n", file, err)
+			continue
+		}
+		for symbol, points := range prices {
+			p.prices[symbol] = append(p.prices[symbol], points...)
+		}
+	}
+
+	for symbol, prices := range p.prices {
+		sort.Slice(prices, func(i, j int) bool { return prices[i].Date.Before(prices[j].Date) })
+		p.prices[symbol] = prices
+	}
+}
+
+// loadPriceFile reads the closes of a CSV file by symbol. A file with any
+// invalid line is rejected whole.
+func loadPriceFile(path string) (map[string][]PricePoint, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	reader := csv.NewReader(f)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, err
+	}
+	columns := make(map[string]int)
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	dateCol, ok := columns["date"]
+	if !ok {
+		return nil, fmt.Errorf("missing date column")
+	}
+	closeCol, ok := columns["close"]
+	if !ok {
+		return nil, fmt.Errorf("missing close column")
+	}
+	symbolCol, hasSymbol := columns["symbol"]
+	fileSymbol := strings.ToUpper(strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)))
+
+	prices := make(map[string][]PricePoint)
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return prices, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if dateCol >= len(record) || closeCol >= len(record) || (hasSymbol && symbolCol >= len(record)) {
+			return nil, fmt.Errorf("line %d: missing columns", line)
+		}
+
+		date, err := parseDate(record[dateCol])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		closePrice, err := strconv.ParseFloat(strings.TrimSpace(record[closeCol]), 64)
+		if err != nil || closePrice <= 0 || math.IsInf(closePrice, 0) || math.IsNaN(closePrice) {
+			return nil, fmt.Errorf("line %d: invalid close %q, expected a positive number", line, record[closeCol])
+		}
+
+		symbol := fileSymbol
+		if hasSymbol {
+			symbol = strings.ToUpper(strings.TrimSpace(record[symbolCol]))
+		}
+		prices[symbol] = append(prices[symbol], PricePoint{Date: date, Close: closePrice})
+	}
+}
+
+// parseDate accepts plain dates and RFC 3339 timestamps
+func parseDate(value string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if date, err := time.Parse("2006-01-02", value); err == nil {
+		return date, nil
+	}
+	if date, err := time.Parse(time.RFC3339, value); err == nil {
+		return date, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid date %q", value)
+}
@@ -0,0 +1,195 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/reserveone/saa-risk-analyzer/internal/domain"
+	riskmath "github.com/reserveone/saa-risk-analyzer/internal/math"
+)
+
+// DefaultBaseCurrency is the base currency of portfolios that do not set one
+// and the currency assets are assumed to be quoted in
+const DefaultBaseCurrency = "USD"
+
+// fxLeg is one currency pair used to convert between two currencies, read
+// inverted when only the opposite pair is quoted
+type fxLeg struct {
+	Symbol string
+	Invert bool
+}
+
+// FXService converts between currencies using FX pair closes (EURUSD is the
+// price of one EUR in USD). Rates live in the price store like any other
+// asset, so they are imported, fetched and cached the same way. Pairs that
+// are not quoted are crossed through USD.
+type FXService struct {
+	prices *PriceStore
+	quotes *LatestPriceService
+}
+
+func NewFXService(prices *PriceStore, quotes *LatestPriceService) *FXService {
+	return &FXService{
+		prices: prices,
+		quotes: quotes,
+	}
+}
+
+// NormalizeCurrency validates an ISO 4217 style currency code, defaulting to
+// DefaultBaseCurrency
+func NormalizeCurrency(currency string) (string, error) {
+	currency = strings.ToUpper(strings.TrimSpace(currency))
+	if currency == "" {
+		return DefaultBaseCurrency, nil
+	}
+	if len(currency) != 3 {
+		return "", fmt.Errorf("invalid currency %q, expected a 3-letter code", currency)
+	}
+	for _, r := range currency {
+		if r < 'A' || r > 'Z' {
+			return "", fmt.Errorf("invalid currency %q, expected a 3-letter code", currency)
+		}
+	}
+	return currency, nil
+}
+
+// CurrencyOf returns the currency a new asset with symbol is quoted in; FX
+// pairs are quoted in their second currency
+func CurrencyOf(symbol string) string {
+	if isFXPair(symbol) {
+		return symbol[3:]
+	}
+	return DefaultBaseCurrency
+}
+
+// priceCurrency returns the currency the closes of an asset are quoted in
+func priceCurrency(asset domain.Asset) string {
+	if isFXPair(asset.Symbol) {
+		return asset.Symbol[3:]
+	}
+	if asset.Currency == "" {
+		return DefaultBaseCurrency
+	}
+	return strings.ToUpper(asset.Currency)
+}
+
+// exposureCurrency returns the currency a holding of asset is exposed to. A
+// position in an FX pair holds its first currency.
+func exposureCurrency(asset domain.Asset) string {
+	if isFXPair(asset.Symbol) {
+		return asset.Symbol[:3]
+	}
+	return priceCurrency(asset)
+}
+
+// Rate returns the units of to per unit of from at the latest close on or
+// before asOf
+func (s *FXService) Rate(ctx context.Context, from, to string, asOf time.Time) (float64, error) {
+	if from == to {
+		return 1, nil
+	}
+
+	closes := make(map[string]float64)
+	legs, err := s.legs(from, to, func(symbol string) error {
+		price, _, err := latestClose(ctx, s.prices, s.quotes, symbol, asOf)
+		if err != nil {
+			return err
+		}
+		if price.Close <= 0 {
+			return fmt.Errorf("invalid rate for %s", symbol)
+		}
+		closes[symbol] = price.Close
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	rate := 1.0
+	for _, leg := range legs {
+		if leg.Invert {
+			rate /= closes[leg.Symbol]
+		} else {
+			rate *= closes[leg.Symbol]
+		}
+	}
+	return rate, nil
+}
+
+// Convert converts closes (oldest first) quoted in from into to, at the rate
+// of each close date. Converted returns therefore include the FX return.
+func (s *FXService) Convert(ctx context.Context, prices []riskmath.PricePoint, from, to string) ([]riskmath.PricePoint, error) {
+	if from == to || len(prices) == 0 {
+		return prices, nil
+	}
+
+	// Rates from a week before the first close cover its carry-forward
+	query := HistoryQuery{
+		From: truncateToDay(prices[0].Date).AddDate(0, 0, -7),
+		To:   truncateToDay(prices[len(prices)-1].Date).Add(24*time.Hour - time.Nanosecond),
+	}
+	history := make(map[string][]riskmath.PricePoint)
+	legs, err := s.legs(from, to, func(symbol string) error {
+		query.Symbol = symbol
+		rates, _, err := s.prices.Query(ctx, query)
+		if err != nil {
+			return err
+		}
+		if len(rates) == 0 {
+			return fmt.Errorf("no rates for %s", symbol)
+		}
+		history[symbol] = convertPrices(rates)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	converted := prices
+	for _, leg := range legs {
+		rates := history[leg.Symbol]
+		if leg.Invert {
+			rates = riskmath.InvertRates(rates)
+		}
+		converted = riskmath.ConvertPrices(converted, rates)
+	}
+	if len(converted) < 2 {
+		return nil, fmt.Errorf("insufficient %s/%s rate history", from, to)
+	}
+	return converted, nil
+}
+
+// legs resolves the pairs that convert from into to: the direct pair, its
+// inverse, or a cross through USD. load is called on each candidate pair and
+// the first that loads is used.
+func (s *FXService) legs(from, to string, load func(symbol string) error) ([]fxLeg, error) {
+	direct := func(from, to string) (fxLeg, error) {
+		if err := load(from + to); err == nil {
+			return fxLeg{Symbol: from + to}, nil
+		}
+		if err := load(to + from); err == nil {
+			return fxLeg{Symbol: to + from, Invert: true}, nil
+		}
+		return fxLeg{}, fmt.Errorf("no FX rate for %s/%s", from, to)
+	}
+
+	leg, err := direct(from, to)
+	if err == nil {
+		return []fxLeg{leg}, nil
+	}
+	if from == DefaultBaseCurrency || to == DefaultBaseCurrency {
+		return nil, err
+	}
+
+	first, err := direct(from, DefaultBaseCurrency)
+	if err != nil {
+		return nil, err
+	}
+	second, err := direct(DefaultBaseCurrency, to)
+	if err != nil {
+		return nil, err
+	}
+	return []fxLeg{first, second}, nil
+}
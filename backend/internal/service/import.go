@@ -0,0 +1,455 @@
+package service
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/reserveone/saa-risk-analyzer/internal/domain"
+)
+
+const importBatchSize = 500
+
+// errDryRun rolls back a dry-run import after every row has been applied
+var errDryRun = fmt.Errorf("dry run")
+
+// ImportService loads prices and positions from uploaded CSV or XLSX files.
+// Every import runs in one transaction: it commits only when all rows are
+// valid, and a dry run applies the rows and always rolls back, so its counts
+// match what a real import would do.
+type ImportService struct {
+	db *gorm.DB
+}
+
+func NewImportService(db *gorm.DB) *ImportService {
+	return &ImportService{db: db}
+}
+
+// ImportPrices upserts date,symbol,close rows into the prices table. Missing
+// assets are created. Imported closes are marked with the import source, so
+// fetched provider data never overwrites them.
+func (s *ImportService) ImportPrices(rows TableReader, dryRun bool) (*domain.ImportResult, error) {
+	result := &domain.ImportResult{DryRun: dryRun}
+
+	err := s.transaction(result, dryRun, func(tx *gorm.DB) error {
+		cols, err := readHeader(rows, "date", "symbol", "close")
+		if err != nil {
+			return err
+		}
+
+		assets := newAssetCache(tx, result)
+		seen := make(map[string]int) // symbol|date -> first row
+		batch := make([]domain.Price, 0, importBatchSize)
+
+		for {
+			fields, rowNum, err := rows.Read()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return err
+			}
+			if blankRow(fields) {
+				continue
+			}
+			result.Rows++
+
+			date, dateErr := parseImportDate(field(fields, cols["date"]))
+			symbol := strings.ToUpper(field(fields, cols["symbol"]))
+			closePrice, closeErr := strconv.ParseFloat(field(fields, cols["close"]), 64)
+			switch {
+			case dateErr != nil:
+				result.AddError(rowNum, "date", field(fields, cols["date"]), dateErr.Error())
+				continue
+			case symbol == "":
+				result.AddError(rowNum, "symbol", "", "symbol required")
+				continue
+			case closeErr != nil || closePrice <= 0 || math.IsInf(closePrice, 0) || math.IsNaN(closePrice):
+				result.AddError(rowNum, "close", field(fields, cols["close"]), "close must be a positive number")
+				continue
+			}
+
+			key := symbol + "|" + date.Format("2006-01-02")
+			if first, ok := seen[key]; ok {
+				result.AddError(rowNum, "date", field(fields, cols["date"]), fmt.Sprintf("duplicate of row %d", first))
+				continue
+			}
+			seen[key] = rowNum
+
+			asset, err := assets.get(symbol)
+			if err != nil {
+				return err
+			}
+			result.Valid++
+			batch = append(batch, domain.Price{
+				AssetID: asset.ID,
+				Date:    date,
+				Close:   closePrice,
+				Source:  PriceSourceImport,
+			})
+			if len(batch) == importBatchSize {
+				if err := s.upsertPrices(tx, batch, result); err != nil {
+					return err
+				}
+				batch = batch[:0]
+			}
+		}
+
+		return s.upsertPrices(tx, batch, result)
+	})
+	return result, err
+}
+
+// ImportPositions upserts symbol,quantity,avg_price rows into a portfolio,
+// replacing the quantity and average price of positions already held
+func (s *ImportService) ImportPositions(portfolioID uuid.UUID, rows TableReader, dryRun bool) (*domain.ImportResult, error) {
+	result := &domain.ImportResult{DryRun: dryRun}
+
+	var portfolio domain.Portfolio
+	if err := s.db.First(&portfolio, "id = ?", portfolioID).Error; err != nil {
+		return nil, fmt.Errorf("portfolio not found: %w", err)
+	}
+	derived, err := NewLedgerService(s.db).HasTransactions(portfolioID)
+	if err != nil {
+		return nil, err
+	}
+	if derived {
+		return nil, ErrLedgerPositions
+	}
+
+	err = s.transaction(result, dryRun, func(tx *gorm.DB) error {
+		cols, err := readHeader(rows, "symbol", "quantity", "avg_price")
+		if err != nil {
+			return err
+		}
+
+		assets := newAssetCache(tx, result)
+		seen := make(map[string]int)
+
+		for {
+			fields, rowNum, err := rows.Read()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if blankRow(fields) {
+				continue
+			}
+			result.Rows++
+
+			symbol := strings.ToUpper(field(fields, cols["symbol"]))
+			quantity, quantityErr := strconv.ParseFloat(field(fields, cols["quantity"]), 64)
+			avgPrice, priceErr := strconv.ParseFloat(field(fields, cols["avg_price"]), 64)
+			switch {
+			case symbol == "":
+				result.AddError(rowNum, "symbol", "", "symbol required")
+				continue
+			case quantityErr != nil || quantity == 0 || math.IsInf(quantity, 0) || math.IsNaN(quantity):
+				result.AddError(rowNum, "quantity", field(fields, cols["quantity"]), "quantity must be a non-zero number")
+				continue
+			case priceErr != nil || avgPrice <= 0 || math.IsInf(avgPrice, 0) || math.IsNaN(avgPrice):
+				result.AddError(rowNum, "avg_price", field(fields, cols["avg_price"]), "avg_price must be a positive number")
+				continue
+			}
+			if first, ok := seen[symbol]; ok {
+				result.AddError(rowNum, "symbol", symbol, fmt.Sprintf("duplicate of row %d", first))
+				continue
+			}
+			seen[symbol] = rowNum
+
+			asset, err := assets.get(symbol)
+			if err != nil {
+				return err
+			}
+			result.Valid++
+
+			var position domain.Position
+			err = tx.Where("portfolio_id = ? AND asset_id = ?", portfolioID, asset.ID).First(&position).Error
+			switch {
+			case err == gorm.ErrRecordNotFound:
+				position = domain.Position{
+					PortfolioID: portfolioID,
+					AssetID:     asset.ID,
+					Quantity:    quantity,
+					AvgPrice:    avgPrice,
+				}
+				if err := tx.Create(&position).Error; err != nil {
+					return fmt.Errorf("row %d: failed to create position: %w", rowNum, err)
+				}
+				result.Inserted++
+			case err != nil:
+				return err
+			default:
+				position.Quantity = quantity
+				position.AvgPrice = avgPrice
+				if err := tx.Save(&position).Error; err != nil {
+					return fmt.Errorf("row %d: failed to update position: %w", rowNum, err)
+				}
+				result.Updated++
+			}
+		}
+	})
+	return result, err
+}
+
+// ImportCorporateActions upserts date,symbol,type,value rows, where type is
+// split (value is the ratio, 2 for 2-for-1) or dividend (cash per share)
+func (s *ImportService) ImportCorporateActions(rows TableReader, dryRun bool) (*domain.ImportResult, error) {
+	result := &domain.ImportResult{DryRun: dryRun}
+
+	err := s.transaction(result, dryRun, func(tx *gorm.DB) error {
+		cols, err := readHeader(rows, "date", "symbol", "type", "value")
+		if err != nil {
+			return err
+		}
+
+		assets := newAssetCache(tx, result)
+		seen := make(map[string]int)
+
+		for {
+			fields, rowNum, err := rows.Read()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if blankRow(fields) {
+				continue
+			}
+			result.Rows++
+
+			date, dateErr := parseImportDate(field(fields, cols["date"]))
+			symbol := strings.ToUpper(field(fields, cols["symbol"]))
+			actionType := strings.ToLower(field(fields, cols["type"]))
+			value, valueErr := strconv.ParseFloat(field(fields, cols["value"]), 64)
+			switch {
+			case dateErr != nil:
+				result.AddError(rowNum, "date", field(fields, cols["date"]), dateErr.Error())
+				continue
+			case symbol == "":
+				result.AddError(rowNum, "symbol", "", "symbol required")
+				continue
+			case actionType != ActionSplit && actionType != ActionDividend:
+				result.AddError(rowNum, "type", field(fields, cols["type"]), "type must be split or dividend")
+				continue
+			case valueErr != nil || value <= 0 || math.IsInf(value, 0) || math.IsNaN(value):
+				result.AddError(rowNum, "value", field(fields, cols["value"]), "value must be a positive number")
+				continue
+			}
+
+			key := symbol + "|" + actionType + "|" + date.Format("2006-01-02")
+			if first, ok := seen[key]; ok {
+				result.AddError(rowNum, "date", field(fields, cols["date"]), fmt.Sprintf("duplicate of row %d", first))
+				continue
+			}
+			seen[key] = rowNum
+
+			asset, err := assets.get(symbol)
+			if err != nil {
+				return err
+			}
+			result.Valid++
+
+			var existing int64
+			err = tx.Model(&domain.CorporateAction{}).
+				Where("asset_id = ? AND type = ? AND ex_date = ?", asset.ID, actionType, date).
+				Count(&existing).Error
+			if err != nil {
+				return err
+			}
+			action := domain.CorporateAction{
+				AssetID: asset.ID,
+				Type:    actionType,
+				ExDate:  date,
+				Value:   value,
+				Source:  PriceSourceImport,
+			}
+			if err := tx.Clauses(clause.OnConflict{
+				Columns:   []clause.Column{{Name: "asset_id"}, {Name: "type"}, {Name: "ex_date"}},
+				DoUpdates: clause.AssignmentColumns([]string{"value", "source", "updated_at"}),
+			}).Create(&action).Error; err != nil {
+				return fmt.Errorf("row %d: failed to write corporate action: %w", rowNum, err)
+			}
+			if existing > 0 {
+				result.Updated++
+			} else {
+				result.Inserted++
+			}
+		}
+	})
+	return result, err
+}
+
+// transaction runs fn in a transaction that commits only for a real import
+// without row errors
+func (s *ImportService) transaction(result *domain.ImportResult, dryRun bool, fn func(tx *gorm.DB) error) error {
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := fn(tx); err != nil {
+			return err
+		}
+		if dryRun || result.ErrorCount > 0 {
+			return errDryRun
+		}
+		return nil
+	})
+	if err == errDryRun {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	result.Committed = true
+	return nil
+}
+
+// upsertPrices writes a batch, counting closes that replace existing ones
+func (s *ImportService) upsertPrices(tx *gorm.DB, batch []domain.Price, result *domain.ImportResult) error {
+	if len(batch) == 0 {
+		return nil
+	}
+
+	keys := make([][]interface{}, len(batch))
+	for i, p := range batch {
+		keys[i] = []interface{}{p.AssetID, p.Date}
+	}
+	var existing int64
+	if err := tx.Model(&domain.Price{}).Where("(asset_id, date) IN ?", keys).Count(&existing).Error; err != nil {
+		return err
+	}
+
+	err := tx.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "asset_id"}, {Name: "date"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"close":      gorm.Expr("EXCLUDED.close"),
+			"source":     PriceSourceImport,
+			"fetched_at": nil,
+		}),
+	}).Create(&batch).Error
+	if err != nil {
+		return fmt.Errorf("failed to write prices: %w", err)
+	}
+
+	result.Updated += int(existing)
+	result.Inserted += len(batch) - int(existing)
+	return nil
+}
+
+// assetCache resolves symbols to assets, creating missing ones
+type assetCache struct {
+	tx     *gorm.DB
+	result *domain.ImportResult
+	assets map[string]domain.Asset
+}
+
+func newAssetCache(tx *gorm.DB, result *domain.ImportResult) *assetCache {
+	return &assetCache{tx: tx, result: result, assets: make(map[string]domain.Asset)}
+}
+
+func (a *assetCache) get(symbol string) (domain.Asset, error) {
+	if asset, ok := a.assets[symbol]; ok {
+		return asset, nil
+	}
+
+	var asset domain.Asset
+	err := a.tx.Where("symbol = ?", symbol).First(&asset).Error
+	if err == gorm.ErrRecordNotFound {
+		asset = NewAsset(symbol)
+		if err := a.tx.Create(&asset).Error; err != nil {
+			return asset, fmt.Errorf("failed to create asset %s: %w", symbol, err)
+		}
+		a.result.AssetsCreated++
+	} else if err != nil {
+		return asset, err
+	}
+
+	a.assets[symbol] = asset
+	return asset, nil
+}
+
+// readHeader maps the required column names to their positions
+func readHeader(rows TableReader, required ...string) (map[string]int, error) {
+	header, _, err := rows.Read()
+	if err == io.EOF {
+		return nil, fmt.Errorf("file is empty")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	cols := make(map[string]int, len(header))
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+		if _, ok := cols[name]; !ok {
+			cols[name] = i
+		}
+	}
+	for _, name := range required {
+		if _, ok := cols[name]; !ok {
+			return nil, fmt.Errorf("missing required column %q, expected %s", name, strings.Join(required, ","))
+		}
+	}
+	return cols, nil
+}
+
+func field(fields []string, col int) string {
+	if col >= len(fields) {
+		return ""
+	}
+	return strings.TrimSpace(fields[col])
+}
+
+func blankRow(fields []string) bool {
+	for _, f := range fields {
+		if strings.TrimSpace(f) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// parseImportDate accepts the file formats of parseDate and Excel date serials
+func parseImportDate(value string) (time.Time, error) {
+	if serial, err := strconv.ParseFloat(value, 64); err == nil && serial > 0 && serial < 2958466 {
+		// Excel counts days from 1899-12-30
+		excelEpoch := time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+		return excelEpoch.AddDate(0, 0, int(serial)), nil
+	}
+	date, err := parseDate(value)
+	if err != nil {
+		return date, fmt.Errorf("expected YYYY-MM-DD")
+	}
+	return truncateToDay(date), nil
+}
+
+// csvTableReader streams CSV rows with their line numbers
+type csvTableReader struct {
+	reader *csv.Reader
+}
+
+func newCSVTableReader(r io.Reader) *csvTableReader {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	reader.ReuseRecord = true
+	return &csvTableReader{reader: reader}
+}
+
+func (c *csvTableReader) Read() ([]string, int, error) {
+	record, err := c.reader.Read()
+	if err != nil {
+		return nil, 0, err
+	}
+	line, _ := c.reader.FieldPos(0)
+	return record, line, nil
+}
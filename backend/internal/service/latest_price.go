@@ -0,0 +1,188 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/reserveone/saa-risk-analyzer/internal/config"
+	"github.com/reserveone/saa-risk-analyzer/internal/domain"
+)
+
+// Price sources reported on quotes and valuations
+const (
+	PriceSourceDatabase = "database"
+	PriceSourceAPI      = "api"
+	PriceSourceCost     = "avg_price" // no market price available, valued at cost
+)
+
+const (
+	defaultQuoteTTL   = time.Minute
+	defaultStaleAfter = 72 * time.Hour
+	maxQuoteLookups   = 8 // concurrent lookups for bulk quotes
+)
+
+// LatestPriceService resolves the latest price of a symbol from an ordered
+// chain of sources and caches the result for a short TTL
+type LatestPriceService struct {
+	db         *gorm.DB
+	market     *MarketDataService
+	sources    []string
+	ttl        time.Duration
+	staleAfter time.Duration
+
+	mu    sync.Mutex
+	cache map[string]cachedQuote
+}
+
+type cachedQuote struct {
+	quote   domain.PriceQuote
+	expires time.Time
+}
+
+func NewLatestPriceService(db *gorm.DB, market *MarketDataService, cfg config.MarketConfig) *LatestPriceService {
+	sources := cfg.PriceSources
+	if len(sources) == 0 {
+		sources = []string{PriceSourceAPI, PriceSourceDatabase}
+	}
+	ttl := cfg.QuoteTTL
+	if ttl <= 0 {
+		ttl = defaultQuoteTTL
+	}
+	staleAfter := cfg.StaleAfter
+	if staleAfter <= 0 {
+		staleAfter = defaultStaleAfter
+	}
+
+	return &LatestPriceService{
+		db:         db,
+		market:     market,
+		sources:    sources,
+		ttl:        ttl,
+		staleAfter: staleAfter,
+		cache:      make(map[string]cachedQuote),
+	}
+}
+
+// Market returns the market data service quotes are fetched from
+func (s *LatestPriceService) Market() *MarketDataService {
+	return s.market
+}
+
+// Quote returns the latest price of symbol. Sources are tried in order and
+// the first fresh quote wins; if every source is stale the freshest quote is
+// returned and flagged as stale.
+func (s *LatestPriceService) Quote(ctx context.Context, symbol string) (*domain.PriceQuote, error) {
+	symbol = strings.ToUpper(strings.TrimSpace(symbol))
+	if symbol == "" {
+		return nil, fmt.Errorf("symbol required")
+	}
+	now := time.Now()
+
+	s.mu.Lock()
+	cached, ok := s.cache[symbol]
+	s.mu.Unlock()
+	if ok && now.Before(cached.expires) {
+		quote := s.withAge(cached.quote, now)
+		quote.Cached = true
+		return &quote, nil
+	}
+
+	var best *domain.PriceQuote
+	var errs []string
+	for _, source := range s.sources {
+		quote, err := s.fetch(ctx, source, symbol)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", source, err))
+			continue
+		}
+		if best == nil || quote.AsOf.After(best.AsOf) {
+			best = quote
+		}
+		if now.Sub(quote.AsOf) <= s.staleAfter {
+			break
+		}
+	}
+	if best == nil {
+		return nil, fmt.Errorf("no price for %s (%s)", symbol, strings.Join(errs, "; "))
+	}
+
+	s.mu.Lock()
+	s.cache[symbol] = cachedQuote{quote: *best, expires: now.Add(s.ttl)}
+	s.mu.Unlock()
+
+	quote := s.withAge(*best, now)
+	return &quote, nil
+}
+
+// Quotes resolves many symbols concurrently. Symbols that cannot be priced
+// are reported in the error map rather than failing the whole lookup.
+func (s *LatestPriceService) Quotes(ctx context.Context, symbols []string) ([]domain.PriceQuote, map[string]string) {
+	quotes := make([]*domain.PriceQuote, len(symbols))
+	errs := make([]error, len(symbols))
+
+	sem := make(chan struct{}, maxQuoteLookups)
+	var wg sync.WaitGroup
+	for i, symbol := range symbols {
+		wg.Add(1)
+		go func(i int, symbol string) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			quotes[i], errs[i] = s.Quote(ctx, symbol)
+		}(i, symbol)
+	}
+	wg.Wait()
+
+	result := make([]domain.PriceQuote, 0, len(symbols))
+	failed := make(map[string]string)
+	for i, symbol := range symbols {
+		if errs[i] != nil {
+			failed[symbol] = errs[i].Error()
+			continue
+		}
+		result = append(result, *quotes[i])
+	}
+	return result, failed
+}
+
+func (s *LatestPriceService) fetch(ctx context.Context, source, symbol string) (*domain.PriceQuote, error) {
+	switch source {
+	case PriceSourceAPI:
+		prices, err := s.market.GetHistoricalPrices(ctx, symbol, 2)
+		if err != nil {
+			return nil, err
+		}
+		for i := len(prices) - 1; i >= 0; i-- {
+			if prices[i].Close > 0 {
+				return &domain.PriceQuote{Symbol: symbol, Price: prices[i].Close, AsOf: prices[i].Date, Source: source}, nil
+			}
+		}
+		return nil, fmt.Errorf("no prices returned")
+
+	case PriceSourceDatabase:
+		var price domain.Price
+		err := s.db.
+			Joins("JOIN assets ON assets.id = prices.asset_id").
+			Where("assets.symbol = ?", symbol).
+			Order("prices.date DESC").
+			First(&price).Error
+		if err != nil {
+			return nil, err
+		}
+		return &domain.PriceQuote{Symbol: symbol, Price: price.Close, AsOf: price.Date, Source: source}, nil
+	}
+
+	return nil, fmt.Errorf("unknown price source")
+}
+
+func (s *LatestPriceService) withAge(quote domain.PriceQuote, now time.Time) domain.PriceQuote {
+	age := now.Sub(quote.AsOf)
+	quote.AgeSeconds = age.Seconds()
+	quote.Stale = age > s.staleAfter
+	return quote
+}
@@ -0,0 +1,680 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/reserveone/saa-risk-analyzer/internal/domain"
+)
+
+// Transaction types
+const (
+	TransactionBuy      = "buy"
+	TransactionSell     = "sell"
+	TransactionTransfer = "transfer"
+	TransactionFee      = "fee"
+	TransactionDividend = "dividend"
+)
+
+// Cost methods, matching sales to the lots they close
+const (
+	CostFIFO    = "fifo"
+	CostLIFO    = "lifo"
+	CostAverage = "average"
+)
+
+// OpeningBalanceNote marks the transfers that carry a portfolio's positions
+// into its ledger. The ledger has no history before the latest of them.
+const OpeningBalanceNote = "opening balance"
+
+var (
+	TransactionTypes = []string{TransactionBuy, TransactionSell, TransactionTransfer, TransactionFee, TransactionDividend}
+	CostMethods      = []string{CostFIFO, CostLIFO, CostAverage}
+)
+
+var (
+	// ErrInvalidTransaction wraps the validation errors of transactions,
+	// including sales of more than is held
+	ErrInvalidTransaction = errors.New("invalid transaction")
+	// ErrLedgerPositions is returned when positions derived from a ledger are
+	// changed directly
+	ErrLedgerPositions = errors.New("positions are derived from the portfolio's transactions")
+	// ErrBeforeOpeningBalances is returned for ledger dates before the opening
+	// balances, which the ledger has no history for
+	ErrBeforeOpeningBalances = errors.New("date is before the opening balances")
+)
+
+// NormalizeCostMethod validates a cost method, defaulting to FIFO
+func NormalizeCostMethod(method string) (string, error) {
+	method = strings.ToLower(strings.TrimSpace(method))
+	if method == "" {
+		return CostFIFO, nil
+	}
+	if !containsString(CostMethods, method) {
+		return "", fmt.Errorf("unknown cost method %q, expected one of %s", method, strings.Join(CostMethods, ", "))
+	}
+	return method, nil
+}
+
+// BuildLedger replays transactions, and the splits of their assets, up to and
+// including asOf (all of them for the zero time), into holdings, tax lots and
+// realized P&L. Transactions apply in trade date order, those of a day in the
+// order they were recorded, after the splits going ex that day. Amounts of a
+// fee without an asset are in currency. Opening balances hold the positions
+// from before the ledger: transactions dated before them would count those
+// positions twice and are rejected, as is an asOf before them.
+func BuildLedger(transactions []domain.Transaction, splits []domain.CorporateAction, method, currency string, asOf time.Time) (*domain.Ledger, error) {
+	method, err := NormalizeCostMethod(method)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkOpeningBalances(transactions, asOf); err != nil {
+		return nil, err
+	}
+	ordered := append([]domain.Transaction(nil), transactions...)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		if !ordered[i].TradeDate.Equal(ordered[j].TradeDate) {
+			return ordered[i].TradeDate.Before(ordered[j].TradeDate)
+		}
+		return ordered[i].CreatedAt.Before(ordered[j].CreatedAt)
+	})
+	splits = append([]domain.CorporateAction(nil), splits...)
+	sort.SliceStable(splits, func(i, j int) bool { return splits[i].ExDate.Before(splits[j].ExDate) })
+
+	b := &ledgerBuilder{
+		ledger:   &domain.Ledger{AsOf: asOf, CostMethod: method, Realized: []domain.Realization{}},
+		method:   method,
+		holdings: make(map[uuid.UUID]*domain.Holding),
+		fees:     make(map[string]float64),
+	}
+	next := 0
+	for _, t := range ordered {
+		if !asOf.IsZero() && t.TradeDate.After(asOf) {
+			break
+		}
+		for ; next < len(splits) && !splits[next].ExDate.After(t.TradeDate); next++ {
+			b.split(splits[next])
+		}
+		if err := b.apply(t, currency); err != nil {
+			return nil, err
+		}
+	}
+	for ; next < len(splits) && (asOf.IsZero() || !splits[next].ExDate.After(asOf)); next++ {
+		b.split(splits[next])
+	}
+	return b.finish(), nil
+}
+
+// checkOpeningBalances rejects transactions, and an asOf, dated before the
+// latest opening balance
+func checkOpeningBalances(transactions []domain.Transaction, asOf time.Time) error {
+	var opening time.Time
+	for _, t := range transactions {
+		if isOpeningBalance(t) && t.TradeDate.After(opening) {
+			opening = t.TradeDate
+		}
+	}
+	if opening.IsZero() {
+		return nil
+	}
+	if !asOf.IsZero() && asOf.Before(opening) {
+		return fmt.Errorf("%w of %s", ErrBeforeOpeningBalances, opening.Format("2006-01-02"))
+	}
+	for _, t := range transactions {
+		if !isOpeningBalance(t) && t.TradeDate.Before(opening) {
+			return fmt.Errorf("%w: %s on %s is before the opening balances of %s, delete them to record earlier history",
+				ErrInvalidTransaction, t.Type, t.TradeDate.Format("2006-01-02"), opening.Format("2006-01-02"))
+		}
+	}
+	return nil
+}
+
+func isOpeningBalance(t domain.Transaction) bool {
+	return t.Type == TransactionTransfer && t.Note == OpeningBalanceNote
+}
+
+type ledgerBuilder struct {
+	ledger   *domain.Ledger
+	method   string
+	holdings map[uuid.UUID]*domain.Holding
+	fees     map[string]float64 // fees without an asset, by currency
+}
+
+// closedLot is the part of a lot a sale or transfer out closes
+type closedLot struct {
+	openDate *time.Time
+	quantity float64
+	cost     float64
+}
+
+func (b *ledgerBuilder) holding(t domain.Transaction) *domain.Holding {
+	h, ok := b.holdings[*t.AssetID]
+	if !ok {
+		h = &domain.Holding{AssetID: *t.AssetID, Lots: []domain.TaxLot{}}
+		if t.Asset != nil {
+			h.Symbol = t.Asset.Symbol
+			h.Currency = priceCurrency(*t.Asset)
+		}
+		b.holdings[*t.AssetID] = h
+	}
+	return h
+}
+
+func (b *ledgerBuilder) apply(t domain.Transaction, currency string) error {
+	if t.AssetID == nil {
+		if t.Type != TransactionFee {
+			return fmt.Errorf("%w: %s on %s has no asset", ErrInvalidTransaction, t.Type, t.TradeDate.Format("2006-01-02"))
+		}
+		b.fees[currency] += t.Amount
+		return nil
+	}
+	h := b.holding(t)
+
+	switch t.Type {
+	case TransactionBuy:
+		b.open(h, t, t.Quantity, (t.Quantity*t.Price+t.Fee)/t.Quantity)
+
+	case TransactionSell:
+		closed, err := b.close(h, t, t.Quantity)
+		if err != nil {
+			return err
+		}
+		proceeds := t.Quantity*t.Price - t.Fee
+		for _, lot := range closed {
+			share := proceeds * lot.quantity / t.Quantity
+			h.RealizedPnL += share - lot.cost
+			b.ledger.Realized = append(b.ledger.Realized, domain.Realization{
+				TransactionID: t.ID,
+				Date:          t.TradeDate,
+				Symbol:        h.Symbol,
+				Currency:      h.Currency,
+				Quantity:      lot.quantity,
+				Proceeds:      share,
+				CostBasis:     lot.cost,
+				PnL:           share - lot.cost,
+				OpenDate:      lot.openDate,
+			})
+		}
+
+	case TransactionTransfer:
+		if t.Quantity > 0 {
+			b.open(h, t, t.Quantity, t.Price)
+		} else if _, err := b.close(h, t, -t.Quantity); err != nil {
+			return err
+		}
+
+	case TransactionDividend:
+		h.Dividends += t.Amount
+
+	case TransactionFee:
+		h.Fees += t.Amount
+
+	default:
+		return fmt.Errorf("%w: unknown type %q", ErrInvalidTransaction, t.Type)
+	}
+	return nil
+}
+
+func (b *ledgerBuilder) open(h *domain.Holding, t domain.Transaction, quantity, unitCost float64) {
+	h.Lots = append(h.Lots, domain.TaxLot{
+		TransactionID: t.ID,
+		OpenDate:      t.TradeDate,
+		Quantity:      quantity,
+		UnitCost:      unitCost,
+	})
+	h.Quantity += quantity
+	h.CostBasis += quantity * unitCost
+}
+
+// close takes quantity out of a holding's lots: the oldest first with FIFO,
+// the newest first with LIFO, and every lot in proportion with average cost,
+// which keeps the cost per unit of what is left
+func (b *ledgerBuilder) close(h *domain.Holding, t domain.Transaction, quantity float64) ([]closedLot, error) {
+	if h.Quantity <= 0 || quantity > h.Quantity+quantityEpsilon {
+		return nil, fmt.Errorf("%w: %s of %g %s on %s exceeds the %g held",
+			ErrInvalidTransaction, t.Type, quantity, h.Symbol, t.TradeDate.Format("2006-01-02"), h.Quantity)
+	}
+
+	var closed []closedLot
+	switch b.method {
+	case CostAverage:
+		fraction := quantity / h.Quantity
+		total := closedLot{quantity: quantity}
+		for i := range h.Lots {
+			total.cost += h.Lots[i].Quantity * fraction * h.Lots[i].UnitCost
+			h.Lots[i].Quantity -= h.Lots[i].Quantity * fraction
+		}
+		closed = append(closed, total)
+
+	default:
+		remaining := quantity
+		for n := 0; n < len(h.Lots) && remaining > quantityEpsilon; n++ {
+			i := n
+			if b.method == CostLIFO {
+				i = len(h.Lots) - 1 - n
+			}
+			lot := &h.Lots[i]
+			take := math.Min(lot.Quantity, remaining)
+			openDate := lot.OpenDate
+			closed = append(closed, closedLot{openDate: &openDate, quantity: take, cost: take * lot.UnitCost})
+			lot.Quantity -= take
+			remaining -= take
+		}
+	}
+
+	open := h.Lots[:0]
+	h.Quantity, h.CostBasis = 0, 0
+	for _, lot := range h.Lots {
+		if lot.Quantity > quantityEpsilon {
+			open = append(open, lot)
+			h.Quantity += lot.Quantity
+			h.CostBasis += lot.Quantity * lot.UnitCost
+		}
+	}
+	h.Lots = open
+	return closed, nil
+}
+
+// split multiplies the units of a holding's lots by a split's ratio, keeping
+// their cost
+func (b *ledgerBuilder) split(action domain.CorporateAction) {
+	h, ok := b.holdings[action.AssetID]
+	if !ok || action.Value <= 0 {
+		return
+	}
+	for i := range h.Lots {
+		h.Lots[i].Quantity *= action.Value
+		h.Lots[i].UnitCost /= action.Value
+	}
+	h.Quantity *= action.Value
+}
+
+func (b *ledgerBuilder) finish() *domain.Ledger {
+	totals := make(map[string]*domain.LedgerTotal)
+	total := func(currency string) *domain.LedgerTotal {
+		if totals[currency] == nil {
+			totals[currency] = &domain.LedgerTotal{Currency: currency}
+		}
+		return totals[currency]
+	}
+
+	b.ledger.Holdings = make([]domain.Holding, 0, len(b.holdings))
+	for _, h := range b.holdings {
+		if h.Quantity > quantityEpsilon {
+			h.AvgCost = h.CostBasis / h.Quantity
+		} else {
+			h.Quantity, h.CostBasis = 0, 0
+		}
+		b.ledger.Holdings = append(b.ledger.Holdings, *h)
+		t := total(h.Currency)
+		t.RealizedPnL += h.RealizedPnL
+		t.Dividends += h.Dividends
+		t.Fees += h.Fees
+	}
+	for currency, fees := range b.fees {
+		total(currency).Fees += fees
+	}
+	sort.Slice(b.ledger.Holdings, func(i, j int) bool { return b.ledger.Holdings[i].Symbol < b.ledger.Holdings[j].Symbol })
+
+	b.ledger.Totals = make([]domain.LedgerTotal, 0, len(totals))
+	for _, t := range totals {
+		t.Net = t.RealizedPnL + t.Dividends - t.Fees
+		b.ledger.Totals = append(b.ledger.Totals, *t)
+	}
+	sort.Slice(b.ledger.Totals, func(i, j int) bool { return b.ledger.Totals[i].Currency < b.ledger.Totals[j].Currency })
+	return b.ledger
+}
+
+// LedgerService records portfolio transactions and derives positions from
+// them
+type LedgerService struct {
+	db *gorm.DB
+}
+
+func NewLedgerService(db *gorm.DB) *LedgerService {
+	return &LedgerService{db: db}
+}
+
+// HasTransactions reports whether a portfolio's positions are derived from a
+// ledger
+func (s *LedgerService) HasTransactions(portfolioID uuid.UUID) (bool, error) {
+	var count int64
+	err := s.db.Model(&domain.Transaction{}).Where("portfolio_id = ?", portfolioID).Limit(1).Count(&count).Error
+	return count > 0, err
+}
+
+// Transactions lists a portfolio's transactions from the from date to the to
+// date (both optional) in the order they apply
+func (s *LedgerService) Transactions(portfolioID uuid.UUID, from, to time.Time) ([]domain.Transaction, error) {
+	query := s.db.Preload("Asset").Where("portfolio_id = ?", portfolioID)
+	if !from.IsZero() {
+		query = query.Where("trade_date >= ?", from)
+	}
+	if !to.IsZero() {
+		query = query.Where("trade_date <= ?", to)
+	}
+	var transactions []domain.Transaction
+	err := query.Order("trade_date, created_at").Find(&transactions).Error
+	return transactions, err
+}
+
+// Record adds a transaction and updates the portfolio's positions from the
+// ledger. The first transaction of a portfolio with positions carries them in
+// as transfers at their average price, dated when they were added. A
+// transaction that would sell more than is held, at its date or later, or
+// that is dated before the opening balances, is rejected.
+func (s *LedgerService) Record(portfolioID uuid.UUID, req domain.TransactionRequest) (*domain.Transaction, error) {
+	var transaction *domain.Transaction
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		portfolio, err := lockPortfolio(tx, portfolioID)
+		if err != nil {
+			return err
+		}
+		if err := openingBalances(tx, portfolio); err != nil {
+			return err
+		}
+		transaction, err = newTransaction(tx, portfolioID, req)
+		if err != nil {
+			return err
+		}
+		if err := tx.Omit("Asset").Create(transaction).Error; err != nil {
+			return err
+		}
+		return s.sync(tx, portfolio)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return transaction, nil
+}
+
+// Delete removes a transaction and updates the portfolio's positions, unless
+// a later sale would then exceed what is held
+func (s *LedgerService) Delete(portfolioID, id uuid.UUID) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		portfolio, err := lockPortfolio(tx, portfolioID)
+		if err != nil {
+			return err
+		}
+		result := tx.Where("id = ? AND portfolio_id = ?", id, portfolioID).Delete(&domain.Transaction{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return s.sync(tx, portfolio)
+	})
+}
+
+// Ledger derives a portfolio's holdings, lots and realized P&L as of a date
+// (all transactions for the zero time) with a cost method, the portfolio's
+// own if empty
+func (s *LedgerService) Ledger(portfolioID uuid.UUID, asOf time.Time, method string) (*domain.Ledger, error) {
+	var portfolio domain.Portfolio
+	if err := s.db.First(&portfolio, "id = ?", portfolioID).Error; err != nil {
+		return nil, err
+	}
+	if method == "" {
+		method = portfolio.CostMethod
+	}
+	method, err := NormalizeCostMethod(method)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidTransaction, err)
+	}
+	portfolio.CostMethod = method
+	ledger, _, err := replay(s.db, &portfolio, asOf)
+	if err != nil {
+		return nil, err
+	}
+	if ledger == nil {
+		ledger, _ = BuildLedger(nil, nil, method, "", asOf)
+		ledger.PortfolioID = portfolio.ID
+	}
+	return ledger, nil
+}
+
+// PortfolioAsOf replaces the positions of a portfolio with a ledger by those
+// it held as of a date, keeping the IDs of the stored positions, for the
+// valuation and currency exposure. Risk calculations use the stored
+// positions, as their price windows end today. Portfolios without
+// transactions are left as they are.
+func (s *LedgerService) PortfolioAsOf(portfolio *domain.Portfolio, asOf time.Time) error {
+	ledger, assets, err := replay(s.db, portfolio, asOf)
+	if err != nil || ledger == nil {
+		return err
+	}
+	stored := make(map[uuid.UUID]domain.Position, len(portfolio.Positions))
+	for _, pos := range portfolio.Positions {
+		stored[pos.AssetID] = pos
+	}
+	positions := make([]domain.Position, 0, len(ledger.Holdings))
+	for _, h := range ledger.Holdings {
+		if h.Quantity == 0 {
+			continue
+		}
+		pos, ok := stored[h.AssetID]
+		if !ok {
+			pos = domain.Position{ID: uuid.New(), PortfolioID: portfolio.ID, AssetID: h.AssetID, Asset: assets[h.AssetID]}
+		}
+		pos.Quantity = h.Quantity
+		pos.AvgPrice = h.AvgCost
+		positions = append(positions, pos)
+	}
+	portfolio.Positions = positions
+	return nil
+}
+
+// SyncPositions updates a portfolio's positions from its ledger, after its
+// cost method changed
+func (s *LedgerService) SyncPositions(portfolioID uuid.UUID) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		portfolio, err := lockPortfolio(tx, portfolioID)
+		if err != nil {
+			return err
+		}
+		return s.sync(tx, portfolio)
+	})
+}
+
+// sync replays a portfolio's whole ledger and writes the open holdings as its
+// positions, one per asset
+func (s *LedgerService) sync(tx *gorm.DB, portfolio *domain.Portfolio) error {
+	ledger, _, err := replay(tx, portfolio, time.Time{})
+	if err != nil {
+		return err
+	}
+	holdings := []domain.Holding{}
+	if ledger != nil {
+		holdings = ledger.Holdings
+	}
+
+	var positions []domain.Position
+	if err := tx.Where("portfolio_id = ?", portfolio.ID).Order("created_at").Find(&positions).Error; err != nil {
+		return err
+	}
+	stored := make(map[uuid.UUID]domain.Position, len(positions))
+	var stale []uuid.UUID
+	for _, pos := range positions {
+		if _, ok := stored[pos.AssetID]; ok {
+			stale = append(stale, pos.ID)
+			continue
+		}
+		stored[pos.AssetID] = pos
+	}
+
+	for _, h := range holdings {
+		pos, ok := stored[h.AssetID]
+		delete(stored, h.AssetID)
+		switch {
+		case h.Quantity == 0 && ok:
+			stale = append(stale, pos.ID)
+		case h.Quantity == 0:
+		case ok:
+			err := tx.Model(&pos).Updates(map[string]interface{}{"quantity": h.Quantity, "avg_price": h.AvgCost}).Error
+			if err != nil {
+				return err
+			}
+		default:
+			pos = domain.Position{PortfolioID: portfolio.ID, AssetID: h.AssetID, Quantity: h.Quantity, AvgPrice: h.AvgCost}
+			if err := tx.Create(&pos).Error; err != nil {
+				return err
+			}
+		}
+	}
+	for _, pos := range stored {
+		stale = append(stale, pos.ID)
+	}
+	if len(stale) == 0 {
+		return nil
+	}
+	return tx.Where("id IN ?", stale).Delete(&domain.Position{}).Error
+}
+
+// replay builds a portfolio's ledger as of a date with its cost method, and
+// returns the assets it traded. The ledger is nil if the portfolio has no
+// transactions.
+func replay(tx *gorm.DB, portfolio *domain.Portfolio, asOf time.Time) (*domain.Ledger, map[uuid.UUID]domain.Asset, error) {
+	var transactions []domain.Transaction
+	if err := tx.Preload("Asset").Where("portfolio_id = ?", portfolio.ID).Find(&transactions).Error; err != nil {
+		return nil, nil, err
+	}
+	if len(transactions) == 0 {
+		return nil, nil, nil
+	}
+	assets := make(map[uuid.UUID]domain.Asset)
+	var assetIDs []uuid.UUID
+	for _, t := range transactions {
+		if t.Asset != nil {
+			if _, ok := assets[t.Asset.ID]; !ok {
+				assetIDs = append(assetIDs, t.Asset.ID)
+			}
+			assets[t.Asset.ID] = *t.Asset
+		}
+	}
+	var splits []domain.CorporateAction
+	if len(assetIDs) > 0 {
+		err := tx.Where("type = ? AND asset_id IN ?", ActionSplit, assetIDs).Find(&splits).Error
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	currency, err := NormalizeCurrency(portfolio.BaseCurrency)
+	if err != nil {
+		return nil, nil, err
+	}
+	ledger, err := BuildLedger(transactions, splits, portfolio.CostMethod, currency, asOf)
+	if err != nil {
+		return nil, nil, err
+	}
+	ledger.PortfolioID = portfolio.ID
+	return ledger, assets, nil
+}
+
+// lockPortfolio loads a portfolio for update, so ledger changes to it apply
+// one at a time
+func lockPortfolio(tx *gorm.DB, portfolioID uuid.UUID) (*domain.Portfolio, error) {
+	var portfolio domain.Portfolio
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&portfolio, "id = ?", portfolioID).Error
+	if err != nil {
+		return nil, err
+	}
+	return &portfolio, nil
+}
+
+// openingBalances carries a portfolio's positions into its ledger when it
+// gets its first transaction
+func openingBalances(tx *gorm.DB, portfolio *domain.Portfolio) error {
+	var count int64
+	if err := tx.Model(&domain.Transaction{}).Where("portfolio_id = ?", portfolio.ID).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+	var positions []domain.Position
+	if err := tx.Where("portfolio_id = ?", portfolio.ID).Order("created_at").Find(&positions).Error; err != nil {
+		return err
+	}
+	for _, pos := range positions {
+		if pos.Quantity < 0 {
+			return fmt.Errorf("%w: the short position in asset %s cannot be carried into the ledger", ErrInvalidTransaction, pos.AssetID)
+		}
+		assetID := pos.AssetID
+		opening := domain.Transaction{
+			PortfolioID: portfolio.ID,
+			AssetID:     &assetID,
+			Type:        TransactionTransfer,
+			TradeDate:   snapshotDate(pos.CreatedAt),
+			Quantity:    pos.Quantity,
+			Price:       pos.AvgPrice,
+			Note:        OpeningBalanceNote,
+		}
+		if err := tx.Create(&opening).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// newTransaction validates a transaction request, resolving its symbol
+func newTransaction(tx *gorm.DB, portfolioID uuid.UUID, req domain.TransactionRequest) (*domain.Transaction, error) {
+	kind := strings.ToLower(strings.TrimSpace(req.Type))
+	if !containsString(TransactionTypes, kind) {
+		return nil, fmt.Errorf("%w: unknown type %q, expected one of %s", ErrInvalidTransaction, req.Type, strings.Join(TransactionTypes, ", "))
+	}
+	date, err := time.Parse("2006-01-02", req.TradeDate)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid trade_date, expected YYYY-MM-DD", ErrInvalidTransaction)
+	}
+	symbol := strings.ToUpper(strings.TrimSpace(req.Symbol))
+
+	switch {
+	case symbol == "" && kind != TransactionFee:
+		return nil, fmt.Errorf("%w: a %s needs a symbol", ErrInvalidTransaction, kind)
+	case (kind == TransactionBuy || kind == TransactionSell) && req.Quantity <= 0:
+		return nil, fmt.Errorf("%w: a %s needs a positive quantity", ErrInvalidTransaction, kind)
+	case kind == TransactionTransfer && req.Quantity == 0:
+		return nil, fmt.Errorf("%w: a transfer needs a quantity, positive in and negative out", ErrInvalidTransaction)
+	case kind == TransactionDividend && req.Amount == 0:
+		return nil, fmt.Errorf("%w: a dividend needs an amount", ErrInvalidTransaction)
+	case kind == TransactionFee && req.Amount <= 0:
+		return nil, fmt.Errorf("%w: a fee needs a positive amount", ErrInvalidTransaction)
+	}
+
+	transaction := &domain.Transaction{
+		PortfolioID: portfolioID,
+		Type:        kind,
+		TradeDate:   date,
+		Note:        req.Note,
+	}
+	switch kind {
+	case TransactionBuy, TransactionSell:
+		transaction.Quantity = req.Quantity
+		transaction.Price = req.Price
+		transaction.Fee = req.Fee
+	case TransactionTransfer:
+		transaction.Quantity = req.Quantity
+		transaction.Price = req.Price
+	default:
+		transaction.Amount = req.Amount
+	}
+	if symbol != "" {
+		asset, err := ResolveAsset(tx, symbol)
+		if err != nil {
+			return nil, err
+		}
+		transaction.AssetID = &asset.ID
+		transaction.Asset = &asset
+	}
+	return transaction, nil
+}
@@ -0,0 +1,458 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/reserveone/saa-risk-analyzer/internal/domain"
+	"github.com/reserveone/saa-risk-analyzer/internal/notify"
+)
+
+// Limit types
+const (
+	LimitVaR           = "var"           // VaR / NAV
+	LimitCVaR          = "cvar"          // CVaR / NAV
+	LimitConcentration = "concentration" // largest position's weight
+	LimitAssetClass    = "asset_class"   // an asset class's weight
+	LimitStressLoss    = "stress_loss"   // a stress scenario's loss / NAV
+)
+
+// Limit states
+const (
+	LimitOK      = "ok"
+	LimitWarning = "warning"
+	LimitBreach  = "breach"
+)
+
+const (
+	defaultLimitWarning = 0.8
+	defaultEventLimit   = 100
+	maxEventLimit       = 1000
+	alertTimeout        = time.Minute
+)
+
+var LimitTypes = []string{LimitVaR, LimitCVaR, LimitConcentration, LimitAssetClass, LimitStressLoss}
+
+// ErrInvalidLimit wraps the validation errors of limit requests
+var ErrInvalidLimit = errors.New("invalid limit")
+
+// RiskObservation is the result of a risk calculation that a portfolio's
+// limits are checked against; nil or empty fields were not calculated
+type RiskObservation struct {
+	Confidence   float64
+	HorizonDays  int
+	VaR          *float64
+	CVaR         *float64
+	StressLosses map[string]float64 // loss by scenario as a fraction of NAV, positive for losses
+}
+
+// LimitPortfolio is a portfolio's current NAV and weights, which limits are
+// measured with
+type LimitPortfolio struct {
+	NAV          float64
+	Weights      map[string]float64 // by symbol
+	ClassWeights map[string]float64 // by asset class
+}
+
+// MeasureLimit returns a limit's value and utilization, 1 at the limit. ok is
+// false when the observation does not measure what the limit caps. An asset
+// class band's utilization is the distance of the weight from the middle of
+// the band, 1 at either bound.
+func MeasureLimit(limit *domain.RiskLimit, obs RiskObservation, portfolio LimitPortfolio) (value, utilization float64, detail string, ok bool) {
+	switch limit.Type {
+	case LimitVaR, LimitCVaR:
+		amount := obs.VaR
+		if limit.Type == LimitCVaR {
+			amount = obs.CVaR
+		}
+		if amount == nil || portfolio.NAV <= 0 {
+			return 0, 0, "", false
+		}
+		if limit.Confidence != 0 && limit.Confidence != obs.Confidence {
+			return 0, 0, "", false
+		}
+		if limit.HorizonDays != 0 && limit.HorizonDays != obs.HorizonDays {
+			return 0, 0, "", false
+		}
+		value = *amount / portfolio.NAV
+		detail = fmt.Sprintf("%.0f%% %d-day", obs.Confidence*100, obs.HorizonDays)
+
+	case LimitConcentration:
+		if len(portfolio.Weights) == 0 {
+			return 0, 0, "", false
+		}
+		largest := ""
+		for symbol, weight := range portfolio.Weights {
+			if w := math.Abs(weight); w > value || (w == value && symbol < largest) || largest == "" {
+				value, largest = w, symbol
+			}
+		}
+		detail = largest
+
+	case LimitAssetClass:
+		if portfolio.ClassWeights == nil {
+			return 0, 0, "", false
+		}
+		value = portfolio.ClassWeights[limit.AssetClass]
+		if limit.Min != nil {
+			mid := (*limit.Min + limit.Max) / 2
+			half := (limit.Max - *limit.Min) / 2
+			return value, math.Abs(value-mid) / half, "", true
+		}
+
+	case LimitStressLoss:
+		if len(obs.StressLosses) == 0 {
+			return 0, 0, "", false
+		}
+		if limit.Scenario != "" {
+			loss, found := obs.StressLosses[limit.Scenario]
+			if !found {
+				return 0, 0, "", false
+			}
+			value, detail = loss, limit.Scenario
+			break
+		}
+		value = math.Inf(-1)
+		for scenario, loss := range obs.StressLosses {
+			if loss > value || (loss == value && scenario < detail) {
+				value, detail = loss, scenario
+			}
+		}
+
+	default:
+		return 0, 0, "", false
+	}
+	return value, value / limit.Max, detail, true
+}
+
+// LimitState returns the state of a limit at a utilization: breach above 1,
+// warning from the warning level
+func LimitState(utilization, warning float64) string {
+	switch {
+	case utilization > 1:
+		return LimitBreach
+	case utilization >= warning:
+		return LimitWarning
+	default:
+		return LimitOK
+	}
+}
+
+// LimitService stores risk limits, checks them against risk results and
+// alerts when they change state
+type LimitService struct {
+	db       *gorm.DB
+	notifier notify.Notifier
+}
+
+// NewLimitService returns a limit service alerting through notifier; with no
+// notifier state changes are only recorded
+func NewLimitService(db *gorm.DB, notifier notify.Notifier) *LimitService {
+	if multi, ok := notifier.(notify.Multi); ok && len(multi) == 0 {
+		notifier = nil
+	}
+	return &LimitService{db: db, notifier: notifier}
+}
+
+// Observe checks a portfolio's enabled limits that a risk result measures,
+// recording and alerting on those that change state. weights are those the
+// result was calculated with, so the portfolio is not valued again.
+func (s *LimitService) Observe(ctx context.Context, portfolioID uuid.UUID, obs RiskObservation, weights LimitPortfolio) error {
+	var limits []domain.RiskLimit
+	if err := s.db.Where("portfolio_id = ? AND enabled", portfolioID).Find(&limits).Error; err != nil {
+		return err
+	}
+
+	var portfolio *domain.Portfolio
+	for i := range limits {
+		limit := &limits[i]
+		value, utilization, detail, ok := MeasureLimit(limit, obs, weights)
+		if !ok {
+			continue
+		}
+		event, err := s.record(limit, value, utilization, detail)
+		if err != nil {
+			return err
+		}
+		if event == nil {
+			continue
+		}
+		if portfolio == nil {
+			portfolio = &domain.Portfolio{}
+			if err := s.db.First(portfolio, "id = ?", portfolioID).Error; err != nil {
+				return err
+			}
+		}
+		s.alert(portfolio, limit, event)
+	}
+	return nil
+}
+
+// limitPortfolio returns the weights of a valued portfolio by symbol and by
+// asset class
+func limitPortfolio(portfolio *domain.Portfolio, valuation *domain.PortfolioValuation) LimitPortfolio {
+	classes := make(map[uuid.UUID]string, len(portfolio.Positions))
+	for _, pos := range portfolio.Positions {
+		classes[pos.ID] = pos.Asset.Class
+	}
+	result := LimitPortfolio{
+		NAV:          valuation.NAV,
+		Weights:      make(map[string]float64, len(valuation.Positions)),
+		ClassWeights: make(map[string]float64),
+	}
+	for _, pos := range valuation.Positions {
+		result.Weights[pos.Symbol] += pos.Weight
+		result.ClassWeights[classes[pos.PositionID]] += pos.Weight
+	}
+	return result
+}
+
+// record stores a limit's measurement, and an event if its state changed.
+// The limit is locked meanwhile, so concurrent checks record one change.
+func (s *LimitService) record(limit *domain.RiskLimit, value, utilization float64, detail string) (*domain.LimitEvent, error) {
+	var event *domain.LimitEvent
+	now := time.Now()
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var current domain.RiskLimit
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&current, "id = ?", limit.ID).Error
+		if err != nil {
+			return err
+		}
+
+		state := LimitState(utilization, current.Warning)
+		if state != current.State {
+			event = &domain.LimitEvent{
+				LimitID:       current.ID,
+				PortfolioID:   current.PortfolioID,
+				State:         state,
+				PreviousState: current.State,
+				Value:         value,
+				Utilization:   utilization,
+				Detail:        detail,
+			}
+			if err := tx.Create(event).Error; err != nil {
+				return err
+			}
+		}
+
+		limit.State = state
+		limit.Value = &value
+		limit.Utilization = &utilization
+		limit.Detail = detail
+		limit.CheckedAt = &now
+		return tx.Model(&current).Updates(map[string]interface{}{
+			"state":       state,
+			"value":       value,
+			"utilization": utilization,
+			"detail":      detail,
+			"checked_at":  now,
+		}).Error
+	})
+	return event, err
+}
+
+// alert delivers an event in the background and records the outcome
+func (s *LimitService) alert(portfolio *domain.Portfolio, limit *domain.RiskLimit, event *domain.LimitEvent) {
+	if s.notifier == nil {
+		return
+	}
+	alert := notify.Alert{
+		LimitID:       limit.ID,
+		LimitName:     limit.Name,
+		LimitType:     limit.Type,
+		PortfolioID:   portfolio.ID,
+		PortfolioName: portfolio.Name,
+		State:         event.State,
+		PreviousState: event.PreviousState,
+		Value:         event.Value,
+		Min:           limit.Min,
+		Max:           limit.Max,
+		Utilization:   event.Utilization,
+		Detail:        event.Detail,
+		At:            event.CreatedAt,
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), alertTimeout)
+		defer cancel()
+		updates := map[string]interface{}{"notified": true, "notify_error": ""}
+		if err := s.notifier.Notify(ctx, alert); err != nil {
+			fmt.Printf("Warning: failed to deliver alert for limit %s: %v\n", limit.ID, err)
+			updates = map[string]interface{}{"notified": false, "notify_error": err.Error()}
+		}
+		if err := s.db.Model(&domain.LimitEvent{}).Where("id = ?", event.ID).Updates(updates).Error; err != nil {
+			fmt.Printf("Warning: failed to record alert delivery for limit %s: %v\n", limit.ID, err)
+		}
+	}()
+}
+
+func (s *LimitService) List(portfolioID uuid.UUID) ([]domain.RiskLimit, error) {
+	var limits []domain.RiskLimit
+	err := s.db.Where("portfolio_id = ?", portfolioID).Order("name").Find(&limits).Error
+	return limits, err
+}
+
+func (s *LimitService) Get(portfolioID, id uuid.UUID) (*domain.RiskLimit, error) {
+	var limit domain.RiskLimit
+	if err := s.db.First(&limit, "id = ? AND portfolio_id = ?", id, portfolioID).Error; err != nil {
+		return nil, err
+	}
+	return &limit, nil
+}
+
+func (s *LimitService) Create(portfolioID uuid.UUID, req domain.RiskLimitRequest) (*domain.RiskLimit, error) {
+	if err := s.db.Select("id").First(&domain.Portfolio{}, "id = ?", portfolioID).Error; err != nil {
+		return nil, err
+	}
+	limit := domain.RiskLimit{PortfolioID: portfolioID, State: LimitOK}
+	if err := applyLimit(&limit, req); err != nil {
+		return nil, err
+	}
+	if err := s.db.Create(&limit).Error; err != nil {
+		return nil, err
+	}
+	return &limit, nil
+}
+
+// Update replaces a limit's definition. Its state is kept until the next
+// check, which records any change against the new definition.
+func (s *LimitService) Update(portfolioID, id uuid.UUID, req domain.RiskLimitRequest) (*domain.RiskLimit, error) {
+	limit, err := s.Get(portfolioID, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := applyLimit(limit, req); err != nil {
+		return nil, err
+	}
+	if err := s.db.Save(limit).Error; err != nil {
+		return nil, err
+	}
+	return limit, nil
+}
+
+func (s *LimitService) Delete(portfolioID, id uuid.UUID) error {
+	result := s.db.Delete(&domain.RiskLimit{}, "id = ? AND portfolio_id = ?", id, portfolioID)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// Events returns a portfolio's limit state changes, newest first, of one
+// limit when limitID is not nil
+func (s *LimitService) Events(portfolioID uuid.UUID, limitID *uuid.UUID, limit int) ([]domain.LimitEvent, error) {
+	if limit <= 0 {
+		limit = defaultEventLimit
+	} else if limit > maxEventLimit {
+		limit = maxEventLimit
+	}
+
+	query := s.db.Where("portfolio_id = ?", portfolioID)
+	if limitID != nil {
+		query = query.Where("limit_id = ?", *limitID)
+	}
+	var events []domain.LimitEvent
+	err := query.Order("created_at DESC").Limit(limit).Find(&events).Error
+	return events, err
+}
+
+// applyLimit validates a request and sets the limit's definition from it
+func applyLimit(limit *domain.RiskLimit, req domain.RiskLimitRequest) error {
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidLimit)
+	}
+	limitType := strings.ToLower(strings.TrimSpace(req.Type))
+	if !containsString(LimitTypes, limitType) {
+		return fmt.Errorf("%w: invalid type %q, expected one of %s", ErrInvalidLimit, req.Type, strings.Join(LimitTypes, ", "))
+	}
+	if req.Max <= 0 {
+		return fmt.Errorf("%w: max must be positive", ErrInvalidLimit)
+	}
+
+	limit.AssetClass, limit.Scenario, limit.Min = "", "", nil
+	limit.Confidence, limit.HorizonDays = 0, 0
+	switch limitType {
+	case LimitVaR, LimitCVaR:
+		limit.Confidence = req.Confidence
+		limit.HorizonDays = req.HorizonDays
+	case LimitAssetClass:
+		if strings.TrimSpace(req.AssetClass) == "" {
+			return fmt.Errorf("%w: asset_class is required", ErrInvalidLimit)
+		}
+		class, ok := normalizeAssetClass(strings.TrimSpace(req.AssetClass))
+		if !ok {
+			return fmt.Errorf("%w: asset_class %q, expected one of %s", ErrInvalidLimit, req.AssetClass, strings.Join(AssetClasses, ", "))
+		}
+		limit.AssetClass = class
+		if req.Min != nil {
+			if *req.Min >= req.Max {
+				return fmt.Errorf("%w: min must be below max", ErrInvalidLimit)
+			}
+			limit.Min = req.Min
+		}
+	case LimitStressLoss:
+		limit.Scenario = strings.TrimSpace(req.Scenario)
+	}
+	if limitType != LimitAssetClass && req.Min != nil {
+		return fmt.Errorf("%w: min applies to asset_class limits only", ErrInvalidLimit)
+	}
+
+	warning := req.Warning
+	if warning == 0 {
+		warning = defaultLimitWarning
+	}
+	if warning < 0 || warning > 1 {
+		return fmt.Errorf("%w: warning must be in (0, 1]", ErrInvalidLimit)
+	}
+
+	limit.Name = name
+	limit.Type = limitType
+	limit.Max = req.Max
+	limit.Warning = warning
+	limit.Enabled = req.Enabled == nil || *req.Enabled
+	return nil
+}
+
+// stressLosses returns each scenario's loss as a fraction of NAV
+func stressLosses(response *domain.StressTestResponse) map[string]float64 {
+	if response.NAV <= 0 {
+		return nil
+	}
+	losses := make(map[string]float64, len(response.Scenarios))
+	for _, sc := range response.Scenarios {
+		losses[sc.Name] = -sc.DeltaNAV / response.NAV
+	}
+	return losses
+}
+
+// observe checks a risk result against the portfolio's limits. A failed
+// check is logged and never fails the calculation.
+func (s *RiskService) observe(ctx context.Context, portfolioID uuid.UUID, obs RiskObservation, weights LimitPortfolio) {
+	if s.limits == nil {
+		return
+	}
+	if err := s.limits.Observe(ctx, portfolioID, obs, weights); err != nil {
+		fmt.Printf("Warning: failed to check risk limits of portfolio %s: %v\n", portfolioID, err)
+	}
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -1,204 +1,238 @@
 package service
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
-	"io"
 	"net/http"
+	"sort"
+	"strings"
 	"time"
+
+	"github.com/reserveone/saa-risk-analyzer/internal/config"
 )
 
 type MarketDataService struct {
-	client *http.Client
+	providers map[string]PriceProvider
+	chains    map[string][]string // provider names by asset class, "default" for the rest
+	state     map[string]*providerState
+	policy    ResiliencePolicy
+	symbols   SymbolSource // nil routes on AssetClassOf and provider default tickers
+}
+
+// SymbolSource is reference data about symbols used to route them to
+// providers, see SymbolService
+type SymbolSource interface {
+	// Class returns the asset class of a known symbol
+	Class(symbol string) (string, bool)
+	// Ticker returns a provider's ticker for a symbol
+	Ticker(provider, symbol string) (string, bool)
+}
+
+// DefaultProviderChain is the chain key used for asset classes without their own chain
+const DefaultProviderChain = "default"
+
+var defaultProviderChains = map[string][]string{
+	AssetClassCrypto:     {ProviderBinance, ProviderCoinGecko, ProviderCoinCap},
+	DefaultProviderChain: {ProviderYahoo},
+}
+
+// NewMarketDataService registers the built-in API providers, plus the file
+// provider when a data directory is configured. Without configured chains the
+// file provider, when present, is tried before the APIs.
+func NewMarketDataService(cfg config.MarketConfig, symbols SymbolSource) *MarketDataService {
+	// Timeouts are applied per attempt from the resilience policy
+	client := &http.Client{}
+	providers := []PriceProvider{
+		&binanceProvider{client: client},
+		&coinGeckoProvider{client: client},
+		&coinCapProvider{client: client},
+		&yahooProvider{client: client},
+	}
+
+	chains := cfg.ProviderChains
+	if len(chains) == 0 {
+		chains = make(map[string][]string, len(defaultProviderChains))
+		for class, chain := range defaultProviderChains {
+			if cfg.DataDir != "" {
+				chain = append([]string{ProviderFile}, chain...)
+			}
+			chains[class] = chain
+		}
+	}
+	if cfg.DataDir != "" {
+		providers = append(providers, NewFileProvider(cfg.DataDir))
+	}
+
+	policy := ResiliencePolicy{
+		Retries:         cfg.Retries,
+		RetryBaseDelay:  cfg.RetryBaseDelay,
+		RequestTimeout:  cfg.RequestTimeout,
+		BreakerFailures: cfg.BreakerFailures,
+		BreakerCooldown: cfg.BreakerCooldown,
+	}
+	return NewMarketDataServiceWithProviders(providers, chains, policy, symbols)
 }
 
-func NewMarketDataService() *MarketDataService {
+// NewMarketDataServiceWithProviders builds a service from explicit providers
+// and chains, e.g. to run offline against a FileProvider. Each provider gets
+// its own rate limit and circuit breaker.
+func NewMarketDataServiceWithProviders(providers []PriceProvider, chains map[string][]string, policy ResiliencePolicy, symbols SymbolSource) *MarketDataService {
+	registry := make(map[string]PriceProvider, len(providers))
+	state := make(map[string]*providerState, len(providers))
+	for _, provider := range providers {
+		registry[provider.Name()] = provider
+		state[provider.Name()] = &providerState{
+			limiter: newTokenBucket(provider.Capabilities().RateLimit),
+			state:   CircuitClosed,
+		}
+	}
+
 	return &MarketDataService{
-		client: &http.Client{Timeout: 10 * time.Second},
-	}
-}
-
-// GetHistoricalPrices retrieves historical prices with API priority
-func (s *MarketDataService) GetHistoricalPrices(symbol string, days int) ([]PricePoint, error) {
-	// Determine asset type
-	if isCrypto(symbol) {
-		return s.getCryptoPrices(symbol, days)
-	}
-	return s.getStockPrices(symbol, days)
-}
-
-// getCryptoPrices uses multi-API fallback for cryptocurrencies
-func (s *MarketDataService) getCryptoPrices(symbol string, days int) ([]PricePoint, error) {
-	// 1. Try Binance (NO LIMITS)
-	prices, err := s.fetchBinance(symbol, days)
-	if err == nil && len(prices) > 0 {
-		return prices, nil
-	}
-	
-	// 2. Try CoinGecko (free)
-	prices, err = s.fetchCoinGecko(symbol, days)
-	if err == nil && len(prices) > 0 {
-		return prices, nil
-	}
-	
-	// 3. Try CoinCap (200/day)
-	prices, err = s.fetchCoinCap(symbol, days)
-	if err == nil && len(prices) > 0 {
-		return prices, nil
-	}
-	
-	return nil, fmt.Errorf("failed to fetch crypto prices for %s", symbol)
-}
-
-// getStockPrices for stocks/ETFs
-func (s *MarketDataService) getStockPrices(symbol string, days int) ([]PricePoint, error) {
-	// 1. Yahoo Finance (free)
-	prices, err := s.fetchYahooFinance(symbol, days)
-	if err == nil && len(prices) > 0 {
-		return prices, nil
-	}
-	
-	return nil, fmt.Errorf("failed to fetch stock prices for %s", symbol)
-}
-
-// Binance API (NO LIMITS)
-func (s *MarketDataService) fetchBinance(symbol string, days int) ([]PricePoint, error) {
-	// Convert symbol (BTC -> BTCUSDT)
-	pair := symbol + "USDT"
-	
-	url := fmt.Sprintf("https://api.binance.com/api/v3/klines?symbol=%s&interval=1d&limit=%d", pair, days)
-	
-	resp, err := s.client.Get(url)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-	
-	if resp.StatusCode != 200 {
-		return nil, fmt.Errorf("binance API error: %d", resp.StatusCode)
-	}
-	
-	var data [][]interface{}
-	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
-		return nil, err
-	}
-	
-	prices := make([]PricePoint, 0, len(data))
-	for _, candle := range data {
-		timestamp := int64(candle[0].(float64))
-		closePrice := parseFloat(candle[4])
-		
-		prices = append(prices, PricePoint{
-			Date:  time.Unix(timestamp/1000, 0),
-			Close: closePrice,
-		})
+		providers: registry,
+		chains:    chains,
+		state:     state,
+		policy:    policy,
+		symbols:   symbols,
 	}
-	
-	return prices, nil
-}
-
-// CoinGecko API (free)
-func (s *MarketDataService) fetchCoinGecko(symbol string, days int) ([]PricePoint, error) {
-	coinID := getCoinGeckoID(symbol)
-	
-	url := fmt.Sprintf("https://api.coingecko.com/api/v3/coins/%s/market_chart?vs_currency=usd&days=%d", coinID, days)
-	
-	resp, err := s.client.Get(url)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-	
-	if resp.StatusCode != 200 {
-		return nil, fmt.Errorf("coingecko API error: %d", resp.StatusCode)
-	}
-	
-	var data struct {
-		Prices [][]float64 `json:"prices"`
-	}
-	
-	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
-		return nil, err
-	}
-	
-	prices := make([]PricePoint, 0, len(data.Prices))
-	for _, p := range data.Prices {
-		prices = append(prices, PricePoint{
-			Date:  time.Unix(int64(p[0]/1000), 0),
-			Close: p[1],
-		})
+}
+
+// GetHistoricalPrices retrieves historical prices from the provider chain of
+// the symbol's asset class, falling back along the chain on errors
+func (s *MarketDataService) GetHistoricalPrices(ctx context.Context, symbol string, days int) ([]PricePoint, error) {
+	prices, _, err := s.FetchHistoricalPrices(ctx, symbol, days)
+	return prices, err
+}
+
+// FetchHistoricalPrices is GetHistoricalPrices, also returning the name of
+// the provider that served the prices
+func (s *MarketDataService) FetchHistoricalPrices(ctx context.Context, symbol string, days int) ([]PricePoint, string, error) {
+	assetClass := s.AssetClass(symbol)
+	chain := s.Chain(assetClass)
+	if len(chain) == 0 {
+		return nil, "", fmt.Errorf("no price providers configured for %s", assetClass)
 	}
-	
-	return prices, nil
-}
-
-// CoinCap API (200 requests/day)
-func (s *MarketDataService) fetchCoinCap(symbol string, days int) ([]PricePoint, error) {
-	url := fmt.Sprintf("https://api.coincap.io/v2/assets/%s/history?interval=d1", toLowerCase(symbol))
-	
-	resp, err := s.client.Get(url)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-	
-	body, _ := io.ReadAll(resp.Body)
-	
-	var data struct {
-		Data []struct {
-			PriceUsd string `json:"priceUsd"`
-			Time     int64  `json:"time"`
-		} `json:"data"`
-	}
-	
-	json.Unmarshal(body, &data)
-	
-	prices := make([]PricePoint, 0)
-	for _, p := range data.Data {
-		prices = append(prices, PricePoint{
-			Date:  time.Unix(p.Time/1000, 0),
-			Close: parseFloat(p.PriceUsd),
+
+	var errs []string
+	for _, name := range chain {
+		provider, ok := s.providers[name]
+		if !ok {
+			errs = append(errs, fmt.Sprintf("%s: unknown provider", name))
+			continue
+		}
+		capabilities := provider.Capabilities()
+		if !capabilities.Supports(assetClass) {
+			continue
+		}
+
+		request := days
+		if capabilities.MaxHistoryDays > 0 && request > capabilities.MaxHistoryDays {
+			request = capabilities.MaxHistoryDays
+		}
+		var prices []PricePoint
+		err := s.call(ctx, name, func(ctx context.Context) error {
+			var err error
+			prices, err = provider.HistoricalPrices(ctx, s.ticker(name, symbol), request)
+			return err
 		})
+		if err == nil && len(prices) > 0 {
+			return prices, name, nil
+		}
+		if ctx.Err() != nil {
+			return nil, "", ctx.Err()
+		}
+		if err == nil {
+			err = fmt.Errorf("no prices returned")
+		}
+		errs = append(errs, fmt.Sprintf("%s: %v", name, err))
 	}
-	
-	return prices, nil
-}
-
-// Yahoo Finance (free) - using chart API instead of download
-func (s *MarketDataService) fetchYahooFinance(symbol string, days int) ([]PricePoint, error) {
-	// Use v8 chart API for better reliability
-	url := fmt.Sprintf("https://query1.finance.yahoo.com/v8/finance/chart/%s?interval=1d&range=%dd", symbol, days)
-	
-	resp, err := s.client.Get(url)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-	
-	if resp.StatusCode != 200 {
-		return nil, fmt.Errorf("yahoo API error: %d", resp.StatusCode)
-	}
-	
-	// Simple CSV parsing
-	body, _ := io.ReadAll(resp.Body)
-	lines := parseCSV(string(body))
-	
-	prices := make([]PricePoint, 0)
-	for i, line := range lines {
-		if i == 0 || len(line) < 5 {
-			continue // skip header
+
+	return nil, "", fmt.Errorf("failed to fetch prices for %s (%s)", symbol, strings.Join(errs, "; "))
+}
+
+// FetchCorporateActions returns splits and dividends over the last days from
+// the first provider in the symbol's chain that reports them
+func (s *MarketDataService) FetchCorporateActions(ctx context.Context, symbol string, days int) ([]CorporateAction, string, error) {
+	assetClass := s.AssetClass(symbol)
+
+	var errs []string
+	for _, name := range s.Chain(assetClass) {
+		provider, ok := s.providers[name].(CorporateActionProvider)
+		if !ok || !s.providers[name].Capabilities().Supports(assetClass) {
+			continue
 		}
-		
-		date, _ := time.Parse("2006-01-02", line[0])
-		closePrice := parseFloat(line[4])
-		
-		prices = append(prices, PricePoint{
-			Date:  date,
-			Close: closePrice,
+		var actions []CorporateAction
+		err := s.call(ctx, name, func(ctx context.Context) error {
+			var err error
+			actions, err = provider.CorporateActions(ctx, s.ticker(name, symbol), days)
+			return err
 		})
+		if err == nil {
+			return actions, name, nil
+		}
+		if ctx.Err() != nil {
+			return nil, "", ctx.Err()
+		}
+		errs = append(errs, fmt.Sprintf("%s: %v", name, err))
+	}
+
+	if len(errs) == 0 {
+		return nil, "", fmt.Errorf("no corporate action providers configured for %s", assetClass)
+	}
+	return nil, "", fmt.Errorf("failed to fetch corporate actions for %s (%s)", symbol, strings.Join(errs, "; "))
+}
+
+// AssetClass classifies a symbol for provider routing, from the symbol master
+// when it knows the symbol
+func (s *MarketDataService) AssetClass(symbol string) string {
+	if s.symbols != nil {
+		if class, ok := s.symbols.Class(symbol); ok {
+			return class
+		}
 	}
-	
-	return prices, nil
+	return AssetClassOf(symbol)
+}
+
+// ticker returns the symbol as the named provider expects it: the symbol
+// master's ticker, else the provider's default mapping
+func (s *MarketDataService) ticker(provider, symbol string) string {
+	if s.symbols != nil {
+		if ticker, ok := s.symbols.Ticker(provider, symbol); ok {
+			return ticker
+		}
+	}
+	if mapper, ok := s.providers[provider].(TickerMapper); ok {
+		return mapper.Ticker(symbol)
+	}
+	return symbol
+}
+
+// providerNames returns the registered provider names in order
+func (s *MarketDataService) providerNames() []string {
+	names := make([]string, 0, len(s.providers))
+	for name := range s.providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Chain returns the provider names tried, in order, for an asset class
+func (s *MarketDataService) Chain(assetClass string) []string {
+	if chain, ok := s.chains[assetClass]; ok {
+		return chain
+	}
+	return s.chains[DefaultProviderChain]
+}
+
+// AssetClassOf classifies a symbol not in the symbol master
+func AssetClassOf(symbol string) string {
+	switch {
+	case isCrypto(symbol):
+		return AssetClassCrypto
+	case isFXPair(symbol):
+		return AssetClassFX
+	}
+	return AssetClassEquity
 }
 
 // Helper functions
@@ -215,24 +249,18 @@ func isCrypto(symbol string) bool {
 	return cryptos[symbol]
 }
 
-func getCoinGeckoID(symbol string) string {
-	mapping := map[string]string{
-		"BTC": "bitcoin",
-		"ETH": "ethereum",
-		"BNB": "binancecoin",
-		"XRP": "ripple",
-		"ADA": "cardano",
-		"SOL": "solana",
-		"DOGE": "dogecoin",
+// isFXPair matches six-letter currency pairs such as EURUSD
+func isFXPair(symbol string) bool {
+	if len(symbol) != 6 {
+		return false
 	}
-	if id, ok := mapping[symbol]; ok {
-		return id
+	currencies := map[string]bool{
+		"USD": true, "EUR": true, "GBP": true, "JPY": true,
+		"CHF": true, "CAD": true, "AUD": true, "NZD": true,
+		"SEK": true, "NOK": true, "DKK": true, "HKD": true,
+		"SGD": true, "CNY": true,
 	}
-	return toLowerCase(symbol)
-}
-
-func toLowerCase(s string) string {
-	return string(append([]byte(nil), []byte(s)...))
+	return currencies[symbol[:3]] && currencies[symbol[3:]]
 }
 
 func parseFloat(s interface{}) float64 {
@@ -246,9 +274,3 @@ func parseFloat(s interface{}) float64 {
 	}
 	return 0
 }
-
-func parseCSV(data string) [][]string {
-	lines := [][]string{}
-	// Simplified parsing - use encoding/csv for production
-	return lines
-}
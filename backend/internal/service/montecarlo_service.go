@@ -0,0 +1,99 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/reserveone/saa-risk-analyzer/internal/domain"
+	riskmath "github.com/reserveone/saa-risk-analyzer/internal/math"
+)
+
+const (
+	defaultSimulations    = 10000
+	defaultMonteCarloDays = 250
+)
+
+// calculatePortfolioMonteCarlo simulates portfolio VaR and ES with the Monte
+// Carlo engine on the configured worker pool, and returns the weights it was
+// calculated with. Requests for more than the configured maximum number of
+// simulations are rejected.
+func (s *RiskService) calculatePortfolioMonteCarlo(ctx context.Context, req domain.VaRRequest) (*domain.MonteCarloStats, LimitPortfolio, error) {
+	windowDays := req.WindowDays
+	if windowDays == 0 {
+		windowDays = defaultMonteCarloDays
+	}
+	simulations := req.Simulations
+	if simulations == 0 {
+		simulations = defaultSimulations
+	}
+	if s.perf.MaxSimulations > 0 && simulations > s.perf.MaxSimulations {
+		return nil, LimitPortfolio{}, fmt.Errorf("simulations must not exceed %d", s.perf.MaxSimulations)
+	}
+
+	data, err := s.loadAlignedPortfolio(ctx, req.PortfolioID, windowDays, req.Adjustment)
+	if err != nil {
+		return nil, LimitPortfolio{}, err
+	}
+
+	// Weights over priced assets only, as the historical methods do
+	exposures := data.Exposures()
+	pricedValue := 0.0
+	for _, e := range exposures {
+		pricedValue += e
+	}
+	weights := make([]float64, len(exposures))
+	for i := range exposures {
+		weights[i] = exposures[i] / pricedValue
+	}
+
+	result, err := riskmath.RunMonteCarlo(data.Returns, weights, req.Confidence, req.HorizonDays, riskmath.MonteCarloConfig{
+		Simulations:      simulations,
+		Workers:          s.perf.WorkerPoolSize,
+		Seed:             req.Seed,
+		Antithetic:       req.Antithetic,
+		Sampler:          req.Sampler,
+		Dependence:       req.Dependence,
+		Marginals:        req.Marginals,
+		DegreesOfFreedom: req.DegreesOfFreedom,
+	})
+	if err != nil {
+		return nil, LimitPortfolio{}, err
+	}
+
+	return &domain.MonteCarloStats{
+		VaR:         result.VaR * pricedValue,
+		ES:          result.ES * pricedValue,
+		VaRStdErr:   result.VaRStdErr * pricedValue,
+		ESStdErr:    result.ESStdErr * pricedValue,
+		Seed:        result.Seed,
+		Simulations: result.Simulations,
+		Workers:     result.Workers,
+		Sampler:     result.Sampler,
+		Antithetic:  result.Antithetic,
+		Dependence:  dependenceFitDTO(result.Dependence, data.Symbols),
+		Adjustment:  data.Adjustment,
+	}, data.limitPortfolio(), nil
+}
+
+func dependenceFitDTO(fit *riskmath.DependenceFit, symbols []string) *domain.DependenceFit {
+	if fit == nil {
+		return nil
+	}
+
+	dto := &domain.DependenceFit{
+		Model:            fit.Model,
+		Marginals:        fit.Marginals,
+		DegreesOfFreedom: fit.DegreesOfFreedom,
+		Symbols:          symbols,
+		Correlation:      fit.Correlation,
+	}
+	for i, m := range fit.MarginalFits {
+		dto.MarginalFits = append(dto.MarginalFits, domain.MarginalFit{
+			Symbol:           symbols[i],
+			Location:         m.Location,
+			Scale:            m.Scale,
+			DegreesOfFreedom: m.DegreesOfFreedom,
+		})
+	}
+	return dto
+}
@@ -0,0 +1,103 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"math"
+
+	"github.com/reserveone/saa-risk-analyzer/internal/domain"
+	riskmath "github.com/reserveone/saa-risk-analyzer/internal/math"
+)
+
+const (
+	defaultPaths          = 10000
+	defaultPathWindowDays = 750 // ~3 years of daily returns
+	tradingDaysPerMonth   = 21
+	// maxPathHorizonMonths bounds the months simulated, as every path keeps
+	// its value at each of them
+	maxPathHorizonMonths = 600
+)
+
+// SimulatePortfolioPaths projects the portfolio month by month with periodic
+// rebalancing to target weights and regular cash flows
+func (s *RiskService) SimulatePortfolioPaths(ctx context.Context, req domain.PathSimulationRequest) (*domain.PathSimulationResponse, error) {
+	paths := req.Paths
+	if paths == 0 {
+		paths = defaultPaths
+	}
+	if s.perf.MaxSimulations > 0 && paths > s.perf.MaxSimulations {
+		return nil, fmt.Errorf("paths must not exceed %d", s.perf.MaxSimulations)
+	}
+	if req.HorizonMonths > maxPathHorizonMonths {
+		return nil, fmt.Errorf("horizon_months must not exceed %d", maxPathHorizonMonths)
+	}
+	windowDays := req.WindowDays
+	if windowDays == 0 {
+		windowDays = defaultPathWindowDays
+	}
+
+	data, err := s.loadAlignedPortfolio(ctx, req.PortfolioID, windowDays, req.Adjustment)
+	if err != nil {
+		return nil, err
+	}
+
+	exposures := data.Exposures()
+	initialValue := 0.0
+	for _, e := range exposures {
+		initialValue += e
+	}
+
+	weights := make([]float64, len(data.Symbols))
+	if len(req.TargetWeights) == 0 {
+		for i := range exposures {
+			weights[i] = exposures[i] / initialValue
+		}
+	} else {
+		index := make(map[string]int, len(data.Symbols))
+		for i, symbol := range data.Symbols {
+			index[symbol] = i
+		}
+		total := 0.0
+		for symbol, w := range req.TargetWeights {
+			i, ok := index[symbol]
+			if !ok {
+				return nil, fmt.Errorf("target weight for %s: no price history in portfolio", symbol)
+			}
+			weights[i] = w
+			total += w
+		}
+		if math.Abs(total-1) > 1e-4 {
+			return nil, fmt.Errorf("target weights must sum to 1, got %f", total)
+		}
+	}
+
+	result, err := riskmath.SimulatePaths(data.Returns, weights, riskmath.PathConfig{
+		Paths:          paths,
+		Periods:        req.HorizonMonths,
+		PeriodDays:     tradingDaysPerMonth,
+		InitialValue:   initialValue,
+		Contribution:   req.Contribution,
+		RebalanceEvery: req.RebalanceMonths,
+		Goal:           req.Goal,
+		Seed:           req.Seed,
+		Workers:        s.perf.WorkerPoolSize,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &domain.PathSimulationResponse{
+		InitialValue:         initialValue,
+		Quantiles:            riskmath.PathQuantiles,
+		TerminalWealth:       result.TerminalQuantiles,
+		MeanTerminalWealth:   result.MeanTerminal,
+		ShortfallProbability: result.ShortfallProbability,
+		DepletionProbability: result.DepletionProbability,
+		MaxDrawdown:          result.MaxDrawdownQuantiles,
+		MeanMaxDrawdown:      result.MeanMaxDrawdown,
+		Fan:                  result.PeriodQuantiles,
+		Seed:                 result.Seed,
+		Paths:                result.Paths,
+		Adjustment:           data.Adjustment,
+	}, nil
+}
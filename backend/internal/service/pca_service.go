@@ -0,0 +1,62 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"gonum.org/v1/gonum/mat"
+
+	"github.com/reserveone/saa-risk-analyzer/internal/domain"
+	riskmath "github.com/reserveone/saa-risk-analyzer/internal/math"
+)
+
+// CalculatePCA runs a principal component analysis of the symbols' returns
+// over the dates they share
+func (s *RiskService) CalculatePCA(ctx context.Context, req domain.PCARequest) (*domain.PCAResponse, error) {
+	adjustment, err := riskmath.NormalizeAdjustment(req.Adjustment)
+	if err != nil {
+		return nil, err
+	}
+	if len(req.Symbols) < 2 {
+		return nil, fmt.Errorf("PCA needs at least 2 symbols")
+	}
+
+	symbols := make([]string, len(req.Symbols))
+	prices := make(map[string][]riskmath.PricePoint, len(req.Symbols))
+	for i, symbol := range req.Symbols {
+		symbols[i] = strings.ToUpper(symbol)
+		history, err := s.adjustedHistory(ctx, symbols[i], req.WindowDays+1, adjustment)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get prices for %s: %w", symbols[i], err)
+		}
+		prices[symbols[i]] = history
+	}
+
+	_, returns := riskmath.AlignReturns(prices, symbols, true)
+	if len(returns) == 0 || len(returns[0]) < 2 {
+		return nil, fmt.Errorf("insufficient overlapping price history")
+	}
+
+	result, err := riskmath.CalculatePCA(returns, req.Components)
+	if err != nil {
+		return nil, err
+	}
+
+	return &domain.PCAResponse{
+		ExplainedVariance:  result.ExplainedVariance,
+		CumulativeVariance: result.CumulativeVariance,
+		Components:         denseRows(result.Components),
+		Symbols:            symbols,
+		Adjustment:         adjustment,
+	}, nil
+}
+
+func denseRows(m *mat.Dense) [][]float64 {
+	r, _ := m.Dims()
+	rows := make([][]float64, r)
+	for i := range rows {
+		rows[i] = mat.Row(nil, i, m)
+	}
+	return rows
+}
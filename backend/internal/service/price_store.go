@@ -0,0 +1,325 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/reserveone/saa-risk-analyzer/internal/domain"
+)
+
+// PriceSourceImport marks closes loaded from files or uploads. Fetched closes
+// never overwrite them.
+const PriceSourceImport = "import"
+
+// priceRefreshInterval throttles provider calls for an asset, so repeated
+// loads within it are served from the prices table
+const priceRefreshInterval = time.Hour
+
+// PriceStore is a write-through cache of daily closes in the prices table.
+// Missing history is fetched from the market data providers and persisted,
+// so later loads only fetch the bars added since.
+type PriceStore struct {
+	db     *gorm.DB
+	market *MarketDataService
+}
+
+func NewPriceStore(db *gorm.DB, market *MarketDataService) *PriceStore {
+	return &PriceStore{
+		db:     db,
+		market: market,
+	}
+}
+
+// gapTolerance is how far the stored closes may start after or end before the
+// requested bounds without counting as missing, covering weekends and holidays
+const gapTolerance = 4 * 24 * time.Hour
+
+// HistoryQuery selects closes either as a window of the Days most recent
+// closes up to AsOf, or as every close between From and To
+type HistoryQuery struct {
+	Symbol string
+	AsOf   time.Time // end of the window, zero is now
+	Days   int
+	From   time.Time // explicit range, used when Days is 0
+	To     time.Time // zero is now
+}
+
+// Query returns the closes selected by q, oldest first, from the prices table.
+// Missing bars at either end are fetched from the providers and stored; the
+// coverage reports how much of the request was served and from where.
+// Symbols without an asset row are served from the providers without being
+// stored.
+func (s *PriceStore) Query(ctx context.Context, q HistoryQuery) ([]PricePoint, *domain.PriceCoverage, error) {
+	now := time.Now()
+	from, to := q.From, q.To
+	if q.Days > 0 {
+		from, to = time.Time{}, q.AsOf
+	}
+	if to.IsZero() || to.After(now) {
+		to = now
+	}
+	if q.Days <= 0 && from.IsZero() {
+		return nil, nil, fmt.Errorf("window or from date required")
+	}
+	if !from.IsZero() && from.After(to) {
+		return nil, nil, fmt.Errorf("from date is after to date")
+	}
+
+	coverage := &domain.PriceCoverage{
+		Symbol:    q.Symbol,
+		Requested: q.Days,
+		From:      from,
+		To:        to,
+	}
+
+	var asset domain.Asset
+	if err := s.db.Where("symbol = ?", q.Symbol).First(&asset).Error; err != nil {
+		fetched, source, err := s.market.FetchHistoricalPrices(ctx, q.Symbol, FetchDays(q, from, to, nil, now))
+		if err != nil {
+			return nil, nil, err
+		}
+		prices := SelectPrices(fetched, q.Days, from, to)
+		coverage.Fetched = len(prices)
+		coverage.Source = source
+		return prices, s.finishCoverage(coverage, prices), nil
+	}
+
+	stored, imported, err := s.load(asset.ID, q.Days, from, to)
+	if err != nil {
+		return nil, nil, err
+	}
+	coverage.Source = PriceSourceDatabase
+	if !MissingPrices(q, from, to, stored, now) || !s.refreshDue(asset.ID, now) {
+		coverage.Stored = len(stored)
+		return stored, s.finishCoverage(coverage, stored), nil
+	}
+
+	fetched, source, err := s.market.FetchHistoricalPrices(ctx, q.Symbol, FetchDays(q, from, to, stored, now))
+	if err != nil {
+		if len(stored) == 0 {
+			return nil, nil, err
+		}
+		// Serve what is stored, but log the error
+		fmt.Printf("Warning: failed to fetch missing prices for %s: %v\n", q.Symbol, err)
+		coverage.Stored = len(stored)
+		return stored, s.finishCoverage(coverage, stored), nil
+	}
+	if err := s.Save(asset.ID, fetched, source); err != nil {
+		fmt.Printf("Warning: failed to store prices for %s: %v\n", q.Symbol, err)
+	}
+
+	merged, fetchedDays := MergePrices(stored, fetched, imported)
+	prices := SelectPrices(merged, q.Days, from, to)
+	for _, p := range prices {
+		if fetchedDays[truncateToDay(p.Date)] {
+			coverage.Fetched++
+		} else {
+			coverage.Stored++
+		}
+	}
+	if coverage.Fetched > 0 {
+		coverage.Source = source
+	}
+	return prices, s.finishCoverage(coverage, prices), nil
+}
+
+// MissingPrices reports whether the stored closes fall short of the query at
+// now, either ending before its end date or, for windows, holding fewer
+// closes than requested, or for ranges, starting after its start date
+func MissingPrices(q HistoryQuery, from, to time.Time, stored []PricePoint, now time.Time) bool {
+	if len(stored) == 0 {
+		return true
+	}
+	if q.Days > 0 && len(stored) < q.Days {
+		return true
+	}
+	if q.Days <= 0 && stored[0].Date.Sub(truncateToDay(from)) > gapTolerance {
+		return true
+	}
+
+	last := stored[len(stored)-1].Date
+	// Queries ending today can be completed by today's close
+	today := truncateToDay(now)
+	if !to.Before(today) {
+		return last.Before(today)
+	}
+	return truncateToDay(to).Sub(last) > gapTolerance
+}
+
+// FetchDays sizes the provider request, which always ends at now, to reach
+// back to the earliest missing close
+func FetchDays(q HistoryQuery, from, to time.Time, stored []PricePoint, now time.Time) int {
+	daysSince := func(t time.Time) int {
+		return int(now.Sub(t).Hours()/24) + 2
+	}
+
+	if q.Days <= 0 {
+		return daysSince(from)
+	}
+	if len(stored) >= q.Days {
+		// Only the bars after the latest stored close are missing
+		return daysSince(stored[len(stored)-1].Date)
+	}
+	// Calendar days spanning the window, allowing for weekends and holidays
+	return daysSince(to) + q.Days*7/5 + 7
+}
+
+// finishCoverage records the returned span and whether it covers the query
+func (s *PriceStore) finishCoverage(coverage *domain.PriceCoverage, prices []PricePoint) *domain.PriceCoverage {
+	coverage.Returned = len(prices)
+	if len(prices) == 0 {
+		return coverage
+	}
+
+	coverage.FirstDate = prices[0].Date
+	coverage.LastDate = prices[len(prices)-1].Date
+	if coverage.Requested > 0 {
+		coverage.Complete = coverage.Returned >= coverage.Requested
+	} else {
+		coverage.Complete = coverage.FirstDate.Sub(truncateToDay(coverage.From)) <= gapTolerance &&
+			truncateToDay(coverage.To).Sub(coverage.LastDate) <= gapTolerance
+	}
+	return coverage
+}
+
+// Save upserts closes for an asset, one row per day. Existing fetched closes
+// are updated, e.g. today's still-moving close; imported closes are kept.
+func (s *PriceStore) Save(assetID uuid.UUID, prices []PricePoint, source string) error {
+	if len(prices) == 0 {
+		return nil
+	}
+
+	now := time.Now()
+	rows := make([]domain.Price, 0, len(prices))
+	seen := make(map[time.Time]int)
+	for _, p := range prices {
+		if p.Close <= 0 {
+			continue
+		}
+		date := truncateToDay(p.Date)
+		// Providers may return several points per day, the last one wins
+		if i, ok := seen[date]; ok {
+			rows[i].Close = p.Close
+			continue
+		}
+		seen[date] = len(rows)
+		rows = append(rows, domain.Price{
+			AssetID:   assetID,
+			Date:      date,
+			Close:     p.Close,
+			Source:    source,
+			FetchedAt: &now,
+		})
+	}
+	if len(rows) == 0 {
+		return nil
+	}
+
+	return s.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "asset_id"}, {Name: "date"}},
+		DoUpdates: clause.AssignmentColumns([]string{"close", "source", "fetched_at"}),
+		Where: clause.Where{Exprs: []clause.Expression{
+			clause.Neq{Column: clause.Column{Table: "prices", Name: "source"}, Value: PriceSourceImport},
+		}},
+	}).CreateInBatches(&rows, 500).Error
+}
+
+// load reads stored closes of an asset, oldest first: the most recent days
+// closes up to to, or every close between from and to when days is 0. The
+// days of imported closes are returned too.
+func (s *PriceStore) load(assetID uuid.UUID, days int, from, to time.Time) ([]PricePoint, map[time.Time]bool, error) {
+	query := s.db.Where("asset_id = ? AND date <= ?", assetID, to)
+	if days > 0 {
+		query = query.Order("date DESC").Limit(days)
+	} else {
+		query = query.Where("date >= ?", truncateToDay(from)).Order("date DESC")
+	}
+
+	var rows []domain.Price
+	if err := query.Find(&rows).Error; err != nil {
+		return nil, nil, err
+	}
+
+	prices := make([]PricePoint, len(rows))
+	imported := make(map[time.Time]bool)
+	for i, p := range rows {
+		prices[len(rows)-1-i] = PricePoint{Date: p.Date, Close: p.Close}
+		if p.Source == PriceSourceImport {
+			imported[truncateToDay(p.Date)] = true
+		}
+	}
+	return prices, imported, nil
+}
+
+// refreshDue throttles provider calls to one per priceRefreshInterval per asset
+func (s *PriceStore) refreshDue(assetID uuid.UUID, now time.Time) bool {
+	var lastFetch sql.NullTime
+	err := s.db.Model(&domain.Price{}).
+		Where("asset_id = ?", assetID).
+		Select("MAX(fetched_at)").
+		Scan(&lastFetch).Error
+	if err != nil || !lastFetch.Valid {
+		return true
+	}
+	return RefreshDue(lastFetch.Time, now)
+}
+
+// RefreshDue reports whether an asset last fetched at lastFetch (zero for
+// never) may be fetched again at now
+func RefreshDue(lastFetch, now time.Time) bool {
+	return lastFetch.IsZero() || now.Sub(lastFetch) > priceRefreshInterval
+}
+
+// SelectPrices keeps the days most recent closes up to to, or the closes
+// between from and to when days is 0
+func SelectPrices(prices []PricePoint, days int, from, to time.Time) []PricePoint {
+	selected := make([]PricePoint, 0, len(prices))
+	for _, p := range prices {
+		if p.Date.After(to) || (days <= 0 && p.Date.Before(truncateToDay(from))) {
+			continue
+		}
+		selected = append(selected, p)
+	}
+	if days > 0 && len(selected) > days {
+		selected = selected[len(selected)-days:]
+	}
+	return selected
+}
+
+// MergePrices combines stored and fetched closes by day, oldest first, as
+// Save stores them: fetched closes win, except on the imported days, whose
+// stored closes are kept. It also returns the days whose close was fetched.
+func MergePrices(stored, fetched []PricePoint, imported map[time.Time]bool) ([]PricePoint, map[time.Time]bool) {
+	byDay := make(map[time.Time]PricePoint, len(stored)+len(fetched))
+	for _, p := range stored {
+		byDay[truncateToDay(p.Date)] = p
+	}
+	fetchedDays := make(map[time.Time]bool, len(fetched))
+	for _, p := range fetched {
+		day := truncateToDay(p.Date)
+		if imported[day] || p.Close <= 0 {
+			continue
+		}
+		byDay[day] = PricePoint{Date: day, Close: p.Close}
+		fetchedDays[day] = true
+	}
+
+	merged := make([]PricePoint, 0, len(byDay))
+	for _, p := range byDay {
+		merged = append(merged, p)
+	}
+	sort.Slice(merged, func(i, j int) bool { return merged[i].Date.Before(merged[j].Date) })
+	return merged, fetchedDays
+}
+
+func truncateToDay(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
@@ -0,0 +1,378 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Asset classes used to route symbols to providers, matching domain.Asset.Class
+const (
+	AssetClassEquity      = "Equity"
+	AssetClassBond        = "Bond"
+	AssetClassFX          = "FX"
+	AssetClassCommodities = "Commodities"
+	AssetClassCrypto      = "Crypto"
+)
+
+// Built-in provider names, used in provider chains
+const (
+	ProviderBinance   = "binance"
+	ProviderCoinGecko = "coingecko"
+	ProviderCoinCap   = "coincap"
+	ProviderYahoo     = "yahoo"
+	ProviderFile      = "file"
+)
+
+// RateLimit is the request budget a provider allows
+type RateLimit struct {
+	Requests int
+	Per      time.Duration
+}
+
+// ProviderCapabilities describes what a provider can serve
+type ProviderCapabilities struct {
+	AssetClasses   []string  // asset classes served, empty serves every class
+	MaxHistoryDays int       // longest history per request, 0 is unlimited
+	RateLimit      RateLimit // zero value is unlimited
+}
+
+// Supports reports whether the provider serves assetClass
+func (c ProviderCapabilities) Supports(assetClass string) bool {
+	if len(c.AssetClasses) == 0 {
+		return true
+	}
+	for _, class := range c.AssetClasses {
+		if strings.EqualFold(class, assetClass) {
+			return true
+		}
+	}
+	return false
+}
+
+// PriceProvider is a source of daily closing prices. Symbols are passed as
+// the provider's own ticker, see TickerMapper.
+type PriceProvider interface {
+	Name() string
+	Capabilities() ProviderCapabilities
+	// HistoricalPrices returns up to days daily closes ending at the latest
+	// available date, oldest first
+	HistoricalPrices(ctx context.Context, ticker string, days int) ([]PricePoint, error)
+}
+
+// TickerMapper is implemented by providers whose tickers differ from our
+// symbols. It is used for symbols without a ticker in the symbol master.
+type TickerMapper interface {
+	Ticker(symbol string) string
+}
+
+// Corporate action types
+const (
+	ActionSplit    = "split"
+	ActionDividend = "dividend"
+)
+
+// CorporateAction is a split (Value is the ratio) or cash dividend (Value is
+// the amount per share) reported by a provider
+type CorporateAction struct {
+	Type   string
+	ExDate time.Time
+	Value  float64
+}
+
+// CorporateActionProvider is implemented by providers that also report
+// splits and dividends
+type CorporateActionProvider interface {
+	CorporateActions(ctx context.Context, ticker string, days int) ([]CorporateAction, error)
+}
+
+// StatusError is a non-200 response from a provider API
+type StatusError struct {
+	Provider   string
+	StatusCode int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("%s API error: %d", e.Provider, e.StatusCode)
+}
+
+// httpGet issues a GET bound to ctx, returning a StatusError for any
+// response other than 200
+func httpGet(ctx context.Context, client *http.Client, provider, url string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, &StatusError{Provider: provider, StatusCode: resp.StatusCode}
+	}
+	return resp, nil
+}
+
+// Binance API
+type binanceProvider struct {
+	client *http.Client
+}
+
+func (p *binanceProvider) Name() string { return ProviderBinance }
+
+func (p *binanceProvider) Capabilities() ProviderCapabilities {
+	return ProviderCapabilities{
+		AssetClasses:   []string{AssetClassCrypto},
+		MaxHistoryDays: 1000,
+		RateLimit:      RateLimit{Requests: 1200, Per: time.Minute},
+	}
+}
+
+// Ticker quotes crypto against USDT (BTC -> BTCUSDT)
+func (p *binanceProvider) Ticker(symbol string) string { return symbol + "USDT" }
+
+func (p *binanceProvider) HistoricalPrices(ctx context.Context, ticker string, days int) ([]PricePoint, error) {
+	url := fmt.Sprintf("https://api.binance.com/api/v3/klines?symbol=%s&interval=1d&limit=%d", ticker, days)
+
+	resp, err := httpGet(ctx, p.client, ProviderBinance, url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var data [][]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
+		return nil, err
+	}
+
+	prices := make([]PricePoint, 0, len(data))
+	for _, candle := range data {
+		timestamp := int64(candle[0].(float64))
+		closePrice := parseFloat(candle[4])
+
+		prices = append(prices, PricePoint{
+			Date:  time.Unix(timestamp/1000, 0),
+			Close: closePrice,
+		})
+	}
+
+	return prices, nil
+}
+
+// CoinGecko API (free)
+type coinGeckoProvider struct {
+	client *http.Client
+}
+
+func (p *coinGeckoProvider) Name() string { return ProviderCoinGecko }
+
+func (p *coinGeckoProvider) Capabilities() ProviderCapabilities {
+	return ProviderCapabilities{
+		AssetClasses:   []string{AssetClassCrypto},
+		MaxHistoryDays: 365,
+		RateLimit:      RateLimit{Requests: 30, Per: time.Minute},
+	}
+}
+
+// Ticker guesses the coin ID; seeded coins carry theirs in the symbol master
+func (p *coinGeckoProvider) Ticker(symbol string) string { return strings.ToLower(symbol) }
+
+func (p *coinGeckoProvider) HistoricalPrices(ctx context.Context, ticker string, days int) ([]PricePoint, error) {
+	url := fmt.Sprintf("https://api.coingecko.com/api/v3/coins/%s/market_chart?vs_currency=usd&days=%d", ticker, days)
+
+	resp, err := httpGet(ctx, p.client, ProviderCoinGecko, url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var data struct {
+		Prices [][]float64 `json:"prices"`
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
+		return nil, err
+	}
+
+	prices := make([]PricePoint, 0, len(data.Prices))
+	for _, p := range data.Prices {
+		prices = append(prices, PricePoint{
+			Date:  time.Unix(int64(p[0]/1000), 0),
+			Close: p[1],
+		})
+	}
+
+	return prices, nil
+}
+
+// CoinCap API (200 requests/day)
+type coinCapProvider struct {
+	client *http.Client
+}
+
+func (p *coinCapProvider) Name() string { return ProviderCoinCap }
+
+func (p *coinCapProvider) Capabilities() ProviderCapabilities {
+	return ProviderCapabilities{
+		AssetClasses: []string{AssetClassCrypto},
+		RateLimit:    RateLimit{Requests: 200, Per: 24 * time.Hour},
+	}
+}
+
+// Ticker guesses the asset ID; seeded coins carry theirs in the symbol master
+func (p *coinCapProvider) Ticker(symbol string) string { return strings.ToLower(symbol) }
+
+func (p *coinCapProvider) HistoricalPrices(ctx context.Context, ticker string, days int) ([]PricePoint, error) {
+	url := fmt.Sprintf("https://api.coincap.io/v2/assets/%s/history?interval=d1", ticker)
+
+	resp, err := httpGet(ctx, p.client, ProviderCoinCap, url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+
+	var data struct {
+		Data []struct {
+			PriceUsd string `json:"priceUsd"`
+			Time     int64  `json:"time"`
+		} `json:"data"`
+	}
+
+	if err := json.Unmarshal(body, &data); err != nil {
+		return nil, err
+	}
+
+	prices := make([]PricePoint, 0)
+	for _, p := range data.Data {
+		prices = append(prices, PricePoint{
+			Date:  time.Unix(p.Time/1000, 0),
+			Close: parseFloat(p.PriceUsd),
+		})
+	}
+
+	// CoinCap always returns its full daily history
+	if days > 0 && len(prices) > days {
+		prices = prices[len(prices)-days:]
+	}
+
+	return prices, nil
+}
+
+// Yahoo Finance (free) - chart API
+type yahooProvider struct {
+	client *http.Client
+}
+
+func (p *yahooProvider) Name() string { return ProviderYahoo }
+
+func (p *yahooProvider) Capabilities() ProviderCapabilities {
+	return ProviderCapabilities{
+		AssetClasses: []string{AssetClassEquity, AssetClassBond, AssetClassCommodities, AssetClassFX},
+		RateLimit:    RateLimit{Requests: 60, Per: time.Minute},
+	}
+}
+
+// Ticker adds Yahoo's =X suffix to FX pairs
+func (p *yahooProvider) Ticker(symbol string) string {
+	if isFXPair(symbol) {
+		return symbol + "=X"
+	}
+	return symbol
+}
+
+func (p *yahooProvider) HistoricalPrices(ctx context.Context, ticker string, days int) ([]PricePoint, error) {
+	url := fmt.Sprintf("https://query1.finance.yahoo.com/v8/finance/chart/%s?interval=1d&range=%dd", ticker, days)
+
+	resp, err := httpGet(ctx, p.client, ProviderYahoo, url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var data struct {
+		Chart struct {
+			Result []struct {
+				Timestamp  []int64 `json:"timestamp"`
+				Indicators struct {
+					Quote []struct {
+						Close []*float64 `json:"close"`
+					} `json:"quote"`
+				} `json:"indicators"`
+			} `json:"result"`
+		} `json:"chart"`
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
+		return nil, err
+	}
+	if len(data.Chart.Result) == 0 || len(data.Chart.Result[0].Indicators.Quote) == 0 {
+		return nil, fmt.Errorf("yahoo API returned no data for %s", ticker)
+	}
+
+	result := data.Chart.Result[0]
+	closes := result.Indicators.Quote[0].Close
+	prices := make([]PricePoint, 0, len(result.Timestamp))
+	for i, timestamp := range result.Timestamp {
+		// Holidays and halted sessions come back as nulls
+		if i >= len(closes) || closes[i] == nil {
+			continue
+		}
+		prices = append(prices, PricePoint{
+			Date:  time.Unix(timestamp, 0),
+			Close: *closes[i],
+		})
+	}
+
+	return prices, nil
+}
+
+// CorporateActions returns dividends over the last days. Yahoo chart closes
+// are already split-adjusted, so its splits are not reported; doing so would
+// adjust them twice.
+func (p *yahooProvider) CorporateActions(ctx context.Context, ticker string, days int) ([]CorporateAction, error) {
+	url := fmt.Sprintf("https://query1.finance.yahoo.com/v8/finance/chart/%s?interval=1d&range=%dd&events=div", ticker, days)
+
+	resp, err := httpGet(ctx, p.client, ProviderYahoo, url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var data struct {
+		Chart struct {
+			Result []struct {
+				Events struct {
+					Dividends map[string]struct {
+						Amount float64 `json:"amount"`
+						Date   int64   `json:"date"`
+					} `json:"dividends"`
+				} `json:"events"`
+			} `json:"result"`
+		} `json:"chart"`
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
+		return nil, err
+	}
+	if len(data.Chart.Result) == 0 {
+		return nil, fmt.Errorf("yahoo API returned no data for %s", ticker)
+	}
+
+	actions := make([]CorporateAction, 0, len(data.Chart.Result[0].Events.Dividends))
+	for _, dividend := range data.Chart.Result[0].Events.Dividends {
+		actions = append(actions, CorporateAction{
+			Type:   ActionDividend,
+			ExDate: time.Unix(dividend.Date, 0),
+			Value:  dividend.Amount,
+		})
+	}
+
+	return actions, nil
+}
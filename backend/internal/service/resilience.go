@@ -0,0 +1,341 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/reserveone/saa-risk-analyzer/internal/domain"
+)
+
+// Circuit breaker states
+const (
+	CircuitClosed   = "closed"
+	CircuitOpen     = "open"
+	CircuitHalfOpen = "half_open"
+)
+
+// maxRetryDelay caps the exponential backoff between attempts
+const maxRetryDelay = 10 * time.Second
+
+// maxRateLimitWait is the longest a call waits for a rate limit token;
+// providers with a longer wait are skipped as rate limited
+const maxRateLimitWait = time.Second
+
+// ResiliencePolicy controls how provider calls are retried and when a
+// failing provider is skipped
+type ResiliencePolicy struct {
+	Retries         int           // attempts after the first
+	RetryBaseDelay  time.Duration // backoff before the first retry, doubled per retry
+	RequestTimeout  time.Duration // per-attempt timeout, 0 is none
+	BreakerFailures int           // consecutive failures that open the circuit, 0 never opens it
+	BreakerCooldown time.Duration // how long an open circuit skips the provider
+}
+
+// errCircuitOpen is returned for calls to a provider whose circuit is open
+var errCircuitOpen = errors.New("circuit open")
+
+// errRateLimited is returned for calls to a provider whose rate limit has no
+// token within maxRateLimitWait
+var errRateLimited = errors.New("rate limited")
+
+// retryable reports whether a failed provider call may succeed if repeated:
+// network errors, timeouts, rate limiting and server errors
+func retryable(err error) bool {
+	if errors.Is(err, errRateLimited) {
+		return true
+	}
+	var status *StatusError
+	if errors.As(err, &status) {
+		return status.StatusCode == http.StatusTooManyRequests || status.StatusCode >= 500
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// backoff returns the delay before retry attempt (1 for the first retry):
+// exponential in the attempt with full jitter
+func backoff(base time.Duration, attempt int) time.Duration {
+	if base <= 0 {
+		return 0
+	}
+	ceiling := base << (attempt - 1)
+	if ceiling > maxRetryDelay || ceiling <= 0 {
+		ceiling = maxRetryDelay
+	}
+	return time.Duration(rand.Int63n(int64(ceiling) + 1))
+}
+
+// sleep waits for d or until ctx is done
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// tokenBucket enforces a RateLimit, allowing bursts of up to Requests
+type tokenBucket struct {
+	mu       sync.Mutex
+	capacity float64
+	tokens   float64
+	rate     float64 // tokens per second
+	last     time.Time
+}
+
+func newTokenBucket(limit RateLimit) *tokenBucket {
+	if limit.Requests <= 0 || limit.Per <= 0 {
+		return nil
+	}
+	return &tokenBucket{
+		capacity: float64(limit.Requests),
+		tokens:   float64(limit.Requests),
+		rate:     float64(limit.Requests) / limit.Per.Seconds(),
+		last:     time.Now(),
+	}
+}
+
+// Wait takes a token, blocking until one is available or ctx is done. When
+// the next token is more than max away it returns errRateLimited at once. A
+// nil bucket is unlimited.
+func (b *tokenBucket) Wait(ctx context.Context, max time.Duration) error {
+	if b == nil {
+		return ctx.Err()
+	}
+	for {
+		b.mu.Lock()
+		b.refill(time.Now())
+		if b.tokens >= 1 {
+			b.tokens--
+			b.mu.Unlock()
+			return nil
+		}
+		wait := time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+		b.mu.Unlock()
+		if wait > max {
+			return errRateLimited
+		}
+
+		if err := sleep(ctx, wait); err != nil {
+			return err
+		}
+	}
+}
+
+// Available returns the tokens currently in the bucket
+func (b *tokenBucket) Available() float64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refill(time.Now())
+	return b.tokens
+}
+
+func (b *tokenBucket) refill(now time.Time) {
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.capacity {
+		b.tokens = b.capacity
+	}
+	b.last = now
+}
+
+// providerState tracks the rate limit, circuit and call statistics of a
+// provider
+type providerState struct {
+	limiter *tokenBucket
+
+	mu          sync.Mutex
+	state       string
+	failures    int // consecutive
+	openedUntil time.Time
+	trial       bool // a half-open trial call is in flight
+	requests    int64
+	errors      int64
+	lastError   string
+	lastFailure time.Time
+	lastSuccess time.Time
+}
+
+// allow reports whether a call may go ahead. After the cool-down an open
+// circuit lets a single trial call through.
+func (p *providerState) allow(now time.Time) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	switch p.state {
+	case CircuitOpen:
+		if now.Before(p.openedUntil) {
+			return false
+		}
+		p.state = CircuitHalfOpen
+		p.trial = true
+		return true
+	case CircuitHalfOpen:
+		if p.trial {
+			return false
+		}
+		p.trial = true
+	}
+	return true
+}
+
+func (p *providerState) success(now time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.requests++
+	p.state = CircuitClosed
+	p.failures = 0
+	p.trial = false
+	p.lastSuccess = now
+}
+
+func (p *providerState) failure(err error, policy ResiliencePolicy, now time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.requests++
+	p.errors++
+	p.failures++
+	p.trial = false
+	p.lastError = err.Error()
+	p.lastFailure = now
+	if p.state == CircuitHalfOpen || (policy.BreakerFailures > 0 && p.failures >= policy.BreakerFailures) {
+		p.state = CircuitOpen
+		p.openedUntil = now.Add(policy.BreakerCooldown)
+	}
+}
+
+// release ends a call that neither succeeded nor failed, e.g. cancelled
+func (p *providerState) release() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.trial = false
+}
+
+// answered ends a call the provider answered with an error a retry cannot
+// fix. The request is counted, but the circuit and failure streak are left
+// as they are: a half-open circuit waits for another trial.
+func (p *providerState) answered() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.requests++
+	p.trial = false
+}
+
+// call runs fn against a provider behind its circuit breaker and rate limit,
+// retrying retryable errors with exponential backoff. Errors that a retry
+// cannot fix, such as an unknown symbol, are returned without counting
+// against the provider's health. A provider out of rate limit tokens is not
+// waited for: errRateLimited is returned so the chain moves on.
+func (s *MarketDataService) call(ctx context.Context, name string, fn func(ctx context.Context) error) error {
+	state := s.state[name]
+	if state == nil {
+		return fn(ctx)
+	}
+	if !state.allow(time.Now()) {
+		return errCircuitOpen
+	}
+
+	var err error
+	for attempt := 0; attempt <= s.policy.Retries; attempt++ {
+		if attempt > 0 {
+			if err := sleep(ctx, backoff(s.policy.RetryBaseDelay, attempt)); err != nil {
+				state.release()
+				return err
+			}
+		}
+		if err := state.limiter.Wait(ctx, maxRateLimitWait); err != nil {
+			state.release()
+			return err
+		}
+
+		err = s.attempt(ctx, fn)
+		if err == nil || ctx.Err() != nil {
+			break
+		}
+		if !retryable(err) {
+			state.answered()
+			return err
+		}
+	}
+
+	switch {
+	case err == nil:
+		state.success(time.Now())
+	case ctx.Err() != nil:
+		state.release()
+		return ctx.Err()
+	default:
+		state.failure(err, s.policy, time.Now())
+	}
+	return err
+}
+
+func (s *MarketDataService) attempt(ctx context.Context, fn func(ctx context.Context) error) error {
+	if s.policy.RequestTimeout <= 0 {
+		return fn(ctx)
+	}
+	ctx, cancel := context.WithTimeout(ctx, s.policy.RequestTimeout)
+	defer cancel()
+	return fn(ctx)
+}
+
+// Health reports the rate limit, circuit state and call statistics of every
+// registered provider
+func (s *MarketDataService) Health() []domain.ProviderHealth {
+	now := time.Now()
+	health := make([]domain.ProviderHealth, 0, len(s.providers))
+	for _, name := range s.providerNames() {
+		capabilities := s.providers[name].Capabilities()
+		state := s.state[name]
+
+		h := domain.ProviderHealth{
+			Name:         name,
+			AssetClasses: capabilities.AssetClasses,
+		}
+		if state.limiter != nil {
+			h.RateLimit = &domain.ProviderRateLimit{
+				Requests:   capabilities.RateLimit.Requests,
+				PerSeconds: capabilities.RateLimit.Per.Seconds(),
+				Available:  state.limiter.Available(),
+			}
+		}
+
+		state.mu.Lock()
+		h.State = state.state
+		if h.State == CircuitOpen && !now.Before(state.openedUntil) {
+			h.State = CircuitHalfOpen
+		}
+		h.ConsecutiveFailures = state.failures
+		h.Requests = state.requests
+		h.Errors = state.errors
+		h.LastError = state.lastError
+		h.LastFailure = timePtr(state.lastFailure)
+		h.LastSuccess = timePtr(state.lastSuccess)
+		if state.state == CircuitOpen {
+			h.OpenUntil = timePtr(state.openedUntil)
+		}
+		state.mu.Unlock()
+
+		health = append(health, h)
+	}
+	return health
+}
+
+func timePtr(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
@@ -0,0 +1,182 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/reserveone/saa-risk-analyzer/internal/domain"
+	riskmath "github.com/reserveone/saa-risk-analyzer/internal/math"
+)
+
+// dataVersion fingerprints what a portfolio calculation reads from the
+// database: the positions, and the prices and corporate actions of their
+// assets and of the FX pairs converting them. Any change to those changes
+// the version, and with it the cache key, in every API instance.
+type dataVersion struct {
+	BaseCurrency string
+	Positions    []positionVersion
+	Prices       priceVersion
+	Actions      actionVersion
+	AsOf         string // today, as history windows end now
+}
+
+type positionVersion struct {
+	AssetID   uuid.UUID
+	Quantity  float64
+	AvgPrice  float64
+	UpdatedAt time.Time
+}
+
+type priceVersion struct {
+	Count    int64
+	LastDate *time.Time
+	Total    string // sum of the closes, exact, so overwritten closes count
+}
+
+type actionVersion struct {
+	Count       int64
+	LastUpdated *time.Time
+}
+
+func (s *RiskService) dataVersion(portfolioID uuid.UUID) (*dataVersion, error) {
+	var portfolio domain.Portfolio
+	if err := s.db.Select("id", "base_currency").First(&portfolio, "id = ?", portfolioID).Error; err != nil {
+		return nil, fmt.Errorf("portfolio not found: %w", err)
+	}
+
+	version := &dataVersion{
+		BaseCurrency: portfolio.BaseCurrency,
+		AsOf:         time.Now().UTC().Format("2006-01-02"),
+	}
+	err := s.db.Model(&domain.Position{}).
+		Select("asset_id, quantity, avg_price, updated_at").
+		Where("portfolio_id = ?", portfolioID).
+		Order("id").
+		Scan(&version.Positions).Error
+	if err != nil {
+		return nil, err
+	}
+
+	held := s.db.Model(&domain.Position{}).Select("asset_id").Where("portfolio_id = ?", portfolioID)
+	fx := s.db.Model(&domain.Asset{}).Select("id").Where("class = ?", AssetClassFX)
+	err = s.db.Model(&domain.Price{}).
+		Select("COUNT(*) AS count, MAX(date) AS last_date, COALESCE(SUM(close::numeric), 0)::text AS total").
+		Where("asset_id IN (?) OR asset_id IN (?)", held, fx).
+		Scan(&version.Prices).Error
+	if err != nil {
+		return nil, err
+	}
+	err = s.db.Model(&domain.CorporateAction{}).
+		Select("COUNT(*) AS count, MAX(updated_at) AS last_updated").
+		Where("asset_id IN (?)", held).
+		Scan(&version.Actions).Error
+	if err != nil {
+		return nil, err
+	}
+	return version, nil
+}
+
+// cached runs a portfolio calculation through the cache, keyed by kind, its
+// parameters and the version of the portfolio's data. Sync endpoints and
+// jobs share the results, and identical concurrent calculations run once.
+func (s *RiskService) cached(ctx context.Context, kind string, portfolioID uuid.UUID, params interface{}, compute func(ctx context.Context) (interface{}, error)) (interface{}, error) {
+	version, err := s.dataVersion(portfolioID)
+	if err != nil {
+		return nil, err
+	}
+	key, err := CacheKey(kind, portfolioID, params, version)
+	if err != nil {
+		return nil, err
+	}
+	return s.cache.Do(ctx, key, compute)
+}
+
+// observedResult is a cached risk result with the weights it was calculated
+// with, which the portfolio's limits are measured against on every request
+type observedResult struct {
+	value   interface{}
+	weights LimitPortfolio
+}
+
+// CacheStats returns the lookups of the risk result cache
+func (s *RiskService) CacheStats() CacheStats {
+	return s.cache.Stats()
+}
+
+// CalculatePortfolioVaR calculates historical VaR, reusing the result of an
+// identical calculation on unchanged data, and checks the portfolio's limits
+func (s *RiskService) CalculatePortfolioVaR(ctx context.Context, portfolioID uuid.UUID, confidence float64, horizonDays, windowDays int, adjustment string) (*domain.VaRResponse, error) {
+	adjustment, err := riskmath.NormalizeAdjustment(adjustment)
+	if err != nil {
+		return nil, err
+	}
+	params := []interface{}{confidence, horizonDays, windowDays, adjustment}
+	result, err := s.cached(ctx, "var", portfolioID, params, func(ctx context.Context) (interface{}, error) {
+		response, weights, err := s.calculatePortfolioVaR(ctx, portfolioID, confidence, horizonDays, windowDays, adjustment)
+		return observedResult{response, weights}, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	observed := result.(observedResult)
+	response := *observed.value.(*domain.VaRResponse)
+	s.observe(ctx, portfolioID, RiskObservation{Confidence: confidence, HorizonDays: horizonDays, VaR: &response.VaR}, observed.weights)
+	return &response, nil
+}
+
+// CalculatePortfolioCVaR calculates historical CVaR, reusing the result of an
+// identical calculation on unchanged data, and checks the portfolio's limits
+func (s *RiskService) CalculatePortfolioCVaR(ctx context.Context, portfolioID uuid.UUID, confidence float64, horizonDays, windowDays int, adjustment string) (*domain.CVaRResponse, error) {
+	adjustment, err := riskmath.NormalizeAdjustment(adjustment)
+	if err != nil {
+		return nil, err
+	}
+	params := []interface{}{confidence, horizonDays, windowDays, adjustment}
+	result, err := s.cached(ctx, "cvar", portfolioID, params, func(ctx context.Context) (interface{}, error) {
+		response, weights, err := s.calculatePortfolioCVaR(ctx, portfolioID, confidence, horizonDays, windowDays, adjustment)
+		return observedResult{response, weights}, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	observed := result.(observedResult)
+	response := *observed.value.(*domain.CVaRResponse)
+	s.observe(ctx, portfolioID, RiskObservation{Confidence: confidence, HorizonDays: horizonDays, CVaR: &response.CVaR}, observed.weights)
+	return &response, nil
+}
+
+// CalculatePortfolioVolatility calculates annualized portfolio volatility,
+// reusing the result of an identical calculation on unchanged data
+func (s *RiskService) CalculatePortfolioVolatility(ctx context.Context, portfolioID uuid.UUID, windowDays int, adjustment string) (float64, error) {
+	adjustment, err := riskmath.NormalizeAdjustment(adjustment)
+	if err != nil {
+		return 0, err
+	}
+	params := []interface{}{windowDays, adjustment}
+	result, err := s.cached(ctx, "volatility", portfolioID, params, func(ctx context.Context) (interface{}, error) {
+		return s.calculatePortfolioVolatility(ctx, portfolioID, windowDays, adjustment)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return result.(float64), nil
+}
+
+// CalculatePortfolioMonteCarlo simulates portfolio VaR and ES, reusing the
+// result of an identical simulation on unchanged data
+func (s *RiskService) CalculatePortfolioMonteCarlo(ctx context.Context, req domain.VaRRequest) (*domain.MonteCarloStats, error) {
+	result, err := s.cached(ctx, "monte_carlo", req.PortfolioID, req, func(ctx context.Context) (interface{}, error) {
+		stats, weights, err := s.calculatePortfolioMonteCarlo(ctx, req)
+		return observedResult{stats, weights}, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	observed := result.(observedResult)
+	stats := *observed.value.(*domain.MonteCarloStats)
+	s.observe(ctx, req.PortfolioID, RiskObservation{Confidence: req.Confidence, HorizonDays: req.HorizonDays, VaR: &stats.VaR, CVaR: &stats.ES}, observed.weights)
+	return &stats, nil
+}
@@ -1,26 +1,57 @@
 package service
 
 import (
+	"context"
 	"fmt"
 	"math"
+	"time"
 	
 	"github.com/google/uuid"
 	"gorm.io/gorm"
 	
+	"github.com/reserveone/saa-risk-analyzer/internal/config"
 	"github.com/reserveone/saa-risk-analyzer/internal/domain"
+	"github.com/reserveone/saa-risk-analyzer/internal/jobs"
 	riskmath "github.com/reserveone/saa-risk-analyzer/internal/math"
 )
 
 type RiskService struct {
-	db     *gorm.DB
-	market *MarketDataService
+	db        *gorm.DB
+	market    *MarketDataService
+	prices    *PriceStore
+	actions   *CorporateActionService
+	valuation *ValuationService
+	perf      config.PerfConfig
+	cache     *ComputeCache
+	limits    *LimitService
 }
 
-func NewRiskService(db *gorm.DB) *RiskService {
+func NewRiskService(db *gorm.DB, perf config.PerfConfig, quotes *LatestPriceService) *RiskService {
+	return NewRiskServiceWithLimits(db, perf, quotes, nil)
+}
+
+// NewRiskServiceWithLimits returns a risk service checking its VaR, CVaR and
+// stress results against the portfolios' risk limits
+func NewRiskServiceWithLimits(db *gorm.DB, perf config.PerfConfig, quotes *LatestPriceService, limits *LimitService) *RiskService {
 	return &RiskService{
-		db:     db,
-		market: NewMarketDataService(),
+		db:        db,
+		market:    quotes.market,
+		prices:    NewPriceStore(db, quotes.market),
+		actions:   NewCorporateActionService(db, quotes.market),
+		valuation: NewValuationService(db, quotes),
+		perf:      perf,
+		cache:     NewComputeCache(perf.CacheTTL, perf.CacheSize),
+		limits:    limits,
+	}
+}
+
+// loadPortfolio loads a portfolio with its positions and their assets
+func (s *RiskService) loadPortfolio(portfolioID uuid.UUID) (*domain.Portfolio, error) {
+	var portfolio domain.Portfolio
+	if err := s.db.Preload("Positions.Asset").First(&portfolio, "id = ?", portfolioID).Error; err != nil {
+		return nil, fmt.Errorf("portfolio not found: %w", err)
 	}
+	return &portfolio, nil
 }
 
 // GetDB returns the database connection
@@ -28,41 +59,69 @@ func (s *RiskService) GetDB() *gorm.DB {
 	return s.db
 }
 
-// getHistoricalPricesWithFallback tries DB first, then API
-func (s *RiskService) getHistoricalPricesWithFallback(symbol string, days int) ([]PricePoint, error) {
-	// 1. Try database first
-	var dbPrices []domain.Price
-	err := s.db.
-		Joins("JOIN assets ON assets.id = prices.asset_id").
-		Where("assets.symbol = ?", symbol).
-		Order("prices.date ASC").
-		Limit(days).
-		Find(&dbPrices).Error
-	
-	if err == nil && len(dbPrices) > 0 {
-		// Convert to PricePoint
-		prices := make([]PricePoint, len(dbPrices))
-		for i, p := range dbPrices {
-			prices[i] = PricePoint{
-				Date:  p.Date,
-				Close: p.Close,
-			}
-		}
-		return prices, nil
+// ValuePortfolio marks a portfolio to market as of asOf
+func (s *RiskService) ValuePortfolio(ctx context.Context, portfolio *domain.Portfolio, asOf time.Time) (*domain.PortfolioValuation, error) {
+	return s.valuation.ValuePortfolio(ctx, portfolio, asOf)
+}
+
+// getHistoricalPricesWithFallback returns the most recent days closes, read
+// from the DB and fetched from the APIs only for the missing range
+func (s *RiskService) getHistoricalPricesWithFallback(ctx context.Context, symbol string, days int) ([]PricePoint, error) {
+	prices, coverage, err := s.prices.Query(ctx, HistoryQuery{Symbol: symbol, Days: days})
+	if err != nil {
+		return nil, err
 	}
-	
-	// 2. Fallback to API
-	return s.market.GetHistoricalPrices(symbol, days)
+	if !coverage.Complete {
+		fmt.Printf("Warning: only %d of %d prices available for %s\n", coverage.Returned, days, symbol)
+	}
+	return prices, nil
 }
 
-func (s *RiskService) CalculatePortfolioVaR(portfolioID uuid.UUID, confidence float64, horizonDays, windowDays int) (*domain.VaRResponse, error) {
-	var portfolio domain.Portfolio
-	if err := s.db.Preload("Positions.Asset").First(&portfolio, "id = ?", portfolioID).Error; err != nil {
-		return nil, fmt.Errorf("portfolio not found: %w", err)
+// adjustedHistory returns the most recent days closes of symbol adjusted for
+// corporate actions on the given basis
+func (s *RiskService) adjustedHistory(ctx context.Context, symbol string, days int, adjustment string) ([]riskmath.PricePoint, error) {
+	prices, err := s.getHistoricalPricesWithFallback(ctx, symbol, days)
+	if err != nil {
+		return nil, err
+	}
+	return s.actions.Adjust(symbol, convertPrices(prices), adjustment)
+}
+
+// baseHistory returns the adjusted closes of asset converted into the base
+// currency, so their returns include the FX return
+func (s *RiskService) baseHistory(ctx context.Context, asset domain.Asset, base string, days int, adjustment string) ([]riskmath.PricePoint, error) {
+	prices, err := s.adjustedHistory(ctx, asset.Symbol, days, adjustment)
+	if err != nil {
+		return nil, err
+	}
+	return s.valuation.FX().Convert(ctx, prices, priceCurrency(asset), base)
+}
+
+func (s *RiskService) calculatePortfolioVaR(ctx context.Context, portfolioID uuid.UUID, confidence float64, horizonDays, windowDays int, adjustment string) (*domain.VaRResponse, LimitPortfolio, error) {
+	portfolio, err := s.loadPortfolio(portfolioID)
+	if err != nil {
+		return nil, LimitPortfolio{}, err
+	}
+	return s.portfolioVaR(ctx, portfolio, confidence, horizonDays, windowDays, adjustment)
+}
+
+// portfolioVaR calculates historical VaR of a preloaded portfolio, whose
+// positions need not be stored, and returns the weights it was calculated
+// with
+func (s *RiskService) portfolioVaR(ctx context.Context, portfolio *domain.Portfolio, confidence float64, horizonDays, windowDays int, adjustment string) (*domain.VaRResponse, LimitPortfolio, error) {
+	adjustment, err := riskmath.NormalizeAdjustment(adjustment)
+	if err != nil {
+		return nil, LimitPortfolio{}, err
 	}
 	
 	if len(portfolio.Positions) == 0 {
-		return nil, fmt.Errorf("portfolio has no positions")
+		return nil, LimitPortfolio{}, fmt.Errorf("portfolio has no positions")
+	}
+	
+	jobs.ReportProgress(ctx, 5, "valuing portfolio")
+	valuation, err := s.valuation.ValuePortfolio(ctx, portfolio, time.Now())
+	if err != nil {
+		return nil, LimitPortfolio{}, fmt.Errorf("failed to value portfolio: %w", err)
 	}
 	
 	assetReturns := make([][]float64, len(portfolio.Positions))
@@ -70,15 +129,16 @@ func (s *RiskService) CalculatePortfolioVaR(portfolioID uuid.UUID, confidence fl
 	totalValue := 0.0
 	
 	for i, pos := range portfolio.Positions {
-		prices, err := s.getHistoricalPricesWithFallback(pos.Asset.Symbol, windowDays+1)
+		jobs.ReportProgress(ctx, 10+40*i/len(portfolio.Positions), "loading prices")
+		prices, err := s.baseHistory(ctx, pos.Asset, valuation.BaseCurrency, windowDays+1, adjustment)
 		if err != nil {
-			return nil, fmt.Errorf("failed to get prices for %s: %w", pos.Asset.Symbol, err)
+			return nil, LimitPortfolio{}, fmt.Errorf("failed to get prices for %s: %w", pos.Asset.Symbol, err)
 		}
 		
-		returns := riskmath.CalculateReturns(convertPrices(prices), true)
+		returns := riskmath.CalculateReturns(prices, true)
 		assetReturns[i] = returns
 		
-		marketValue := pos.Quantity * pos.AvgPrice
+		marketValue := valuation.MarketValue(pos.ID)
 		totalValue += marketValue
 		weights[i] = marketValue
 	}
@@ -87,15 +147,16 @@ func (s *RiskService) CalculatePortfolioVaR(portfolioID uuid.UUID, confidence fl
 		weights[i] = weights[i] / totalValue
 	}
 	
+	jobs.ReportProgress(ctx, 50, "computing")
 	portfolioReturns := riskmath.CalculatePortfolioReturns(assetReturns, weights)
 	
 	if len(portfolioReturns) == 0 {
-		return nil, fmt.Errorf("no portfolio returns calculated")
+		return nil, LimitPortfolio{}, fmt.Errorf("no portfolio returns calculated")
 	}
 	
 	varResult, err := riskmath.CalculateHistoricalVaR(portfolioReturns, confidence, horizonDays)
 	if err != nil {
-		return nil, err
+		return nil, LimitPortfolio{}, err
 	}
 	
 	// VaR is in return units (e.g., 0.02 = 2%), multiply by portfolio value
@@ -124,7 +185,7 @@ func (s *RiskService) CalculatePortfolioVaR(portfolioID uuid.UUID, confidence fl
 			varAmount = totalValue * 0.03
 		} else {
 			// Returns themselves seem wrong - error
-			return nil, fmt.Errorf("VaR calculation error: returns seem invalid (max return: %.4f, VaR: %.2f)", maxReturn, varAmount)
+			return nil, LimitPortfolio{}, fmt.Errorf("VaR calculation error: returns seem invalid (max return: %.4f, VaR: %.2f)", maxReturn, varAmount)
 		}
 	}
 	
@@ -134,18 +195,37 @@ func (s *RiskService) CalculatePortfolioVaR(portfolioID uuid.UUID, confidence fl
 	}
 	
 	return &domain.VaRResponse{
-		VaR: varAmount,
-	}, nil
+		VaR:        varAmount,
+		Currency:   valuation.BaseCurrency,
+		Adjustment: adjustment,
+	}, limitPortfolio(portfolio, valuation), nil
 }
 
-func (s *RiskService) CalculatePortfolioCVaR(portfolioID uuid.UUID, confidence float64, horizonDays, windowDays int) (*domain.CVaRResponse, error) {
-	var portfolio domain.Portfolio
-	if err := s.db.Preload("Positions.Asset").First(&portfolio, "id = ?", portfolioID).Error; err != nil {
-		return nil, fmt.Errorf("portfolio not found: %w", err)
+func (s *RiskService) calculatePortfolioCVaR(ctx context.Context, portfolioID uuid.UUID, confidence float64, horizonDays, windowDays int, adjustment string) (*domain.CVaRResponse, LimitPortfolio, error) {
+	portfolio, err := s.loadPortfolio(portfolioID)
+	if err != nil {
+		return nil, LimitPortfolio{}, err
+	}
+	return s.portfolioCVaR(ctx, portfolio, confidence, horizonDays, windowDays, adjustment)
+}
+
+// portfolioCVaR calculates historical CVaR of a preloaded portfolio, whose
+// positions need not be stored, and returns the weights it was calculated
+// with
+func (s *RiskService) portfolioCVaR(ctx context.Context, portfolio *domain.Portfolio, confidence float64, horizonDays, windowDays int, adjustment string) (*domain.CVaRResponse, LimitPortfolio, error) {
+	adjustment, err := riskmath.NormalizeAdjustment(adjustment)
+	if err != nil {
+		return nil, LimitPortfolio{}, err
 	}
 	
 	if len(portfolio.Positions) == 0 {
-		return nil, fmt.Errorf("portfolio has no positions")
+		return nil, LimitPortfolio{}, fmt.Errorf("portfolio has no positions")
+	}
+	
+	jobs.ReportProgress(ctx, 5, "valuing portfolio")
+	valuation, err := s.valuation.ValuePortfolio(ctx, portfolio, time.Now())
+	if err != nil {
+		return nil, LimitPortfolio{}, fmt.Errorf("failed to value portfolio: %w", err)
 	}
 	
 	assetReturns := make([][]float64, len(portfolio.Positions))
@@ -154,14 +234,15 @@ func (s *RiskService) CalculatePortfolioCVaR(portfolioID uuid.UUID, confidence f
 	validAssets := 0
 	
 	for i, pos := range portfolio.Positions {
-		prices, err := s.getHistoricalPricesWithFallback(pos.Asset.Symbol, windowDays+1)
+		jobs.ReportProgress(ctx, 10+40*i/len(portfolio.Positions), "loading prices")
+		prices, err := s.baseHistory(ctx, pos.Asset, valuation.BaseCurrency, windowDays+1, adjustment)
 		if err != nil {
 			// Skip assets without data, but log the error
 			fmt.Printf("Warning: failed to get prices for %s: %v\n", pos.Asset.Symbol, err)
 			continue
 		}
 		
-		returns := riskmath.CalculateReturns(convertPrices(prices), true)
+		returns := riskmath.CalculateReturns(prices, true)
 		if len(returns) == 0 {
 			fmt.Printf("Warning: no returns calculated for %s\n", pos.Asset.Symbol)
 			continue
@@ -169,19 +250,19 @@ func (s *RiskService) CalculatePortfolioCVaR(portfolioID uuid.UUID, confidence f
 		
 		assetReturns[i] = returns
 		
-		marketValue := pos.Quantity * pos.AvgPrice
+		marketValue := valuation.MarketValue(pos.ID)
 		totalValue += marketValue
 		weights[i] = marketValue
 		validAssets++
 	}
 	
 	if validAssets == 0 {
-		return nil, fmt.Errorf("no valid asset data available for CVaR calculation")
+		return nil, LimitPortfolio{}, fmt.Errorf("no valid asset data available for CVaR calculation")
 	}
 	
 	// Normalize weights
 	if totalValue == 0 {
-		return nil, fmt.Errorf("portfolio has zero value")
+		return nil, LimitPortfolio{}, fmt.Errorf("portfolio has zero value")
 	}
 	
 	// Filter out empty asset returns
@@ -195,24 +276,25 @@ func (s *RiskService) CalculatePortfolioCVaR(portfolioID uuid.UUID, confidence f
 	}
 	
 	if len(validReturns) == 0 {
-		return nil, fmt.Errorf("no valid returns data available")
+		return nil, LimitPortfolio{}, fmt.Errorf("no valid returns data available")
 	}
 	
+	jobs.ReportProgress(ctx, 50, "computing")
 	portfolioReturns := riskmath.CalculatePortfolioReturns(validReturns, validWeights)
 	
 	if len(portfolioReturns) == 0 {
-		return nil, fmt.Errorf("no portfolio returns calculated")
+		return nil, LimitPortfolio{}, fmt.Errorf("no portfolio returns calculated")
 	}
 	
 	cvarResult, err := riskmath.CalculateCVaR(portfolioReturns, confidence, horizonDays)
 	if err != nil {
-		return nil, fmt.Errorf("failed to calculate CVaR: %w", err)
+		return nil, LimitPortfolio{}, fmt.Errorf("failed to calculate CVaR: %w", err)
 	}
 	
 	// Calculate VaR for comparison
 	varResult, err := riskmath.CalculateHistoricalVaR(portfolioReturns, confidence, horizonDays)
 	if err != nil {
-		return nil, fmt.Errorf("failed to calculate VaR for comparison: %w", err)
+		return nil, LimitPortfolio{}, fmt.Errorf("failed to calculate VaR for comparison: %w", err)
 	}
 	
 	// VaR and CVaR are in return units, multiply by portfolio value
@@ -245,20 +327,27 @@ func (s *RiskService) CalculatePortfolioCVaR(portfolioID uuid.UUID, confidence f
 	}
 	
 	return &domain.CVaRResponse{
-		CVaR: cvarAmount,
-	}, nil
+		CVaR:       cvarAmount,
+		Currency:   valuation.BaseCurrency,
+		Adjustment: adjustment,
+	}, limitPortfolio(portfolio, valuation), nil
 }
 
-func (s *RiskService) CalculateCorrelations(symbols []string, windowDays int) (*domain.CorrelationResponse, error) {
+func (s *RiskService) CalculateCorrelations(ctx context.Context, symbols []string, windowDays int, adjustment string) (*domain.CorrelationResponse, error) {
+	adjustment, err := riskmath.NormalizeAdjustment(adjustment)
+	if err != nil {
+		return nil, err
+	}
+	
 	assetReturns := make([][]float64, len(symbols))
 	
 	for i, symbol := range symbols {
-		prices, err := s.getHistoricalPricesWithFallback(symbol, windowDays+1)
+		prices, err := s.adjustedHistory(ctx, symbol, windowDays+1, adjustment)
 		if err != nil {
 			return nil, err
 		}
 		
-		returns := riskmath.CalculateReturns(convertPrices(prices), true)
+		returns := riskmath.CalculateReturns(prices, true)
 		assetReturns[i] = returns
 	}
 	
@@ -270,40 +359,56 @@ func (s *RiskService) CalculateCorrelations(symbols []string, windowDays int) (*
 	matrix := riskmath.ExportCorrelationMatrix(corrResult.Matrix)
 	
 	return &domain.CorrelationResponse{
-		Matrix: matrix,
+		Matrix:     matrix,
+		Adjustment: adjustment,
 	}, nil
 }
 
-// CalculatePortfolioVolatility calculates annualized portfolio volatility
-func (s *RiskService) CalculatePortfolioVolatility(portfolioID uuid.UUID, windowDays int) (float64, error) {
-	var portfolio domain.Portfolio
-	if err := s.db.Preload("Positions.Asset").First(&portfolio, "id = ?", portfolioID).Error; err != nil {
-		return 0, fmt.Errorf("portfolio not found: %w", err)
+// calculatePortfolioVolatility calculates annualized portfolio volatility
+func (s *RiskService) calculatePortfolioVolatility(ctx context.Context, portfolioID uuid.UUID, windowDays int, adjustment string) (float64, error) {
+	portfolio, err := s.loadPortfolio(portfolioID)
+	if err != nil {
+		return 0, err
+	}
+	return s.portfolioVolatility(ctx, portfolio, windowDays, adjustment)
+}
+
+// portfolioVolatility calculates annualized volatility of a preloaded
+// portfolio, whose positions need not be stored
+func (s *RiskService) portfolioVolatility(ctx context.Context, portfolio *domain.Portfolio, windowDays int, adjustment string) (float64, error) {
+	adjustment, err := riskmath.NormalizeAdjustment(adjustment)
+	if err != nil {
+		return 0, err
 	}
 	
 	if len(portfolio.Positions) == 0 {
 		return 0, fmt.Errorf("portfolio has no positions")
 	}
 	
+	valuation, err := s.valuation.ValuePortfolio(ctx, portfolio, time.Now())
+	if err != nil {
+		return 0, fmt.Errorf("failed to value portfolio: %w", err)
+	}
+	
 	assetReturns := make([][]float64, len(portfolio.Positions))
 	weights := make([]float64, len(portfolio.Positions))
 	totalValue := 0.0
 	
 	// Get returns for each asset
 	for i, pos := range portfolio.Positions {
-		prices, err := s.getHistoricalPricesWithFallback(pos.Asset.Symbol, windowDays+1)
+		prices, err := s.baseHistory(ctx, pos.Asset, valuation.BaseCurrency, windowDays+1, adjustment)
 		if err != nil {
 			// Skip assets without data, but continue with others
 			continue
 		}
 		
-		returns := riskmath.CalculateReturns(convertPrices(prices), true)
+		returns := riskmath.CalculateReturns(prices, true)
 		if len(returns) == 0 {
 			continue
 		}
 		assetReturns[i] = returns
 		
-		marketValue := pos.Quantity * pos.AvgPrice
+		marketValue := valuation.MarketValue(pos.ID)
 		totalValue += marketValue
 		weights[i] = marketValue
 	}
@@ -350,3 +455,115 @@ func convertPrices(prices []PricePoint) []riskmath.PricePoint {
 	}
 	return result
 }
+
+// alignedPortfolio holds a portfolio's exposures together with return series
+// aligned on the dates shared by all of its priced assets
+type alignedPortfolio struct {
+	NAV        float64
+	Currency   string // base currency of NAV, positions and prices
+	Adjustment string // basis the price history was adjusted on
+	Positions map[string]float64 // market value by symbol
+	Classes   map[string]string  // asset class by symbol
+	Prices    map[string][]riskmath.PricePoint
+	Symbols   []string // priced symbols, in the order of Returns
+	Dates     []time.Time
+	Returns   [][]float64
+}
+
+// loadAlignedPortfolio loads a portfolio with historyDays of price history per
+// asset. Assets without price data still count towards NAV but are left out
+// of the return series.
+func (s *RiskService) loadAlignedPortfolio(ctx context.Context, portfolioID uuid.UUID, historyDays int, adjustment string) (*alignedPortfolio, error) {
+	portfolio, err := s.loadPortfolio(portfolioID)
+	if err != nil {
+		return nil, err
+	}
+	return s.alignPortfolio(ctx, portfolio, historyDays, adjustment)
+}
+
+// alignPortfolio is loadAlignedPortfolio for a preloaded portfolio, whose
+// positions need not be stored
+func (s *RiskService) alignPortfolio(ctx context.Context, portfolio *domain.Portfolio, historyDays int, adjustment string) (*alignedPortfolio, error) {
+	adjustment, err := riskmath.NormalizeAdjustment(adjustment)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(portfolio.Positions) == 0 {
+		return nil, fmt.Errorf("portfolio has no positions")
+	}
+
+	jobs.ReportProgress(ctx, 5, "valuing portfolio")
+	valuation, err := s.valuation.ValuePortfolio(ctx, portfolio, time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("failed to value portfolio: %w", err)
+	}
+
+	data := &alignedPortfolio{
+		Currency:   valuation.BaseCurrency,
+		Adjustment: adjustment,
+		Positions:  make(map[string]float64),
+		Classes:   make(map[string]string),
+		Prices:    make(map[string][]riskmath.PricePoint),
+	}
+
+	for i, pos := range portfolio.Positions {
+		jobs.ReportProgress(ctx, 10+40*i/len(portfolio.Positions), "loading prices")
+		symbol := pos.Asset.Symbol
+		marketValue := valuation.MarketValue(pos.ID)
+		data.NAV += marketValue
+		data.Positions[symbol] += marketValue
+		data.Classes[symbol] = pos.Asset.Class
+
+		if _, ok := data.Prices[symbol]; ok {
+			continue
+		}
+		prices, err := s.baseHistory(ctx, pos.Asset, valuation.BaseCurrency, historyDays+1, adjustment)
+		if err != nil || len(prices) < 2 {
+			// Skip assets without data, but log the error
+			fmt.Printf("Warning: failed to get prices for %s: %v\n", symbol, err)
+			continue
+		}
+		data.Prices[symbol] = prices
+		data.Symbols = append(data.Symbols, symbol)
+	}
+
+	if data.NAV == 0 {
+		return nil, fmt.Errorf("portfolio has zero value")
+	}
+	if len(data.Symbols) == 0 {
+		return nil, fmt.Errorf("no valid asset data available")
+	}
+
+	data.Dates, data.Returns = riskmath.AlignReturns(data.Prices, data.Symbols, true)
+	if len(data.Dates) < 2 {
+		return nil, fmt.Errorf("insufficient overlapping price history")
+	}
+
+	jobs.ReportProgress(ctx, 50, "computing")
+	return data, nil
+}
+
+// limitPortfolio returns the portfolio's weights by symbol and by asset
+// class, priced or not, as limitPortfolio does for a valuation
+func (p *alignedPortfolio) limitPortfolio() LimitPortfolio {
+	result := LimitPortfolio{
+		NAV:          p.NAV,
+		Weights:      make(map[string]float64, len(p.Positions)),
+		ClassWeights: make(map[string]float64),
+	}
+	for symbol, value := range p.Positions {
+		result.Weights[symbol] = value / p.NAV
+		result.ClassWeights[p.Classes[symbol]] += value / p.NAV
+	}
+	return result
+}
+
+// Exposures returns the market value of each priced symbol, in Symbols order
+func (p *alignedPortfolio) Exposures() []float64 {
+	exposures := make([]float64, len(p.Symbols))
+	for i, symbol := range p.Symbols {
+		exposures[i] = p.Positions[symbol]
+	}
+	return exposures
+}
@@ -0,0 +1,248 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/reserveone/saa-risk-analyzer/internal/domain"
+	riskmath "github.com/reserveone/saa-risk-analyzer/internal/math"
+)
+
+// Snapshot sources
+const (
+	SnapshotSourceManual   = "manual"
+	SnapshotSourceSchedule = "schedule"
+)
+
+const (
+	defaultSnapshotConfidence = 0.99
+	defaultSnapshotWindowDays = 250
+)
+
+// ErrSnapshotNotFound is returned when no snapshot exists on or before a date
+var ErrSnapshotNotFound = errors.New("no risk snapshot on or before the date")
+
+// TakeSnapshot calculates a portfolio's NAV, VaR, CVaR, volatility and risk
+// contributions now, and stores them as the snapshot of today (UTC),
+// replacing an earlier snapshot of the same day
+func (s *RiskService) TakeSnapshot(ctx context.Context, req domain.SnapshotRequest) (*domain.RiskSnapshot, error) {
+	if req.Confidence == 0 {
+		req.Confidence = defaultSnapshotConfidence
+	}
+	if req.HorizonDays == 0 {
+		req.HorizonDays = 1
+	}
+	if req.WindowDays == 0 {
+		req.WindowDays = defaultSnapshotWindowDays
+	}
+	if req.Source == "" {
+		req.Source = SnapshotSourceManual
+	}
+	adjustment, err := riskmath.NormalizeAdjustment(req.Adjustment)
+	if err != nil {
+		return nil, err
+	}
+
+	var portfolio domain.Portfolio
+	if err := s.db.Preload("Positions.Asset").First(&portfolio, "id = ?", req.PortfolioID).Error; err != nil {
+		return nil, fmt.Errorf("portfolio not found: %w", err)
+	}
+	now := time.Now()
+	valuation, err := s.ValuePortfolio(ctx, &portfolio, now)
+	if err != nil {
+		return nil, fmt.Errorf("valuation: %w", err)
+	}
+	varResult, err := s.CalculatePortfolioVaR(ctx, req.PortfolioID, req.Confidence, req.HorizonDays, req.WindowDays, adjustment)
+	if err != nil {
+		return nil, fmt.Errorf("VaR: %w", err)
+	}
+	cvarResult, err := s.CalculatePortfolioCVaR(ctx, req.PortfolioID, req.Confidence, req.HorizonDays, req.WindowDays, adjustment)
+	if err != nil {
+		return nil, fmt.Errorf("CVaR: %w", err)
+	}
+	volatility, err := s.CalculatePortfolioVolatility(ctx, req.PortfolioID, req.WindowDays, adjustment)
+	if err != nil {
+		return nil, fmt.Errorf("volatility: %w", err)
+	}
+	contributions, err := s.CalculateRiskContributions(ctx, domain.RiskContributionRequest{
+		PortfolioID: req.PortfolioID,
+		Confidence:  req.Confidence,
+		WindowDays:  req.WindowDays,
+		HorizonDays: req.HorizonDays,
+		Adjustment:  adjustment,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("risk contributions: %w", err)
+	}
+
+	snapshot := &domain.RiskSnapshot{
+		PortfolioID:     req.PortfolioID,
+		AsOf:            snapshotDate(now),
+		Currency:        valuation.BaseCurrency,
+		NAV:             valuation.NAV,
+		VaR:             varResult.VaR,
+		CVaR:            cvarResult.CVaR,
+		Volatility:      volatility,
+		ContributionVaR: contributions.VaR,
+		Contributions:   make([]domain.SnapshotContribution, len(contributions.Contributions)),
+		Confidence:      req.Confidence,
+		HorizonDays:     req.HorizonDays,
+		WindowDays:      req.WindowDays,
+		Adjustment:      adjustment,
+		Source:          req.Source,
+	}
+	for i, c := range contributions.Contributions {
+		weight := 0.0
+		if valuation.NAV != 0 {
+			weight = c.Exposure / valuation.NAV
+		}
+		snapshot.Contributions[i] = domain.SnapshotContribution{
+			Symbol:    c.Symbol,
+			Exposure:  c.Exposure,
+			Weight:    weight,
+			Component: c.Component,
+			Marginal:  c.Marginal,
+		}
+	}
+
+	err = s.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "portfolio_id"}, {Name: "as_of"}},
+		UpdateAll: true,
+	}).Create(snapshot).Error
+	if err != nil {
+		return nil, err
+	}
+	// On conflict the stored row keeps its ID
+	if err := s.db.First(snapshot, "portfolio_id = ? AND as_of = ?", snapshot.PortfolioID, snapshot.AsOf).Error; err != nil {
+		return nil, err
+	}
+	return snapshot, nil
+}
+
+// ListSnapshots returns a portfolio's snapshots from from to to, either of
+// which may be zero for no bound, oldest first
+func (s *RiskService) ListSnapshots(portfolioID uuid.UUID, from, to time.Time) ([]domain.RiskSnapshot, error) {
+	query := s.db.Where("portfolio_id = ?", portfolioID)
+	if !from.IsZero() {
+		query = query.Where("as_of >= ?", snapshotDate(from))
+	}
+	if !to.IsZero() {
+		query = query.Where("as_of <= ?", snapshotDate(to))
+	}
+
+	var snapshots []domain.RiskSnapshot
+	err := query.Order("as_of").Find(&snapshots).Error
+	return snapshots, err
+}
+
+// CompareSnapshots compares a portfolio's latest snapshots on or before two
+// dates
+func (s *RiskService) CompareSnapshots(portfolioID uuid.UUID, from, to time.Time) (*domain.SnapshotComparison, error) {
+	before, err := s.snapshotOn(portfolioID, from)
+	if err != nil {
+		return nil, err
+	}
+	after, err := s.snapshotOn(portfolioID, to)
+	if err != nil {
+		return nil, err
+	}
+	return CompareSnapshots(before, after), nil
+}
+
+// snapshotOn returns a portfolio's latest snapshot on or before date
+func (s *RiskService) snapshotOn(portfolioID uuid.UUID, date time.Time) (*domain.RiskSnapshot, error) {
+	var snapshot domain.RiskSnapshot
+	err := s.db.Where("portfolio_id = ? AND as_of <= ?", portfolioID, snapshotDate(date)).
+		Order("as_of DESC").
+		First(&snapshot).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("%w %s", ErrSnapshotNotFound, date.Format("2006-01-02"))
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &snapshot, nil
+}
+
+// CompareSnapshots attributes the change of risk from one snapshot to another
+// to the positions. A position's component VaR is its exposure times its
+// marginal VaR, so its change splits exactly into an exposure effect and a
+// risk effect; a position held in one snapshot only is all exposure effect.
+func CompareSnapshots(from, to *domain.RiskSnapshot) *domain.SnapshotComparison {
+	comparison := &domain.SnapshotComparison{
+		PortfolioID: to.PortfolioID,
+		From:        from,
+		To:          to,
+		Change: domain.SnapshotChange{
+			NAV:             to.NAV - from.NAV,
+			VaR:             to.VaR - from.VaR,
+			CVaR:            to.CVaR - from.CVaR,
+			Volatility:      to.Volatility - from.Volatility,
+			ContributionVaR: to.ContributionVaR - from.ContributionVaR,
+		},
+		Attribution: []domain.AttributionChange{},
+	}
+	comparison.Change.ModelDifference = comparison.Change.VaR - comparison.Change.ContributionVaR
+
+	if from.ID == to.ID {
+		comparison.Warnings = append(comparison.Warnings, "both dates resolve to the snapshot of "+from.AsOf.Format("2006-01-02"))
+	}
+	if from.Currency != to.Currency {
+		comparison.Warnings = append(comparison.Warnings, fmt.Sprintf("currency changed from %s to %s", from.Currency, to.Currency))
+	}
+	if from.Confidence != to.Confidence || from.HorizonDays != to.HorizonDays ||
+		from.WindowDays != to.WindowDays || from.Adjustment != to.Adjustment {
+		comparison.Warnings = append(comparison.Warnings, "snapshots were taken with different parameters")
+	}
+
+	before := make(map[string]domain.SnapshotContribution, len(from.Contributions))
+	for _, c := range from.Contributions {
+		before[c.Symbol] = c
+	}
+	seen := make(map[string]bool, len(to.Contributions))
+	for _, c := range to.Contributions {
+		seen[c.Symbol] = true
+		previous, held := before[c.Symbol]
+		change := domain.AttributionChange{
+			Symbol: c.Symbol,
+			From:   previous.Component,
+			To:     c.Component,
+			Change: c.Component - previous.Component,
+		}
+		if held {
+			change.ExposureEffect = (c.Exposure - previous.Exposure) * previous.Marginal
+			change.RiskEffect = c.Exposure * (c.Marginal - previous.Marginal)
+		} else {
+			change.ExposureEffect = change.Change
+		}
+		comparison.Attribution = append(comparison.Attribution, change)
+	}
+	for _, c := range from.Contributions {
+		if !seen[c.Symbol] {
+			comparison.Attribution = append(comparison.Attribution, domain.AttributionChange{
+				Symbol:         c.Symbol,
+				From:           c.Component,
+				Change:         -c.Component,
+				ExposureEffect: -c.Component,
+			})
+		}
+	}
+	sort.SliceStable(comparison.Attribution, func(i, j int) bool {
+		return math.Abs(comparison.Attribution[i].Change) > math.Abs(comparison.Attribution[j].Change)
+	})
+	return comparison
+}
+
+// snapshotDate returns the UTC date of t
+func snapshotDate(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
@@ -0,0 +1,264 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"gonum.org/v1/gonum/mat"
+
+	"github.com/reserveone/saa-risk-analyzer/internal/domain"
+	riskmath "github.com/reserveone/saa-risk-analyzer/internal/math"
+)
+
+const (
+	defaultStressConfidence  = 0.99
+	defaultStressWindowDays  = 250
+	defaultStressHistoryDays = 1260 // ~5 years of trading days
+	stressedVaRWindowDays    = 250  // 12-month calibration window
+	minScenarioObservations  = 20
+)
+
+// RunStressTest applies each scenario to the portfolio, revalues it and
+// recomputes VaR under the stressed covariance, and calibrates a stressed VaR
+// on the worst 12-month window of the available history.
+func (s *RiskService) RunStressTest(ctx context.Context, req domain.StressTestRequest) (*domain.StressTestResponse, error) {
+	confidence := req.Confidence
+	if confidence == 0 {
+		confidence = defaultStressConfidence
+	}
+	horizonDays := req.HorizonDays
+	if horizonDays == 0 {
+		horizonDays = 1
+	}
+	windowDays := req.WindowDays
+	if windowDays == 0 {
+		windowDays = defaultStressWindowDays
+	}
+	historyDays := req.HistoryDays
+	if historyDays == 0 {
+		historyDays = defaultStressHistoryDays
+	}
+
+	// Historical scenarios need prices back to their start date
+	windows := make([][2]time.Time, len(req.Scenarios))
+	for i, sc := range req.Scenarios {
+		if sc.Type != "historical" {
+			continue
+		}
+		if sc.Window == nil {
+			return nil, fmt.Errorf("scenario %s: historical scenario requires a window", sc.Name)
+		}
+		from, err := time.Parse("2006-01-02", sc.Window.From)
+		if err != nil {
+			return nil, fmt.Errorf("scenario %s: invalid window start: %w", sc.Name, err)
+		}
+		to, err := time.Parse("2006-01-02", sc.Window.To)
+		if err != nil {
+			return nil, fmt.Errorf("scenario %s: invalid window end: %w", sc.Name, err)
+		}
+		if !to.After(from) {
+			return nil, fmt.Errorf("scenario %s: window end must be after start", sc.Name)
+		}
+		windows[i] = [2]time.Time{from, to}
+
+		if days := int(time.Since(from).Hours()/24) + 1; days > historyDays {
+			historyDays = days
+		}
+	}
+
+	data, err := s.loadAlignedPortfolio(ctx, req.PortfolioID, historyDays, req.Adjustment)
+	if err != nil {
+		return nil, err
+	}
+	dates := data.Dates
+
+	// Current covariance from the most recent window
+	start := 0
+	if windowDays > 0 && len(dates) > windowDays {
+		start = len(dates) - windowDays
+	}
+	baseCov := returnsCovariance(data.Returns, start, len(dates))
+
+	exposures := data.Exposures()
+	weights := make([]float64, len(exposures))
+	for i := range exposures {
+		weights[i] = exposures[i] / data.NAV
+	}
+
+	response := &domain.StressTestResponse{
+		NAV:        data.NAV,
+		BaseVaR:    riskmath.DeltaNormalVaR(exposures, baseCov, confidence, horizonDays),
+		Scenarios:  make([]domain.ScenarioResult, 0, len(req.Scenarios)),
+		Adjustment: data.Adjustment,
+	}
+
+	for i, sc := range req.Scenarios {
+		var result *riskmath.StressScenarioResult
+		stressedCov := baseCov
+		covSource := "current"
+
+		switch sc.Type {
+		case "historical":
+			from, to := windows[i][0], windows[i][1]
+			result, err = riskmath.ApplyHistoricalStress(data.Positions, data.Prices, from, to)
+			if err != nil {
+				return nil, fmt.Errorf("scenario %s: %w", sc.Name, err)
+			}
+
+			// Covariance realised during the scenario window, when there is enough of it
+			lo, hi := dateRange(dates, from, to)
+			if hi-lo >= minScenarioObservations && hi-lo > len(data.Symbols) {
+				stressedCov = returnsCovariance(data.Returns, lo, hi)
+				covSource = "scenario_window"
+			}
+		case "custom":
+			result, err = riskmath.ApplyCustomStress(data.Positions, data.Classes, sc.Shocks)
+			if err != nil {
+				return nil, fmt.Errorf("scenario %s: %w", sc.Name, err)
+			}
+		default:
+			return nil, fmt.Errorf("scenario %s: unknown scenario type: %s", sc.Name, sc.Type)
+		}
+
+		stressedCov, err = riskmath.RegimeAdjustedCovariance(stressedCov, req.CorrelationRegime)
+		if err != nil {
+			return nil, err
+		}
+		if req.CorrelationRegime != "" && req.CorrelationRegime != riskmath.RegimeCurrent {
+			covSource += "_" + req.CorrelationRegime
+		}
+
+		if err := riskmath.ApplyStressedVaR(result, data.Symbols, data.Positions, baseCov, stressedCov, confidence, horizonDays); err != nil {
+			return nil, fmt.Errorf("scenario %s: %w", sc.Name, err)
+		}
+
+		impacts := make([]domain.AssetImpact, 0, len(result.AssetImpact))
+		for _, symbol := range data.Symbols {
+			if impact, ok := result.AssetImpact[symbol]; ok {
+				impacts = append(impacts, domain.AssetImpact{Symbol: symbol, Impact: impact})
+			}
+		}
+		for symbol, impact := range result.AssetImpact {
+			if _, ok := data.Prices[symbol]; !ok {
+				impacts = append(impacts, domain.AssetImpact{Symbol: symbol, Impact: impact})
+			}
+		}
+
+		response.Scenarios = append(response.Scenarios, domain.ScenarioResult{
+			Name:             sc.Name,
+			DeltaNAV:         result.DeltaNAV,
+			DeltaVaR:         result.DeltaVaR,
+			PostShockNAV:     result.PostShockNAV,
+			BaseVaR:          result.BaseVaR,
+			StressedVaR:      result.StressedVaR,
+			CovarianceSource: covSource,
+			AssetImpact:      impacts,
+		})
+	}
+
+	// Basel-style stressed VaR on current weights over the full history
+	portfolioReturns := riskmath.CalculatePortfolioReturns(data.Returns, weights)
+	stressed, err := riskmath.CalculateStressedVaR(portfolioReturns, stressedVaRWindowDays, confidence, horizonDays)
+	if err != nil {
+		return nil, fmt.Errorf("failed to calculate stressed VaR: %w", err)
+	}
+	current, err := riskmath.CalculateHistoricalVaR(portfolioReturns[start:], confidence, horizonDays)
+	if err != nil {
+		return nil, fmt.Errorf("failed to calculate current VaR: %w", err)
+	}
+
+	response.StressedVaR = &domain.StressedVaRResult{
+		VaR:          stressed.VaR * data.NAV,
+		CurrentVaR:   current.VaR * data.NAV,
+		WindowFrom:   dates[stressed.WindowStart].Format("2006-01-02"),
+		WindowTo:     dates[stressed.WindowEnd-1].Format("2006-01-02"),
+		Observations: stressed.WindowEnd - stressed.WindowStart,
+	}
+
+	s.observe(ctx, req.PortfolioID, RiskObservation{StressLosses: stressLosses(response)}, data.limitPortfolio())
+	return response, nil
+}
+
+// returnsCovariance builds the covariance matrix of the aligned returns in [from, to)
+func returnsCovariance(assetReturns [][]float64, from, to int) *mat.SymDense {
+	window := make([][]float64, len(assetReturns))
+	for i, series := range assetReturns {
+		window[i] = series[from:to]
+	}
+	cov, _ := riskmath.ReturnMoments(window)
+	return cov
+}
+
+// dateRange returns the index range [lo, hi) of sorted dates falling within [from, to]
+func dateRange(dates []time.Time, from, to time.Time) (int, int) {
+	lo, hi := len(dates), len(dates)
+	for i, d := range dates {
+		if lo == len(dates) && !d.Before(from) {
+			lo = i
+		}
+		if d.After(to) {
+			hi = i
+			break
+		}
+	}
+	if hi < lo {
+		hi = lo
+	}
+	return lo, hi
+}
+
+// RunReverseStressTest finds the most plausible asset or factor move that makes
+// the portfolio lose exactly the requested amount
+func (s *RiskService) RunReverseStressTest(ctx context.Context, req domain.ReverseStressRequest) (*domain.ReverseStressResponse, error) {
+	horizonDays := req.HorizonDays
+	if horizonDays == 0 {
+		horizonDays = 1
+	}
+	windowDays := req.WindowDays
+	if windowDays == 0 {
+		windowDays = defaultStressWindowDays
+	}
+	mode := req.Mode
+	if mode == "" {
+		mode = "asset"
+	}
+
+	data, err := s.loadAlignedPortfolio(ctx, req.PortfolioID, windowDays, req.Adjustment)
+	if err != nil {
+		return nil, err
+	}
+
+	var result *riskmath.ReverseStressResult
+	switch mode {
+	case "asset":
+		result, err = riskmath.ReverseStressTest(data.Returns, data.Exposures(), req.LossLimit, horizonDays)
+	case "factor":
+		result, err = riskmath.ReverseStressTestFactors(data.Returns, data.Exposures(), req.LossLimit, horizonDays, req.Factors)
+	default:
+		return nil, fmt.Errorf("unknown reverse stress mode: %s", mode)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	scenario := make([]domain.ReverseStressShock, len(data.Symbols))
+	for i, symbol := range data.Symbols {
+		scenario[i] = domain.ReverseStressShock{
+			Symbol: symbol,
+			Shock:  result.Shocks[i],
+			PnL:    result.PnL[i],
+		}
+	}
+
+	return &domain.ReverseStressResponse{
+		NAV:                 data.NAV,
+		Loss:                result.Loss,
+		Mode:                mode,
+		MahalanobisDistance: result.MahalanobisDistance,
+		Plausibility:        result.Plausibility,
+		FactorShocks:        result.FactorShocks,
+		Scenario:            scenario,
+		Adjustment:          data.Adjustment,
+	}, nil
+}
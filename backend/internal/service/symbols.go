@@ -0,0 +1,525 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/reserveone/saa-risk-analyzer/internal/domain"
+)
+
+// ErrSymbolInUse is returned when deleting a symbol that positions, prices,
+// corporate actions or transactions still reference
+var ErrSymbolInUse = errors.New("symbol is referenced by positions, prices, corporate actions or transactions")
+
+// ErrInvalidSymbol wraps validation failures of symbol master requests
+var ErrInvalidSymbol = errors.New("invalid symbol")
+
+// AssetClasses are the valid asset classes of the symbol master
+var AssetClasses = []string{AssetClassEquity, AssetClassBond, AssetClassFX, AssetClassCommodities, AssetClassCrypto}
+
+func cryptoSymbol(symbol, name, binance, coinGecko, coinCap string) domain.Asset {
+	return domain.Asset{
+		Symbol:   symbol,
+		Name:     name,
+		Class:    AssetClassCrypto,
+		Currency: "USD",
+		Tickers: []domain.AssetTicker{
+			{Provider: ProviderBinance, Ticker: binance},
+			{Provider: ProviderCoinGecko, Ticker: coinGecko},
+			{Provider: ProviderCoinCap, Ticker: coinCap},
+		},
+	}
+}
+
+func fundSymbol(symbol, name, class, subClass, exchange, cusip string) domain.Asset {
+	return domain.Asset{
+		Symbol:   symbol,
+		Name:     name,
+		Class:    class,
+		SubClass: subClass,
+		Currency: "USD",
+		Exchange: exchange,
+		ISIN:     "US" + cusip + isinCheckDigit("US"+cusip),
+		CUSIP:    cusip,
+	}
+}
+
+func fxSymbol(symbol, name string) domain.Asset {
+	return domain.Asset{Symbol: symbol, Name: name, Class: AssetClassFX, SubClass: "Major", Currency: symbol[3:]}
+}
+
+// defaultSymbols seed the symbol master
+var defaultSymbols = []domain.Asset{
+	cryptoSymbol("BTC", "Bitcoin", "BTCUSDT", "bitcoin", "bitcoin"),
+	cryptoSymbol("ETH", "Ethereum", "ETHUSDT", "ethereum", "ethereum"),
+	cryptoSymbol("BNB", "BNB", "BNBUSDT", "binancecoin", "binance-coin"),
+	cryptoSymbol("XRP", "XRP", "XRPUSDT", "ripple", "xrp"),
+	cryptoSymbol("ADA", "Cardano", "ADAUSDT", "cardano", "cardano"),
+	cryptoSymbol("SOL", "Solana", "SOLUSDT", "solana", "solana"),
+	cryptoSymbol("DOGE", "Dogecoin", "DOGEUSDT", "dogecoin", "dogecoin"),
+	cryptoSymbol("DOT", "Polkadot", "DOTUSDT", "polkadot", "polkadot"),
+	fundSymbol("SPY", "SPDR S&P 500 ETF Trust", AssetClassEquity, "US Large Cap", "NYSE Arca", "78462F103"),
+	fundSymbol("QQQ", "Invesco QQQ Trust", AssetClassEquity, "US Large Cap Growth", "NASDAQ", "46090E103"),
+	fundSymbol("IWM", "iShares Russell 2000 ETF", AssetClassEquity, "US Small Cap", "NYSE Arca", "464287655"),
+	fundSymbol("EFA", "iShares MSCI EAFE ETF", AssetClassEquity, "Developed ex-US", "NYSE Arca", "464287465"),
+	fundSymbol("EEM", "iShares MSCI Emerging Markets ETF", AssetClassEquity, "Emerging Markets", "NYSE Arca", "464287234"),
+	fundSymbol("TLT", "iShares 20+ Year Treasury Bond ETF", AssetClassBond, "Long Treasury", "NASDAQ", "464287432"),
+	fundSymbol("IEF", "iShares 7-10 Year Treasury Bond ETF", AssetClassBond, "Intermediate Treasury", "NASDAQ", "464287440"),
+	fundSymbol("LQD", "iShares iBoxx $ Investment Grade Corporate Bond ETF", AssetClassBond, "Investment Grade Corporate", "NYSE Arca", "464287242"),
+	fundSymbol("HYG", "iShares iBoxx $ High Yield Corporate Bond ETF", AssetClassBond, "High Yield Corporate", "NYSE Arca", "464288513"),
+	fundSymbol("GLD", "SPDR Gold Shares", AssetClassCommodities, "Gold", "NYSE Arca", "78463V107"),
+	fundSymbol("SLV", "iShares Silver Trust", AssetClassCommodities, "Silver", "NYSE Arca", "46428Q109"),
+	fxSymbol("EURUSD", "Euro / US Dollar"),
+	fxSymbol("GBPUSD", "British Pound / US Dollar"),
+	fxSymbol("USDJPY", "US Dollar / Japanese Yen"),
+}
+
+// NewAsset returns the reference data of a symbol not yet in the symbol
+// master: its seeded defaults if it has any, otherwise classified from the
+// symbol itself
+func NewAsset(symbol string) domain.Asset {
+	for _, seed := range defaultSymbols {
+		if seed.Symbol == symbol {
+			asset := seed
+			asset.Tickers = append([]domain.AssetTicker(nil), seed.Tickers...)
+			return asset
+		}
+	}
+	return domain.Asset{
+		Symbol:   symbol,
+		Name:     symbol,
+		Class:    AssetClassOf(symbol),
+		Currency: CurrencyOf(symbol),
+	}
+}
+
+// ResolveAsset returns the asset for symbol, creating it from NewAsset if it
+// does not exist yet
+func ResolveAsset(tx *gorm.DB, symbol string) (domain.Asset, error) {
+	var asset domain.Asset
+	err := tx.Where("symbol = ?", symbol).First(&asset).Error
+	if err == nil {
+		return asset, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return asset, err
+	}
+
+	asset = NewAsset(symbol)
+	if err := tx.Create(&asset).Error; err != nil {
+		return asset, fmt.Errorf("failed to create asset %s: %w", symbol, err)
+	}
+	return asset, nil
+}
+
+// SymbolService manages the symbol master and serves it to the market data
+// service for routing, from a cache reloaded on every change
+type SymbolService struct {
+	db *gorm.DB
+
+	mu      sync.RWMutex
+	loaded  bool
+	classes map[string]string            // class by symbol
+	tickers map[string]map[string]string // ticker by symbol and provider
+}
+
+func NewSymbolService(db *gorm.DB) *SymbolService {
+	return &SymbolService{db: db}
+}
+
+// Class returns the asset class of a symbol in the master
+func (s *SymbolService) Class(symbol string) (string, bool) {
+	if !s.ensureLoaded() {
+		return "", false
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	class, ok := s.classes[symbol]
+	return class, ok && isAssetClass(class)
+}
+
+// Ticker returns the ticker a provider uses for a symbol in the master
+func (s *SymbolService) Ticker(provider, symbol string) (string, bool) {
+	if !s.ensureLoaded() {
+		return "", false
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	ticker, ok := s.tickers[symbol][provider]
+	return ticker, ok
+}
+
+func (s *SymbolService) ensureLoaded() bool {
+	s.mu.RLock()
+	loaded := s.loaded
+	s.mu.RUnlock()
+	if loaded {
+		return true
+	}
+	if err := s.Reload(); err != nil {
+		fmt.Printf("Warning: failed to load symbol master: %v\n", err)
+		return false
+	}
+	return true
+}
+
+// Reload refreshes the routing cache from the database
+func (s *SymbolService) Reload() error {
+	var assets []domain.Asset
+	if err := s.db.Preload("Tickers").Find(&assets).Error; err != nil {
+		return err
+	}
+
+	classes := make(map[string]string, len(assets))
+	tickers := make(map[string]map[string]string)
+	for _, asset := range assets {
+		classes[asset.Symbol] = asset.Class
+		for _, t := range asset.Tickers {
+			if tickers[asset.Symbol] == nil {
+				tickers[asset.Symbol] = make(map[string]string)
+			}
+			tickers[asset.Symbol][t.Provider] = t.Ticker
+		}
+	}
+
+	s.mu.Lock()
+	s.classes = classes
+	s.tickers = tickers
+	s.loaded = true
+	s.mu.Unlock()
+	return nil
+}
+
+// Seed adds the default symbols missing from the master, and classifies
+// assets created before the master existed with class Unknown
+func (s *SymbolService) Seed() error {
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		for _, seed := range defaultSymbols {
+			asset := NewAsset(seed.Symbol)
+			tickers := asset.Tickers
+			asset.Tickers = nil
+			if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&asset).Error; err != nil {
+				return err
+			}
+			var stored domain.Asset
+			if err := tx.Where("symbol = ?", seed.Symbol).First(&stored).Error; err != nil {
+				return err
+			}
+			if err := s.saveTickers(tx, stored.ID, tickers, false); err != nil {
+				return err
+			}
+		}
+
+		var unknown []domain.Asset
+		if err := tx.Where("class = ?", "Unknown").Find(&unknown).Error; err != nil {
+			return err
+		}
+		for _, asset := range unknown {
+			defaults := NewAsset(asset.Symbol)
+			updates := map[string]interface{}{"class": defaults.Class}
+			if asset.Name == asset.Symbol {
+				updates["name"] = defaults.Name
+			}
+			if err := tx.Model(&asset).Updates(updates).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return s.Reload()
+}
+
+// List returns the symbols of the master, optionally of one class and
+// matching a search on symbol, name or identifiers
+func (s *SymbolService) List(class, search string) ([]domain.Asset, error) {
+	query := s.db.Preload("Tickers").Order("symbol ASC")
+	if class != "" {
+		query = query.Where("class = ?", class)
+	}
+	if search != "" {
+		like := "%" + strings.ToUpper(search) + "%"
+		query = query.Where("UPPER(symbol) LIKE ? OR UPPER(name) LIKE ? OR isin = ? OR cusip = ? OR figi = ?",
+			like, like, strings.ToUpper(search), strings.ToUpper(search), strings.ToUpper(search))
+	}
+
+	var assets []domain.Asset
+	err := query.Find(&assets).Error
+	return assets, err
+}
+
+// Get returns a symbol of the master
+func (s *SymbolService) Get(symbol string) (*domain.Asset, error) {
+	var asset domain.Asset
+	if err := s.db.Preload("Tickers").Where("symbol = ?", symbol).First(&asset).Error; err != nil {
+		return nil, err
+	}
+	return &asset, nil
+}
+
+// Create adds a symbol to the master
+func (s *SymbolService) Create(req domain.SymbolRequest) (*domain.Asset, error) {
+	symbol := strings.ToUpper(strings.TrimSpace(req.Symbol))
+	if symbol == "" {
+		return nil, fmt.Errorf("%w: symbol required", ErrInvalidSymbol)
+	}
+
+	asset := NewAsset(symbol)
+	asset.Tickers = nil
+	if err := applySymbolRequest(&asset, req); err != nil {
+		return nil, err
+	}
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&asset).Error; err != nil {
+			return err
+		}
+		return s.saveTickers(tx, asset.ID, tickerList(req.Tickers), true)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.changed(symbol)
+}
+
+// Update changes the reference data of a symbol. Fields left empty in req
+// are kept; tickers in req replace those of the same providers, and an empty
+// ticker removes a provider's.
+func (s *SymbolService) Update(symbol string, req domain.SymbolRequest) (*domain.Asset, error) {
+	asset, err := s.Get(symbol)
+	if err != nil {
+		return nil, err
+	}
+	asset.Tickers = nil
+	if err := applySymbolRequest(asset, req); err != nil {
+		return nil, err
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("Tickers").Save(asset).Error; err != nil {
+			return err
+		}
+		for provider, ticker := range req.Tickers {
+			if strings.TrimSpace(ticker) != "" {
+				continue
+			}
+			if err := tx.Where("asset_id = ? AND provider = ?", asset.ID, strings.ToLower(provider)).Delete(&domain.AssetTicker{}).Error; err != nil {
+				return err
+			}
+		}
+		return s.saveTickers(tx, asset.ID, tickerList(req.Tickers), true)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.changed(symbol)
+}
+
+// Delete removes a symbol that no position, price, corporate action or
+// transaction references
+func (s *SymbolService) Delete(symbol string) error {
+	asset, err := s.Get(symbol)
+	if err != nil {
+		return err
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		var references int64
+		for _, model := range []interface{}{&domain.Position{}, &domain.Price{}, &domain.CorporateAction{}, &domain.Transaction{}} {
+			var count int64
+			if err := tx.Model(model).Where("asset_id = ?", asset.ID).Count(&count).Error; err != nil {
+				return err
+			}
+			references += count
+		}
+		if references > 0 {
+			return ErrSymbolInUse
+		}
+		if err := tx.Where("asset_id = ?", asset.ID).Delete(&domain.AssetTicker{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(asset).Error
+	})
+	if err != nil {
+		return err
+	}
+	return s.Reload()
+}
+
+func (s *SymbolService) changed(symbol string) (*domain.Asset, error) {
+	if err := s.Reload(); err != nil {
+		fmt.Printf("Warning: failed to reload symbol master: %v\n", err)
+	}
+	return s.Get(symbol)
+}
+
+// saveTickers upserts provider tickers, replacing existing ones if replace
+func (s *SymbolService) saveTickers(tx *gorm.DB, assetID uuid.UUID, tickers []domain.AssetTicker, replace bool) error {
+	if len(tickers) == 0 {
+		return nil
+	}
+	rows := make([]domain.AssetTicker, len(tickers))
+	for i, t := range tickers {
+		rows[i] = t
+		rows[i].ID = uuid.Nil
+		rows[i].AssetID = assetID
+	}
+	conflict := clause.OnConflict{
+		Columns:   []clause.Column{{Name: "asset_id"}, {Name: "provider"}},
+		DoNothing: true,
+	}
+	if replace {
+		conflict = clause.OnConflict{
+			Columns:   []clause.Column{{Name: "asset_id"}, {Name: "provider"}},
+			DoUpdates: clause.AssignmentColumns([]string{"ticker", "updated_at"}),
+		}
+	}
+	return tx.Clauses(conflict).Create(&rows).Error
+}
+
+// applySymbolRequest validates req and copies its non-empty fields onto asset
+func applySymbolRequest(asset *domain.Asset, req domain.SymbolRequest) error {
+	if req.Name != "" {
+		asset.Name = req.Name
+	}
+	if req.Class != "" {
+		class, ok := normalizeAssetClass(req.Class)
+		if !ok {
+			return fmt.Errorf("%w: class %q, expected one of %s", ErrInvalidSymbol, req.Class, strings.Join(AssetClasses, ", "))
+		}
+		asset.Class = class
+	}
+	if req.SubClass != "" {
+		asset.SubClass = req.SubClass
+	}
+	if req.Currency != "" {
+		currency, err := NormalizeCurrency(req.Currency)
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidSymbol, err)
+		}
+		asset.Currency = currency
+	}
+	if req.Exchange != "" {
+		asset.Exchange = req.Exchange
+	}
+	if req.ISIN != "" {
+		isin := strings.ToUpper(req.ISIN)
+		if !ValidISIN(isin) {
+			return fmt.Errorf("%w: ISIN %q", ErrInvalidSymbol, req.ISIN)
+		}
+		asset.ISIN = isin
+	}
+	if req.CUSIP != "" {
+		cusip := strings.ToUpper(req.CUSIP)
+		if !ValidCUSIP(cusip) {
+			return fmt.Errorf("%w: CUSIP %q", ErrInvalidSymbol, req.CUSIP)
+		}
+		asset.CUSIP = cusip
+	}
+	if req.FIGI != "" {
+		figi := strings.ToUpper(req.FIGI)
+		if len(figi) != 12 || !isAlphanumeric(figi) {
+			return fmt.Errorf("%w: FIGI %q", ErrInvalidSymbol, req.FIGI)
+		}
+		asset.FIGI = figi
+	}
+	return nil
+}
+
+func tickerList(tickers map[string]string) []domain.AssetTicker {
+	list := make([]domain.AssetTicker, 0, len(tickers))
+	for provider, ticker := range tickers {
+		if ticker = strings.TrimSpace(ticker); ticker != "" {
+			list = append(list, domain.AssetTicker{Provider: strings.ToLower(provider), Ticker: ticker})
+		}
+	}
+	return list
+}
+
+func normalizeAssetClass(class string) (string, bool) {
+	for _, c := range AssetClasses {
+		if strings.EqualFold(c, class) {
+			return c, true
+		}
+	}
+	return "", false
+}
+
+func isAssetClass(class string) bool {
+	_, ok := normalizeAssetClass(class)
+	return ok
+}
+
+// ValidISIN checks the format and Luhn check digit of an ISIN
+func ValidISIN(isin string) bool {
+	if len(isin) != 12 || !isAlphanumeric(isin) || isin[0] < 'A' || isin[1] < 'A' {
+		return false
+	}
+	return isinCheckDigit(isin[:11]) == isin[11:]
+}
+
+// ValidCUSIP checks the format and check digit of a CUSIP
+func ValidCUSIP(cusip string) bool {
+	if len(cusip) != 9 || !isAlphanumeric(cusip) {
+		return false
+	}
+	sum := 0
+	for i := 0; i < 8; i++ {
+		v := alphanumericValue(cusip[i])
+		if i%2 == 1 {
+			v *= 2
+		}
+		sum += v/10 + v%10
+	}
+	return int(cusip[8]-'0') == (10-sum%10)%10
+}
+
+// isinCheckDigit computes the check digit of the first 11 ISIN characters:
+// letters expand to two digits, then the Luhn algorithm applies
+func isinCheckDigit(body string) string {
+	var digits []int
+	for i := 0; i < len(body); i++ {
+		v := alphanumericValue(body[i])
+		if v >= 10 {
+			digits = append(digits, v/10)
+		}
+		digits = append(digits, v%10)
+	}
+	sum := 0
+	for i := len(digits) - 1; i >= 0; i-- {
+		d := digits[i]
+		if (len(digits)-1-i)%2 == 0 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+	}
+	return fmt.Sprint((10 - sum%10) % 10)
+}
+
+func alphanumericValue(c byte) int {
+	if c >= '0' && c <= '9' {
+		return int(c - '0')
+	}
+	return int(c-'A') + 10
+}
+
+func isAlphanumeric(s string) bool {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if (c < '0' || c > '9') && (c < 'A' || c > 'Z') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,169 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/reserveone/saa-risk-analyzer/internal/domain"
+)
+
+// ValuationService marks positions to market at the latest close on or
+// before an as-of date, or at the latest quote when valuing as of now, in the
+// portfolio's base currency
+type ValuationService struct {
+	db     *gorm.DB
+	prices *PriceStore
+	quotes *LatestPriceService
+	fx     *FXService
+}
+
+func NewValuationService(db *gorm.DB, quotes *LatestPriceService) *ValuationService {
+	prices := NewPriceStore(db, quotes.market)
+	return &ValuationService{
+		db:     db,
+		prices: prices,
+		quotes: quotes,
+		fx:     NewFXService(prices, quotes),
+	}
+}
+
+// FX returns the service used to convert into base currency
+func (s *ValuationService) FX() *FXService {
+	return s.fx
+}
+
+// ValuePortfolio marks every position of a preloaded portfolio to market.
+// Positions without any market price are valued at their average price and
+// reported with the avg_price source. Prices stay in the asset's currency;
+// market values and cost bases are converted into the base currency.
+func (s *ValuationService) ValuePortfolio(ctx context.Context, portfolio *domain.Portfolio, asOf time.Time) (*domain.PortfolioValuation, error) {
+	base, err := NormalizeCurrency(portfolio.BaseCurrency)
+	if err != nil {
+		return nil, err
+	}
+
+	valuation := &domain.PortfolioValuation{
+		PortfolioID:  portfolio.ID,
+		BaseCurrency: base,
+		AsOf:         asOf,
+		Positions:    make([]domain.PositionValuation, 0, len(portfolio.Positions)),
+	}
+
+	prices := make(map[string]PricePoint)
+	sources := make(map[string]string)
+	rates := make(map[string]float64)
+
+	for _, pos := range portfolio.Positions {
+		symbol := pos.Asset.Symbol
+		price, ok := prices[symbol]
+		if !ok {
+			var source string
+			var err error
+			price, source, err = s.LatestClose(ctx, symbol, asOf)
+			if err != nil {
+				price = PricePoint{Date: pos.UpdatedAt, Close: pos.AvgPrice}
+				source = PriceSourceCost
+			}
+			prices[symbol] = price
+			sources[symbol] = source
+		}
+
+		currency := priceCurrency(pos.Asset)
+		rate, ok := rates[currency]
+		if !ok {
+			rate, err = s.fx.Rate(ctx, currency, base, asOf)
+			if err != nil {
+				return nil, fmt.Errorf("failed to convert %s into %s: %w", symbol, base, err)
+			}
+			rates[currency] = rate
+		}
+
+		marketValue := pos.Quantity * price.Close * rate
+		costBasis := pos.Quantity * pos.AvgPrice * rate
+		valuation.Positions = append(valuation.Positions, domain.PositionValuation{
+			PositionID:    pos.ID,
+			Symbol:        symbol,
+			Quantity:      pos.Quantity,
+			AvgPrice:      pos.AvgPrice,
+			Price:         price.Close,
+			PriceDate:     price.Date,
+			PriceSource:   sources[symbol],
+			Currency:      currency,
+			FXRate:        rate,
+			MarketValue:   marketValue,
+			CostBasis:     costBasis,
+			UnrealizedPnL: marketValue - costBasis,
+		})
+		valuation.NAV += marketValue
+		valuation.CostBasis += costBasis
+	}
+
+	valuation.UnrealizedPnL = valuation.NAV - valuation.CostBasis
+	if valuation.NAV != 0 {
+		for i := range valuation.Positions {
+			valuation.Positions[i].Weight = valuation.Positions[i].MarketValue / valuation.NAV
+		}
+	}
+
+	return valuation, nil
+}
+
+// CurrencyExposure breaks a valuation of a preloaded portfolio down by the
+// currency each position is exposed to, largest exposure first
+func (s *ValuationService) CurrencyExposure(portfolio *domain.Portfolio, valuation *domain.PortfolioValuation) *domain.CurrencyExposureResponse {
+	byCurrency := make(map[string]*domain.CurrencyExposure)
+	for _, pos := range portfolio.Positions {
+		currency := exposureCurrency(pos.Asset)
+		exposure, ok := byCurrency[currency]
+		if !ok {
+			exposure = &domain.CurrencyExposure{Currency: currency}
+			byCurrency[currency] = exposure
+		}
+		exposure.MarketValue += valuation.MarketValue(pos.ID)
+		exposure.Positions++
+	}
+
+	response := &domain.CurrencyExposureResponse{
+		PortfolioID:  valuation.PortfolioID,
+		BaseCurrency: valuation.BaseCurrency,
+		AsOf:         valuation.AsOf,
+		NAV:          valuation.NAV,
+		Currencies:   make([]domain.CurrencyExposure, 0, len(byCurrency)),
+	}
+	for _, exposure := range byCurrency {
+		if valuation.NAV != 0 {
+			exposure.Weight = exposure.MarketValue / valuation.NAV
+		}
+		response.Currencies = append(response.Currencies, *exposure)
+	}
+	sort.Slice(response.Currencies, func(i, j int) bool {
+		return response.Currencies[i].MarketValue > response.Currencies[j].MarketValue
+	})
+	return response
+}
+
+// LatestClose returns the most recent close of symbol on or before asOf,
+// from the stored closes first and the market data providers otherwise
+func (s *ValuationService) LatestClose(ctx context.Context, symbol string, asOf time.Time) (PricePoint, string, error) {
+	return latestClose(ctx, s.prices, s.quotes, symbol, asOf)
+}
+
+func latestClose(ctx context.Context, store *PriceStore, quotes *LatestPriceService, symbol string, asOf time.Time) (PricePoint, string, error) {
+	// Valuations as of now use the latest quote
+	if time.Since(asOf) < time.Minute {
+		if quote, err := quotes.Quote(ctx, symbol); err == nil {
+			return PricePoint{Date: quote.AsOf, Close: quote.Price}, quote.Source, nil
+		}
+	}
+
+	prices, coverage, err := store.Query(ctx, HistoryQuery{Symbol: symbol, AsOf: asOf, Days: 1})
+	if err == nil && len(prices) > 0 {
+		return prices[0], coverage.Source, nil
+	}
+
+	return PricePoint{}, "", fmt.Errorf("no price for %s on or before %s", symbol, asOf.Format("2006-01-02"))
+}
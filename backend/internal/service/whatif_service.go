@@ -0,0 +1,298 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"github.com/reserveone/saa-risk-analyzer/internal/domain"
+	riskmath "github.com/reserveone/saa-risk-analyzer/internal/math"
+)
+
+// quantityEpsilon is the quantity below which a traded position is closed
+const quantityEpsilon = 1e-9
+
+// ErrInvalidTrade wraps the validation errors of what-if requests
+var ErrInvalidTrade = errors.New("invalid trade")
+
+// WhatIfState is a portfolio's risk and weights on one side of hypothetical
+// trades, which its limits are measured with
+type WhatIfState struct {
+	Observation RiskObservation
+	Portfolio   LimitPortfolio
+}
+
+// WhatIf calculates a portfolio's NAV, VaR, CVaR, volatility and risk
+// contributions before and after hypothetical trades, and checks its enabled
+// limits on both sides. Nothing is stored: the trades are applied to a copy
+// of the positions, and limit states and events are left as they are.
+func (s *RiskService) WhatIf(ctx context.Context, portfolioID uuid.UUID, req domain.WhatIfRequest) (*domain.WhatIfResponse, error) {
+	if req.Confidence == 0 {
+		req.Confidence = defaultSnapshotConfidence
+	}
+	if req.HorizonDays == 0 {
+		req.HorizonDays = 1
+	}
+	if req.WindowDays == 0 {
+		req.WindowDays = defaultSnapshotWindowDays
+	}
+	adjustment, err := riskmath.NormalizeAdjustment(req.Adjustment)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidTrade, err)
+	}
+	for i, trade := range req.Trades {
+		req.Trades[i].Symbol = strings.ToUpper(strings.TrimSpace(trade.Symbol))
+		if req.Trades[i].Symbol == "" || trade.Quantity == 0 {
+			return nil, fmt.Errorf("%w: trade %d needs a symbol and a non-zero quantity", ErrInvalidTrade, i+1)
+		}
+	}
+
+	before, err := s.loadPortfolio(portfolioID)
+	if err != nil {
+		return nil, err
+	}
+	assets, err := s.tradeAssets(before, req.Trades)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkTradeHistory(ctx, before, req.Trades, assets, req.WindowDays, adjustment); err != nil {
+		return nil, err
+	}
+	after := *before
+	after.Positions = ApplyTrades(before.Positions, req.Trades, assets)
+	if len(after.Positions) == 0 {
+		return nil, fmt.Errorf("%w: the trades close every position", ErrInvalidTrade)
+	}
+
+	beforeRisk, beforeState, err := s.whatIfRisk(ctx, before, req.Confidence, req.HorizonDays, req.WindowDays, adjustment)
+	if err != nil {
+		return nil, fmt.Errorf("before the trades: %w", err)
+	}
+	afterRisk, afterState, err := s.whatIfRisk(ctx, &after, req.Confidence, req.HorizonDays, req.WindowDays, adjustment)
+	if err != nil {
+		return nil, fmt.Errorf("after the trades: %w", err)
+	}
+
+	var limits []domain.RiskLimit
+	if err := s.db.Where("portfolio_id = ? AND enabled", portfolioID).Order("name").Find(&limits).Error; err != nil {
+		return nil, err
+	}
+	checks, breaches := CheckWhatIfLimits(limits, beforeState, afterState)
+
+	currency, err := NormalizeCurrency(before.BaseCurrency)
+	if err != nil {
+		return nil, err
+	}
+	return &domain.WhatIfResponse{
+		PortfolioID: portfolioID,
+		Currency:    currency,
+		Confidence:  req.Confidence,
+		HorizonDays: req.HorizonDays,
+		WindowDays:  req.WindowDays,
+		Adjustment:  adjustment,
+		Trades:      req.Trades,
+		Before:      *beforeRisk,
+		After:       *afterRisk,
+		Change: domain.WhatIfChange{
+			NAV:        afterRisk.NAV - beforeRisk.NAV,
+			VaR:        afterRisk.VaR - beforeRisk.VaR,
+			CVaR:       afterRisk.CVaR - beforeRisk.CVaR,
+			Volatility: afterRisk.Volatility - beforeRisk.Volatility,
+		},
+		Limits:   checks,
+		Breaches: breaches,
+	}, nil
+}
+
+// tradeAssets returns the assets of traded symbols that the portfolio does
+// not hold, by symbol. Symbols missing from the master are made up with
+// NewAsset, like ResolveAsset would, but not created.
+func (s *RiskService) tradeAssets(portfolio *domain.Portfolio, trades []domain.WhatIfTrade) (map[string]domain.Asset, error) {
+	held := make(map[string]bool, len(portfolio.Positions))
+	for _, pos := range portfolio.Positions {
+		held[strings.ToUpper(pos.Asset.Symbol)] = true
+	}
+	var symbols []string
+	for _, trade := range trades {
+		if !held[trade.Symbol] && !containsString(symbols, trade.Symbol) {
+			symbols = append(symbols, trade.Symbol)
+		}
+	}
+	assets := make(map[string]domain.Asset, len(symbols))
+	if len(symbols) == 0 {
+		return assets, nil
+	}
+
+	var found []domain.Asset
+	if err := s.db.Where("symbol IN ?", symbols).Find(&found).Error; err != nil {
+		return nil, err
+	}
+	for _, asset := range found {
+		assets[strings.ToUpper(asset.Symbol)] = asset
+	}
+	for _, symbol := range symbols {
+		if _, ok := assets[symbol]; !ok {
+			asset := NewAsset(symbol)
+			asset.ID = uuid.New()
+			assets[symbol] = asset
+		}
+	}
+	return assets, nil
+}
+
+// checkTradeHistory rejects trades in symbols the portfolio does not hold
+// that have no price history in the window. The risk calculation leaves such
+// assets out, so the trade would show no change in risk.
+func (s *RiskService) checkTradeHistory(ctx context.Context, portfolio *domain.Portfolio, trades []domain.WhatIfTrade, assets map[string]domain.Asset, windowDays int, adjustment string) error {
+	if len(assets) == 0 {
+		return nil
+	}
+	base, err := NormalizeCurrency(portfolio.BaseCurrency)
+	if err != nil {
+		return err
+	}
+	checked := make(map[string]bool, len(assets))
+	for _, trade := range trades {
+		asset, ok := assets[trade.Symbol]
+		if !ok || checked[trade.Symbol] {
+			continue
+		}
+		checked[trade.Symbol] = true
+		prices, err := s.baseHistory(ctx, asset, base, windowDays+1, adjustment)
+		if err != nil {
+			return fmt.Errorf("%w: no price history for %s: %v", ErrInvalidTrade, trade.Symbol, err)
+		}
+		if len(prices) < 2 {
+			return fmt.Errorf("%w: no price history for %s", ErrInvalidTrade, trade.Symbol)
+		}
+	}
+	return nil
+}
+
+// ApplyTrades returns a copy of positions with trades applied. A trade
+// changes the quantity of the first position in its symbol, or opens a new
+// position in the asset from assets at the trade's price; positions traded
+// to zero are closed. positions are left as they are.
+func ApplyTrades(positions []domain.Position, trades []domain.WhatIfTrade, assets map[string]domain.Asset) []domain.Position {
+	result := make([]domain.Position, len(positions))
+	copy(result, positions)
+
+	for _, trade := range trades {
+		symbol := strings.ToUpper(trade.Symbol)
+		found := false
+		for i := range result {
+			if strings.ToUpper(result[i].Asset.Symbol) == symbol {
+				result[i].Quantity += trade.Quantity
+				found = true
+				break
+			}
+		}
+		if found {
+			continue
+		}
+		asset := assets[symbol]
+		result = append(result, domain.Position{
+			ID:       uuid.New(),
+			AssetID:  asset.ID,
+			Asset:    asset,
+			Quantity: trade.Quantity,
+			AvgPrice: trade.Price,
+		})
+	}
+
+	open := result[:0]
+	for _, pos := range result {
+		if math.Abs(pos.Quantity) > quantityEpsilon {
+			open = append(open, pos)
+		}
+	}
+	return open
+}
+
+// whatIfRisk calculates the risk of a preloaded portfolio without the cache,
+// which is keyed by the stored positions. A portfolio without positions has
+// no risk.
+func (s *RiskService) whatIfRisk(ctx context.Context, portfolio *domain.Portfolio, confidence float64, horizonDays, windowDays int, adjustment string) (*domain.WhatIfRisk, WhatIfState, error) {
+	risk := &domain.WhatIfRisk{Contributions: []domain.AssetContribution{}}
+	state := WhatIfState{Observation: RiskObservation{Confidence: confidence, HorizonDays: horizonDays}}
+	if len(portfolio.Positions) == 0 {
+		var zero float64
+		state.Observation.VaR, state.Observation.CVaR = &zero, &zero
+		return risk, state, nil
+	}
+
+	varResult, weights, err := s.portfolioVaR(ctx, portfolio, confidence, horizonDays, windowDays, adjustment)
+	if err != nil {
+		return nil, state, fmt.Errorf("VaR: %w", err)
+	}
+	cvarResult, _, err := s.portfolioCVaR(ctx, portfolio, confidence, horizonDays, windowDays, adjustment)
+	if err != nil {
+		return nil, state, fmt.Errorf("CVaR: %w", err)
+	}
+	volatility, err := s.portfolioVolatility(ctx, portfolio, windowDays, adjustment)
+	if err != nil {
+		return nil, state, fmt.Errorf("volatility: %w", err)
+	}
+	data, err := s.alignPortfolio(ctx, portfolio, windowDays, adjustment)
+	if err != nil {
+		return nil, state, fmt.Errorf("risk contributions: %w", err)
+	}
+	contributions, err := riskContributions(data, confidence, horizonDays)
+	if err != nil {
+		return nil, state, fmt.Errorf("risk contributions: %w", err)
+	}
+
+	risk.NAV = weights.NAV
+	risk.VaR = varResult.VaR
+	risk.CVaR = cvarResult.CVaR
+	risk.Volatility = volatility
+	risk.Contributions = contributions.Contributions
+	state.Observation.VaR = &risk.VaR
+	state.Observation.CVaR = &risk.CVaR
+	state.Portfolio = weights
+	return risk, state, nil
+}
+
+// CheckWhatIfLimits measures limits before and after hypothetical trades,
+// without recording anything, and counts those in breach after them. Limits
+// measured on neither side, like stress loss limits, are left out.
+func CheckWhatIfLimits(limits []domain.RiskLimit, before, after WhatIfState) ([]domain.WhatIfLimit, int) {
+	checks := make([]domain.WhatIfLimit, 0, len(limits))
+	breaches := 0
+	for i := range limits {
+		limit := &limits[i]
+		check := domain.WhatIfLimit{
+			LimitID: limit.ID,
+			Name:    limit.Name,
+			Type:    limit.Type,
+			Before:  checkLimit(limit, before),
+			After:   checkLimit(limit, after),
+		}
+		if check.Before == nil && check.After == nil {
+			continue
+		}
+		if check.After != nil && check.After.State == LimitBreach {
+			breaches++
+			check.NewBreach = check.Before == nil || check.Before.State != LimitBreach
+		}
+		checks = append(checks, check)
+	}
+	return checks, breaches
+}
+
+func checkLimit(limit *domain.RiskLimit, state WhatIfState) *domain.LimitCheck {
+	value, utilization, detail, ok := MeasureLimit(limit, state.Observation, state.Portfolio)
+	if !ok {
+		return nil
+	}
+	return &domain.LimitCheck{
+		Value:       value,
+		Utilization: utilization,
+		State:       LimitState(utilization, limit.Warning),
+		Detail:      detail,
+	}
+}
@@ -0,0 +1,241 @@
+package service
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// TableReader streams the rows of an uploaded CSV or XLSX file
+type TableReader interface {
+	// Read returns the next row and its 1-based row number in the file, or
+	// io.EOF after the last row
+	Read() ([]string, int, error)
+}
+
+// NewTableReader picks a reader from the file name's extension. XLSX files
+// need random access, which multipart uploads provide.
+func NewTableReader(filename string, r io.ReaderAt, size int64) (TableReader, error) {
+	switch strings.ToLower(path.Ext(filename)) {
+	case ".csv", ".txt":
+		return newCSVTableReader(io.NewSectionReader(r, 0, size)), nil
+	case ".xlsx":
+		return newXLSXReader(r, size)
+	}
+	return nil, fmt.Errorf("unsupported file type %q, expected .csv or .xlsx", path.Ext(filename))
+}
+
+// xlsxReader streams the first worksheet of an XLSX workbook. Only cell
+// values are read; styles, formulas and further sheets are ignored.
+type xlsxReader struct {
+	sheet   io.ReadCloser
+	decoder *xml.Decoder
+	strings []string
+	rowNum  int
+}
+
+func newXLSXReader(r io.ReaderAt, size int64) (*xlsxReader, error) {
+	archive, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("invalid xlsx file: %w", err)
+	}
+	files := make(map[string]*zip.File, len(archive.File))
+	for _, f := range archive.File {
+		files[f.Name] = f
+	}
+
+	shared, err := readSharedStrings(files["xl/sharedStrings.xml"])
+	if err != nil {
+		return nil, err
+	}
+
+	sheetFile := files[firstSheetPath(files)]
+	if sheetFile == nil {
+		return nil, fmt.Errorf("invalid xlsx file: no worksheet")
+	}
+	sheet, err := sheetFile.Open()
+	if err != nil {
+		return nil, err
+	}
+
+	return &xlsxReader{
+		sheet:   sheet,
+		decoder: xml.NewDecoder(sheet),
+		strings: shared,
+	}, nil
+}
+
+func (x *xlsxReader) Read() ([]string, int, error) {
+	for {
+		token, err := x.decoder.Token()
+		if err == io.EOF {
+			x.sheet.Close()
+			return nil, 0, io.EOF
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+
+		start, ok := token.(xml.StartElement)
+		if !ok || start.Name.Local != "row" {
+			continue
+		}
+		x.rowNum++
+		if r := attr(start, "r"); r != "" {
+			if n, err := strconv.Atoi(r); err == nil {
+				x.rowNum = n
+			}
+		}
+
+		var row struct {
+			Cells []struct {
+				Ref    string `xml:"r,attr"`
+				Type   string `xml:"t,attr"`
+				Value  string `xml:"v"`
+				Inline struct {
+					Text []string `xml:"t"`
+					Runs []string `xml:"r>t"`
+				} `xml:"is"`
+			} `xml:"c"`
+		}
+		if err := x.decoder.DecodeElement(&row, &start); err != nil {
+			return nil, 0, err
+		}
+
+		var fields []string
+		for i, cell := range row.Cells {
+			col := i
+			if cell.Ref != "" {
+				var ok bool
+				if col, ok = columnIndex(cell.Ref); !ok {
+					return nil, 0, fmt.Errorf("row %d: invalid cell reference %q", x.rowNum, cell.Ref)
+				}
+			} else if col >= maxXLSXColumns {
+				return nil, 0, fmt.Errorf("row %d: more than %d columns", x.rowNum, maxXLSXColumns)
+			}
+			for len(fields) <= col {
+				fields = append(fields, "")
+			}
+
+			value := cell.Value
+			switch cell.Type {
+			case "s":
+				idx, err := strconv.Atoi(cell.Value)
+				if err != nil || idx < 0 || idx >= len(x.strings) {
+					return nil, 0, fmt.Errorf("row %d: invalid shared string %q", x.rowNum, cell.Value)
+				}
+				value = x.strings[idx]
+			case "inlineStr":
+				value = strings.Join(cell.Inline.Text, "") + strings.Join(cell.Inline.Runs, "")
+			}
+			fields[col] = value
+		}
+		return fields, x.rowNum, nil
+	}
+}
+
+// firstSheetPath resolves the first sheet listed in the workbook, falling
+// back to the first worksheet part by name
+func firstSheetPath(files map[string]*zip.File) string {
+	var workbook struct {
+		Sheets []struct {
+			ID string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+		} `xml:"sheets>sheet"`
+	}
+	var rels struct {
+		Relationships []struct {
+			ID     string `xml:"Id,attr"`
+			Target string `xml:"Target,attr"`
+		} `xml:"Relationship"`
+	}
+	if decodeZipXML(files["xl/workbook.xml"], &workbook) == nil &&
+		decodeZipXML(files["xl/_rels/workbook.xml.rels"], &rels) == nil &&
+		len(workbook.Sheets) > 0 {
+		for _, rel := range rels.Relationships {
+			if rel.ID == workbook.Sheets[0].ID {
+				if strings.HasPrefix(rel.Target, "/") {
+					return strings.TrimPrefix(rel.Target, "/")
+				}
+				return path.Join("xl", rel.Target)
+			}
+		}
+	}
+
+	var sheets []string
+	for name := range files {
+		if strings.HasPrefix(name, "xl/worksheets/") && strings.HasSuffix(name, ".xml") {
+			sheets = append(sheets, name)
+		}
+	}
+	sort.Strings(sheets)
+	if len(sheets) == 0 {
+		return ""
+	}
+	return sheets[0]
+}
+
+func readSharedStrings(f *zip.File) ([]string, error) {
+	if f == nil {
+		return nil, nil
+	}
+	var sst struct {
+		Items []struct {
+			Text []string `xml:"t"`
+			Runs []string `xml:"r>t"`
+		} `xml:"si"`
+	}
+	if err := decodeZipXML(f, &sst); err != nil {
+		return nil, fmt.Errorf("invalid xlsx shared strings: %w", err)
+	}
+
+	shared := make([]string, len(sst.Items))
+	for i, item := range sst.Items {
+		shared[i] = strings.Join(item.Text, "") + strings.Join(item.Runs, "")
+	}
+	return shared, nil
+}
+
+func decodeZipXML(f *zip.File, v interface{}) error {
+	if f == nil {
+		return fmt.Errorf("missing part")
+	}
+	r, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	return xml.NewDecoder(r).Decode(v)
+}
+
+// maxXLSXColumns is the number of columns in a worksheet, A to XFD
+const maxXLSXColumns = 16384
+
+// columnIndex converts a cell reference such as "AB12" to a 0-based column.
+// References without column letters or beyond XFD are invalid.
+func columnIndex(ref string) (int, bool) {
+	col := 0
+	for _, ch := range ref {
+		if ch < 'A' || ch > 'Z' {
+			break
+		}
+		col = col*26 + int(ch-'A') + 1
+		if col > maxXLSXColumns {
+			return 0, false
+		}
+	}
+	return col - 1, col > 0
+}
+
+func attr(start xml.StartElement, name string) string {
+	for _, a := range start.Attr {
+		if a.Name.Local == name {
+			return a.Value
+		}
+	}
+	return ""
+}
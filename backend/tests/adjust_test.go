@@ -0,0 +1,76 @@
+package tests
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	riskmath "github.com/reserveone/saa-risk-analyzer/internal/math"
+)
+
+func adjustFixture() []riskmath.PricePoint {
+	start := time.Date(2024, 6, 3, 0, 0, 0, 0, time.UTC)
+	closes := []float64{100, 102, 51, 52, 50}
+	prices := make([]riskmath.PricePoint, len(closes))
+	for i, c := range closes {
+		prices[i] = riskmath.PricePoint{Date: start.AddDate(0, 0, i), Close: c}
+	}
+	return prices
+}
+
+func TestAdjustPricesSplit(t *testing.T) {
+	prices := adjustFixture()
+	split := []riskmath.CorporateAction{{ExDate: prices[2].Date, SplitRatio: 2}}
+
+	adjusted := riskmath.AdjustPrices(prices, split, riskmath.AdjustmentPriceReturn)
+	expected := []float64{50, 51, 51, 52, 50}
+	for i := range expected {
+		if math.Abs(adjusted[i].Close-expected[i]) > 1e-9 {
+			t.Errorf("Expected close %d to be %v, got %v", i, expected[i], adjusted[i].Close)
+		}
+	}
+	if prices[0].Close != 100 {
+		t.Errorf("Expected input prices to be left unchanged")
+	}
+
+	// The split no longer shows up as a -50% return
+	returns := riskmath.CalculateReturns(adjusted, false)
+	if math.Abs(returns[1]) > 1e-9 {
+		t.Errorf("Expected a flat return across the split, got %v", returns[1])
+	}
+
+	raw := riskmath.AdjustPrices(prices, split, riskmath.AdjustmentNone)
+	if raw[0].Close != 100 {
+		t.Errorf("Expected raw closes with no adjustment, got %v", raw[0].Close)
+	}
+}
+
+func TestAdjustPricesDividend(t *testing.T) {
+	prices := adjustFixture()
+	dividend := []riskmath.CorporateAction{{ExDate: prices[4].Date, Dividend: 2.6}}
+
+	priceReturn := riskmath.AdjustPrices(prices, dividend, riskmath.AdjustmentPriceReturn)
+	if priceReturn[3].Close != 52 {
+		t.Errorf("Expected price return to ignore dividends, got %v", priceReturn[3].Close)
+	}
+
+	// Back-adjusting by 1 - D/P turns the 52 -> 50 ex-date drop into 50 / (52 - 2.6)
+	totalReturn := riskmath.AdjustPrices(prices, dividend, riskmath.AdjustmentTotalReturn)
+	returns := riskmath.CalculateReturns(totalReturn, false)
+	expected := 50/(52-2.6) - 1
+	if math.Abs(returns[3]-expected) > 1e-9 {
+		t.Errorf("Expected ex-date total return %v, got %v", expected, returns[3])
+	}
+	if totalReturn[4].Close != 50 {
+		t.Errorf("Expected the latest close to be unchanged, got %v", totalReturn[4].Close)
+	}
+}
+
+func TestNormalizeAdjustment(t *testing.T) {
+	if basis, err := riskmath.NormalizeAdjustment(""); err != nil || basis != riskmath.AdjustmentTotalReturn {
+		t.Errorf("Expected total_return by default, got %q, %v", basis, err)
+	}
+	if _, err := riskmath.NormalizeAdjustment("dividends"); err == nil {
+		t.Errorf("Expected an error for an unknown adjustment")
+	}
+}
@@ -0,0 +1,207 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/reserveone/saa-risk-analyzer/internal/service"
+)
+
+func TestCacheKey(t *testing.T) {
+	a, err := service.CacheKey("var", []interface{}{0.99, 1, 250, "total_return"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := service.CacheKey("var", []interface{}{0.99, 1, 250, "total_return"})
+	c, _ := service.CacheKey("var", []interface{}{0.95, 1, 250, "total_return"})
+	d, _ := service.CacheKey("cvar", []interface{}{0.99, 1, 250, "total_return"})
+	if a != b {
+		t.Errorf("Expected identical inputs to share a key")
+	}
+	if a == c || a == d {
+		t.Errorf("Expected different parameters or calculations to have different keys")
+	}
+	if len(a) != 64 {
+		t.Errorf("Expected a hex SHA-256, got %q", a)
+	}
+}
+
+func TestComputeCacheReusesResults(t *testing.T) {
+	cache := service.NewComputeCache(time.Minute, 2)
+	calls := 0
+	compute := func(value int) func(context.Context) (interface{}, error) {
+		return func(context.Context) (interface{}, error) {
+			calls++
+			return value, nil
+		}
+	}
+
+	for i := 0; i < 3; i++ {
+		v, err := cache.Do(context.Background(), "a", compute(1))
+		if err != nil || v != 1 {
+			t.Fatalf("Expected 1, got %v, %v", v, err)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("Expected one calculation, got %d", calls)
+	}
+
+	// Errors are not cached
+	failed := errors.New("no prices")
+	if _, err := cache.Do(context.Background(), "b", func(context.Context) (interface{}, error) { return nil, failed }); !errors.Is(err, failed) {
+		t.Errorf("Expected the calculation error, got %v", err)
+	}
+	if v, _ := cache.Do(context.Background(), "b", compute(2)); v != 2 {
+		t.Errorf("Expected the failed calculation to run again, got %v", v)
+	}
+
+	// The cache is bounded: a third key evicts the result expiring first
+	cache.Do(context.Background(), "c", compute(3))
+	if stats := cache.Stats(); stats.Entries != 2 || stats.Hits != 2 || stats.Misses != 4 {
+		t.Errorf("Expected 2 entries, 2 hits and 4 misses, got %+v", stats)
+	}
+	calls = 0
+	cache.Do(context.Background(), "a", compute(1))
+	if calls != 1 {
+		t.Errorf("Expected the evicted result to be calculated again")
+	}
+
+	cache.Purge()
+	if stats := cache.Stats(); stats.Entries != 0 {
+		t.Errorf("Expected an empty cache after purge, got %d entries", stats.Entries)
+	}
+}
+
+func TestComputeCacheExpiry(t *testing.T) {
+	cache := service.NewComputeCache(20*time.Millisecond, 10)
+	var calls int32
+	compute := func(context.Context) (interface{}, error) {
+		return atomic.AddInt32(&calls, 1), nil
+	}
+
+	cache.Do(context.Background(), "a", compute)
+	cache.Do(context.Background(), "a", compute)
+	time.Sleep(30 * time.Millisecond)
+	if v, _ := cache.Do(context.Background(), "a", compute); v != int32(2) {
+		t.Errorf("Expected the expired result to be calculated again, got %v", v)
+	}
+
+	// Without a TTL nothing is kept
+	uncached := service.NewComputeCache(0, 10)
+	uncached.Do(context.Background(), "a", compute)
+	if v, _ := uncached.Do(context.Background(), "a", compute); v != int32(4) {
+		t.Errorf("Expected every call to calculate without a TTL, got %v", v)
+	}
+}
+
+func TestComputeCacheDeduplicates(t *testing.T) {
+	cache := service.NewComputeCache(time.Minute, 10)
+	var calls int32
+	release := make(chan struct{})
+	compute := func(context.Context) (interface{}, error) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		return "result", nil
+	}
+
+	var wg sync.WaitGroup
+	results := make([]interface{}, 10)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], _ = cache.Do(context.Background(), "a", compute)
+		}(i)
+	}
+	// Let every caller join the calculation before it finishes
+	for cache.Stats().Shared < 9 {
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	wg.Wait()
+
+	if calls != 1 {
+		t.Errorf("Expected concurrent identical calls to calculate once, got %d", calls)
+	}
+	for i, result := range results {
+		if result != "result" {
+			t.Errorf("Caller %d: expected the shared result, got %v", i, result)
+		}
+	}
+}
+
+func TestComputeCacheCancelledCaller(t *testing.T) {
+	cache := service.NewComputeCache(time.Minute, 10)
+	started := make(chan struct{})
+	leader, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		_, err := cache.Do(leader, "a", func(ctx context.Context) (interface{}, error) {
+			close(started)
+			<-ctx.Done()
+			return nil, ctx.Err()
+		})
+		done <- err
+	}()
+	<-started
+
+	// A caller waiting on a calculation whose caller went away calculates
+	// itself
+	waiter := make(chan interface{}, 1)
+	go func() {
+		v, _ := cache.Do(context.Background(), "a", func(context.Context) (interface{}, error) {
+			return "recalculated", nil
+		})
+		waiter <- v
+	}()
+	for cache.Stats().Shared < 1 {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected the cancelled caller to get its error, got %v", err)
+	}
+	if v := <-waiter; v != "recalculated" {
+		t.Errorf("Expected the waiting caller to calculate, got %v", v)
+	}
+
+	// A waiting caller may give up without affecting the calculation
+	release := make(chan struct{})
+	go cache.Do(context.Background(), "b", func(context.Context) (interface{}, error) {
+		<-release
+		return "b", nil
+	})
+	for cache.Stats().Misses < 3 {
+		time.Sleep(time.Millisecond)
+	}
+	impatient, stop := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer stop()
+	if _, err := cache.Do(impatient, "b", nil); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected the waiting caller to time out, got %v", err)
+	}
+	close(release)
+}
+
+func TestComputeCachePanic(t *testing.T) {
+	cache := service.NewComputeCache(time.Minute, 10)
+	_, err := cache.Do(context.Background(), "a", func(context.Context) (interface{}, error) {
+		panic("boom")
+	})
+	if err == nil || !strings.Contains(err.Error(), "boom") {
+		t.Fatalf("Expected the panic as an error, got %v", err)
+	}
+
+	// The failed flight is gone, so the next caller calculates
+	v, err := cache.Do(context.Background(), "a", func(context.Context) (interface{}, error) {
+		return "a", nil
+	})
+	if err != nil || v != "a" {
+		t.Errorf("Expected a new calculation, got %v, %v", v, err)
+	}
+}
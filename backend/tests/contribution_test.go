@@ -0,0 +1,82 @@
+package tests
+
+import (
+	"math"
+	"testing"
+
+	"gonum.org/v1/gonum/mat"
+
+	riskmath "github.com/reserveone/saa-risk-analyzer/internal/math"
+)
+
+func TestRiskContributions(t *testing.T) {
+	// vols 0.02 and 0.03, correlation 0.2
+	cov := mat.NewSymDense(2, []float64{
+		0.0004, 0.00012,
+		0.00012, 0.0009,
+	})
+	exposures := []float64{600000, 400000}
+
+	result, err := riskmath.RiskContributions(exposures, cov, 0.99, 10)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	expected := riskmath.DeltaNormalVaR(exposures, cov, 0.99, 10)
+	if math.Abs(result.VaR-expected) > 1e-6 {
+		t.Errorf("Expected VaR %f, got %f", expected, result.VaR)
+	}
+
+	sum := 0.0
+	for i, component := range result.Component {
+		sum += component
+		if math.Abs(component-exposures[i]*result.Marginal[i]) > 1e-6 {
+			t.Errorf("Expected component %d to be exposure times marginal VaR", i)
+		}
+	}
+	if math.Abs(sum-result.VaR) > 1e-6 {
+		t.Errorf("Expected components to sum to VaR %f, got %f", result.VaR, sum)
+	}
+
+	// The marginal VaR is the derivative of VaR in the exposure
+	bumped := []float64{exposures[0] + 1, exposures[1]}
+	numeric := riskmath.DeltaNormalVaR(bumped, cov, 0.99, 10) - expected
+	if math.Abs(numeric-result.Marginal[0]) > 1e-4 {
+		t.Errorf("Expected marginal VaR %f, got %f", numeric, result.Marginal[0])
+	}
+
+	if _, err := riskmath.RiskContributions([]float64{1}, cov, 0.99, 1); err == nil {
+		t.Errorf("Expected an error for mismatched dimensions")
+	}
+}
+
+func TestRollingVaRBacktest(t *testing.T) {
+	returns := make([]float64, 300)
+	for i := range returns {
+		returns[i] = 0.01 * math.Sin(float64(i)*0.7)
+	}
+	returns[280] = -0.2
+
+	estimates, err := riskmath.RollingVaR(returns, 100, 0.99, "historical")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(estimates) != 200 {
+		t.Fatalf("Expected 200 estimates, got %d", len(estimates))
+	}
+
+	result, err := riskmath.BacktestVaR(returns[100:], estimates, 0.99)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if result.Exceedances < 1 {
+		t.Errorf("Expected the -20%% return to exceed VaR")
+	}
+
+	if _, err := riskmath.RollingVaR(returns, 100, 0.99, "garch"); err == nil {
+		t.Errorf("Expected an error for an unknown method")
+	}
+	if _, err := riskmath.RollingVaR(returns[:50], 100, 0.99, "parametric"); err == nil {
+		t.Errorf("Expected an error for a window longer than the history")
+	}
+}
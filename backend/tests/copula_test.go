@@ -0,0 +1,68 @@
+package tests
+
+import (
+	"math"
+	"math/rand/v2"
+	"testing"
+
+	riskmath "github.com/reserveone/saa-risk-analyzer/internal/math"
+)
+
+// fatTailedReturns draws correlated Student-t returns with 4 degrees of freedom
+func fatTailedReturns(n int) [][]float64 {
+	rng := rand.New(rand.NewPCG(1, 2))
+	returns := [][]float64{make([]float64, n), make([]float64, n)}
+	for t := 0; t < n; t++ {
+		w := 0.0
+		for k := 0; k < 4; k++ {
+			g := rng.NormFloat64()
+			w += g * g
+		}
+		mix := math.Sqrt(2 / w) // scaled to unit variance
+		z1, z2 := rng.NormFloat64(), rng.NormFloat64()
+		returns[0][t] = 0.01 * z1 * mix
+		returns[1][t] = 0.03 * (0.7*z1 + math.Sqrt(1-0.49)*z2) * mix
+	}
+	return returns
+}
+
+func TestDependenceModels(t *testing.T) {
+	assetReturns := fatTailedReturns(500)
+	weights := []float64{0.6, 0.4}
+
+	results := map[string]*riskmath.MonteCarloResult{}
+	for _, model := range []string{
+		riskmath.DependenceNormal,
+		riskmath.DependenceStudentT,
+		riskmath.DependenceGaussianCopula,
+		riskmath.DependenceTCopula,
+	} {
+		result, err := riskmath.RunMonteCarlo(assetReturns, weights, 0.99, 1, riskmath.MonteCarloConfig{
+			Simulations: 20000,
+			Seed:        11,
+			Dependence:  model,
+			Marginals:   riskmath.MarginalStudentT,
+		})
+		if err != nil {
+			t.Fatalf("%s: expected no error, got %v", model, err)
+		}
+		if result.Dependence == nil || result.Dependence.Model != model {
+			t.Fatalf("%s: expected fitted parameters to be reported", model)
+		}
+		if result.ES < result.VaR {
+			t.Errorf("%s: expected ES >= VaR, got ES %f VaR %f", model, result.ES, result.VaR)
+		}
+		results[model] = result
+		t.Logf("%s: VaR %f ES %f df %g", model, result.VaR, result.ES, result.Dependence.DegreesOfFreedom)
+	}
+
+	if df := results[riskmath.DependenceStudentT].Dependence.DegreesOfFreedom; df > 10 {
+		t.Errorf("Expected a fat-tailed fit for t(4) data, got %g degrees of freedom", df)
+	}
+	if rho := results[riskmath.DependenceTCopula].Dependence.Correlation[0][1]; math.Abs(rho-0.7) > 0.15 {
+		t.Errorf("Expected copula correlation near 0.7, got %f", rho)
+	}
+	if results[riskmath.DependenceStudentT].ES <= results[riskmath.DependenceNormal].ES {
+		t.Errorf("Expected Student-t ES above normal ES")
+	}
+}
@@ -0,0 +1,75 @@
+package tests
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	riskmath "github.com/reserveone/saa-risk-analyzer/internal/math"
+	"github.com/reserveone/saa-risk-analyzer/internal/service"
+)
+
+func TestConvertPrices(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2024, 3, d, 0, 0, 0, 0, time.UTC) }
+
+	// Friday 1st to Monday 4th, with crypto closes over the weekend
+	prices := []riskmath.PricePoint{
+		{Date: day(1), Close: 100},
+		{Date: day(2), Close: 100},
+		{Date: day(3), Close: 100},
+		{Date: day(4), Close: 100},
+	}
+	// EUR per USD, with no rates over the weekend
+	rates := []riskmath.PricePoint{
+		{Date: day(4), Close: 0.92},
+		{Date: day(1), Close: 0.9},
+	}
+
+	converted := riskmath.ConvertPrices(prices, rates)
+	expected := []float64{90, 90, 90, 92}
+	if len(converted) != len(expected) {
+		t.Fatalf("Expected %d converted prices, got %d", len(expected), len(converted))
+	}
+	for i := range expected {
+		if math.Abs(converted[i].Close-expected[i]) > 1e-9 {
+			t.Errorf("Expected converted close %d to be %v, got %v", i, expected[i], converted[i].Close)
+		}
+	}
+
+	// A flat local price still has the FX return in base currency
+	returns := riskmath.CalculateReturns(converted, false)
+	if math.Abs(returns[2]-(0.92/0.9-1)) > 1e-9 {
+		t.Errorf("Expected the FX return in base currency, got %v", returns[2])
+	}
+
+	// Closes before the first rate cannot be converted
+	if late := riskmath.ConvertPrices(prices, rates[:1]); len(late) != 1 {
+		t.Errorf("Expected only closes on or after the first rate, got %d", len(late))
+	}
+
+	inverted := riskmath.InvertRates(rates)
+	if math.Abs(inverted[1].Close-1/0.9) > 1e-9 {
+		t.Errorf("Expected inverted rate %v, got %v", 1/0.9, inverted[1].Close)
+	}
+}
+
+func TestNormalizeCurrency(t *testing.T) {
+	if currency, err := service.NormalizeCurrency(""); err != nil || currency != "USD" {
+		t.Errorf("Expected USD by default, got %q, %v", currency, err)
+	}
+	if currency, err := service.NormalizeCurrency(" eur "); err != nil || currency != "EUR" {
+		t.Errorf("Expected EUR, got %q, %v", currency, err)
+	}
+	for _, invalid := range []string{"EURO", "E1R"} {
+		if _, err := service.NormalizeCurrency(invalid); err == nil {
+			t.Errorf("Expected an error for %q", invalid)
+		}
+	}
+
+	if currency := service.CurrencyOf("EURGBP"); currency != "GBP" {
+		t.Errorf("Expected FX pairs to be quoted in their second currency, got %s", currency)
+	}
+	if currency := service.CurrencyOf("SPY"); currency != "USD" {
+		t.Errorf("Expected USD for other assets, got %s", currency)
+	}
+}
@@ -0,0 +1,133 @@
+package tests
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/reserveone/saa-risk-analyzer/internal/service"
+)
+
+func readAll(t *testing.T, rows service.TableReader) ([][]string, []int) {
+	t.Helper()
+	var records [][]string
+	var rowNums []int
+	for {
+		fields, rowNum, err := rows.Read()
+		if err == io.EOF {
+			return records, rowNums
+		}
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		records = append(records, append([]string(nil), fields...))
+		rowNums = append(rowNums, rowNum)
+	}
+}
+
+func TestCSVTableReader(t *testing.T) {
+	data := "date,symbol,close\n2021-01-04,SPY,373.88\n\n2021-01-05,SPY,375.96\n"
+	rows, err := service.NewTableReader("prices.csv", strings.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	records, rowNums := readAll(t, rows)
+	if len(records) != 3 || records[2][2] != "375.96" {
+		t.Errorf("Unexpected records %v", records)
+	}
+	// Row numbers are file lines, so errors point at the right row
+	if !reflect.DeepEqual(rowNums, []int{1, 2, 4}) {
+		t.Errorf("Expected line numbers [1 2 4], got %v", rowNums)
+	}
+
+	if _, err := service.NewTableReader("prices.json", strings.NewReader(data), int64(len(data))); err == nil {
+		t.Errorf("Expected an error for an unsupported file type")
+	}
+}
+
+// xlsxFile zips parts into an XLSX workbook
+func xlsxFile(t *testing.T, parts map[string]string) *bytes.Reader {
+	t.Helper()
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	for name, content := range parts {
+		w, err := archive.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(content))
+	}
+	if err := archive.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return bytes.NewReader(buf.Bytes())
+}
+
+func TestXLSXTableReader(t *testing.T) {
+	parts := map[string]string{
+		"xl/workbook.xml": `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+			`<sheets><sheet name="Positions" sheetId="1" r:id="rId1"/></sheets></workbook>`,
+		"xl/_rels/workbook.xml.rels": `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			`<Relationship Id="rId1" Type="worksheet" Target="worksheets/sheet1.xml"/></Relationships>`,
+		"xl/sharedStrings.xml": `<sst xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` +
+			`<si><t>symbol</t></si><si><t>quantity</t></si><si><r><t>avg_</t></r><r><t>price</t></r></si><si><t>SPY</t></si></sst>`,
+		"xl/worksheets/sheet1.xml": `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>` +
+			`<row r="1"><c r="A1" t="s"><v>0</v></c><c r="B1" t="s"><v>1</v></c><c r="C1" t="s"><v>2</v></c></row>` +
+			`<row r="2"><c r="A2" t="s"><v>3</v></c><c r="B2"><v>1000</v></c><c r="C2"><v>370</v></c></row>` +
+			`<row r="4"><c r="A4" t="inlineStr"><is><t>TLT</t></is></c><c r="C4"><v>155.5</v></c></row>` +
+			`</sheetData></worksheet>`,
+	}
+	file := xlsxFile(t, parts)
+
+	rows, err := service.NewTableReader("positions.xlsx", file, file.Size())
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	records, rowNums := readAll(t, rows)
+	expected := [][]string{
+		{"symbol", "quantity", "avg_price"},
+		{"SPY", "1000", "370"},
+		{"TLT", "", "155.5"},
+	}
+	if !reflect.DeepEqual(records, expected) {
+		t.Errorf("Expected %v, got %v", expected, records)
+	}
+	if !reflect.DeepEqual(rowNums, []int{1, 2, 4}) {
+		t.Errorf("Expected row numbers [1 2 4], got %v", rowNums)
+	}
+}
+
+func TestXLSXTableReaderCellReferences(t *testing.T) {
+	for _, ref := range []string{"1", "a1", "XFE1", "ZZZZZZZZZZ1"} {
+		file := xlsxFile(t, map[string]string{
+			"xl/worksheets/sheet1.xml": `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>` +
+				`<row r="1"><c r="` + ref + `"><v>1</v></c></row></sheetData></worksheet>`,
+		})
+		rows, err := service.NewTableReader("positions.xlsx", file, file.Size())
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if _, _, err := rows.Read(); err == nil || !strings.Contains(err.Error(), "row 1") {
+			t.Errorf("Expected a row error for cell reference %q, got %v", ref, err)
+		}
+	}
+
+	// The last column is XFD
+	file := xlsxFile(t, map[string]string{
+		"xl/worksheets/sheet1.xml": `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>` +
+			`<row r="1"><c r="XFD1"><v>1</v></c></row></sheetData></worksheet>`,
+	})
+	rows, err := service.NewTableReader("positions.xlsx", file, file.Size())
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	fields, _, err := rows.Read()
+	if err != nil || len(fields) != 16384 || fields[16383] != "1" {
+		t.Errorf("Expected the value in column 16384, got %d fields, %v", len(fields), err)
+	}
+}
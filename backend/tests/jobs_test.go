@@ -0,0 +1,739 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/reserveone/saa-risk-analyzer/internal/domain"
+	"github.com/reserveone/saa-risk-analyzer/internal/jobs"
+)
+
+// memoryStore keeps copies of jobs in memory, claiming them as the database
+// store does
+type memoryStore struct {
+	mu     sync.Mutex
+	jobs   map[uuid.UUID]domain.Job
+	order  []uuid.UUID // creation order
+	events []domain.JobEvent
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{jobs: make(map[uuid.UUID]domain.Job)}
+}
+
+func (s *memoryStore) Create(job *domain.Job) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job.CreatedAt = time.Now()
+	s.jobs[job.ID] = *job
+	s.order = append(s.order, job.ID)
+	return nil
+}
+
+func (s *memoryStore) Get(id uuid.UUID) (*domain.Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job, ok := s.jobs[id]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &job, nil
+}
+
+func (s *memoryStore) List(filter jobs.Filter) ([]domain.Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var list []domain.Job
+	for _, job := range s.jobs {
+		if (filter.Type == "" || job.Type == filter.Type) && (filter.Status == "" || job.Status == filter.Status) {
+			list = append(list, job)
+		}
+	}
+	return list, nil
+}
+
+func (s *memoryStore) Pending() (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var count int64
+	for _, job := range s.jobs {
+		if job.Status == jobs.StatusQueued {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (s *memoryStore) Claim(worker string, now time.Time) (*domain.Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rank := map[string]int{jobs.PriorityHigh: 0, jobs.PriorityNormal: 1, jobs.PriorityLow: 2}
+	var next *domain.Job
+	for _, id := range s.order {
+		job := s.jobs[id]
+		if job.Status != jobs.StatusQueued || job.RunAfter.After(now) {
+			continue
+		}
+		if next == nil || rank[job.Priority] < rank[next.Priority] {
+			next = &job
+		}
+	}
+	if next == nil {
+		return nil, nil
+	}
+
+	next.Status = jobs.StatusRunning
+	next.WorkerID = worker
+	next.Attempts++
+	next.StartedAt = &now
+	next.HeartbeatAt = &now
+	s.jobs[next.ID] = *next
+	return next, nil
+}
+
+func (s *memoryStore) Save(job *domain.Job, worker string, columns ...string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stored := s.jobs[job.ID]
+	if stored.WorkerID != worker || stored.Status != jobs.StatusRunning {
+		return false, nil
+	}
+	job.CancelRequested = stored.CancelRequested
+	s.jobs[job.ID] = *job
+	return true, nil
+}
+
+func (s *memoryStore) Heartbeat(worker string, ids []uuid.UUID, now time.Time) ([]uuid.UUID, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var cancelled []uuid.UUID
+	for _, id := range ids {
+		job := s.jobs[id]
+		if job.WorkerID != worker || job.Status != jobs.StatusRunning {
+			continue
+		}
+		job.HeartbeatAt = &now
+		s.jobs[id] = job
+		if job.CancelRequested {
+			cancelled = append(cancelled, id)
+		}
+	}
+	return cancelled, nil
+}
+
+func (s *memoryStore) Cancel(id uuid.UUID, now time.Time) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job, ok := s.jobs[id]
+	switch {
+	case !ok:
+		return "", gorm.ErrRecordNotFound
+	case job.Status == jobs.StatusQueued:
+		job.Status = jobs.StatusCancelled
+		job.FinishedAt = &now
+	case job.Status == jobs.StatusRunning:
+		job.CancelRequested = true
+	default:
+		return job.Status, jobs.ErrJobFinished
+	}
+	s.jobs[id] = job
+	return job.Status, nil
+}
+
+func (s *memoryStore) RequeueStale(staleBefore, now time.Time, backoff func(attempts int) time.Duration) (int, int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	requeued, failed := 0, 0
+	for id, job := range s.jobs {
+		if job.Status != jobs.StatusRunning || (job.HeartbeatAt != nil && !job.HeartbeatAt.Before(staleBefore)) {
+			continue
+		}
+		job.WorkerID = ""
+		job.HeartbeatAt = nil
+		if job.Attempts >= job.MaxAttempts {
+			job.Status = jobs.StatusFailed
+			job.Error = "worker lost, no attempts left"
+			failed++
+		} else {
+			job.Status = jobs.StatusQueued
+			job.RunAfter = now.Add(backoff(job.Attempts))
+			requeued++
+		}
+		s.jobs[id] = job
+	}
+	return requeued, failed, nil
+}
+
+func (s *memoryStore) AddEvent(event *domain.JobEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	event.ID = uint64(len(s.events) + 1)
+	event.CreatedAt = time.Now()
+	s.events = append(s.events, *event)
+	return nil
+}
+
+func (s *memoryStore) Events(jobID uuid.UUID, after uint64) ([]domain.JobEvent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var events []domain.JobEvent
+	for _, event := range s.events {
+		if event.JobID == jobID && event.ID > after {
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
+
+// waitForStatus polls a job until it reaches a final status
+func waitForStatus(t *testing.T, store *memoryStore, id uuid.UUID) *domain.Job {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		job, err := store.Get(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		switch job.Status {
+		case jobs.StatusSucceeded, jobs.StatusFailed, jobs.StatusCancelled:
+			return job
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("Job %s did not finish", id)
+	return nil
+}
+
+// testJob is the input of the blocking test job
+type testJob struct {
+	Name string `json:"name"`
+}
+
+// blockingJob runs until release is closed or its context is done,
+// announcing its input's name on started
+func blockingJob(release <-chan struct{}, started chan<- string) jobs.JobFunc {
+	return jobs.Typed(func(ctx context.Context, req testJob) (testJob, error) {
+		if started != nil {
+			started <- req.Name
+		}
+		select {
+		case <-release:
+			return req, nil
+		case <-ctx.Done():
+			return req, ctx.Err()
+		}
+	})
+}
+
+// newTestQueue returns a queue of blocking test jobs polling store every
+// millisecond
+func newTestQueue(store jobs.Store, cfg jobs.Config, release <-chan struct{}, started chan<- string) *jobs.Queue {
+	cfg.PollInterval = time.Millisecond
+	queue := jobs.NewQueueWithStore(store, cfg)
+	queue.Register(jobs.TypeVaR, blockingJob(release, started))
+	return queue
+}
+
+func TestJobResult(t *testing.T) {
+	response := &domain.RiskContributionResponse{
+		VaR:           1250.5,
+		Contributions: []domain.AssetContribution{{Symbol: "SPY", Component: 1250.5, Percentage: 1}},
+		Currency:      "USD",
+	}
+
+	result, err := jobs.Result(response)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if result["var"] != 1250.5 || result["currency"] != "USD" {
+		t.Errorf("Expected the response fields by their JSON names, got %v", result)
+	}
+	contributions, ok := result["contributions"].([]interface{})
+	if !ok || len(contributions) != 1 {
+		t.Fatalf("Expected 1 contribution, got %v", result["contributions"])
+	}
+	if contributions[0].(map[string]interface{})["symbol"] != "SPY" {
+		t.Errorf("Expected the SPY contribution, got %v", contributions[0])
+	}
+	if result["job_id"] != uuid.Nil.String() {
+		t.Errorf("Expected the unset job ID, got %v", result["job_id"])
+	}
+}
+
+func TestTypedJob(t *testing.T) {
+	fn := jobs.Typed(func(ctx context.Context, req domain.VaRRequest) (*domain.VaRResponse, error) {
+		return &domain.VaRResponse{VaR: req.Confidence * 100, Adjustment: req.Adjustment}, nil
+	})
+
+	input, _ := json.Marshal(domain.VaRRequest{Confidence: 0.99, Adjustment: "total_return"})
+	job := &domain.Job{ID: uuid.New(), Input: input}
+	result, err := fn(context.Background(), job)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if result["var"] != 99.0 || result["adjustment"] != "total_return" {
+		t.Errorf("Expected the response computed from the stored request, got %v", result)
+	}
+	if result["job_id"] != job.ID {
+		t.Errorf("Expected the job ID in the result, got %v", result["job_id"])
+	}
+
+	job.Input = json.RawMessage(`{"confidence": "high"}`)
+	if _, err := fn(context.Background(), job); err == nil || !strings.Contains(err.Error(), "invalid job input") {
+		t.Errorf("Expected an invalid input error, got %v", err)
+	}
+}
+
+func TestQueueBoundsConcurrency(t *testing.T) {
+	store := newMemoryStore()
+	queue := jobs.NewQueueWithStore(store, jobs.Config{Workers: 2, PollInterval: time.Millisecond})
+	defer queue.Close()
+
+	var mu sync.Mutex
+	running, peak := 0, 0
+	release := make(chan struct{})
+	queue.Register(jobs.TypeVaR, func(ctx context.Context, job *domain.Job) (map[string]interface{}, error) {
+		mu.Lock()
+		running++
+		if running > peak {
+			peak = running
+		}
+		mu.Unlock()
+		<-release
+		mu.Lock()
+		running--
+		mu.Unlock()
+		return map[string]interface{}{}, nil
+	})
+	queue.Start()
+
+	ids := make([]uuid.UUID, 5)
+	for i := range ids {
+		job, err := queue.Enqueue(jobs.TypeVaR, testJob{}, jobs.Options{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids[i] = job.ID
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+
+	for _, id := range ids {
+		if job := waitForStatus(t, store, id); job.Status != jobs.StatusSucceeded || job.Progress != 100 {
+			t.Errorf("Expected job to succeed, got %s", job.Status)
+		}
+	}
+	if peak != 2 {
+		t.Errorf("Expected at most 2 jobs at once, got %d", peak)
+	}
+
+	if _, err := queue.Enqueue(jobs.TypeStress, testJob{}, jobs.Options{}); err == nil {
+		t.Errorf("Expected an error for a job type without a function")
+	}
+}
+
+func TestQueuePriorities(t *testing.T) {
+	store := newMemoryStore()
+	release := make(chan struct{})
+	started := make(chan string, 4)
+	queue := newTestQueue(store, jobs.Config{Workers: 1}, release, started)
+	queue.Start()
+	defer queue.Close()
+
+	// Occupy the only worker while the other jobs queue up
+	if _, err := queue.Enqueue(jobs.TypeVaR, testJob{Name: "first"}, jobs.Options{}); err != nil {
+		t.Fatal(err)
+	}
+	<-started
+
+	var ids []uuid.UUID
+	for _, priority := range []string{jobs.PriorityLow, jobs.PriorityNormal, jobs.PriorityHigh} {
+		job, err := queue.Enqueue(jobs.TypeVaR, testJob{Name: priority}, jobs.Options{Priority: priority})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, job.ID)
+	}
+	close(release)
+	for _, id := range ids {
+		job := waitForStatus(t, store, id)
+		if job.Result["name"] != job.Priority {
+			t.Errorf("Expected the result computed from the job's input, got %v", job.Result)
+		}
+	}
+
+	order := []string{<-started, <-started, <-started}
+	if strings.Join(order, ",") != "high,normal,low" {
+		t.Errorf("Expected jobs to run by priority, got %v", order)
+	}
+
+	if _, err := queue.Enqueue(jobs.TypeVaR, testJob{}, jobs.Options{Priority: "urgent"}); err == nil {
+		t.Errorf("Expected an error for an unknown priority")
+	}
+}
+
+func TestQueueCancellation(t *testing.T) {
+	store := newMemoryStore()
+	release := make(chan struct{})
+	defer close(release)
+	started := make(chan string, 3)
+	queue := newTestQueue(store, jobs.Config{Workers: 1, HeartbeatInterval: 5 * time.Millisecond}, release, started)
+	queue.Start()
+	defer queue.Close()
+
+	running, err := queue.Enqueue(jobs.TypeVaR, testJob{Name: "running"}, jobs.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-started
+	queued, err := queue.Enqueue(jobs.TypeVaR, testJob{Name: "queued"}, jobs.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A queued job is cancelled at once and never runs
+	if status, err := queue.Cancel(queued.ID); err != nil || status != jobs.StatusCancelled {
+		t.Fatalf("Expected the queued job to be cancelled, got %s, %v", status, err)
+	}
+	if job, _ := store.Get(queued.ID); job.Status != jobs.StatusCancelled {
+		t.Errorf("Expected status cancelled, got %s", job.Status)
+	}
+
+	// A running job has its context cancelled
+	if status, err := queue.Cancel(running.ID); err != nil || status != jobs.StatusRunning {
+		t.Fatalf("Expected cancellation of the running job to be requested, got %s, %v", status, err)
+	}
+	if job := waitForStatus(t, store, running.ID); job.Status != jobs.StatusCancelled {
+		t.Errorf("Expected status cancelled, got %s", job.Status)
+	}
+	select {
+	case name := <-started:
+		t.Errorf("Expected the cancelled job not to run, but %s started", name)
+	default:
+	}
+
+	if _, err := queue.Cancel(running.ID); !errors.Is(err, jobs.ErrJobFinished) {
+		t.Errorf("Expected ErrJobFinished cancelling a finished job, got %v", err)
+	}
+	if _, err := queue.Cancel(uuid.New()); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("Expected not found cancelling an unknown job, got %v", err)
+	}
+
+	// A job running in this process stops at its next heartbeat when another
+	// process sharing the store cancels it
+	remote, err := queue.Enqueue(jobs.TypeVaR, testJob{Name: "remote"}, jobs.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-started
+	other := newTestQueue(store, jobs.Config{}, release, nil)
+	if status, err := other.Cancel(remote.ID); err != nil || status != jobs.StatusRunning {
+		t.Fatalf("Expected cancellation of the running job to be requested, got %s, %v", status, err)
+	}
+	if job := waitForStatus(t, store, remote.ID); job.Status != jobs.StatusCancelled {
+		t.Errorf("Expected status cancelled, got %s", job.Status)
+	}
+}
+
+func TestQueueTimeoutAndLimits(t *testing.T) {
+	store := newMemoryStore()
+	release := make(chan struct{})
+	defer close(release)
+	started := make(chan string, 2)
+	queue := newTestQueue(store, jobs.Config{Workers: 1, Timeout: time.Hour, MaxPending: 1}, release, started)
+	queue.Start()
+	defer queue.Close()
+
+	// Timeouts are whole seconds
+	job, err := queue.Enqueue(jobs.TypeVaR, testJob{}, jobs.Options{Timeout: 20 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.TimeoutSeconds != 1 {
+		t.Errorf("Expected the timeout rounded up to 1s, got %ds", job.TimeoutSeconds)
+	}
+	<-started
+	finished := waitForStatus(t, store, job.ID)
+	if finished.Status != jobs.StatusFailed || !strings.Contains(finished.Error, "timed out") {
+		t.Errorf("Expected the job to time out, got %s: %s", finished.Status, finished.Error)
+	}
+
+	// Fill the only worker and the single pending slot
+	if _, err := queue.Enqueue(jobs.TypeVaR, testJob{}, jobs.Options{}); err != nil {
+		t.Fatal(err)
+	}
+	<-started
+	if _, err := queue.Enqueue(jobs.TypeVaR, testJob{}, jobs.Options{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := queue.Enqueue(jobs.TypeVaR, testJob{}, jobs.Options{}); !errors.Is(err, jobs.ErrQueueFull) {
+		t.Errorf("Expected ErrQueueFull, got %v", err)
+	}
+}
+
+func TestQueueJobsStoredByCaller(t *testing.T) {
+	store := newMemoryStore()
+	release := make(chan struct{})
+	close(release)
+	queue := newTestQueue(store, jobs.Config{Workers: 1}, release, nil)
+	queue.Start()
+	defer queue.Close()
+
+	// NewJob stores nothing, as a caller's transaction may roll back
+	job, err := queue.NewJob(jobs.TypeVaR, testJob{Name: "scheduled"}, jobs.Options{Priority: jobs.PriorityLow})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.Status != jobs.StatusQueued || job.Priority != jobs.PriorityLow {
+		t.Errorf("Expected a queued low priority job, got %+v", job)
+	}
+	if _, err := store.Get(job.ID); err == nil {
+		t.Fatalf("Expected NewJob not to store the job")
+	}
+	if _, err := queue.NewJob("unknown", testJob{}, jobs.Options{}); err == nil {
+		t.Errorf("Expected an error for an unknown job type")
+	}
+
+	if err := store.Create(job); err != nil {
+		t.Fatal(err)
+	}
+	queue.Queued(job)
+	if finished := waitForStatus(t, store, job.ID); finished.Status != jobs.StatusSucceeded {
+		t.Errorf("Expected the stored job to run, got %s: %s", finished.Status, finished.Error)
+	}
+	events, err := store.Events(job.ID, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	queuedEvent := false
+	for _, event := range events {
+		queuedEvent = queuedEvent || event.Status == jobs.StatusQueued
+	}
+	if !queuedEvent {
+		t.Errorf("Expected Queued to record the queued event, got %+v", events)
+	}
+}
+
+func TestQueueRequeuesLostJobs(t *testing.T) {
+	store := newMemoryStore()
+	input, _ := json.Marshal(testJob{Name: "lost"})
+	stale := time.Now().Add(-time.Hour)
+	lost := func(attempts int) *domain.Job {
+		job := &domain.Job{
+			ID:          uuid.New(),
+			Type:        jobs.TypeVaR,
+			Status:      jobs.StatusRunning,
+			Priority:    jobs.PriorityNormal,
+			Input:       input,
+			Attempts:    attempts,
+			MaxAttempts: 3,
+			WorkerID:    "crashed",
+			HeartbeatAt: &stale,
+			StartedAt:   &stale,
+		}
+		if err := store.Create(job); err != nil {
+			t.Fatal(err)
+		}
+		return job
+	}
+	retried := lost(1)
+	exhausted := lost(3)
+
+	release := make(chan struct{})
+	close(release)
+	queue := newTestQueue(store, jobs.Config{Workers: 1, RetryBackoff: time.Millisecond}, release, nil)
+	if err := queue.Recover(); err != nil {
+		t.Fatal(err)
+	}
+	if job, _ := store.Get(retried.ID); job.Status != jobs.StatusQueued || job.WorkerID != "" || !job.RunAfter.After(time.Now().Add(-time.Second)) {
+		t.Errorf("Expected the lost job to be queued again with backoff, got %s on %q after %v", job.Status, job.WorkerID, job.RunAfter)
+	}
+	queue.Start()
+	defer queue.Close()
+
+	if job := waitForStatus(t, store, retried.ID); job.Status != jobs.StatusSucceeded || job.Attempts != 2 || job.Result["name"] != "lost" {
+		t.Errorf("Expected the lost job to succeed on its second attempt, got %s after %d attempts", job.Status, job.Attempts)
+	}
+	if job := waitForStatus(t, store, exhausted.ID); job.Status != jobs.StatusFailed || !strings.Contains(job.Error, "no attempts left") {
+		t.Errorf("Expected the job without attempts left to fail, got %s: %s", job.Status, job.Error)
+	}
+}
+
+func TestQueueCloseRequeuesRunningJobs(t *testing.T) {
+	store := newMemoryStore()
+	release := make(chan struct{})
+	started := make(chan string, 1)
+	queue := newTestQueue(store, jobs.Config{Workers: 1}, release, started)
+	queue.Start()
+
+	job, err := queue.Enqueue(jobs.TypeVaR, testJob{Name: "interrupted"}, jobs.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-started
+	queue.Close()
+
+	if stored, _ := store.Get(job.ID); stored.Status != jobs.StatusQueued || stored.WorkerID != "" {
+		t.Fatalf("Expected the interrupted job to be queued again, got %s on %q", stored.Status, stored.WorkerID)
+	}
+	if _, err := queue.Enqueue(jobs.TypeVaR, testJob{}, jobs.Options{}); !errors.Is(err, jobs.ErrQueueClosed) {
+		t.Errorf("Expected ErrQueueClosed, got %v", err)
+	}
+
+	// The next process picks it up
+	close(release)
+	next := newTestQueue(store, jobs.Config{Workers: 1}, release, nil)
+	next.Start()
+	defer next.Close()
+	if stored := waitForStatus(t, store, job.ID); stored.Status != jobs.StatusSucceeded || stored.Attempts != 2 {
+		t.Errorf("Expected the job to succeed on the next process, got %s after %d attempts", stored.Status, stored.Attempts)
+	}
+}
+
+func TestJobEvents(t *testing.T) {
+	store := newMemoryStore()
+	queue := jobs.NewQueueWithStore(store, jobs.Config{Workers: 1, PollInterval: time.Millisecond})
+	defer queue.Close()
+
+	release := make(chan struct{})
+	queue.Register(jobs.TypeVaR, func(ctx context.Context, job *domain.Job) (map[string]interface{}, error) {
+		jobs.ReportProgress(ctx, 25, "loading prices")
+		jobs.ReportProgress(ctx, 25, "loading prices") // repeats are dropped
+		<-release
+		jobs.ReportProgress(ctx, 150, "computing")
+		return map[string]interface{}{"var": 1250.5}, nil
+	})
+	job, err := queue.Enqueue(jobs.TypeVaR, testJob{}, jobs.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Two subscribers follow the job at once, each reading every event
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var subscribers []<-chan domain.JobEvent
+	for i := 0; i < 2; i++ {
+		events, err := queue.Subscribe(ctx, job.ID, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		subscribers = append(subscribers, events)
+	}
+	queue.Start()
+
+	var once sync.Once
+	collect := func(events <-chan domain.JobEvent) []domain.JobEvent {
+		var list []domain.JobEvent
+		for event := range events {
+			list = append(list, event)
+			if event.Stage == "loading prices" {
+				// Let the job finish once a subscriber saw its progress
+				once.Do(func() { close(release) })
+			}
+		}
+		return list
+	}
+	var wg sync.WaitGroup
+	streams := make([][]domain.JobEvent, len(subscribers))
+	for i, events := range subscribers {
+		wg.Add(1)
+		go func(i int, events <-chan domain.JobEvent) {
+			defer wg.Done()
+			streams[i] = collect(events)
+		}(i, events)
+	}
+	wg.Wait()
+
+	describe := func(events []domain.JobEvent) string {
+		var parts []string
+		for _, e := range events {
+			parts = append(parts, e.Type+":"+e.Status+":"+e.Stage)
+		}
+		return strings.Join(parts, ",")
+	}
+	expected := "status:queued:,status:running:,progress:running:loading prices,progress:running:computing,status:succeeded:computing"
+	for i, stream := range streams {
+		if got := describe(stream); got != expected {
+			t.Fatalf("Subscriber %d: expected %s, got %s", i, expected, got)
+		}
+	}
+	events := streams[0]
+	if events[3].Progress != 99 {
+		t.Errorf("Expected progress capped at 99, got %d", events[3].Progress)
+	}
+	final := events[len(events)-1]
+	if final.Progress != 100 || final.Result["var"] != 1250.5 {
+		t.Errorf("Expected the final event to carry the result, got %+v", final)
+	}
+	if stored, _ := store.Get(job.ID); stored.Stage != "computing" || stored.Progress != 100 {
+		t.Errorf("Expected the stage stored with the job, got %q at %d%%", stored.Stage, stored.Progress)
+	}
+
+	// Resuming after an event replays only the later ones
+	resumed, err := queue.Subscribe(ctx, job.ID, events[2].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var replay []domain.JobEvent
+	for event := range resumed {
+		replay = append(replay, event)
+	}
+	if got := describe(replay); got != "progress:running:computing,status:succeeded:computing" {
+		t.Errorf("Expected the events after the last seen one, got %s", got)
+	}
+
+	// Resuming after the final event ends the stream at once
+	resumed, err = queue.Subscribe(ctx, job.ID, final.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if event, ok := <-resumed; ok {
+		t.Errorf("Expected no events after the final one, got %+v", event)
+	}
+
+	if _, err := queue.Subscribe(ctx, uuid.New(), 0); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("Expected not found subscribing to an unknown job, got %v", err)
+	}
+}
+
+func TestJobEventsOfLostJob(t *testing.T) {
+	store := newMemoryStore()
+	stale := time.Now().Add(-time.Hour)
+	job := &domain.Job{
+		ID:          uuid.New(),
+		Type:        jobs.TypeVaR,
+		Status:      jobs.StatusRunning,
+		Attempts:    1,
+		MaxAttempts: 1,
+		WorkerID:    "crashed",
+		HeartbeatAt: &stale,
+	}
+	store.Create(job)
+
+	queue := newTestQueue(store, jobs.Config{}, nil, nil)
+	events, err := queue.Subscribe(context.Background(), job.ID, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := queue.Recover(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The job failed without a stored event; its final status is streamed
+	// from the job itself
+	var last domain.JobEvent
+	for event := range events {
+		last = event
+	}
+	if last.Status != jobs.StatusFailed || !strings.Contains(last.Error, "no attempts left") {
+		t.Errorf("Expected the failure of the lost job, got %+v", last)
+	}
+}
@@ -0,0 +1,76 @@
+package tests
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/reserveone/saa-risk-analyzer/internal/handlers"
+	"github.com/reserveone/saa-risk-analyzer/internal/service"
+)
+
+func TestLatestQuote(t *testing.T) {
+	quotes, _ := priceServices(t, closesProvider{
+		"SPY": {{Date: daysAgo(2), Close: 495}, {Date: daysAgo(1), Close: 500}},
+		"OLD": {{Date: daysAgo(10), Close: 42}},
+	})
+	ctx := context.Background()
+
+	quote, err := quotes.Quote(ctx, " spy ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if quote.Price != 500 || quote.Source != service.PriceSourceAPI || quote.Stale || quote.Cached {
+		t.Errorf("Expected a fresh quote of 500 from the API, got %+v", quote)
+	}
+	if again, _ := quotes.Quote(ctx, "SPY"); again == nil || !again.Cached {
+		t.Errorf("Expected the second quote from the cache, got %+v", again)
+	}
+
+	stale, err := quotes.Quote(ctx, "OLD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !stale.Stale || stale.AgeSeconds < 9*24*3600 {
+		t.Errorf("Expected a 10-day-old quote to be stale, got %+v", stale)
+	}
+
+	if _, err := quotes.Quote(ctx, "MISSING"); err == nil {
+		t.Error("Expected an error for a symbol without prices")
+	}
+	found, failed := quotes.Quotes(ctx, []string{"SPY", "MISSING"})
+	if len(found) != 1 || failed["MISSING"] == "" {
+		t.Errorf("Expected SPY quoted and MISSING failed, got %+v, %v", found, failed)
+	}
+}
+
+func TestLatestPricesSymbolLimit(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	quotes, _ := priceServices(t, closesProvider{"SPY": {{Date: daysAgo(1), Close: 500}}})
+	router := gin.New()
+	router.GET("/prices/latest", handlers.NewPortfolioHandler(unreachableDB(t), quotes).GetLatestPrices)
+
+	symbols := make([]string, 101)
+	for i := range symbols {
+		symbols[i] = fmt.Sprintf("S%d", i)
+	}
+	for _, test := range []struct {
+		symbols string
+		status  int
+	}{
+		{"SPY", http.StatusOK},
+		{"", http.StatusBadRequest},
+		{strings.Join(symbols, ","), http.StatusBadRequest},
+	} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/prices/latest?symbols="+test.symbols, nil))
+		if w.Code != test.status {
+			t.Errorf("%d symbols: expected %d, got %d", strings.Count(test.symbols, ",")+1, test.status, w.Code)
+		}
+	}
+}
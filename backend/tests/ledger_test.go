@@ -0,0 +1,178 @@
+package tests
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/reserveone/saa-risk-analyzer/internal/domain"
+	"github.com/reserveone/saa-risk-analyzer/internal/service"
+)
+
+var ledgerAsset = domain.Asset{ID: uuid.New(), Symbol: "SPY", Currency: "USD"}
+
+func ledgerDate(value string) time.Time {
+	date, _ := time.Parse("2006-01-02", value)
+	return date
+}
+
+func trade(kind, date string, quantity, price, fee float64) domain.Transaction {
+	return domain.Transaction{
+		ID:        uuid.New(),
+		AssetID:   &ledgerAsset.ID,
+		Asset:     &ledgerAsset,
+		Type:      kind,
+		TradeDate: ledgerDate(date),
+		Quantity:  quantity,
+		Price:     price,
+		Fee:       fee,
+	}
+}
+
+func ledgerTransactions() []domain.Transaction {
+	return []domain.Transaction{
+		trade(service.TransactionBuy, "2026-01-05", 100, 10, 0),
+		trade(service.TransactionBuy, "2026-02-02", 100, 20, 0),
+		trade(service.TransactionSell, "2026-03-02", 150, 30, 0),
+	}
+}
+
+func TestBuildLedgerCostMethods(t *testing.T) {
+	tests := []struct {
+		method   string
+		realized float64
+		avgCost  float64
+		lots     int
+	}{
+		// 100 at 10 and 50 at 20 closed, 50 at 20 left
+		{service.CostFIFO, 4500 - 1000 - 1000, 20, 1},
+		// 100 at 20 and 50 at 10 closed, 50 at 10 left
+		{service.CostLIFO, 4500 - 2000 - 500, 10, 1},
+		// 150 at the average of 15 closed, 50 at 15 left
+		{service.CostAverage, 4500 - 2250, 15, 2},
+	}
+	for _, tt := range tests {
+		ledger, err := service.BuildLedger(ledgerTransactions(), nil, tt.method, "USD", time.Time{})
+		if err != nil {
+			t.Fatalf("%s: %v", tt.method, err)
+		}
+		if len(ledger.Holdings) != 1 {
+			t.Fatalf("%s: expected one holding, got %+v", tt.method, ledger.Holdings)
+		}
+		h := ledger.Holdings[0]
+		if math.Abs(h.Quantity-50) > 1e-9 || math.Abs(h.AvgCost-tt.avgCost) > 1e-9 || len(h.Lots) != tt.lots {
+			t.Errorf("%s: expected 50 at %v in %d lots, got %+v", tt.method, tt.avgCost, tt.lots, h)
+		}
+		if math.Abs(h.RealizedPnL-tt.realized) > 1e-9 || math.Abs(ledger.Totals[0].RealizedPnL-tt.realized) > 1e-9 {
+			t.Errorf("%s: expected a realized P&L of %v, got %v", tt.method, tt.realized, h.RealizedPnL)
+		}
+	}
+
+	fifo, _ := service.BuildLedger(ledgerTransactions(), nil, service.CostFIFO, "USD", time.Time{})
+	if len(fifo.Realized) != 2 || fifo.Realized[0].OpenDate == nil || !fifo.Realized[0].OpenDate.Equal(ledgerDate("2026-01-05")) {
+		t.Errorf("Expected a FIFO realization per lot, oldest first, got %+v", fifo.Realized)
+	}
+	average, _ := service.BuildLedger(ledgerTransactions(), nil, service.CostAverage, "USD", time.Time{})
+	if len(average.Realized) != 1 || average.Realized[0].OpenDate != nil {
+		t.Errorf("Expected one average cost realization without an open date, got %+v", average.Realized)
+	}
+}
+
+func TestBuildLedgerAsOf(t *testing.T) {
+	ledger, err := service.BuildLedger(ledgerTransactions(), nil, service.CostFIFO, "USD", ledgerDate("2026-02-15"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := ledger.Holdings[0]
+	if h.Quantity != 200 || h.CostBasis != 3000 || len(ledger.Realized) != 0 {
+		t.Errorf("Expected 200 held at a cost of 3000 before the sale, got %+v", h)
+	}
+}
+
+func TestBuildLedgerFeesSplitsAndIncome(t *testing.T) {
+	transactions := []domain.Transaction{
+		trade(service.TransactionBuy, "2026-01-05", 100, 10, 5),
+		trade(service.TransactionSell, "2026-04-01", 100, 6, 5),
+		{ID: uuid.New(), Type: service.TransactionFee, TradeDate: ledgerDate("2026-03-31"), Amount: 25},
+		{ID: uuid.New(), AssetID: &ledgerAsset.ID, Asset: &ledgerAsset, Type: service.TransactionDividend, TradeDate: ledgerDate("2026-03-15"), Amount: 40},
+	}
+	splits := []domain.CorporateAction{{AssetID: ledgerAsset.ID, Type: "split", ExDate: ledgerDate("2026-03-02"), Value: 2}}
+
+	ledger, err := service.BuildLedger(transactions, splits, service.CostFIFO, "USD", ledgerDate("2026-03-20"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := ledger.Holdings[0]
+	if h.Quantity != 200 || math.Abs(h.CostBasis-1005) > 1e-9 || math.Abs(h.Lots[0].UnitCost-5.025) > 1e-9 {
+		t.Errorf("Expected the 2-for-1 split to double the units at the same cost, got %+v", h)
+	}
+
+	ledger, err = service.BuildLedger(transactions, splits, service.CostFIFO, "USD", time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h = ledger.Holdings[0]
+	// Sold 100 of the 200 after the split for 595, at a cost of 502.50
+	if h.Quantity != 100 || math.Abs(h.RealizedPnL-92.5) > 1e-9 {
+		t.Errorf("Expected half sold with 92.5 realized, got %+v", h)
+	}
+	total := ledger.Totals[0]
+	if total.Dividends != 40 || total.Fees != 25 || math.Abs(total.Net-(92.5+40-25)) > 1e-9 {
+		t.Errorf("Unexpected totals %+v", total)
+	}
+}
+
+func TestBuildLedgerRejectsOverselling(t *testing.T) {
+	transactions := []domain.Transaction{
+		trade(service.TransactionBuy, "2026-01-05", 100, 10, 0),
+		trade(service.TransactionTransfer, "2026-02-02", -60, 0, 0),
+		trade(service.TransactionSell, "2026-03-02", 50, 12, 0),
+	}
+	if _, err := service.BuildLedger(transactions, nil, service.CostFIFO, "USD", time.Time{}); !errors.Is(err, service.ErrInvalidTransaction) {
+		t.Errorf("Expected selling more than is held to fail, got %v", err)
+	}
+	if _, err := service.BuildLedger(transactions, nil, service.CostFIFO, "USD", ledgerDate("2026-02-28")); err != nil {
+		t.Errorf("Expected the ledger before the sale to build, got %v", err)
+	}
+}
+
+func TestNormalizeCostMethod(t *testing.T) {
+	if method, err := service.NormalizeCostMethod(""); err != nil || method != service.CostFIFO {
+		t.Errorf("Expected FIFO by default, got %q, %v", method, err)
+	}
+	if method, err := service.NormalizeCostMethod(" LIFO "); err != nil || method != service.CostLIFO {
+		t.Errorf("Expected LIFO, got %q, %v", method, err)
+	}
+	if _, err := service.NormalizeCostMethod("hifo"); err == nil {
+		t.Error("Expected an unknown cost method to fail")
+	}
+}
+
+func TestBuildLedgerOpeningBalances(t *testing.T) {
+	opening := trade(service.TransactionTransfer, "2026-02-02", 100, 15, 0)
+	opening.Note = service.OpeningBalanceNote
+	transactions := []domain.Transaction{opening, trade(service.TransactionSell, "2026-03-02", 50, 20, 0)}
+
+	ledger, err := service.BuildLedger(transactions, nil, service.CostFIFO, "USD", time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h := ledger.Holdings[0]; h.Quantity != 50 || h.RealizedPnL != 250 {
+		t.Errorf("Expected 50 left with 250 realized, got %+v", h)
+	}
+	if _, err := service.BuildLedger(transactions, nil, service.CostFIFO, "USD", ledgerDate("2026-01-31")); !errors.Is(err, service.ErrBeforeOpeningBalances) {
+		t.Errorf("Expected a ledger before the opening balances to fail, got %v", err)
+	}
+
+	backdated := append(transactions, trade(service.TransactionBuy, "2026-01-05", 100, 10, 0))
+	if _, err := service.BuildLedger(backdated, nil, service.CostFIFO, "USD", time.Time{}); !errors.Is(err, service.ErrInvalidTransaction) {
+		t.Errorf("Expected a buy before the opening balances to fail, got %v", err)
+	}
+	sameDay := append(transactions, trade(service.TransactionBuy, "2026-02-02", 100, 10, 0))
+	if _, err := service.BuildLedger(sameDay, nil, service.CostFIFO, "USD", time.Time{}); err != nil {
+		t.Errorf("Expected a buy on the opening date to apply, got %v", err)
+	}
+}
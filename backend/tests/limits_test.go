@@ -0,0 +1,85 @@
+package tests
+
+import (
+	"math"
+	"testing"
+
+	"github.com/reserveone/saa-risk-analyzer/internal/domain"
+	"github.com/reserveone/saa-risk-analyzer/internal/service"
+)
+
+func TestMeasureLimit(t *testing.T) {
+	varAmount, cvarAmount := 30000.0, 45000.0
+	obs := service.RiskObservation{
+		Confidence:   0.99,
+		HorizonDays:  1,
+		VaR:          &varAmount,
+		CVaR:         &cvarAmount,
+		StressLosses: map[string]float64{"Equity crash": 0.18, "Rates shock": 0.07, "Rally": -0.05},
+	}
+	portfolio := service.LimitPortfolio{
+		NAV:          1000000,
+		Weights:      map[string]float64{"SPY": 0.45, "TLT": 0.35, "BTC": -0.2},
+		ClassWeights: map[string]float64{"Equity": 0.45, "Bond": 0.35, "Crypto": -0.2},
+	}
+	lower := 0.3
+
+	tests := []struct {
+		name        string
+		limit       domain.RiskLimit
+		value, util float64
+		detail      string
+	}{
+		{"var", domain.RiskLimit{Type: "var", Max: 0.05}, 0.03, 0.6, "99% 1-day"},
+		{"cvar", domain.RiskLimit{Type: "cvar", Max: 0.05, Confidence: 0.99}, 0.045, 0.9, "99% 1-day"},
+		{"concentration", domain.RiskLimit{Type: "concentration", Max: 0.4}, 0.45, 1.125, "SPY"},
+		{"class cap", domain.RiskLimit{Type: "asset_class", AssetClass: "Bond", Max: 0.5}, 0.35, 0.7, ""},
+		{"class band", domain.RiskLimit{Type: "asset_class", AssetClass: "Equity", Min: &lower, Max: 0.5}, 0.45, 0.5, ""},
+		{"class band below", domain.RiskLimit{Type: "asset_class", AssetClass: "Commodities", Min: &lower, Max: 0.5}, 0, 4, ""},
+		{"worst stress", domain.RiskLimit{Type: "stress_loss", Max: 0.2}, 0.18, 0.9, "Equity crash"},
+		{"named stress", domain.RiskLimit{Type: "stress_loss", Scenario: "Rates shock", Max: 0.1}, 0.07, 0.7, "Rates shock"},
+	}
+	for _, tt := range tests {
+		value, util, detail, ok := service.MeasureLimit(&tt.limit, obs, portfolio)
+		if !ok {
+			t.Errorf("%s: expected the limit to be measured", tt.name)
+			continue
+		}
+		if math.Abs(value-tt.value) > 1e-12 || math.Abs(util-tt.util) > 1e-12 || detail != tt.detail {
+			t.Errorf("%s: expected %v at %v (%q), got %v at %v (%q)", tt.name, tt.value, tt.util, tt.detail, value, util, detail)
+		}
+	}
+
+	// Results that do not measure a limit leave it alone
+	unmeasured := []domain.RiskLimit{
+		{Type: "var", Max: 0.05, Confidence: 0.95},
+		{Type: "var", Max: 0.05, HorizonDays: 10},
+		{Type: "stress_loss", Scenario: "Oil spike", Max: 0.1},
+	}
+	for _, limit := range unmeasured {
+		if _, _, _, ok := service.MeasureLimit(&limit, obs, portfolio); ok {
+			t.Errorf("%+v: expected the limit not to be measured", limit)
+		}
+	}
+	if _, _, _, ok := service.MeasureLimit(&domain.RiskLimit{Type: "cvar", Max: 0.05}, service.RiskObservation{VaR: &varAmount}, portfolio); ok {
+		t.Errorf("Expected a VaR result not to measure a CVaR limit")
+	}
+}
+
+func TestLimitState(t *testing.T) {
+	tests := []struct {
+		utilization, warning float64
+		want                 string
+	}{
+		{0.5, 0.8, "ok"},
+		{0.8, 0.8, "warning"},
+		{1, 0.8, "warning"},
+		{1.01, 0.8, "breach"},
+		{0.95, 1, "ok"},
+	}
+	for _, tt := range tests {
+		if got := service.LimitState(tt.utilization, tt.warning); got != tt.want {
+			t.Errorf("utilization %v, warning %v: expected %s, got %s", tt.utilization, tt.warning, tt.want, got)
+		}
+	}
+}
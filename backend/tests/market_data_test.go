@@ -0,0 +1,102 @@
+package tests
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/reserveone/saa-risk-analyzer/internal/service"
+)
+
+// failingProvider always errors, to exercise fallback along a chain
+type failingProvider struct{}
+
+func (failingProvider) Name() string { return "failing" }
+
+func (failingProvider) Capabilities() service.ProviderCapabilities {
+	return service.ProviderCapabilities{}
+}
+
+func (failingProvider) HistoricalPrices(ctx context.Context, symbol string, days int) ([]service.PricePoint, error) {
+	return nil, fmt.Errorf("unavailable")
+}
+
+func TestFileProvider(t *testing.T) {
+	dir := t.TempDir()
+	multi := "date,symbol,close\n2021-01-05,SPY,375.96\n2021-01-04,SPY,373.88\n2021-01-04,BTC,31971.91\n"
+	single := "date,close\n2021-01-04,94.23\n2021-01-05,94.50\n2021-01-06,94.10\n"
+	if err := os.WriteFile(filepath.Join(dir, "prices.csv"), []byte(multi), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "tlt.csv"), []byte(single), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	market := service.NewMarketDataServiceWithProviders(
+		[]service.PriceProvider{failingProvider{}, service.NewFileProvider(dir)},
+		map[string][]string{service.DefaultProviderChain: {"failing", service.ProviderFile}},
+		service.ResiliencePolicy{},
+		nil,
+	)
+	ctx := context.Background()
+
+	prices, err := market.GetHistoricalPrices(ctx, "SPY", 10)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(prices) != 2 || !prices[0].Date.Before(prices[1].Date) {
+		t.Errorf("Expected 2 prices in date order, got %v", prices)
+	}
+
+	prices, err = market.GetHistoricalPrices(ctx, "TLT", 2)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(prices) != 2 || prices[1].Close != 94.10 {
+		t.Errorf("Expected the 2 most recent TLT prices, got %v", prices)
+	}
+
+	if _, err := market.GetHistoricalPrices(ctx, "QQQ", 10); err == nil {
+		t.Errorf("Expected an error for a symbol missing from every provider")
+	}
+}
+
+func TestFileProviderSkipsInvalidFiles(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"prices.csv": "date,symbol,close\n2021-01-04,SPY,373.88\n2021-01-05,QQQ,310.2\n2021-01-06,SPY,oops\n",
+		"gld.csv":    "date,close\n2021-01-04,180.5\n2021-01-05,NaN\n",
+		"tlt.csv":    "date,close\n2021-01-04,94.23\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	provider := service.NewFileProvider(dir)
+	ctx := context.Background()
+
+	for _, symbol := range []string{"SPY", "QQQ", "GLD"} {
+		if prices, err := provider.HistoricalPrices(ctx, symbol, 10); err == nil {
+			t.Errorf("Expected no %s prices from an invalid file, got %v", symbol, prices)
+		}
+	}
+	if prices, err := provider.HistoricalPrices(ctx, "TLT", 10); err != nil || len(prices) != 1 {
+		t.Errorf("Expected the valid file to load, got %v, %v", prices, err)
+	}
+}
+
+func TestProviderCapabilities(t *testing.T) {
+	crypto := service.ProviderCapabilities{AssetClasses: []string{service.AssetClassCrypto}}
+	if !crypto.Supports("crypto") || crypto.Supports(service.AssetClassEquity) {
+		t.Errorf("Expected a crypto-only provider to serve only crypto")
+	}
+	if !(service.ProviderCapabilities{}).Supports(service.AssetClassFX) {
+		t.Errorf("Expected a provider without asset classes to serve every class")
+	}
+	if service.AssetClassOf("EURUSD") != service.AssetClassFX || service.AssetClassOf("BTC") != service.AssetClassCrypto {
+		t.Errorf("Unexpected asset classification")
+	}
+}
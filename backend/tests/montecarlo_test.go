@@ -0,0 +1,96 @@
+package tests
+
+import (
+	"math"
+	"testing"
+
+	riskmath "github.com/reserveone/saa-risk-analyzer/internal/math"
+)
+
+var mcAssetReturns = [][]float64{
+	{0.01, -0.02, 0.015, -0.01, 0.02, -0.015, 0.01, 0.008, -0.012, 0.018},
+	{0.03, -0.05, 0.04, -0.02, 0.06, -0.04, 0.02, 0.01, -0.03, 0.05},
+	{0.002, 0.001, -0.003, 0.004, -0.001, 0.002, 0.000, -0.002, 0.003, 0.001},
+}
+
+func TestMonteCarloReproducibleAcrossWorkers(t *testing.T) {
+	weights := []float64{0.5, 0.3, 0.2}
+
+	cfg := riskmath.MonteCarloConfig{Simulations: 20000, Workers: 1, Seed: 42, Antithetic: true}
+	single, err := riskmath.RunMonteCarlo(mcAssetReturns, weights, 0.99, 1, cfg)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	cfg.Workers = 8
+	parallel, err := riskmath.RunMonteCarlo(mcAssetReturns, weights, 0.99, 1, cfg)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if single.VaR != parallel.VaR || single.ES != parallel.ES {
+		t.Errorf("Expected identical results for the same seed, got VaR %f/%f ES %f/%f",
+			single.VaR, parallel.VaR, single.ES, parallel.ES)
+	}
+	if parallel.Seed != 42 {
+		t.Errorf("Expected seed 42, got %d", parallel.Seed)
+	}
+	if parallel.ES < parallel.VaR {
+		t.Errorf("Expected ES >= VaR, got ES %f VaR %f", parallel.ES, parallel.VaR)
+	}
+	if parallel.VaRStdErr <= 0 || parallel.ESStdErr <= 0 {
+		t.Errorf("Expected positive standard errors, got %f and %f", parallel.VaRStdErr, parallel.ESStdErr)
+	}
+}
+
+func TestMonteCarloMatchesParametric(t *testing.T) {
+	weights := []float64{0.5, 0.3, 0.2}
+
+	portfolioReturns := riskmath.CalculatePortfolioReturns(mcAssetReturns, weights)
+	parametric, err := riskmath.CalculateParametricVaR(portfolioReturns, 0.99, 1)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	for _, sampler := range []string{riskmath.SamplerPseudo, riskmath.SamplerSobol} {
+		result, err := riskmath.RunMonteCarlo(mcAssetReturns, weights, 0.99, 1, riskmath.MonteCarloConfig{
+			Simulations: 50000,
+			Seed:        7,
+			Sampler:     sampler,
+		})
+		if err != nil {
+			t.Fatalf("%s: expected no error, got %v", sampler, err)
+		}
+
+		if math.Abs(result.VaR-parametric.VaR) > 5*result.VaRStdErr+1e-4 {
+			t.Errorf("%s: expected VaR near %f, got %f (std err %f)", sampler, parametric.VaR, result.VaR, result.VaRStdErr)
+		}
+		t.Logf("%s VaR: %f ± %f", sampler, result.VaR, result.VaRStdErr)
+	}
+}
+
+func TestMonteCarloSobolStdErrMatchesSpread(t *testing.T) {
+	weights := []float64{0.5, 0.3, 0.2}
+
+	var estimates, stdErrs []float64
+	for seed := uint64(1); seed <= 30; seed++ {
+		result, err := riskmath.RunMonteCarlo(mcAssetReturns, weights, 0.99, 1, riskmath.MonteCarloConfig{
+			Simulations: 4000,
+			Seed:        seed,
+			Sampler:     riskmath.SamplerSobol,
+		})
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		estimates = append(estimates, result.VaR)
+		stdErrs = append(stdErrs, result.VaRStdErr)
+	}
+
+	// The reported error should measure how much the estimate moves between seeds
+	spread := riskmath.StdDev(estimates)
+	stdErr := riskmath.Mean(stdErrs)
+	if stdErr < spread/1.5 || stdErr > spread*1.5 {
+		t.Errorf("Expected the std err %f to match the spread across seeds %f", stdErr, spread)
+	}
+	t.Logf("Sobol VaR spread %f, mean std err %f", spread, stdErr)
+}
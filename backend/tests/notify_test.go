@@ -0,0 +1,177 @@
+package tests
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/reserveone/saa-risk-analyzer/internal/notify"
+)
+
+func testAlert() notify.Alert {
+	return notify.Alert{
+		LimitID:       uuid.New(),
+		LimitName:     "1-day VaR",
+		LimitType:     "var",
+		PortfolioID:   uuid.New(),
+		PortfolioName: "Reserve",
+		State:         "breach",
+		PreviousState: "warning",
+		Value:         0.055,
+		Max:           0.05,
+		Utilization:   1.1,
+		Detail:        "99% 1-day",
+		At:            time.Date(2026, 3, 2, 18, 0, 0, 0, time.UTC),
+	}
+}
+
+func TestWebhookNotifier(t *testing.T) {
+	var received notify.Alert
+	var signature string
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = io.ReadAll(r.Body)
+		signature = r.Header.Get("X-Signature-256")
+		json.Unmarshal(body, &received)
+	}))
+	defer server.Close()
+
+	alert := testAlert()
+	if err := notify.NewWebhook(server.URL, "s3cret", time.Second).Notify(context.Background(), alert); err != nil {
+		t.Fatal(err)
+	}
+	if received.LimitID != alert.LimitID || received.State != "breach" || received.Utilization != 1.1 {
+		t.Errorf("Unexpected alert received: %+v", received)
+	}
+	if signature != "sha256="+notify.Sign("s3cret", body) {
+		t.Errorf("Expected the body to be signed, got %q", signature)
+	}
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer failing.Close()
+	if err := notify.NewWebhook(failing.URL, "", time.Second).Notify(context.Background(), alert); err == nil {
+		t.Errorf("Expected an error from a failing webhook")
+	}
+}
+
+// smtpStandIn accepts one message the way a mail server would, without TLS
+// or authentication, and returns its envelope and data
+func smtpStandIn(t *testing.T) (string, <-chan []string) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	received := make(chan []string, 1)
+	go func() {
+		defer listener.Close()
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		reply := func(line string) { io.WriteString(conn, line+"\r\n") }
+
+		var lines []string
+		reply("220 localhost ESMTP stand-in")
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			line = strings.TrimRight(line, "\r\n")
+			command := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+			switch {
+			case command == "EHLO" || command == "HELO":
+				reply("250 localhost")
+			case strings.HasPrefix(strings.ToUpper(line), "MAIL FROM:") || strings.HasPrefix(strings.ToUpper(line), "RCPT TO:"):
+				lines = append(lines, line)
+				reply("250 OK")
+			case command == "DATA":
+				reply("354 End data with <CR><LF>.<CR><LF>")
+				for {
+					data, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					data = strings.TrimRight(data, "\r\n")
+					if data == "." {
+						break
+					}
+					lines = append(lines, data)
+				}
+				reply("250 OK: queued")
+			case command == "QUIT":
+				reply("221 Bye")
+				received <- lines
+				return
+			default:
+				reply("502 Command not implemented")
+			}
+		}
+	}()
+	return listener.Addr().String(), received
+}
+
+func TestSMTPNotifier(t *testing.T) {
+	addr, received := smtpStandIn(t)
+	notifier := &notify.SMTP{
+		Addr:    addr,
+		From:    "risk@example.com",
+		To:      []string{"cro@example.com", "desk@example.com"},
+		Timeout: 2 * time.Second,
+	}
+	if err := notifier.Notify(context.Background(), testAlert()); err != nil {
+		t.Fatal(err)
+	}
+
+	var lines []string
+	select {
+	case lines = <-received:
+	case <-time.After(2 * time.Second):
+		t.Fatal("The stand-in received no message")
+	}
+	message := strings.Join(lines, "\n")
+	for _, want := range []string{
+		"MAIL FROM:<risk@example.com>",
+		"RCPT TO:<cro@example.com>",
+		"RCPT TO:<desk@example.com>",
+		`Subject: [breach] Reserve: var limit "1-day VaR" at 110%`,
+		"State:       breach, was warning",
+		"Utilization: 110.0%",
+	} {
+		if !strings.Contains(message, want) {
+			t.Errorf("Expected the message to contain %q, got:\n%s", want, message)
+		}
+	}
+}
+
+func TestMultiNotifier(t *testing.T) {
+	calls := 0
+	ok := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { calls++ }))
+	defer ok.Close()
+
+	// One channel failing does not stop the others
+	multi := notify.Multi{
+		&notify.SMTP{Addr: "127.0.0.1:1", From: "a@example.com", To: []string{"b@example.com"}, Timeout: time.Second},
+		notify.NewWebhook(ok.URL, "", time.Second),
+	}
+	if err := multi.Notify(context.Background(), testAlert()); err == nil || !strings.Contains(err.Error(), "smtp") {
+		t.Errorf("Expected the SMTP error, got %v", err)
+	}
+	if calls != 1 {
+		t.Errorf("Expected the webhook to be notified, got %d calls", calls)
+	}
+}
@@ -0,0 +1,99 @@
+package tests
+
+import (
+	"math"
+	"testing"
+
+	riskmath "github.com/reserveone/saa-risk-analyzer/internal/math"
+)
+
+func TestSimulatePaths(t *testing.T) {
+	assetReturns := [][]float64{
+		{0.01, -0.02, 0.015, -0.01, 0.02, -0.015, 0.01, 0.008, -0.012, 0.018},
+		{0.002, 0.001, -0.003, 0.004, -0.001, 0.002, 0.000, -0.002, 0.003, 0.001},
+	}
+	weights := []float64{0.6, 0.4}
+
+	cfg := riskmath.PathConfig{
+		Paths:          5000,
+		Periods:        24,
+		PeriodDays:     21,
+		InitialValue:   100000,
+		Contribution:   1000,
+		RebalanceEvery: 3,
+		Goal:           150000,
+		Seed:           3,
+		Workers:        4,
+	}
+
+	result, err := riskmath.SimulatePaths(assetReturns, weights, cfg)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if len(result.PeriodQuantiles) != cfg.Periods+1 {
+		t.Errorf("Expected %d fan chart rows, got %d", cfg.Periods+1, len(result.PeriodQuantiles))
+	}
+	for i := 1; i < len(result.TerminalQuantiles); i++ {
+		if result.TerminalQuantiles[i] < result.TerminalQuantiles[i-1] {
+			t.Errorf("Expected increasing terminal wealth quantiles, got %v", result.TerminalQuantiles)
+		}
+	}
+	if result.ShortfallProbability <= 0 || result.ShortfallProbability >= 1 {
+		t.Errorf("Expected shortfall probability in (0, 1), got %f", result.ShortfallProbability)
+	}
+	if result.MeanMaxDrawdown <= 0 || result.MeanMaxDrawdown >= 1 {
+		t.Errorf("Expected mean max drawdown in (0, 1), got %f", result.MeanMaxDrawdown)
+	}
+
+	cfg.Workers = 1
+	again, err := riskmath.SimulatePaths(assetReturns, weights, cfg)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if again.MeanTerminal != result.MeanTerminal {
+		t.Errorf("Expected identical results for the same seed, got %f and %f", again.MeanTerminal, result.MeanTerminal)
+	}
+
+	// Withdrawing more than the portfolio can sustain depletes it
+	cfg.Contribution = -20000
+	depleting, err := riskmath.SimulatePaths(assetReturns, weights, cfg)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if depleting.DepletionProbability < 0.99 {
+		t.Errorf("Expected near-certain depletion, got %f", depleting.DepletionProbability)
+	}
+
+	t.Logf("Median terminal wealth: %f, P(shortfall): %f", result.TerminalQuantiles[2], result.ShortfallProbability)
+}
+
+func TestSimulatePathsDrawdownIgnoresCashFlows(t *testing.T) {
+	// With one asset, every path's performance is the same whatever flows in
+	// or out, and so must its drawdown be
+	assetReturns := [][]float64{{0.01, -0.02, 0.015, -0.01, 0.02, -0.015, 0.01, 0.008, -0.012, 0.018}}
+	cfg := riskmath.PathConfig{
+		Paths:        2000,
+		Periods:      24,
+		PeriodDays:   21,
+		InitialValue: 100000,
+		Seed:         5,
+		Workers:      2,
+	}
+
+	base, err := riskmath.SimulatePaths(assetReturns, []float64{1}, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, contribution := range []float64{50000, -3000} {
+		cfg.Contribution = contribution
+		result, err := riskmath.SimulatePaths(assetReturns, []float64{1}, cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if math.Abs(result.MeanMaxDrawdown-base.MeanMaxDrawdown) > 1e-9 {
+			t.Errorf("Contribution %v: expected a mean max drawdown of %f, got %f",
+				contribution, base.MeanMaxDrawdown, result.MeanMaxDrawdown)
+		}
+	}
+}
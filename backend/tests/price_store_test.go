@@ -0,0 +1,142 @@
+package tests
+
+import (
+	"testing"
+	"time"
+
+	"github.com/reserveone/saa-risk-analyzer/internal/service"
+)
+
+func storeDay(day int) time.Time {
+	return time.Date(2026, 3, day, 0, 0, 0, 0, time.UTC)
+}
+
+func storePrices(closes map[int]float64) []service.PricePoint {
+	var prices []service.PricePoint
+	for day := 1; day <= 31; day++ {
+		if close, ok := closes[day]; ok {
+			prices = append(prices, service.PricePoint{Date: storeDay(day), Close: close})
+		}
+	}
+	return prices
+}
+
+func TestMergePrices(t *testing.T) {
+	stored := storePrices(map[int]float64{2: 100, 3: 101, 4: 102})
+	fetched := []service.PricePoint{
+		{Date: storeDay(3).Add(20 * time.Hour), Close: 111},
+		{Date: storeDay(4), Close: 112},
+		{Date: storeDay(5), Close: 113},
+		{Date: storeDay(6), Close: 0},
+	}
+	imported := map[time.Time]bool{storeDay(4): true}
+
+	merged, fetchedDays := service.MergePrices(stored, fetched, imported)
+	want := storePrices(map[int]float64{2: 100, 3: 111, 4: 102, 5: 113})
+	if len(merged) != len(want) {
+		t.Fatalf("Expected %d closes, got %+v", len(want), merged)
+	}
+	for i := range want {
+		if !merged[i].Date.Equal(want[i].Date) || merged[i].Close != want[i].Close {
+			t.Errorf("Close %d: expected %+v, got %+v", i, want[i], merged[i])
+		}
+	}
+	for day, fetched := range map[int]bool{2: false, 3: true, 4: false, 5: true} {
+		if fetchedDays[storeDay(day)] != fetched {
+			t.Errorf("Day %d: expected fetched %v", day, fetched)
+		}
+	}
+}
+
+func TestMissingPrices(t *testing.T) {
+	now := storeDay(20).Add(12 * time.Hour)
+	tests := []struct {
+		name     string
+		query    service.HistoryQuery
+		from, to time.Time
+		stored   []service.PricePoint
+		missing  bool
+	}{
+		{"nothing stored", service.HistoryQuery{Days: 3}, time.Time{}, now, nil, true},
+		{"short window", service.HistoryQuery{Days: 3}, time.Time{}, now, storePrices(map[int]float64{19: 1, 20: 1}), true},
+		{"full window", service.HistoryQuery{Days: 3}, time.Time{}, now, storePrices(map[int]float64{18: 1, 19: 1, 20: 1}), false},
+		{"without today's close", service.HistoryQuery{Days: 3}, time.Time{}, now, storePrices(map[int]float64{17: 1, 18: 1, 19: 1}), true},
+		{"full range", service.HistoryQuery{}, storeDay(2), storeDay(10), storePrices(map[int]float64{2: 1, 6: 1, 10: 1}), false},
+		{"range starting late", service.HistoryQuery{}, storeDay(2), storeDay(10), storePrices(map[int]float64{9: 1, 10: 1}), true},
+		{"range ending over a weekend", service.HistoryQuery{}, storeDay(9), storeDay(16), storePrices(map[int]float64{9: 1, 13: 1}), false},
+		{"range ending early", service.HistoryQuery{}, storeDay(2), storeDay(16), storePrices(map[int]float64{2: 1, 10: 1}), true},
+	}
+	for _, tt := range tests {
+		if got := service.MissingPrices(tt.query, tt.from, tt.to, tt.stored, now); got != tt.missing {
+			t.Errorf("%s: expected missing %v, got %v", tt.name, tt.missing, got)
+		}
+	}
+}
+
+func TestFetchDays(t *testing.T) {
+	now := storeDay(20).Add(12 * time.Hour)
+	tests := []struct {
+		name   string
+		query  service.HistoryQuery
+		from   time.Time
+		stored []service.PricePoint
+		days   int
+	}{
+		{"range", service.HistoryQuery{}, storeDay(10), nil, 12},
+		{"window after the latest close", service.HistoryQuery{Days: 2}, time.Time{}, storePrices(map[int]float64{17: 1, 18: 1}), 4},
+		// 2 days to now plus 10 closes in calendar days and a week's margin
+		{"short window", service.HistoryQuery{Days: 10}, time.Time{}, storePrices(map[int]float64{18: 1}), 23},
+	}
+	for _, tt := range tests {
+		if got := service.FetchDays(tt.query, tt.from, now, tt.stored, now); got != tt.days {
+			t.Errorf("%s: expected %d days, got %d", tt.name, tt.days, got)
+		}
+	}
+}
+
+func TestRefreshDue(t *testing.T) {
+	now := storeDay(20)
+	tests := []struct {
+		lastFetch time.Time
+		due       bool
+	}{
+		{time.Time{}, true},
+		{now.Add(-30 * time.Minute), false},
+		{now.Add(-2 * time.Hour), true},
+	}
+	for _, tt := range tests {
+		if got := service.RefreshDue(tt.lastFetch, now); got != tt.due {
+			t.Errorf("Last fetched %v: expected due %v, got %v", tt.lastFetch, tt.due, got)
+		}
+	}
+}
+
+func TestSelectPrices(t *testing.T) {
+	prices := storePrices(map[int]float64{2: 1, 3: 2, 4: 3, 5: 4, 6: 5, 9: 6, 10: 7})
+	endOf := func(day int) time.Time { return storeDay(day).Add(24*time.Hour - time.Nanosecond) }
+	tests := []struct {
+		name     string
+		days     int
+		from, to time.Time
+		closes   []float64
+	}{
+		{"window as of a date", 3, time.Time{}, endOf(6), []float64{3, 4, 5}},
+		{"window as of a weekend", 2, time.Time{}, endOf(8), []float64{4, 5}},
+		{"window longer than the history", 10, time.Time{}, endOf(4), []float64{1, 2, 3}},
+		{"range", 0, storeDay(4), endOf(9), []float64{3, 4, 5, 6}},
+		{"range with a time of day", 0, storeDay(4).Add(15 * time.Hour), endOf(5), []float64{3, 4}},
+	}
+	for _, tt := range tests {
+		got := service.SelectPrices(prices, tt.days, tt.from, tt.to)
+		if len(got) != len(tt.closes) {
+			t.Errorf("%s: expected %v, got %+v", tt.name, tt.closes, got)
+			continue
+		}
+		for i := range got {
+			if got[i].Close != tt.closes[i] {
+				t.Errorf("%s: expected %v, got %+v", tt.name, tt.closes, got)
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/reserveone/saa-risk-analyzer/internal/service"
+)
+
+// flakyProvider fails its first failures calls with err, then serves a price
+type flakyProvider struct {
+	name      string
+	failures  int
+	err       error
+	calls     int
+	rateLimit service.RateLimit
+}
+
+func (p *flakyProvider) Name() string { return p.name }
+
+func (p *flakyProvider) Capabilities() service.ProviderCapabilities {
+	return service.ProviderCapabilities{RateLimit: p.rateLimit}
+}
+
+func (p *flakyProvider) HistoricalPrices(ctx context.Context, symbol string, days int) ([]service.PricePoint, error) {
+	p.calls++
+	if p.calls <= p.failures {
+		return nil, p.err
+	}
+	return []service.PricePoint{{Date: time.Now(), Close: 100}}, nil
+}
+
+func newFlakyMarket(policy service.ResiliencePolicy, providers ...*flakyProvider) *service.MarketDataService {
+	registered := make([]service.PriceProvider, len(providers))
+	chain := make([]string, len(providers))
+	for i, p := range providers {
+		registered[i] = p
+		chain[i] = p.name
+	}
+	return service.NewMarketDataServiceWithProviders(registered, map[string][]string{service.DefaultProviderChain: chain}, policy, nil)
+}
+
+func TestProviderRetries(t *testing.T) {
+	unavailable := &service.StatusError{Provider: "flaky", StatusCode: 503}
+	flaky := &flakyProvider{name: "flaky", failures: 2, err: unavailable}
+	market := newFlakyMarket(service.ResiliencePolicy{Retries: 2, RetryBaseDelay: time.Millisecond}, flaky)
+
+	if _, err := market.GetHistoricalPrices(context.Background(), "SPY", 1); err != nil {
+		t.Fatalf("Expected the third attempt to succeed, got %v", err)
+	}
+	if flaky.calls != 3 {
+		t.Errorf("Expected 3 calls, got %d", flaky.calls)
+	}
+
+	// Client errors are not retried
+	missing := &flakyProvider{name: "missing", failures: 10, err: &service.StatusError{Provider: "missing", StatusCode: 404}}
+	market = newFlakyMarket(service.ResiliencePolicy{Retries: 2, RetryBaseDelay: time.Millisecond}, missing)
+	if _, err := market.GetHistoricalPrices(context.Background(), "SPY", 1); err == nil {
+		t.Fatalf("Expected an error")
+	}
+	if missing.calls != 1 {
+		t.Errorf("Expected a 404 not to be retried, got %d calls", missing.calls)
+	}
+}
+
+func TestProviderCircuitBreaker(t *testing.T) {
+	down := &flakyProvider{name: "down", failures: 100, err: &service.StatusError{Provider: "down", StatusCode: 502}}
+	backup := &flakyProvider{name: "backup"}
+	market := newFlakyMarket(service.ResiliencePolicy{BreakerFailures: 2, BreakerCooldown: time.Hour}, down, backup)
+
+	for i := 0; i < 4; i++ {
+		if _, err := market.GetHistoricalPrices(context.Background(), "SPY", 1); err != nil {
+			t.Fatalf("Expected the backup provider to serve, got %v", err)
+		}
+	}
+	if down.calls != 2 {
+		t.Errorf("Expected the open circuit to skip the provider after 2 failures, got %d calls", down.calls)
+	}
+
+	health := market.Health()
+	if len(health) != 2 || health[1].Name != "down" {
+		t.Fatalf("Unexpected health %+v", health)
+	}
+	if health[1].State != service.CircuitOpen || health[1].OpenUntil == nil || health[1].Errors != 2 {
+		t.Errorf("Expected an open circuit with 2 errors, got %+v", health[1])
+	}
+	if health[0].State != service.CircuitClosed || health[0].Requests != 4 {
+		t.Errorf("Expected a closed circuit with 4 requests, got %+v", health[0])
+	}
+}
+
+func TestProviderClientErrorsLeaveHealth(t *testing.T) {
+	flaky := &flakyProvider{name: "flaky", failures: 100, err: &service.StatusError{Provider: "flaky", StatusCode: 502}}
+	market := newFlakyMarket(service.ResiliencePolicy{BreakerFailures: 2, BreakerCooldown: time.Hour}, flaky)
+
+	market.GetHistoricalPrices(context.Background(), "SPY", 1)
+	// An unknown symbol neither succeeds nor fails the provider
+	flaky.err = &service.StatusError{Provider: "flaky", StatusCode: 404}
+	market.GetHistoricalPrices(context.Background(), "SPY", 1)
+
+	health := market.Health()[0]
+	if health.ConsecutiveFailures != 1 || health.LastSuccess != nil || health.Requests != 2 {
+		t.Errorf("Expected the 404 to leave the failure streak, got %+v", health)
+	}
+
+	flaky.err = &service.StatusError{Provider: "flaky", StatusCode: 502}
+	market.GetHistoricalPrices(context.Background(), "SPY", 1)
+	if health := market.Health()[0]; health.State != service.CircuitOpen {
+		t.Errorf("Expected the second consecutive failure to open the circuit, got %+v", health)
+	}
+}
+
+func TestProviderRateLimitSkipsProvider(t *testing.T) {
+	limited := &flakyProvider{name: "limited", rateLimit: service.RateLimit{Requests: 1, Per: time.Hour}}
+	backup := &flakyProvider{name: "backup"}
+	market := newFlakyMarket(service.ResiliencePolicy{}, limited, backup)
+
+	for i := 0; i < 2; i++ {
+		if _, err := market.GetHistoricalPrices(context.Background(), "SPY", 1); err != nil {
+			t.Fatalf("Expected request %d to be served, got %v", i+1, err)
+		}
+	}
+	// The next token is an hour away, so the chain moves on at once
+	if limited.calls != 1 || backup.calls != 1 {
+		t.Errorf("Expected the rate limited provider to be skipped, got %d and %d calls", limited.calls, backup.calls)
+	}
+
+	market = newFlakyMarket(service.ResiliencePolicy{}, &flakyProvider{name: "limited", rateLimit: service.RateLimit{Requests: 1, Per: time.Hour}})
+	market.GetHistoricalPrices(context.Background(), "SPY", 1)
+	start := time.Now()
+	_, err := market.GetHistoricalPrices(context.Background(), "SPY", 1)
+	if err == nil || !strings.Contains(err.Error(), "rate limited") {
+		t.Errorf("Expected a rate limited error, got %v", err)
+	}
+	if time.Since(start) > 100*time.Millisecond {
+		t.Errorf("Expected the rate limited request not to wait")
+	}
+	health := market.Health()
+	if health[0].Errors != 0 || health[0].State != service.CircuitClosed {
+		t.Errorf("Expected rate limiting not to count against the provider, got %+v", health[0])
+	}
+}
+
+func TestProviderRateLimitHonoursContext(t *testing.T) {
+	limited := &flakyProvider{name: "limited", rateLimit: service.RateLimit{Requests: 1, Per: 500 * time.Millisecond}}
+	market := newFlakyMarket(service.ResiliencePolicy{}, limited)
+
+	if _, err := market.GetHistoricalPrices(context.Background(), "SPY", 1); err != nil {
+		t.Fatalf("Expected the first request to pass, got %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := market.GetHistoricalPrices(ctx, "SPY", 1)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected the deadline to abort the rate limit wait, got %v", err)
+	}
+	if time.Since(start) > 250*time.Millisecond {
+		t.Errorf("Expected the wait to stop with the context")
+	}
+	if limited.calls != 1 {
+		t.Errorf("Expected the second request not to reach the provider, got %d calls", limited.calls)
+	}
+}
@@ -0,0 +1,57 @@
+package tests
+
+import (
+	"math"
+	"testing"
+
+	riskmath "github.com/reserveone/saa-risk-analyzer/internal/math"
+)
+
+func TestReverseStressTest(t *testing.T) {
+	assetReturns := [][]float64{
+		{0.01, -0.02, 0.015, -0.01, 0.02, -0.015, 0.01, 0.008, -0.012, 0.018},
+		{0.03, -0.05, 0.04, -0.02, 0.06, -0.04, 0.02, 0.01, -0.03, 0.05},
+	}
+	exposures := []float64{60000, 40000}
+	loss := 10000.0
+
+	result, err := riskmath.ReverseStressTest(assetReturns, exposures, loss, 1)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	totalPnL := 0.0
+	for _, pnl := range result.PnL {
+		totalPnL += pnl
+	}
+	if math.Abs(totalPnL+loss) > 1e-6 {
+		t.Errorf("Expected scenario P&L of %f, got %f", -loss, totalPnL)
+	}
+
+	// Distance equals the loss in units of portfolio standard deviation
+	cov, _ := riskmath.ReturnMoments(assetReturns)
+	sigma := riskmath.PortfolioStdDev(exposures, cov)
+	if math.Abs(result.MahalanobisDistance-loss/sigma) > 1e-9 {
+		t.Errorf("Expected distance %f, got %f", loss/sigma, result.MahalanobisDistance)
+	}
+	if result.Plausibility <= 0 || result.Plausibility >= 0.5 {
+		t.Errorf("Expected plausibility in (0, 0.5), got %f", result.Plausibility)
+	}
+
+	factors, err := riskmath.ReverseStressTestFactors(assetReturns, exposures, loss, 1, 1)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	totalPnL = 0
+	for _, pnl := range factors.PnL {
+		totalPnL += pnl
+	}
+	if math.Abs(totalPnL+loss) > 1e-6 {
+		t.Errorf("Expected factor scenario P&L of %f, got %f", -loss, totalPnL)
+	}
+	if factors.MahalanobisDistance < result.MahalanobisDistance {
+		t.Errorf("Expected restricted factor scenario to be no more plausible than the asset scenario")
+	}
+
+	t.Logf("Distance: %f, Plausibility: %f", result.MahalanobisDistance, result.Plausibility)
+}
@@ -0,0 +1,183 @@
+package tests
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/reserveone/saa-risk-analyzer/internal/domain"
+	"github.com/reserveone/saa-risk-analyzer/internal/scheduler"
+)
+
+func TestParseCron(t *testing.T) {
+	valid := []string{
+		"* * * * *",
+		"*/15 9-17 * * MON-FRI",
+		"0 0 1,15 * *",
+		"30 6 * JAN-MAR,DEC 7",
+		"5/10 * ? * *",
+		"@daily",
+		"@Hourly",
+	}
+	for _, expr := range valid {
+		if _, err := scheduler.ParseCron(expr); err != nil {
+			t.Errorf("%q: unexpected error %v", expr, err)
+		}
+	}
+
+	invalid := []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"10-5 * * * *",
+		"* * * FOO *",
+		"@reboot",
+	}
+	for _, expr := range invalid {
+		if _, err := scheduler.ParseCron(expr); err == nil {
+			t.Errorf("%q: expected an error", expr)
+		}
+	}
+}
+
+func mustCron(t *testing.T, expr string) *scheduler.Cron {
+	t.Helper()
+	cron, err := scheduler.ParseCron(expr)
+	if err != nil {
+		t.Fatalf("%q: %v", expr, err)
+	}
+	return cron
+}
+
+func TestCronNext(t *testing.T) {
+	at := func(value string) time.Time {
+		v, err := time.Parse("2006-01-02 15:04", value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+
+	tests := []struct {
+		expr, from, want string
+	}{
+		{"*/15 * * * *", "2026-03-02 10:07", "2026-03-02 10:15"},
+		{"*/15 * * * *", "2026-03-02 10:15", "2026-03-02 10:30"},
+		{"0 18 * * MON-FRI", "2026-03-06 18:00", "2026-03-09 18:00"}, // Friday to Monday
+		{"0 0 1 * *", "2026-01-31 12:00", "2026-02-01 00:00"},
+		{"@yearly", "2026-06-01 00:00", "2027-01-01 00:00"},
+		{"0 12 29 2 *", "2026-03-01 00:00", "2028-02-29 12:00"},
+		{"0 0 * * 7", "2026-03-02 00:00", "2026-03-08 00:00"}, // 7 is Sunday
+		{"5/20 * * * *", "2026-03-02 10:30", "2026-03-02 10:45"},
+		// Both day fields restricted: the 13th or any Friday
+		{"0 0 13 * FRI", "2026-03-07 00:00", "2026-03-13 00:00"},
+		{"0 0 13 * FRI", "2026-03-13 00:00", "2026-03-20 00:00"},
+	}
+	for _, tt := range tests {
+		got := mustCron(t, tt.expr).Next(at(tt.from))
+		if !got.Equal(at(tt.want)) {
+			t.Errorf("%q after %s: expected %s, got %s", tt.expr, tt.from, tt.want, got.Format("2006-01-02 15:04"))
+		}
+	}
+
+	if next := mustCron(t, "0 0 30 2 *").Next(at("2026-01-01 00:00")); !next.IsZero() {
+		t.Errorf("Expected 30 February never to fire, got %s", next)
+	}
+}
+
+func TestCronNextInTimezone(t *testing.T) {
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cron := mustCron(t, "30 2 * * *")
+
+	// 02:30 does not exist on 8 March 2026, when clocks jump to 03:00
+	next := cron.Next(time.Date(2026, 3, 7, 3, 0, 0, 0, ny))
+	if want := time.Date(2026, 3, 9, 2, 30, 0, 0, ny); !next.Equal(want) {
+		t.Errorf("Expected the skipped fire time not to fire, got %s", next)
+	}
+
+	// Fire times follow the zone's wall clock across the change
+	daily := mustCron(t, "0 9 * * *")
+	before := daily.Next(time.Date(2026, 3, 6, 10, 0, 0, 0, ny))
+	after := daily.Next(before)
+	if before.UTC().Hour() != 14 || after.UTC().Hour() != 13 {
+		t.Errorf("Expected 09:00 New York at 14:00 then 13:00 UTC, got %s and %s", before.UTC(), after.UTC())
+	}
+}
+
+func TestPlanRuns(t *testing.T) {
+	hourly := mustCron(t, "0 * * * *")
+	due := time.Date(2026, 3, 2, 0, 0, 0, 0, time.UTC)
+	grace := 5 * time.Minute
+
+	// On time: the due fire time runs
+	plan := scheduler.PlanRuns(hourly, time.UTC, due, due.Add(time.Minute), scheduler.MissedRunOnce, grace)
+	if len(plan.Runs) != 1 || plan.Runs[0].Trigger != scheduler.TriggerSchedule || plan.Skipped != 0 {
+		t.Errorf("Expected one scheduled run, got %+v", plan)
+	}
+	if want := due.Add(time.Hour); !plan.Next.Equal(want) {
+		t.Errorf("Expected next run at %s, got %s", want, plan.Next)
+	}
+
+	// Down from 00:00 to 05:02: 00:00-04:00 were missed, 05:00 is on time
+	now := due.Add(5*time.Hour + 2*time.Minute)
+	plan = scheduler.PlanRuns(hourly, time.UTC, due, now, scheduler.MissedSkip, grace)
+	if len(plan.Runs) != 1 || plan.Skipped != 5 || !plan.FirstSkipped.Equal(due) {
+		t.Errorf("skip: expected the on-time run and 5 skipped, got %+v", plan)
+	}
+	plan = scheduler.PlanRuns(hourly, time.UTC, due, now, scheduler.MissedRunOnce, grace)
+	if len(plan.Runs) != 1 || plan.Runs[0].Trigger != scheduler.TriggerSchedule || plan.Skipped != 5 {
+		t.Errorf("run_once: expected no catch-up beside an on-time run, got %+v", plan)
+	}
+
+	// Down from 00:00 to 04:30: the latest missed fire time catches up once
+	now = due.Add(4*time.Hour + 30*time.Minute)
+	plan = scheduler.PlanRuns(hourly, time.UTC, due, now, scheduler.MissedRunOnce, grace)
+	if len(plan.Runs) != 1 || plan.Runs[0].Trigger != scheduler.TriggerCatchUp ||
+		!plan.Runs[0].At.Equal(due.Add(4*time.Hour)) || plan.Skipped != 4 {
+		t.Errorf("run_once: expected a catch-up of 04:00 and 4 skipped, got %+v", plan)
+	}
+
+	// A single missed fire time catching up leaves nothing skipped
+	now = due.Add(30 * time.Minute)
+	plan = scheduler.PlanRuns(hourly, time.UTC, due, now, scheduler.MissedRunOnce, grace)
+	if len(plan.Runs) != 1 || plan.Skipped != 0 || !plan.FirstSkipped.IsZero() {
+		t.Errorf("run_once: expected a catch-up and nothing skipped, got %+v", plan)
+	}
+}
+
+func TestScheduledCalculationInput(t *testing.T) {
+	portfolioID := uuid.New()
+	input, err := scheduler.Input(domain.ScheduledCalculation{
+		Type:   "var",
+		Params: map[string]interface{}{"confidence": 0.99, "method": "historical", "horizon_days": 1},
+	}, portfolioID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, ok := input.(*domain.VaRRequest)
+	if !ok || req.PortfolioID != portfolioID || req.Confidence != 0.99 || req.Method != "historical" {
+		t.Errorf("Expected a VaR request for the portfolio, got %+v", input)
+	}
+
+	invalid := []domain.ScheduledCalculation{
+		{Type: "correlation"},
+		{Type: "var", Params: map[string]interface{}{"confidnce": 0.99}},
+		{Type: "stress", Params: map[string]interface{}{"scenarios": "all"}},
+	}
+	for _, calc := range invalid {
+		if _, err := scheduler.Input(calc, portfolioID); !errors.Is(err, scheduler.ErrInvalidSchedule) {
+			t.Errorf("%+v: expected an invalid schedule error, got %v", calc, err)
+		}
+	}
+}
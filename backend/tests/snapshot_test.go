@@ -0,0 +1,122 @@
+package tests
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/reserveone/saa-risk-analyzer/internal/domain"
+	"github.com/reserveone/saa-risk-analyzer/internal/scheduler"
+	"github.com/reserveone/saa-risk-analyzer/internal/service"
+)
+
+func snapshot(asOf string, varValue float64, contributions ...domain.SnapshotContribution) *domain.RiskSnapshot {
+	date, _ := time.Parse("2006-01-02", asOf)
+	total := 0.0
+	for _, c := range contributions {
+		total += c.Component
+	}
+	return &domain.RiskSnapshot{
+		ID:              uuid.New(),
+		AsOf:            date,
+		Currency:        "USD",
+		VaR:             varValue,
+		ContributionVaR: total,
+		Contributions:   contributions,
+		Confidence:      0.99,
+		HorizonDays:     1,
+		WindowDays:      250,
+		Adjustment:      "total_return",
+	}
+}
+
+func contribution(symbol string, exposure, marginal float64) domain.SnapshotContribution {
+	return domain.SnapshotContribution{Symbol: symbol, Exposure: exposure, Marginal: marginal, Component: exposure * marginal}
+}
+
+func TestCompareSnapshots(t *testing.T) {
+	from := snapshot("2026-03-02", 5000,
+		contribution("SPY", 100000, 0.03),
+		contribution("TLT", 50000, 0.01),
+		contribution("GLD", 20000, 0.02),
+	)
+	to := snapshot("2026-03-09", 6200,
+		contribution("SPY", 120000, 0.035), // bought more and got riskier
+		contribution("TLT", 50000, 0.008),  // same holding, calmer
+		contribution("BTC", 10000, 0.06),   // new position
+	)
+
+	comparison := service.CompareSnapshots(from, to)
+	change := comparison.Change
+	if math.Abs(change.VaR-1200) > 1e-9 {
+		t.Errorf("Expected a VaR change of 1200, got %v", change.VaR)
+	}
+	wantContribution := to.ContributionVaR - from.ContributionVaR
+	if math.Abs(change.ContributionVaR-wantContribution) > 1e-9 ||
+		math.Abs(change.ModelDifference-(1200-wantContribution)) > 1e-9 {
+		t.Errorf("Unexpected change %+v", change)
+	}
+	if len(comparison.Warnings) != 0 {
+		t.Errorf("Expected no warnings, got %v", comparison.Warnings)
+	}
+
+	bySymbol := make(map[string]domain.AttributionChange)
+	total := 0.0
+	for _, a := range comparison.Attribution {
+		bySymbol[a.Symbol] = a
+		total += a.Change
+		if math.Abs(a.ExposureEffect+a.RiskEffect-a.Change) > 1e-9 {
+			t.Errorf("%s: effects %v + %v do not add up to %v", a.Symbol, a.ExposureEffect, a.RiskEffect, a.Change)
+		}
+	}
+	if len(bySymbol) != 4 {
+		t.Fatalf("Expected 4 positions in the attribution, got %+v", comparison.Attribution)
+	}
+	if math.Abs(total-wantContribution) > 1e-9 {
+		t.Errorf("Expected the attribution to add up to %v, got %v", wantContribution, total)
+	}
+
+	spy := bySymbol["SPY"]
+	if math.Abs(spy.ExposureEffect-20000*0.03) > 1e-9 || math.Abs(spy.RiskEffect-120000*0.005) > 1e-9 {
+		t.Errorf("SPY: unexpected effects %+v", spy)
+	}
+	if tlt := bySymbol["TLT"]; tlt.ExposureEffect != 0 || math.Abs(tlt.RiskEffect-(-100)) > 1e-9 {
+		t.Errorf("TLT: expected a risk effect only, got %+v", tlt)
+	}
+	if btc := bySymbol["BTC"]; btc.From != 0 || btc.ExposureEffect != 600 || btc.RiskEffect != 0 {
+		t.Errorf("BTC: expected a new position to be all exposure effect, got %+v", btc)
+	}
+	if gld := bySymbol["GLD"]; gld.To != 0 || gld.ExposureEffect != -400 {
+		t.Errorf("GLD: expected a closed position to be all exposure effect, got %+v", gld)
+	}
+	if comparison.Attribution[0].Symbol != "SPY" {
+		t.Errorf("Expected the largest change first, got %s", comparison.Attribution[0].Symbol)
+	}
+}
+
+func TestCompareSnapshotsWarnings(t *testing.T) {
+	from := snapshot("2026-03-02", 5000, contribution("SPY", 100000, 0.03))
+	to := snapshot("2026-03-09", 5000, contribution("SPY", 100000, 0.03))
+	to.Confidence = 0.95
+	to.Currency = "EUR"
+	if warnings := service.CompareSnapshots(from, to).Warnings; len(warnings) != 2 {
+		t.Errorf("Expected currency and parameter warnings, got %v", warnings)
+	}
+	if warnings := service.CompareSnapshots(from, from).Warnings; len(warnings) != 1 {
+		t.Errorf("Expected a warning comparing a snapshot with itself, got %v", warnings)
+	}
+}
+
+func TestScheduledSnapshotInput(t *testing.T) {
+	portfolioID := uuid.New()
+	input, err := scheduler.Input(domain.ScheduledCalculation{Type: "snapshot"}, portfolioID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, ok := input.(*domain.SnapshotRequest)
+	if !ok || req.PortfolioID != portfolioID || req.Source != service.SnapshotSourceSchedule {
+		t.Errorf("Expected a scheduled snapshot request, got %+v", input)
+	}
+}
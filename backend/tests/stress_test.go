@@ -0,0 +1,102 @@
+package tests
+
+import (
+	"math"
+	"testing"
+
+	"gonum.org/v1/gonum/mat"
+
+	riskmath "github.com/reserveone/saa-risk-analyzer/internal/math"
+)
+
+func TestRegimeAdjustedCovariance(t *testing.T) {
+	// vols 0.02 and 0.03, correlation 0.2
+	cov := mat.NewSymDense(2, []float64{
+		0.0004, 0.00012,
+		0.00012, 0.0009,
+	})
+
+	tight, err := riskmath.RegimeAdjustedCovariance(cov, riskmath.RegimeTight)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if rho := tight.At(0, 1) / (0.02 * 0.03); math.Abs(rho-0.6) > 1e-9 {
+		t.Errorf("Expected tight correlation 0.6, got %f", rho)
+	}
+	if tight.At(0, 0) != cov.At(0, 0) || tight.At(1, 1) != cov.At(1, 1) {
+		t.Errorf("Expected variances to be unchanged")
+	}
+
+	loose, err := riskmath.RegimeAdjustedCovariance(cov, riskmath.RegimeLoose)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if rho := loose.At(0, 1) / (0.02 * 0.03); math.Abs(rho-0.1) > 1e-9 {
+		t.Errorf("Expected loose correlation 0.1, got %f", rho)
+	}
+
+	if _, err := riskmath.RegimeAdjustedCovariance(cov, "sideways"); err == nil {
+		t.Errorf("Expected error for unknown regime")
+	}
+}
+
+func TestApplyStressedVaR(t *testing.T) {
+	positions := map[string]float64{"SPY": 60000, "BTC": 40000}
+	classes := map[string]string{"SPY": "Equity", "BTC": "Crypto"}
+	shocks := map[string]float64{"Equity": -0.2, "Crypto": -0.5}
+
+	result, err := riskmath.ApplyCustomStress(positions, classes, shocks)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	symbols := []string{"SPY", "BTC"}
+	baseCov := mat.NewSymDense(2, []float64{
+		0.0001, 0.0001,
+		0.0001, 0.0016,
+	})
+	stressedCov, _ := riskmath.RegimeAdjustedCovariance(baseCov, riskmath.RegimeTight)
+
+	if err := riskmath.ApplyStressedVaR(result, symbols, positions, baseCov, stressedCov, 0.99, 1); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if math.Abs(result.PostShockNAV-68000) > 1e-6 {
+		t.Errorf("Expected post-shock NAV 68000, got %f", result.PostShockNAV)
+	}
+	if result.BaseVaR <= 0 || result.StressedVaR <= 0 {
+		t.Errorf("Expected positive VaR, got base %f stressed %f", result.BaseVaR, result.StressedVaR)
+	}
+	if math.Abs(result.DeltaVaR-(result.StressedVaR-result.BaseVaR)) > 1e-9 {
+		t.Errorf("Expected DeltaVaR to be stressed minus base VaR")
+	}
+
+	t.Logf("Base VaR: %f, Stressed VaR: %f", result.BaseVaR, result.StressedVaR)
+}
+
+func TestStressedVaRFindsWorstWindow(t *testing.T) {
+	returns := make([]float64, 600)
+	for i := range returns {
+		if i%2 == 0 {
+			returns[i] = 0.005
+		} else {
+			returns[i] = -0.005
+		}
+	}
+	// Turbulent period in the middle of the history
+	for i := 300; i < 350; i++ {
+		returns[i] = -0.04
+	}
+
+	result, err := riskmath.CalculateStressedVaR(returns, 250, 0.99, 1)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if result.WindowEnd <= 300 || result.WindowStart >= 350 {
+		t.Errorf("Expected worst window to overlap the turbulent period, got [%d, %d)", result.WindowStart, result.WindowEnd)
+	}
+	if math.Abs(result.VaR-0.04) > 1e-9 {
+		t.Errorf("Expected stressed VaR 0.04, got %f", result.VaR)
+	}
+}
@@ -0,0 +1,114 @@
+package tests
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/reserveone/saa-risk-analyzer/internal/service"
+)
+
+// recordingProvider records the tickers it is asked for, with a default
+// mapping prefixing the symbol
+type recordingProvider struct {
+	classes []string
+	tickers []string
+}
+
+func (p *recordingProvider) Name() string { return "recording" }
+
+func (p *recordingProvider) Capabilities() service.ProviderCapabilities {
+	return service.ProviderCapabilities{AssetClasses: p.classes}
+}
+
+func (p *recordingProvider) Ticker(symbol string) string { return "default-" + symbol }
+
+func (p *recordingProvider) HistoricalPrices(ctx context.Context, ticker string, days int) ([]service.PricePoint, error) {
+	p.tickers = append(p.tickers, ticker)
+	return []service.PricePoint{{Date: time.Now(), Close: 1}}, nil
+}
+
+// staticSymbols is a symbol master held in memory
+type staticSymbols struct {
+	classes map[string]string
+	tickers map[string]string // by symbol, for the recording provider
+}
+
+func (s staticSymbols) Class(symbol string) (string, bool) {
+	class, ok := s.classes[symbol]
+	return class, ok
+}
+
+func (s staticSymbols) Ticker(provider, symbol string) (string, bool) {
+	if provider != "recording" {
+		return "", false
+	}
+	ticker, ok := s.tickers[symbol]
+	return ticker, ok
+}
+
+func TestSymbolMasterRouting(t *testing.T) {
+	provider := &recordingProvider{classes: []string{service.AssetClassCrypto}}
+	symbols := staticSymbols{
+		classes: map[string]string{"WBTC": service.AssetClassCrypto},
+		tickers: map[string]string{"WBTC": "wrapped-bitcoin"},
+	}
+	market := service.NewMarketDataServiceWithProviders(
+		[]service.PriceProvider{provider},
+		map[string][]string{service.DefaultProviderChain: {"recording"}},
+		service.ResiliencePolicy{},
+		symbols,
+	)
+	ctx := context.Background()
+
+	// The master classifies WBTC as crypto and supplies the provider's ticker
+	if _, err := market.GetHistoricalPrices(ctx, "WBTC", 1); err != nil {
+		t.Fatalf("Expected WBTC to route to the crypto provider, got %v", err)
+	}
+	// Symbols without a master ticker fall back to the provider's mapping
+	if _, err := market.GetHistoricalPrices(ctx, "BTC", 1); err != nil {
+		t.Fatalf("Expected BTC to route to the crypto provider, got %v", err)
+	}
+	if len(provider.tickers) != 2 || provider.tickers[0] != "wrapped-bitcoin" || provider.tickers[1] != "default-BTC" {
+		t.Errorf("Expected tickers [wrapped-bitcoin default-BTC], got %v", provider.tickers)
+	}
+
+	// Equities are not routed to a crypto-only provider
+	if _, err := market.GetHistoricalPrices(ctx, "SPY", 1); err == nil {
+		t.Errorf("Expected no provider for SPY")
+	}
+	if market.AssetClass("WBTC") != service.AssetClassCrypto {
+		t.Errorf("Expected the master's class for WBTC, got %s", market.AssetClass("WBTC"))
+	}
+}
+
+func TestSecurityIdentifiers(t *testing.T) {
+	for _, isin := range []string{"US78462F1030", "US0378331005", "GB0002634946"} {
+		if !service.ValidISIN(isin) {
+			t.Errorf("Expected %s to be a valid ISIN", isin)
+		}
+	}
+	for _, isin := range []string{"US78462F1031", "US78462F103", "1278462F1030"} {
+		if service.ValidISIN(isin) {
+			t.Errorf("Expected %s to be an invalid ISIN", isin)
+		}
+	}
+
+	for _, cusip := range []string{"78462F103", "037833100", "46428Q109"} {
+		if !service.ValidCUSIP(cusip) {
+			t.Errorf("Expected %s to be a valid CUSIP", cusip)
+		}
+	}
+	for _, cusip := range []string{"78462F104", "0378331"} {
+		if service.ValidCUSIP(cusip) {
+			t.Errorf("Expected %s to be an invalid CUSIP", cusip)
+		}
+	}
+
+	if asset := service.NewAsset("SPY"); asset.ISIN != "US78462F1030" || asset.Class != service.AssetClassEquity {
+		t.Errorf("Expected seeded SPY reference data, got %+v", asset)
+	}
+	if asset := service.NewAsset("CHFJPY"); asset.Class != service.AssetClassFX || asset.Currency != "JPY" {
+		t.Errorf("Expected CHFJPY classified as FX quoted in JPY, got %+v", asset)
+	}
+}
@@ -0,0 +1,126 @@
+package tests
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"github.com/reserveone/saa-risk-analyzer/internal/config"
+	"github.com/reserveone/saa-risk-analyzer/internal/domain"
+	"github.com/reserveone/saa-risk-analyzer/internal/service"
+)
+
+// closesProvider serves fixed closes by symbol, oldest first
+type closesProvider map[string][]service.PricePoint
+
+func (closesProvider) Name() string { return "closes" }
+
+func (closesProvider) Capabilities() service.ProviderCapabilities {
+	return service.ProviderCapabilities{}
+}
+
+func (p closesProvider) HistoricalPrices(ctx context.Context, symbol string, days int) ([]service.PricePoint, error) {
+	closes, ok := p[symbol]
+	if !ok {
+		return nil, fmt.Errorf("unknown symbol %s", symbol)
+	}
+	if len(closes) > days {
+		closes = closes[len(closes)-days:]
+	}
+	return closes, nil
+}
+
+// unreachableDB returns a handle whose queries fail, so prices are served by
+// the providers alone
+func unreachableDB(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(postgres.Open("host=127.0.0.1 port=1 user=test dbname=test sslmode=disable connect_timeout=1"), &gorm.Config{
+		DisableAutomaticPing: true,
+		Logger:               logger.Discard,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func daysAgo(days int) time.Time {
+	now := time.Now().UTC()
+	return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC).AddDate(0, 0, -days)
+}
+
+func priceServices(t *testing.T, provider closesProvider) (*service.LatestPriceService, *service.ValuationService) {
+	market := service.NewMarketDataServiceWithProviders(
+		[]service.PriceProvider{provider},
+		map[string][]string{service.DefaultProviderChain: {"closes"}},
+		service.ResiliencePolicy{},
+		nil,
+	)
+	db := unreachableDB(t)
+	quotes := service.NewLatestPriceService(db, market, config.MarketConfig{
+		PriceSources: []string{service.PriceSourceAPI},
+		StaleAfter:   72 * time.Hour,
+	})
+	return quotes, service.NewValuationService(db, quotes)
+}
+
+func TestValuePortfolio(t *testing.T) {
+	_, valuation := priceServices(t, closesProvider{
+		"SPY":    {{Date: daysAgo(5), Close: 450}, {Date: daysAgo(1), Close: 500}},
+		"EURUSD": {{Date: daysAgo(5), Close: 1.1}, {Date: daysAgo(1), Close: 1.25}},
+	})
+	position := func(symbol, currency string, quantity, avgPrice float64) domain.Position {
+		asset := domain.Asset{ID: uuid.New(), Symbol: symbol, Currency: currency}
+		return domain.Position{ID: uuid.New(), AssetID: asset.ID, Asset: asset, Quantity: quantity, AvgPrice: avgPrice}
+	}
+	portfolio := &domain.Portfolio{
+		ID:           uuid.New(),
+		BaseCurrency: "EUR",
+		Positions: []domain.Position{
+			position("SPY", "USD", 10, 400),
+			position("UNPRICED", "EUR", 5, 20),
+		},
+	}
+	ctx := context.Background()
+
+	// Now: the latest quote, converted at the latest EURUSD, inverted
+	now, err := valuation.ValuePortfolio(ctx, portfolio, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	spy, unpriced := now.Positions[0], now.Positions[1]
+	if spy.Price != 500 || math.Abs(spy.FXRate-0.8) > 1e-9 || math.Abs(spy.MarketValue-4000) > 1e-9 {
+		t.Errorf("Expected SPY at 500 USD worth 4000 EUR, got %+v", spy)
+	}
+	if math.Abs(spy.CostBasis-3200) > 1e-9 || math.Abs(spy.UnrealizedPnL-800) > 1e-9 {
+		t.Errorf("Expected a cost basis of 3200 EUR, got %+v", spy)
+	}
+	// A position without any price is valued at cost
+	if unpriced.PriceSource != service.PriceSourceCost || unpriced.MarketValue != 100 || unpriced.FXRate != 1 {
+		t.Errorf("Expected UNPRICED valued at its average price, got %+v", unpriced)
+	}
+	if math.Abs(now.NAV-4100) > 1e-9 || math.Abs(spy.Weight-4000.0/4100) > 1e-9 {
+		t.Errorf("Expected a NAV of 4100 EUR, got %v", now.NAV)
+	}
+
+	// As of an earlier date: the closes on or before it, not the latest quote
+	past, err := valuation.ValuePortfolio(ctx, portfolio, daysAgo(3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	spy = past.Positions[0]
+	if spy.Price != 450 || math.Abs(spy.FXRate-1/1.1) > 1e-9 || !spy.PriceDate.Equal(daysAgo(5)) {
+		t.Errorf("Expected SPY at the close of 5 days ago, got %+v", spy)
+	}
+
+	// Before the first rate there is nothing to convert at
+	if _, err := valuation.ValuePortfolio(ctx, portfolio, daysAgo(8)); err == nil {
+		t.Error("Expected valuing before any EURUSD close to fail")
+	}
+}
@@ -0,0 +1,62 @@
+package tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/reserveone/saa-risk-analyzer/internal/handlers"
+)
+
+func TestWebSocketOriginCheck(t *testing.T) {
+	upgrader := websocket.Upgrader{CheckOrigin: handlers.OriginChecker("https://app.example.com, https://admin.example.com/")}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.WriteJSON(map[string]string{"status": "running"})
+	}))
+	defer server.Close()
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http")
+
+	for _, test := range []struct {
+		origin string
+		status int
+	}{
+		{"", http.StatusSwitchingProtocols},
+		{"https://app.example.com", http.StatusSwitchingProtocols},
+		{"https://ADMIN.example.com", http.StatusSwitchingProtocols},
+		{server.URL, http.StatusSwitchingProtocols},
+		{"https://evil.example.com", http.StatusForbidden},
+		{"null", http.StatusForbidden},
+	} {
+		header := http.Header{}
+		if test.origin != "" {
+			header.Set("Origin", test.origin)
+		}
+		conn, resp, err := websocket.DefaultDialer.Dial(wsURL, header)
+		if resp == nil {
+			t.Fatalf("Origin %q: expected a response, got %v", test.origin, err)
+		}
+		if resp.StatusCode != test.status {
+			t.Errorf("Origin %q: expected %d, got %d", test.origin, test.status, resp.StatusCode)
+		}
+		if conn == nil {
+			continue
+		}
+		var event map[string]string
+		if err := conn.ReadJSON(&event); err != nil || event["status"] != "running" {
+			t.Errorf("Origin %q: expected the JSON message, got %v, %v", test.origin, event, err)
+		}
+		conn.Close()
+	}
+
+	if !handlers.OriginChecker("*")(&http.Request{Host: "api", Header: http.Header{"Origin": {"https://any.example.com"}}}) {
+		t.Errorf("Expected * to allow any origin")
+	}
+}
@@ -0,0 +1,83 @@
+package tests
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+
+	"github.com/reserveone/saa-risk-analyzer/internal/domain"
+	"github.com/reserveone/saa-risk-analyzer/internal/service"
+)
+
+func heldPosition(symbol string, quantity float64) domain.Position {
+	asset := domain.Asset{ID: uuid.New(), Symbol: symbol}
+	return domain.Position{ID: uuid.New(), AssetID: asset.ID, Asset: asset, Quantity: quantity, AvgPrice: 100}
+}
+
+func TestApplyTrades(t *testing.T) {
+	positions := []domain.Position{heldPosition("SPY", 100), heldPosition("TLT", 50)}
+	gld := domain.Asset{ID: uuid.New(), Symbol: "GLD", Class: "Commodities"}
+	trades := []domain.WhatIfTrade{
+		{Symbol: "spy", Quantity: -40},
+		{Symbol: "TLT", Quantity: -50},
+		{Symbol: "GLD", Quantity: 10, Price: 180},
+		{Symbol: "GLD", Quantity: 5},
+	}
+
+	result := service.ApplyTrades(positions, trades, map[string]domain.Asset{"GLD": gld})
+	if len(result) != 2 {
+		t.Fatalf("Expected SPY and GLD after the trades, got %+v", result)
+	}
+	if result[0].Asset.Symbol != "SPY" || result[0].Quantity != 60 || result[0].ID != positions[0].ID {
+		t.Errorf("Expected SPY reduced to 60, got %+v", result[0])
+	}
+	if result[1].AssetID != gld.ID || result[1].Quantity != 15 || result[1].AvgPrice != 180 {
+		t.Errorf("Expected a new GLD position of 15 at 180, got %+v", result[1])
+	}
+	if positions[0].Quantity != 100 || positions[1].Quantity != 50 {
+		t.Errorf("Expected the stored positions to be left as they are, got %+v", positions)
+	}
+}
+
+func TestCheckWhatIfLimits(t *testing.T) {
+	portfolio := service.LimitPortfolio{
+		NAV:          1000,
+		Weights:      map[string]float64{"SPY": 0.5, "TLT": 0.5},
+		ClassWeights: map[string]float64{"Equity": 0.5, "Bond": 0.5},
+	}
+	traded := service.LimitPortfolio{
+		NAV:          1000,
+		Weights:      map[string]float64{"SPY": 0.8, "TLT": 0.2},
+		ClassWeights: map[string]float64{"Equity": 0.8, "Bond": 0.2},
+	}
+	beforeVaR, afterVaR := 30.0, 45.0
+	before := service.WhatIfState{
+		Observation: service.RiskObservation{Confidence: 0.99, HorizonDays: 1, VaR: &beforeVaR},
+		Portfolio:   portfolio,
+	}
+	after := service.WhatIfState{
+		Observation: service.RiskObservation{Confidence: 0.99, HorizonDays: 1, VaR: &afterVaR},
+		Portfolio:   traded,
+	}
+	limits := []domain.RiskLimit{
+		{ID: uuid.New(), Name: "VaR", Type: service.LimitVaR, Max: 0.05, Warning: 0.8},
+		{ID: uuid.New(), Name: "Concentration", Type: service.LimitConcentration, Max: 0.6, Warning: 0.8},
+		{ID: uuid.New(), Name: "Stress", Type: service.LimitStressLoss, Max: 0.2, Warning: 0.8},
+	}
+
+	checks, breaches := service.CheckWhatIfLimits(limits, before, after)
+	if len(checks) != 2 {
+		t.Fatalf("Expected the stress loss limit to be left out, got %+v", checks)
+	}
+	if breaches != 1 {
+		t.Errorf("Expected one breach, got %d", breaches)
+	}
+	varCheck := checks[0]
+	if varCheck.Before.State != service.LimitOK || varCheck.After.State != service.LimitWarning || varCheck.NewBreach {
+		t.Errorf("Expected the VaR limit to go from ok to warning, got %+v %+v", varCheck.Before, varCheck.After)
+	}
+	concentration := checks[1]
+	if concentration.After.State != service.LimitBreach || !concentration.NewBreach || concentration.After.Detail != "SPY" {
+		t.Errorf("Expected a new concentration breach in SPY, got %+v", concentration)
+	}
+}